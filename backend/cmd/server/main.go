@@ -10,6 +10,7 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/veops/oneterm/internal/api"
+	"github.com/veops/oneterm/internal/dbproxy"
 	"github.com/veops/oneterm/internal/schedule"
 	"github.com/veops/oneterm/internal/sshsrv"
 	"github.com/veops/oneterm/pkg/logger"
@@ -39,6 +40,13 @@ func main() {
 			sshsrv.StopSsh()
 		})
 	}
+	{
+		rg.Add(func() error {
+			return dbproxy.RunDbProxy()
+		}, func(err error) {
+			dbproxy.StopDbProxy()
+		})
+	}
 	{
 		rg.Add(func() error {
 			return schedule.RunSchedule()
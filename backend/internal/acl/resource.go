@@ -299,6 +299,7 @@ func AddResource(ctx context.Context, uid int, resourceTypeId string, name strin
 		SetResult(&res).
 		Post(url)
 	err = remote.HandleErr(err, resp, func(dt map[string]any) bool { return true })
+	invalidateRoleResources(ctx, resourceTypeId, "*")
 	return
 }
 
@@ -316,6 +317,7 @@ func DeleteResource(ctx context.Context, uid int, resourceId int) (err error) {
 			"Accept-Language":  getAcceptLanguage(ctx)}).
 		Delete(url)
 	err = remote.HandleErr(err, resp, func(dt map[string]any) bool { return true })
+	invalidateRoleResources(ctx, "*", "*")
 	return
 }
 
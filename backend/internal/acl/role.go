@@ -3,24 +3,30 @@ package acl
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/samber/lo"
 	"github.com/spf13/cast"
 	"golang.org/x/sync/errgroup"
 
+	redis "github.com/veops/oneterm/pkg/cache"
 	"github.com/veops/oneterm/pkg/config"
 	"github.com/veops/oneterm/pkg/remote"
 )
 
 const (
-	kFmtResources = "resource-%s-%d"
+	kFmtResources        = "resource-%s-%d"
+	kFmtResourcesPattern = "resource-%s-%v"
+
+	// roleResourcesTTL is short as grants made directly in acl, rather than through oneterm, can not invalidate the cache
+	roleResourcesTTL = time.Second * 10
 )
 
 func GetRoleResources(ctx context.Context, rid int, resourceTypeId string) (res []*Resource, err error) {
-	// k := fmt.Sprintf(kFmtResources, resourceTypeId, rid)
-	// if err = redis.Get(ctx, k, &res); err == nil {
-	// 	return
-	// }
+	k := fmt.Sprintf(kFmtResources, resourceTypeId, rid)
+	if err = redis.Get(ctx, k, &res); err == nil {
+		return
+	}
 
 	token, err := remote.GetAclToken(ctx)
 	if err != nil {
@@ -44,7 +50,7 @@ func GetRoleResources(ctx context.Context, rid int, resourceTypeId string) (res
 
 	res = data.Resources
 
-	// redis.SetEx(ctx, k, res, time.Minute)
+	redis.SetEx(ctx, k, res, roleResourcesTTL)
 
 	return
 }
@@ -104,6 +110,7 @@ func GrantRoleResource(ctx context.Context, uid int, roleId int, resourceId int,
 		}).
 		Post(url)
 	err = remote.HandleErr(err, resp, func(dt map[string]any) bool { return true })
+	invalidateRoleResources(ctx, "*", roleId)
 	return
 }
 
@@ -123,6 +130,7 @@ func RevokeRoleResource(ctx context.Context, uid int, roleId int, resourceId int
 		}).
 		Post(url)
 	err = remote.HandleErr(err, resp, func(dt map[string]any) bool { return true })
+	invalidateRoleResources(ctx, "*", roleId)
 	return
 }
 
@@ -151,3 +159,8 @@ func BatchRevokeRoleResource(ctx context.Context, uid int, roleIds []int, resour
 
 	return
 }
+
+// invalidateRoleResources drops cached role resources, * matches any resource type or role
+func invalidateRoleResources(ctx context.Context, resourceTypeId string, rid any) {
+	redis.DeleteByPattern(ctx, fmt.Sprintf(kFmtResourcesPattern, resourceTypeId, rid))
+}
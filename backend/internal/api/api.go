@@ -10,6 +10,7 @@ import (
 
 	"github.com/veops/oneterm/internal/acl"
 	"github.com/veops/oneterm/internal/api/router"
+	"github.com/veops/oneterm/internal/audit"
 	"github.com/veops/oneterm/internal/model"
 	"github.com/veops/oneterm/internal/service"
 	fileservice "github.com/veops/oneterm/internal/service/file"
@@ -33,8 +34,10 @@ func initDB() {
 		model.DefaultCommand, model.DefaultCommandTemplate, model.DefaultConfig, model.DefaultFileHistory,
 		model.DefaultGateway, model.DefaultHistory, model.DefaultNode, model.DefaultPublicKey,
 		model.DefaultSession, model.DefaultSessionCmd, model.DefaultShare, model.DefaultQuickCommand,
-		model.DefaultUserPreference, model.DefaultStorageConfig, model.DefaultStorageMetrics,
-		model.DefaultTimeTemplate, model.DefaultMigrationRecord, model.DefaultSystemConfig,
+		model.DefaultSessionOutput, model.DefaultSessionOutputTerm, model.DefaultUserPreference,
+		model.DefaultStorageConfig, model.DefaultStorageMetrics, model.DefaultReplayIndex, model.DefaultReplaySignature,
+		model.DefaultTimeTemplate, model.DefaultMigrationRecord, model.DefaultSystemConfig, model.DefaultKnownHost,
+		model.DefaultAuditChain,
 	); err != nil {
 		logger.L().Fatal("Failed to init database", zap.Error(err))
 	}
@@ -43,6 +46,10 @@ func initDB() {
 		logger.L().Fatal("Failed to drop index", zap.Error(err))
 	}
 
+	if err := audit.RegisterCallbacks(db.DB); err != nil {
+		logger.L().Fatal("Failed to register audit callbacks", zap.Error(err))
+	}
+
 	gsession.InitSessionCleanup()
 }
 
@@ -90,6 +97,12 @@ func RunApi() error {
 		logger.L().Fatal("Failed to init storage", zap.Error(err))
 	}
 
+	// Finalize recordings of sessions which were closed by InitSessionCleanup
+	go func() {
+		gsession.RecoverSpooledReplays()
+		gsession.RecoverGuacdReplays()
+	}()
+
 	r := gin.New()
 
 	router.SetupRouter(r)
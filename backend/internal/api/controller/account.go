@@ -97,6 +97,7 @@ func (c *Controller) UpdateAccount(ctx *gin.Context) {
 //	@Param		name		query		string	false	"account name"
 //	@Param		info		query		bool	false	"is info mode"
 //	@Param		type		query		int		false	"account type"
+//	@Param		tags		query		string	false	"tag expression, e.g. env=prod"
 //	@Success	200			{object}	HttpResponse{data=ListData{list=[]model.Account}}
 //	@Router		/account [get]
 func (c *Controller) GetAccounts(ctx *gin.Context) {
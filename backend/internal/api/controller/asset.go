@@ -96,6 +96,7 @@ func (c *Controller) UpdateAsset(ctx *gin.Context) {
 //	@Param		parent_id	query		int		false	"asset's parent id"
 //	@Param		name		query		string	false	"asset name"
 //	@Param		ip			query		string	false	"asset ip"
+//	@Param		tags		query		string	false	"tag expression, e.g. env=prod,team in (db, infra)"
 //	@Param		info		query		bool	false	"is info mode"
 //	@Success	200			{object}	HttpResponse{data=ListData{list=[]model.Asset}}
 //	@Router		/asset [get]
@@ -302,6 +302,41 @@ func (c *Controller) CheckPermissionV2(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, HttpResponse{Data: result})
 }
 
+// GetAuthorizationV2CacheStats godoc
+//
+//	@Tags		authorization_v2
+//	@Success	200	{object}	HttpResponse{data=service.AuthCacheStats}
+//	@Router		/authorization_v2/cache [get]
+func (c *Controller) GetAuthorizationV2CacheStats(ctx *gin.Context) {
+	currentUser, _ := acl.GetSessionFromCtx(ctx)
+	if !acl.IsAdmin(currentUser) {
+		ctx.AbortWithError(http.StatusForbidden, &myErrors.ApiError{Code: myErrors.ErrNoPerm, Data: map[string]any{"perm": "admin"}})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, NewHttpResponseWithData(service.DefaultAuthCache.Stats()))
+}
+
+// FlushAuthorizationV2Cache godoc
+//
+//	@Tags		authorization_v2
+//	@Success	200	{object}	HttpResponse
+//	@Router		/authorization_v2/cache [delete]
+func (c *Controller) FlushAuthorizationV2Cache(ctx *gin.Context) {
+	currentUser, _ := acl.GetSessionFromCtx(ctx)
+	if !acl.IsAdmin(currentUser) {
+		ctx.AbortWithError(http.StatusForbidden, &myErrors.ApiError{Code: myErrors.ErrNoPerm, Data: map[string]any{"perm": "admin"}})
+		return
+	}
+
+	if err := service.DefaultAuthCache.Flush(ctx); err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, &myErrors.ApiError{Code: myErrors.ErrInternal, Data: map[string]any{"err": err}})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, defaultHttpResponse)
+}
+
 // CheckPermissionRequest represents a permission check request
 type CheckPermissionRequest struct {
 	NodeId    int              `json:"node_id" binding:"gte=0"`
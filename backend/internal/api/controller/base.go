@@ -149,6 +149,7 @@ func doCreate[T model.Model](ctx *gin.Context, needAcl bool, md T, resourceType
 
 func doDelete[T model.Model](ctx *gin.Context, needAcl bool, md T, resourceType string, dcs ...deleteCheck) (err error) {
 	defer repository.DeleteAllFromCacheDb(ctx, md)
+	defer service.DefaultAuthCache.InvalidateModel(ctx, md)
 
 	currentUser, _ := acl.GetSessionFromCtx(ctx)
 	baseService := service.NewBaseService()
@@ -237,6 +238,7 @@ func doDelete[T model.Model](ctx *gin.Context, needAcl bool, md T, resourceType
 
 func doUpdate[T model.Model](ctx *gin.Context, needAcl bool, md T, resourceType string, preHooks ...preHook[T]) (err error) {
 	defer repository.DeleteAllFromCacheDb(ctx, md)
+	defer service.DefaultAuthCache.InvalidateModel(ctx, md)
 
 	currentUser, _ := acl.GetSessionFromCtx(ctx)
 	baseService := service.NewBaseService()
@@ -0,0 +1,130 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/cast"
+
+	"github.com/veops/oneterm/internal/acl"
+	gsession "github.com/veops/oneterm/internal/session"
+	"github.com/veops/oneterm/pkg/errors"
+)
+
+// GetSessionParticipants godoc
+//
+//	@Tags		session
+//	@Param		session_id	path		string	true	"session id"
+//	@Success	200			{object}	HttpResponse{data=gsession.CollabState}
+//	@Router		/session/:session_id/participant [get]
+func (c *Controller) GetSessionParticipants(ctx *gin.Context) {
+	sess, ok := getCollabSession(ctx, false)
+	if !ok {
+		return
+	}
+
+	ctx.JSON(http.StatusOK, NewHttpResponseWithData(sess.Collab.State()))
+}
+
+// InviteSessionParticipant godoc
+//
+//	@Tags		session
+//	@Param		session_id	path		string	true	"session id"
+//	@Param		body		body		object	true	"uid and role of the user, viewer or driver"
+//	@Success	200			{object}	HttpResponse{data=gsession.Participant}
+//	@Router		/session/:session_id/participant [post]
+func (c *Controller) InviteSessionParticipant(ctx *gin.Context) {
+	currentUser, _ := acl.GetSessionFromCtx(ctx)
+	req := struct {
+		Uid  int    `json:"uid" binding:"required"`
+		Role string `json:"role" binding:"required"`
+	}{}
+	if err := ctx.ShouldBindBodyWithJSON(&req); err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, &errors.ApiError{Code: errors.ErrInvalidArgument, Data: map[string]any{"err": err}})
+		return
+	}
+
+	sess, ok := getCollabSession(ctx, false)
+	if !ok {
+		return
+	}
+
+	p, err := sess.Collab.Invite(req.Uid, req.Role, currentUser.GetUserName())
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, &errors.ApiError{Code: errors.ErrInvalidArgument, Data: map[string]any{"err": err}})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, NewHttpResponseWithData(p))
+}
+
+// RevokeSessionParticipant godoc
+//
+//	@Tags		session
+//	@Param		session_id	path		string	true	"session id"
+//	@Param		uid			path		int		true	"uid of the participant"
+//	@Success	200			{object}	HttpResponse
+//	@Router		/session/:session_id/participant/:uid [delete]
+func (c *Controller) RevokeSessionParticipant(ctx *gin.Context) {
+	sess, ok := getCollabSession(ctx, false)
+	if !ok {
+		return
+	}
+
+	if err := sess.Collab.Revoke(cast.ToInt(ctx.Param("uid"))); err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, &errors.ApiError{Code: errors.ErrInvalidArgument, Data: map[string]any{"err": err}})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, defaultHttpResponse)
+}
+
+// HandOverSessionControl godoc
+//
+//	@Tags		session
+//	@Param		session_id	path		string	true	"session id"
+//	@Param		body		body		object	true	"uid of the owner or a joined driver"
+//	@Success	200			{object}	HttpResponse{data=gsession.CollabState}
+//	@Router		/session/:session_id/control [post]
+func (c *Controller) HandOverSessionControl(ctx *gin.Context) {
+	req := struct {
+		Uid int `json:"uid" binding:"required"`
+	}{}
+	if err := ctx.ShouldBindBodyWithJSON(&req); err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, &errors.ApiError{Code: errors.ErrInvalidArgument, Data: map[string]any{"err": err}})
+		return
+	}
+
+	sess, ok := getCollabSession(ctx, true)
+	if !ok {
+		return
+	}
+
+	if err := sess.Collab.HandOver(req.Uid); err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, &errors.ApiError{Code: errors.ErrInvalidArgument, Data: map[string]any{"err": err}})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, NewHttpResponseWithData(sess.Collab.State()))
+}
+
+// getCollabSession gets the online terminal session which current user is allowed to manage,
+// i.e. the owner or an administrator, and the controller when it is a handover
+func getCollabSession(ctx *gin.Context, handover bool) (*gsession.Session, bool) {
+	currentUser, _ := acl.GetSessionFromCtx(ctx)
+
+	sessionId := ctx.Param("session_id")
+	sess := gsession.GetOnlineSessionById(sessionId)
+	if sess == nil || sess.IsGuacd() || sess.IsPortForward() {
+		ctx.AbortWithError(http.StatusBadRequest, &errors.ApiError{Code: errors.ErrInvalidSessionId, Data: map[string]any{"sessionId": sessionId}})
+		return nil, false
+	}
+
+	uid := currentUser.GetUid()
+	if sess.Uid != uid && !acl.IsAdmin(currentUser) && !(handover && sess.Collab.IsController(uid)) {
+		ctx.AbortWithError(http.StatusForbidden, &errors.ApiError{Code: errors.ErrNoPerm, Data: map[string]any{"perm": "manage participants"}})
+		return nil, false
+	}
+
+	return sess, true
+}
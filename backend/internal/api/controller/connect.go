@@ -27,6 +27,22 @@ func (c *Controller) ConnectMonitor(ctx *gin.Context) {
 	connector.ConnectMonitor(ctx)
 }
 
+// ConnectAttach handles WebSocket connections reattaching detached sessions
+// @Tags		connect
+// @Success	200	{object}	HttpResponse
+// @Router		/connect/attach/:session_id [get]
+func (c *Controller) ConnectAttach(ctx *gin.Context) {
+	connector.ConnectAttach(ctx)
+}
+
+// ConnectJoin handles WebSocket connections of users invited to sessions
+// @Tags		connect
+// @Success	200	{object}	HttpResponse
+// @Router		/connect/join/:session_id [get]
+func (c *Controller) ConnectJoin(ctx *gin.Context) {
+	connector.ConnectJoin(ctx)
+}
+
 // ConnectClose handles closing a session
 // @Tags		connect
 // @Success	200	{object}	HttpResponse
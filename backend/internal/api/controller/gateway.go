@@ -18,6 +18,13 @@ var (
 	gatewayService = service.NewGatewayService()
 
 	gatewayPreHooks = []preHook[*model.Gateway]{
+		// Check parent gateway
+		func(ctx *gin.Context, data *model.Gateway) {
+			if err := gatewayService.CheckCycle(ctx, data, cast.ToInt(ctx.Param("id"))); err != nil {
+				ctx.AbortWithError(http.StatusBadRequest, &errors.ApiError{Code: errors.ErrInvalidArgument, Data: map[string]any{"err": err}})
+				return
+			}
+		},
 		// Validate public key
 		func(ctx *gin.Context, data *model.Gateway) {
 			if err := gatewayService.ValidatePublicKey(data); err != nil {
@@ -38,6 +45,12 @@ var (
 				return
 			}
 		},
+		// Attach hops of gateway chain with health
+		func(ctx *gin.Context, data []*model.Gateway) {
+			if err := gatewayService.AttachHops(ctx, data); err != nil {
+				return
+			}
+		},
 		// Decrypt sensitive data
 		func(ctx *gin.Context, data []*model.Gateway) {
 			gatewayService.DecryptSensitiveData(data)
@@ -55,6 +68,16 @@ var (
 			err = lo.Ternary[error](err == nil, &errors.ApiError{Code: errors.ErrHasDepency, Data: map[string]any{"name": assetName}}, err)
 			ctx.AbortWithError(code, err)
 		},
+		// Check child gateways
+		func(ctx *gin.Context, id int) {
+			gatewayName, err := gatewayService.CheckChildDependencies(ctx, id)
+			if err == nil && gatewayName == "" {
+				return
+			}
+			code := lo.Ternary(err == nil, http.StatusBadRequest, http.StatusInternalServerError)
+			err = lo.Ternary[error](err == nil, &errors.ApiError{Code: errors.ErrGatewayHasChild, Data: map[string]any{"name": gatewayName}}, err)
+			ctx.AbortWithError(code, err)
+		},
 	}
 )
 
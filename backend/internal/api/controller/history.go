@@ -4,7 +4,9 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/spf13/cast"
 
+	"github.com/veops/oneterm/internal/acl"
 	"github.com/veops/oneterm/internal/model"
 	"github.com/veops/oneterm/internal/service"
 	"github.com/veops/oneterm/pkg/errors"
@@ -19,7 +21,7 @@ var (
 //	@Tags		history
 //	@Param		page_index	query		int		true	"page_index"
 //	@Param		page_size	query		int		true	"page_size"
-//	@Param		type		query		string	false	"type"	Enums(account, asset, command, gateway, node, public_key)
+//	@Param		type		query		string	false	"type"	Enums(account, asset, command, gateway, known_host, node, public_key)
 //	@Param		target_id	query		int		false	"target_id"
 //	@Param		uid			query		int		false	"uid"
 //	@Param		action_type	query		int		false	"create=1 delete=2 update=3"
@@ -52,3 +54,26 @@ func (c *Controller) GetHistoryTypeMapping(ctx *gin.Context) {
 
 	ctx.JSON(http.StatusOK, NewHttpResponseWithData(mapping))
 }
+
+// VerifyAuditChain godoc
+//
+//	@Tags		history
+//	@Param		from_id	query		int	false	"id of the first link to check"
+//	@Param		limit	query		int	false	"max links to check, all by default"
+//	@Success	200		{object}	HttpResponse{data=model.AuditReport}
+//	@Router		/history/verify [get]
+func (c *Controller) VerifyAuditChain(ctx *gin.Context) {
+	currentUser, _ := acl.GetSessionFromCtx(ctx)
+	if !acl.IsAdmin(currentUser) {
+		ctx.AbortWithError(http.StatusForbidden, &errors.ApiError{Code: errors.ErrNoPerm, Data: map[string]any{"perm": acl.READ}})
+		return
+	}
+
+	report, err := historyService.VerifyAuditChain(ctx, cast.ToInt(ctx.Query("from_id")), cast.ToInt(ctx.Query("limit")))
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, &errors.ApiError{Code: errors.ErrInternal, Data: map[string]any{"err": err}})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, NewHttpResponseWithData(report))
+}
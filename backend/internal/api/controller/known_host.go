@@ -0,0 +1,116 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/cast"
+	"gorm.io/gorm"
+
+	"github.com/veops/oneterm/internal/acl"
+	"github.com/veops/oneterm/internal/model"
+	"github.com/veops/oneterm/internal/service"
+	myErrors "github.com/veops/oneterm/pkg/errors"
+)
+
+var (
+	knownHostService = service.NewKnownHostService()
+)
+
+// GetKnownHosts godoc
+//
+//	@Tags		known_host
+//	@Param		page_index	query		int		true	"page_index"
+//	@Param		page_size	query		int		true	"page_size"
+//	@Param		target_type	query		string	false	"target type"	Enums(asset, gateway)
+//	@Param		target_id	query		int		false	"asset or gateway id"
+//	@Param		status		query		string	false	"status"	Enums(trusted, pending, changed)
+//	@Param		search		query		string	false	"address or fingerprint"
+//	@Success	200			{object}	HttpResponse{data=ListData{list=[]model.KnownHost}}
+//	@Router		/known_host [get]
+func (c *Controller) GetKnownHosts(ctx *gin.Context) {
+	currentUser, _ := acl.GetSessionFromCtx(ctx)
+	if !acl.IsAdmin(currentUser) {
+		ctx.AbortWithError(http.StatusForbidden, &myErrors.ApiError{Code: myErrors.ErrNoPerm, Data: map[string]any{"perm": "admin"}})
+		return
+	}
+
+	doGet[*model.KnownHost](ctx, false, knownHostService.BuildQuery(ctx), "")
+}
+
+// PinKnownHost godoc
+//
+//	@Tags		known_host
+//	@Param		known_host	body		service.PinKnownHostRequest	true	"host key to pin"
+//	@Success	200			{object}	HttpResponse{data=model.KnownHost}
+//	@Router		/known_host [post]
+func (c *Controller) PinKnownHost(ctx *gin.Context) {
+	currentUser, _ := acl.GetSessionFromCtx(ctx)
+	if !acl.IsAdmin(currentUser) {
+		ctx.AbortWithError(http.StatusForbidden, &myErrors.ApiError{Code: myErrors.ErrNoPerm, Data: map[string]any{"perm": "admin"}})
+		return
+	}
+
+	req := &service.PinKnownHostRequest{}
+	if err := ctx.ShouldBindBodyWithJSON(req); err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, &myErrors.ApiError{Code: myErrors.ErrInvalidArgument, Data: map[string]any{"err": err}})
+		return
+	}
+
+	kh, err := knownHostService.Pin(ctx, req, currentUser.GetUid())
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, &myErrors.ApiError{Code: myErrors.ErrInvalidArgument, Data: map[string]any{"err": err}})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, NewHttpResponseWithData(kh))
+}
+
+// AcceptKnownHost godoc
+//
+//	@Tags		known_host
+//	@Param		id	path		int	true	"known host id"
+//	@Success	200	{object}	HttpResponse{data=model.KnownHost}
+//	@Router		/known_host/:id/accept [post]
+func (c *Controller) AcceptKnownHost(ctx *gin.Context) {
+	currentUser, _ := acl.GetSessionFromCtx(ctx)
+	if !acl.IsAdmin(currentUser) {
+		ctx.AbortWithError(http.StatusForbidden, &myErrors.ApiError{Code: myErrors.ErrNoPerm, Data: map[string]any{"perm": "admin"}})
+		return
+	}
+
+	kh, err := knownHostService.Accept(ctx, cast.ToInt(ctx.Param("id")), currentUser.GetUid())
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, &myErrors.ApiError{Code: myErrors.ErrInvalidArgument, Data: map[string]any{"err": err}})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, NewHttpResponseWithData(kh))
+}
+
+// ResetKnownHost godoc
+//
+//	@Tags		known_host
+//	@Param		id	path		int	true	"known host id"
+//	@Success	200	{object}	HttpResponse
+//	@Router		/known_host/:id [delete]
+func (c *Controller) ResetKnownHost(ctx *gin.Context) {
+	currentUser, _ := acl.GetSessionFromCtx(ctx)
+	if !acl.IsAdmin(currentUser) {
+		ctx.AbortWithError(http.StatusForbidden, &myErrors.ApiError{Code: myErrors.ErrNoPerm, Data: map[string]any{"perm": "admin"}})
+		return
+	}
+
+	id := cast.ToInt(ctx.Param("id"))
+	if err := knownHostService.Reset(ctx, id, currentUser.GetUid()); err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		ctx.AbortWithError(http.StatusInternalServerError, &myErrors.ApiError{Code: myErrors.ErrInternal, Data: map[string]any{"err": err}})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, HttpResponse{
+		Data: map[string]any{
+			"id": id,
+		},
+	})
+}
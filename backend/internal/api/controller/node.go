@@ -78,6 +78,7 @@ func (c *Controller) UpdateNode(ctx *gin.Context) {
 //	@Param		no_self_child	query		int		false	"exclude itself and its child"
 //	@Param		self_parent		query		int		false	"include itself and its parent"
 //	@Param		recursive		query		bool	false	"return tree structure with children"
+//	@Param		tags			query		string	false	"tag expression, e.g. env=prod,team in (db, infra)"
 //	@Success	200				{object}	HttpResponse{data=ListData{list=[]model.Node}}
 //	@Router		/node [get]
 func (c *Controller) GetNodes(ctx *gin.Context) {
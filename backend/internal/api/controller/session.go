@@ -4,10 +4,15 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/spf13/cast"
 	"go.uber.org/zap"
 
+	"github.com/veops/oneterm/internal/acl"
 	"github.com/veops/oneterm/internal/model"
 	"github.com/veops/oneterm/internal/service"
 	"github.com/veops/oneterm/pkg/errors"
@@ -52,16 +57,23 @@ func (c *Controller) CreateSessionCmd(ctx *gin.Context) {
 // GetSessions godoc
 //
 //	@Tags		session
-//	@Param		page_index	query		int		true	"page_index"
-//	@Param		page_size	query		int		true	"page_size"
-//	@Param		search		query		string	false	"search"
-//	@Param		status		query		int		false	"status, online=1, offline=2"
-//	@Param		start		query		string	false	"start, RFC3339"
-//	@Param		end			query		string	false	"end, RFC3339"
-//	@Param		uid			query		int		false	"uid"
-//	@Param		asset_id	query		int		false	"asset id"
-//	@Param		client_ip	query		string	false	"client_ip"
-//	@Success	200			{object}	HttpResponse{data=ListData{list=[]model.Session}}
+//	@Param		page_index		query		int		true	"page_index"
+//	@Param		page_size		query		int		true	"page_size"
+//	@Param		search			query		string	false	"search"
+//	@Param		status			query		int		false	"status, online=1, offline=2, detached=3"
+//	@Param		start			query		string	false	"start, RFC3339"
+//	@Param		end				query		string	false	"end, RFC3339"
+//	@Param		uid				query		int		false	"uid"
+//	@Param		asset_id		query		int		false	"asset id"
+//	@Param		client_ip		query		string	false	"client_ip"
+//	@Param		close_reason	query		string	false	"close reason" Enums(idle_timeout, session_timeout, admin_close, access_time, client_disconnect, remote_exit)
+//	@Param		exit_code		query		int		false	"exit status of the remote shell"
+//	@Param		min_bytes_in	query		int		false	"min bytes sent to the asset"
+//	@Param		min_bytes_out	query		int		false	"min bytes received from the asset"
+//	@Param		min_peak_width	query		int		false	"min peak window width"
+//	@Param		min_peak_height	query		int		false	"min peak window height"
+//	@Param		min_forbidden	query		int		false	"min hits of forbidden commands"
+//	@Success	200				{object}	HttpResponse{data=ListData{list=[]model.Session}}
 //	@Router		/session [get]
 func (c *Controller) GetSessions(ctx *gin.Context) {
 	db, err := sessionService.BuildQuery(ctx)
@@ -87,6 +99,60 @@ func (c *Controller) GetSessionCmds(ctx *gin.Context) {
 	doGet[*model.SessionCmd](ctx, false, db, "")
 }
 
+// SearchSessionCmds godoc
+//
+//	@Tags		session
+//	@Param		page_index	query		int		true	"page_index"
+//	@Param		page_size	query		int		true	"page_size"
+//	@Param		search		query		string	false	"text of the command"
+//	@Param		regex		query		string	false	"regular expression of the command"
+//	@Param		result		query		string	false	"text of the result"
+//	@Param		level		query		int		false	"risk level"
+//	@Param		action		query		string	false	"action of the command policy"
+//	@Param		uid			query		int		false	"uid"
+//	@Param		user_name	query		string	false	"user name"
+//	@Param		asset_id	query		int		false	"asset id"
+//	@Param		protocol	query		string	false	"protocol"
+//	@Param		start		query		string	false	"start, RFC3339"
+//	@Param		end			query		string	false	"end, RFC3339"
+//	@Success	200			{object}	HttpResponse{data=ListData{list=[]model.SessionSearchHit}}
+//	@Router		/session/search/cmd [get]
+func (c *Controller) SearchSessionCmds(ctx *gin.Context) {
+	db, err := sessionService.BuildCmdSearchQuery(ctx)
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, &errors.ApiError{Code: errors.ErrInvalidArgument, Data: map[string]any{"err": err}})
+		return
+	}
+
+	doGet(ctx, false, db, "", func(ctx *gin.Context, data []*model.SessionSearchHit) {
+		sessionService.AttachReplayOffsets(data)
+	})
+}
+
+// SearchSessionOutput godoc
+//
+//	@Tags		session
+//	@Param		page_index	query		int		true	"page_index"
+//	@Param		page_size	query		int		true	"page_size"
+//	@Param		search		query		string	true	"text of the output"
+//	@Param		uid			query		int		false	"uid"
+//	@Param		user_name	query		string	false	"user name"
+//	@Param		asset_id	query		int		false	"asset id"
+//	@Param		protocol	query		string	false	"protocol"
+//	@Param		start		query		string	false	"start of the session, RFC3339"
+//	@Param		end			query		string	false	"end of the session, RFC3339"
+//	@Success	200			{object}	HttpResponse{data=ListData{list=[]model.SessionSearchHit}}
+//	@Router		/session/search/output [get]
+func (c *Controller) SearchSessionOutput(ctx *gin.Context) {
+	db, err := sessionService.BuildOutputSearchQuery(ctx)
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, &errors.ApiError{Code: errors.ErrInvalidArgument, Data: map[string]any{"err": err}})
+		return
+	}
+
+	doGet[*model.SessionSearchHit](ctx, false, db, "")
+}
+
 // GetSessionOptionAsset godoc
 //
 //	@Tags		session
@@ -143,11 +209,37 @@ func (c *Controller) CreateSessionReplay(ctx *gin.Context) {
 //
 //	@Tags		session
 //	@Param		session_id	path		string	true	"session id"
+//	@Param		start		query		number	false	"start of the time range in seconds, asciicast only"
+//	@Param		end			query		number	false	"end of the time range in seconds, asciicast only"
+//	@Param		Range		header		string	false	"byte range, e.g. bytes=0-1023"
 //	@Success	200			{object}	string
 //	@Router		/session/replay/:session_id [get]
 func (c *Controller) GetSessionReplay(ctx *gin.Context) {
 	sessionId := ctx.Param("session_id")
 
+	// Stream the file content
+	filename := fmt.Sprintf("%s.cast", sessionId)
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+	ctx.Header("Content-Type", "application/octet-stream")
+	ctx.Header("Accept-Ranges", "bytes")
+
+	// A time range is cut from the recording with the seek index
+	if ctx.Query("start") != "" || ctx.Query("end") != "" {
+		start, end := cast.ToFloat64(ctx.Query("start")), cast.ToFloat64(ctx.Query("end"))
+		if start < 0 || (end > 0 && end < start) {
+			ctx.AbortWithError(http.StatusBadRequest, &errors.ApiError{Code: errors.ErrInvalidArgument, Data: map[string]any{"err": "invalid time range"}})
+			return
+		}
+		if err := sessionService.SliceSessionReplay(ctx, sessionId, start, end, ctx.Writer); err != nil {
+			if !ctx.Writer.Written() {
+				ctx.AbortWithError(http.StatusBadRequest, &errors.ApiError{Code: errors.ErrInvalidArgument, Data: map[string]any{"err": err}})
+				return
+			}
+			logger.L().Error("Failed to stream replay slice", zap.String("session_id", sessionId), zap.Error(err))
+		}
+		return
+	}
+
 	// Try to get replay from storage service or local file system
 	replayReader, err := sessionService.GetSessionReplay(ctx, sessionId)
 	if err != nil {
@@ -156,10 +248,10 @@ func (c *Controller) GetSessionReplay(ctx *gin.Context) {
 	}
 	defer replayReader.Close()
 
-	// Stream the file content
-	filename := fmt.Sprintf("%s.cast", sessionId)
-	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
-	ctx.Header("Content-Type", "application/octet-stream")
+	if ctx.GetHeader("Range") != "" {
+		serveReplayRange(ctx, sessionId, replayReader)
+		return
+	}
 
 	_, err = io.Copy(ctx.Writer, replayReader)
 	if err != nil {
@@ -167,3 +259,184 @@ func (c *Controller) GetSessionReplay(ctx *gin.Context) {
 		return
 	}
 }
+
+// serveReplayRange serves a byte range of the recording.
+// Local files are served by http.ServeContent, other readers are skipped to the start with the size from the seek index.
+// The index of an online session would be built again on every request, so ranges of those are refused.
+func serveReplayRange(ctx *gin.Context, sessionId string, reader io.Reader) {
+	if rs, ok := reader.(io.ReadSeeker); ok {
+		http.ServeContent(ctx.Writer, ctx.Request, "", time.Time{}, rs)
+		return
+	}
+	if _, err := sessionService.GetOnlineSessionByID(ctx, sessionId); err == nil {
+		ctx.AbortWithError(http.StatusBadRequest, &errors.ApiError{Code: errors.ErrInvalidArgument, Data: map[string]any{"err": "byte ranges are not supported while the session is online"}})
+		return
+	}
+
+	index, err := sessionService.GetSessionReplayIndex(ctx, sessionId)
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, &errors.ApiError{Code: errors.ErrInternal, Data: map[string]any{"err": err}})
+		return
+	}
+	start, end, ok := parseByteRange(ctx.GetHeader("Range"), index.Size)
+	if !ok {
+		ctx.Header("Content-Range", fmt.Sprintf("bytes */%d", index.Size))
+		ctx.AbortWithStatus(http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+
+	if _, err = io.CopyN(io.Discard, reader, start); err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, &errors.ApiError{Code: errors.ErrInternal, Data: map[string]any{"err": err}})
+		return
+	}
+	ctx.Header("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, index.Size))
+	ctx.Header("Content-Length", cast.ToString(end-start+1))
+	ctx.Status(http.StatusPartialContent)
+	if _, err = io.CopyN(ctx.Writer, reader, end-start+1); err != nil {
+		logger.L().Error("Failed to stream replay range", zap.String("session_id", sessionId), zap.Error(err))
+	}
+}
+
+// parseByteRange parses a single range like bytes=0-1023, bytes=1024- or bytes=-1024
+func parseByteRange(header string, size int64) (start, end int64, ok bool) {
+	spec, found := strings.CutPrefix(header, "bytes=")
+	if !found || strings.Contains(spec, ",") {
+		return 0, 0, false
+	}
+	s, e, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found {
+		return 0, 0, false
+	}
+
+	switch {
+	case s == "":
+		n, err := strconv.ParseInt(e, 10, 64)
+		if err != nil || n <= 0 {
+			return 0, 0, false
+		}
+		start, end = max(size-n, 0), size-1
+	default:
+		var err error
+		if start, err = strconv.ParseInt(s, 10, 64); err != nil {
+			return 0, 0, false
+		}
+		end = size - 1
+		if e != "" {
+			if end, err = strconv.ParseInt(e, 10, 64); err != nil {
+				return 0, 0, false
+			}
+			end = min(end, size-1)
+		}
+	}
+
+	return start, end, start >= 0 && start <= end
+}
+
+// GetSessionReplayIndex godoc
+//
+//	@Tags		session
+//	@Param		session_id	path		string	true	"session id"
+//	@Success	200			{object}	HttpResponse{data=model.ReplayIndex}
+//	@Router		/session/replay/:session_id/index [get]
+func (c *Controller) GetSessionReplayIndex(ctx *gin.Context) {
+	index, err := sessionService.GetSessionReplayIndex(ctx, ctx.Param("session_id"))
+	if err != nil {
+		ctx.AbortWithError(http.StatusNotFound, &errors.ApiError{Code: errors.ErrInternal, Data: map[string]any{"err": err}})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, NewHttpResponseWithData(index))
+}
+
+// VerifySessionReplay godoc
+//
+//	@Tags		session
+//	@Param		session_id	path		string	true	"session id"
+//	@Success	200			{object}	HttpResponse{data=model.ReplayVerification}
+//	@Router		/session/replay/:session_id/verify [get]
+func (c *Controller) VerifySessionReplay(ctx *gin.Context) {
+	currentUser, _ := acl.GetSessionFromCtx(ctx)
+	if !acl.IsAdmin(currentUser) {
+		ctx.AbortWithError(http.StatusForbidden, &errors.ApiError{Code: errors.ErrNoPerm, Data: map[string]any{"perm": acl.READ}})
+		return
+	}
+
+	res, err := sessionService.VerifySessionReplay(ctx, ctx.Param("session_id"))
+	if err != nil {
+		ctx.AbortWithError(http.StatusNotFound, &errors.ApiError{Code: errors.ErrInternal, Data: map[string]any{"err": err}})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, NewHttpResponseWithData(res))
+}
+
+// CreateSessionReplayExport godoc
+//
+//	@Tags		session
+//	@Param		session_id	path		string	true	"session id"
+//	@Param		body		body		object	true	"format of the export, text, gif or mp4"
+//	@Success	200			{object}	HttpResponse{data=service.ReplayExportProgress}
+//	@Router		/session/replay/:session_id/export [post]
+func (c *Controller) CreateSessionReplayExport(ctx *gin.Context) {
+	req := struct {
+		Format string `json:"format" binding:"required"`
+	}{}
+	if err := ctx.ShouldBindBodyWithJSON(&req); err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, &errors.ApiError{Code: errors.ErrInvalidArgument, Data: map[string]any{"err": err}})
+		return
+	}
+
+	progress, err := sessionService.CreateReplayExport(ctx, ctx.Param("session_id"), req.Format)
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, &errors.ApiError{Code: errors.ErrInvalidArgument, Data: map[string]any{"err": err}})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, NewHttpResponseWithData(progress))
+}
+
+// GetSessionReplayExport godoc
+//
+//	@Tags		session
+//	@Param		session_id	path		string	true	"session id"
+//	@Param		export_id	path		string	true	"export id"
+//	@Success	200			{object}	HttpResponse{data=service.ReplayExportProgress}
+//	@Router		/session/replay/:session_id/export/:export_id [get]
+func (c *Controller) GetSessionReplayExport(ctx *gin.Context) {
+	progress, err := sessionService.GetReplayExport(ctx, ctx.Param("export_id"))
+	if err != nil || progress.SessionID != ctx.Param("session_id") {
+		ctx.AbortWithError(http.StatusNotFound, &errors.ApiError{Code: errors.ErrInvalidArgument, Data: map[string]any{"err": fmt.Errorf("export %s not found", ctx.Param("export_id"))}})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, NewHttpResponseWithData(progress))
+}
+
+// DownloadSessionReplayExport godoc
+//
+//	@Tags		session
+//	@Param		session_id	path		string	true	"session id"
+//	@Param		format		query		string	true	"export format, text, gif or mp4"
+//	@Success	200			{object}	string
+//	@Router		/session/replay/:session_id/export [get]
+func (c *Controller) DownloadSessionReplayExport(ctx *gin.Context) {
+	sessionId, format := ctx.Param("session_id"), ctx.Query("format")
+	ext, ok := service.ReplayExportExt(format)
+	if !ok {
+		ctx.AbortWithError(http.StatusBadRequest, &errors.ApiError{Code: errors.ErrInvalidArgument, Data: map[string]any{"err": fmt.Errorf("unsupported export format %s", format)}})
+		return
+	}
+
+	reader, err := sessionService.GetReplayExportFile(ctx, sessionId, format)
+	if err != nil {
+		ctx.AbortWithError(http.StatusNotFound, &errors.ApiError{Code: errors.ErrInternal, Data: map[string]any{"err": err}})
+		return
+	}
+	defer reader.Close()
+
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s%s", sessionId, ext))
+	ctx.Header("Content-Type", "application/octet-stream")
+	if _, err = io.Copy(ctx.Writer, reader); err != nil {
+		logger.L().Error("Failed to stream replay export", zap.String("session_id", sessionId), zap.Error(err))
+	}
+}
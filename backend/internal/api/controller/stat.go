@@ -78,6 +78,24 @@ func (c *Controller) StatAsset(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, NewHttpResponseWithData(toListData(stat)))
 }
 
+// StatSession godoc
+//
+//	@Tags		stat
+//	@Param		type	query		string	true	"time range" Enums(day, week, month)
+//	@Success	200		{object}	HttpResponse{data=model.StatSession}
+//	@Router		/stat/session [get]
+func (c *Controller) StatSession(ctx *gin.Context) {
+	timeRange := ctx.Query("type")
+
+	stat, err := statService.GetStatSession(ctx, timeRange)
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, NewHttpResponseWithData(stat))
+}
+
 // StatCountOfUser godoc
 //
 //	@Tags		stat
@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
@@ -11,6 +12,7 @@ import (
 	"github.com/veops/oneterm/internal/model"
 	"github.com/veops/oneterm/internal/service"
 	"github.com/veops/oneterm/internal/service/web_proxy"
+	myErrors "github.com/veops/oneterm/pkg/errors"
 	"github.com/veops/oneterm/pkg/logger"
 )
 
@@ -105,6 +107,23 @@ func (c *WebProxyController) StartWebSession(ctx *gin.Context) {
 
 	resp, err := web_proxy.StartWebSession(ctx, req)
 	if err != nil {
+		var ae *myErrors.ApiError
+		if errors.As(err, &ae) {
+			// Only the session limit is a rate limit, other api errors keep the status of their code
+			status := http.StatusInternalServerError
+			switch {
+			case ae.Code == myErrors.ErrMaxSessions:
+				status = http.StatusTooManyRequests
+			case ae.Code == myErrors.ErrNoPerm:
+				status = http.StatusForbidden
+			case ae.Code == myErrors.ErrUnauthorized:
+				status = http.StatusUnauthorized
+			case ae.Code < myErrors.ErrInternal:
+				status = http.StatusBadRequest
+			}
+			ctx.AbortWithError(status, ae)
+			return
+		}
 		// Return appropriate HTTP status code and JSON error for API
 		if strings.Contains(err.Error(), "not found") {
 			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
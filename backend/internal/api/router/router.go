@@ -96,6 +96,14 @@ func SetupRouter(r *gin.Engine) {
 			gateway.GET("", c.GetGateways)
 		}
 
+		knownHost := v1.Group("known_host")
+		{
+			knownHost.GET("", c.GetKnownHosts)
+			knownHost.POST("", c.PinKnownHost)
+			knownHost.POST("/:id/accept", c.AcceptKnownHost)
+			knownHost.DELETE("/:id", c.ResetKnownHost)
+		}
+
 		stat := v1.Group("stat")
 		{
 			stat.GET("assettype", c.StatAssetType)
@@ -103,6 +111,7 @@ func SetupRouter(r *gin.Engine) {
 			stat.GET("count/ofuser", c.StatCountOfUser)
 			stat.GET("account", c.StatAccount)
 			stat.GET("asset", c.StatAsset)
+			stat.GET("session", c.StatSession)
 			stat.GET("rank/ofuser", c.StatRankOfUser)
 		}
 
@@ -118,15 +127,28 @@ func SetupRouter(r *gin.Engine) {
 		{
 			session.GET("", c.GetSessions)
 			session.GET("/:session_id/cmd", c.GetSessionCmds)
+			session.GET("/:session_id/participant", c.GetSessionParticipants)
+			session.POST("/:session_id/participant", c.InviteSessionParticipant)
+			session.DELETE("/:session_id/participant/:uid", c.RevokeSessionParticipant)
+			session.POST("/:session_id/control", c.HandOverSessionControl)
+			session.GET("/search/cmd", c.SearchSessionCmds)
+			session.GET("/search/output", c.SearchSessionOutput)
 			session.GET("/option/asset", c.GetSessionOptionAsset)
 			session.GET("/option/clientip", c.GetSessionOptionClientIp)
 			session.GET("/replay/:session_id", c.GetSessionReplay)
+			session.GET("/replay/:session_id/index", c.GetSessionReplayIndex)
+			session.GET("/replay/:session_id/verify", c.VerifySessionReplay)
+			session.POST("/replay/:session_id/export", c.CreateSessionReplayExport)
+			session.GET("/replay/:session_id/export", c.DownloadSessionReplayExport)
+			session.GET("/replay/:session_id/export/:export_id", c.GetSessionReplayExport)
 		}
 
 		connect := v1.Group("connect")
 		{
 			connect.GET("/:asset_id/:account_id/:protocol", c.Connect)
 			connect.GET("/monitor/:session_id", c.ConnectMonitor)
+			connect.GET("/attach/:session_id", c.ConnectAttach)
+			connect.GET("/join/:session_id", c.ConnectJoin)
 			connect.POST("/close/:session_id", c.ConnectClose)
 			// WebSSH route - direct access to SSH server interface
 			connect.GET("/webssh", sshsrv.HandleWebSSH)
@@ -167,6 +189,7 @@ func SetupRouter(r *gin.Engine) {
 		{
 			history.GET("", c.GetHistories)
 			history.GET("/type/mapping", c.GetHistoryTypeMapping)
+			history.GET("/verify", c.VerifyAuditChain)
 		}
 
 		share := v1.Group("/share")
@@ -194,6 +217,8 @@ func SetupRouter(r *gin.Engine) {
 			authorizationV2.DELETE("/:id", c.DeleteAuthorizationV2)
 			authorizationV2.POST("/:id/clone", c.CloneAuthorizationV2)
 			authorizationV2.POST("/check", c.CheckPermissionV2)
+			authorizationV2.GET("/cache", c.GetAuthorizationV2CacheStats)
+			authorizationV2.DELETE("/cache", c.FlushAuthorizationV2Cache)
 		}
 
 		quickCommand := v1.Group("/quick_command")
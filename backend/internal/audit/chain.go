@@ -0,0 +1,243 @@
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+
+	"github.com/samber/lo"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/veops/oneterm/internal/model"
+	dbpkg "github.com/veops/oneterm/pkg/db"
+	"github.com/veops/oneterm/pkg/logger"
+)
+
+const (
+	// chainBatchSize is how many links are verified at once
+	chainBatchSize = 500
+	// maxIssues bounds the issues of a report
+	maxIssues = 1000
+)
+
+var (
+	// auditedTables load the rows of the tables covered by the chain with their digests by id
+	auditedTables = map[string]func(tx *gorm.DB, ids []int) (map[int]string, error){
+		model.DefaultHistory.TableName(): func(tx *gorm.DB, ids []int) (map[int]string, error) {
+			return loadDigests(tx, ids, func(m *model.History) (int, string) { return m.Id, m.AuditDigest() })
+		},
+		model.DefaultSessionCmd.TableName(): func(tx *gorm.DB, ids []int) (map[int]string, error) {
+			return loadDigests(tx, ids, func(m *model.SessionCmd) (int, string) { return m.Id, m.AuditDigest() })
+		},
+	}
+)
+
+func loadDigests[T any](tx *gorm.DB, ids []int, digest func(T) (int, string)) (map[int]string, error) {
+	rows := make([]T, 0)
+	if err := tx.Where("id IN ?", ids).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	return lo.SliceToMap(rows, digest), nil
+}
+
+// RegisterCallbacks appends rows created in the audited tables to the chain in the transaction which creates them
+func RegisterCallbacks(db *gorm.DB) error {
+	return db.Callback().Create().After("gorm:create").Register("audit:chain", appendCreated)
+}
+
+func appendCreated(db *gorm.DB) {
+	if db.Error != nil || db.Statement.Schema == nil || db.Statement.Schema.PrioritizedPrimaryField == nil {
+		return
+	}
+	table := db.Statement.Schema.Table
+	if _, ok := auditedTables[table]; !ok {
+		return
+	}
+
+	ids := make([]int, 0)
+	field, rv := db.Statement.Schema.PrioritizedPrimaryField, reflect.Indirect(db.Statement.ReflectValue)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			if id, zero := field.ValueOf(db.Statement.Context, reflect.Indirect(rv.Index(i))); !zero {
+				ids = append(ids, int(reflect.ValueOf(id).Int()))
+			}
+		}
+	case reflect.Struct:
+		if id, zero := field.ValueOf(db.Statement.Context, rv); !zero {
+			ids = append(ids, int(reflect.ValueOf(id).Int()))
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+
+	// Without the key rows are left out of the chain and reported as unchained, instead of failing the write
+	priv, err := SigningKey()
+	if err != nil {
+		logger.L().Error("audit key unavailable, rows are not chained", zap.String("table", table), zap.Error(err))
+		return
+	}
+	if err = appendLinks(db.Session(&gorm.Session{NewDB: true}), priv, table, ids); err != nil {
+		db.AddError(fmt.Errorf("append audit chain failed: %w", err))
+	}
+}
+
+func appendLinks(tx *gorm.DB, priv []byte, table string, ids []int) error {
+	digests, err := auditedTables[table](tx, ids)
+	if err != nil {
+		return err
+	}
+
+	last, err := lockChainHead(tx)
+	if err != nil {
+		return err
+	}
+	prev := last.Hash
+	for _, id := range ids {
+		link := &model.AuditChain{TargetType: table, TargetId: id, Digest: digests[id], PrevHash: prev}
+		link.Hash = linkHash(link)
+		link.Signature = sign(priv, []byte(link.Hash))
+		if err = tx.Create(link).Error; err != nil {
+			return err
+		}
+		prev = link.Hash
+	}
+
+	return nil
+}
+
+// lockChainHead locks the last link until the transaction which creates the rows ends, so writers of all
+// instances append one after another. A writer which waited for the lock reads the head again, since the link
+// it locked may no longer be the last one once the writer before it committed.
+// There is no link to lock before the first one, so writers of an empty chain lock the row of the audit key instead.
+func lockChainHead(tx *gorm.DB) (*model.AuditChain, error) {
+	last, keyLocked := &model.AuditChain{}, false
+	for {
+		head := &model.AuditChain{}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Order("id DESC").Limit(1).Find(head).Error; err != nil {
+			return nil, err
+		}
+		if head.Id == 0 && !keyLocked {
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("config_key = ?", model.SysConfigAuditSigningKey).Find(&model.SystemConfig{}).Error; err != nil {
+				return nil, err
+			}
+			keyLocked = true
+			continue
+		}
+		if head.Id == last.Id {
+			return head, nil
+		}
+		last = head
+	}
+}
+
+func linkHash(link *model.AuditChain) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\n%s\n%d\n%s", link.PrevHash, link.TargetType, link.TargetId, link.Digest)))
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifyChain checks the links from fromId on, limit <= 0 checks to the end.
+// Links are checked against the previous link, their signature and the current rows,
+// and rows created after the first chained one of their table but missing from the chain are reported as unchained.
+func VerifyChain(ctx context.Context, fromId, limit int) (*model.AuditReport, error) {
+	priv, err := SigningKey()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &model.AuditReport{Issues: make([]*model.AuditIssue, 0)}
+	addIssue := func(link *model.AuditChain, problem string) {
+		if len(report.Issues) < maxIssues {
+			report.Issues = append(report.Issues, &model.AuditIssue{
+				ChainId: link.Id, TargetType: link.TargetType, TargetId: link.TargetId, Problem: problem,
+			})
+		}
+	}
+
+	db := dbpkg.DB.WithContext(ctx)
+	prev := &model.AuditChain{}
+	if err = db.Where("id < ?", fromId).Order("id DESC").Limit(1).Find(prev).Error; err != nil {
+		return nil, err
+	}
+	report.Head = prev.Hash
+
+	for lastId := max(fromId, 1) - 1; limit <= 0 || report.Checked < limit; {
+		size := chainBatchSize
+		if limit > 0 {
+			size = min(size, limit-report.Checked)
+		}
+		links := make([]*model.AuditChain, 0)
+		if err = db.Where("id > ?", lastId).Order("id").Limit(size).Find(&links).Error; err != nil {
+			return nil, err
+		}
+		if len(links) == 0 {
+			break
+		}
+
+		digests := map[string]map[int]string{}
+		for table, ls := range lo.GroupBy(links, func(l *model.AuditChain) string { return l.TargetType }) {
+			load, ok := auditedTables[table]
+			if !ok {
+				continue
+			}
+			if digests[table], err = load(db, lo.Map(ls, func(l *model.AuditChain, _ int) int { return l.TargetId })); err != nil {
+				return nil, err
+			}
+		}
+
+		for _, link := range links {
+			digest, ok := digests[link.TargetType][link.TargetId]
+			switch {
+			case link.PrevHash != report.Head:
+				addIssue(link, "gap")
+			case link.Hash != linkHash(link) || !verify(priv, []byte(link.Hash), link.Signature):
+				addIssue(link, "signature")
+			case !ok:
+				addIssue(link, "deleted")
+			case digest != link.Digest:
+				addIssue(link, "modified")
+			}
+			report.Head = link.Hash
+		}
+		report.Checked += len(links)
+		lastId = links[len(links)-1].Id
+	}
+
+	for table := range auditedTables {
+		ids, err := unchainedRows(db, table)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			addIssue(&model.AuditChain{TargetType: table, TargetId: id}, "unchained")
+		}
+	}
+	report.Valid = len(report.Issues) == 0
+
+	return report, nil
+}
+
+// unchainedRows returns rows created after the first chained row of the table which are not in the chain
+func unchainedRows(db *gorm.DB, table string) ([]int, error) {
+	first := 0
+	if err := db.Model(model.DefaultAuditChain).Select("COALESCE(MIN(target_id), 0)").
+		Where("target_type = ?", table).Scan(&first).Error; err != nil || first == 0 {
+		return nil, err
+	}
+
+	ids := make([]int, 0)
+	err := db.Table(table).Select("id").
+		Where("id > ?", first).
+		Where("NOT EXISTS (?)", db.Model(model.DefaultAuditChain).Select("1").
+			Where("target_type = ? AND target_id = "+table+".id", table)).
+		Order("id").Limit(maxIssues).
+		Scan(&ids).Error
+
+	return ids, err
+}
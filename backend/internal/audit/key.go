@@ -0,0 +1,77 @@
+// Package audit signs session recordings and keeps a signed hash chain over history and session_cmd rows,
+// so that changes made directly in storage or the database are detected.
+package audit
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sync"
+
+	"gorm.io/gorm"
+
+	"github.com/veops/oneterm/internal/model"
+	dbpkg "github.com/veops/oneterm/pkg/db"
+	"github.com/veops/oneterm/pkg/utils"
+)
+
+var (
+	keyMu sync.Mutex
+	key   ed25519.PrivateKey
+)
+
+// SigningKey returns the ed25519 audit key, it is generated on first use and kept encrypted in system_config
+func SigningKey() (ed25519.PrivateKey, error) {
+	keyMu.Lock()
+	defer keyMu.Unlock()
+
+	if key != nil {
+		return key, nil
+	}
+
+	cfg := &model.SystemConfig{}
+	err := dbpkg.DB.Where("config_key = ?", model.SysConfigAuditSigningKey).First(cfg).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate audit key: %w", err)
+		}
+		// Another instance may have created the key first
+		cfg = &model.SystemConfig{Key: model.SysConfigAuditSigningKey}
+		if err = dbpkg.DB.Where("config_key = ?", model.SysConfigAuditSigningKey).
+			Attrs(model.SystemConfig{Value: utils.EncryptAES(base64.StdEncoding.EncodeToString(priv.Seed()))}).
+			FirstOrCreate(cfg).Error; err != nil {
+			return nil, fmt.Errorf("failed to save audit key: %w", err)
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to query audit key: %w", err)
+	}
+
+	seed, err := base64.StdEncoding.DecodeString(utils.DecryptAES(cfg.Value))
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("invalid audit key")
+	}
+	key = ed25519.NewKeyFromSeed(seed)
+
+	return key, nil
+}
+
+// PublicKey returns the base64 public audit key to verify signatures out of the server
+func PublicKey() (string, error) {
+	priv, err := SigningKey()
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(priv.Public().(ed25519.PublicKey)), nil
+}
+
+func sign(priv ed25519.PrivateKey, msg []byte) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(priv, msg))
+}
+
+func verify(priv ed25519.PrivateKey, msg []byte, signature string) bool {
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	return err == nil && ed25519.Verify(priv.Public().(ed25519.PublicKey), msg, sig)
+}
@@ -0,0 +1,82 @@
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+
+	"gorm.io/gorm/clause"
+
+	"github.com/veops/oneterm/internal/model"
+	dbpkg "github.com/veops/oneterm/pkg/db"
+)
+
+// replayMessage is what is signed for a recording, it binds the digest to the session
+func replayMessage(sessionID, digest string, size int64) []byte {
+	return []byte(fmt.Sprintf("oneterm-replay\n%s\n%s\n%d", sessionID, digest, size))
+}
+
+func digestReader(r io.Reader) (string, int64, error) {
+	h := sha256.New()
+	size, err := io.Copy(h, r)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), size, nil
+}
+
+// SignReplay saves the signed sha256 digest of a finalized recording, r is the recording as it is replayed
+func SignReplay(sessionID string, r io.Reader) error {
+	priv, err := SigningKey()
+	if err != nil {
+		return err
+	}
+	digest, size, err := digestReader(r)
+	if err != nil {
+		return err
+	}
+
+	return dbpkg.DB.
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "session_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"digest", "size", "signature"}),
+		}).
+		Create(&model.ReplaySignature{
+			SessionId: sessionID,
+			Digest:    digest,
+			Size:      size,
+			Signature: sign(priv, replayMessage(sessionID, digest, size)),
+		}).
+		Error
+}
+
+// VerifyReplay checks a recording against its signed digest
+func VerifyReplay(signature *model.ReplaySignature, r io.Reader) (*model.ReplayVerification, error) {
+	priv, err := SigningKey()
+	if err != nil {
+		return nil, err
+	}
+	digest, size, err := digestReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &model.ReplayVerification{
+		SessionId: signature.SessionId,
+		Signed:    true,
+		Digest:    digest,
+		Expected:  signature.Digest,
+		Size:      size,
+	}
+	switch {
+	case !verify(priv, replayMessage(signature.SessionId, signature.Digest, signature.Size), signature.Signature):
+		res.Error = "signature does not match the recorded digest"
+	case digest != signature.Digest || size != signature.Size:
+		res.Error = "recording was modified"
+	default:
+		res.Valid = true
+	}
+
+	return res, nil
+}
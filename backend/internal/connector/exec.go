@@ -0,0 +1,196 @@
+package connector
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samber/lo"
+	"go.uber.org/zap"
+	gossh "golang.org/x/crypto/ssh"
+
+	"github.com/veops/oneterm/internal/connector/protocols"
+	"github.com/veops/oneterm/internal/model"
+	gsession "github.com/veops/oneterm/internal/session"
+	"github.com/veops/oneterm/internal/tunneling"
+	myErrors "github.com/veops/oneterm/pkg/errors"
+	"github.com/veops/oneterm/pkg/logger"
+)
+
+const (
+	// execResultLimit is the max length of the output stored as the result of the command
+	execResultLimit = 64 * 1024
+)
+
+// DoExec runs a non-interactive command, e.g. ssh oneterm web01 -- uptime or scp, on the ssh asset of the request.
+// It is audited as a session whose output is recorded and whose command is checked against command policies.
+func DoExec(ctx *gin.Context, command string, stdin io.Reader, stdout, stderr io.Writer) (code int, err error) {
+	// An empty command would start the login shell of the account, which no command policy checks
+	if strings.TrimSpace(command) == "" {
+		err = &myErrors.ApiError{Code: myErrors.ErrInvalidArgument, Data: map[string]any{"err": "empty command"}}
+		return
+	}
+	sess, asset, account, gateway, err := newSession(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer func() { discardRecording(sess, err) }()
+	if protocol := strings.Split(sess.Protocol, ":")[0]; protocol != "ssh" {
+		err = &myErrors.ApiError{Code: myErrors.ErrInvalidArgument, Data: map[string]any{"err": fmt.Sprintf("exec is not supported by %s", protocol)}}
+		return
+	}
+
+	// scp -t copies files to the asset and scp -f copies files from it
+	actions := []model.AuthAction{model.ActionConnect}
+	transfer := scpAction(command)
+	if transfer != "" {
+		actions = append(actions, transfer)
+	}
+	result, err := authorizeSession(ctx, sess, actions...)
+	if err != nil {
+		return
+	}
+	if transfer != "" && !result.IsAllowed(transfer) {
+		err = &myErrors.ApiError{Code: myErrors.ErrUnauthorized, Data: map[string]any{"perm": string(transfer)}}
+		return
+	}
+
+	gsession.GetOnlineSession().Store(sess.SessionId, sess)
+	gsession.UpsertSession(sess)
+	defer func() {
+		sess.Status = model.SESSIONSTATUS_OFFLINE
+		sess.ClosedAt = lo.ToPtr(time.Now())
+		sess.ExitCode = lo.ToPtr(code)
+		if closeErr := sess.SshRecoder.Close(); closeErr != nil {
+			logger.L().Error("Failed to close SSH recorder", zap.String("sessionId", sess.SessionId), zap.Error(closeErr))
+		}
+		if upsertErr := gsession.UpsertSession(sess); upsertErr != nil {
+			logger.L().Error("upsert session failed", zap.Error(upsertErr))
+		}
+		gsession.GetOnlineSession().Delete(sess.SessionId)
+		tunneling.CloseTunnels(sess.SessionId)
+	}()
+
+	res := sess.SshParser.Check(command)
+	if !res.Allowed {
+		atomic.AddInt64(&sess.Forbidden, 1)
+		sess.SshParser.RecordCmd(command, "", res)
+		msg := fmt.Sprintf("%s is forbidden\n", res.Reason)
+		sess.SshRecoder.Write([]byte(msg))
+		fmt.Fprint(stderr, msg)
+		return 1, nil
+	}
+	if res.Action == model.CommandActionAudit {
+		protocols.AlertMonitors(sess, res)
+	}
+
+	output := &execOutput{rec: sess.SshRecoder, binary: transfer != ""}
+	defer func() {
+		sess.SshParser.RecordCmd(command, output.String(), res)
+	}()
+
+	sshCli, err := protocols.DialSsh(sess.SessionId, asset, account, gateway)
+	if err != nil {
+		err = &myErrors.ApiError{Code: myErrors.ErrConnectServer, Data: map[string]any{"err": err}}
+		return
+	}
+	defer sshCli.Close()
+
+	sshSess, err := sshCli.NewSession()
+	if err != nil {
+		err = &myErrors.ApiError{Code: myErrors.ErrConnectServer, Data: map[string]any{"err": err}}
+		return
+	}
+	defer sshSess.Close()
+
+	sshSess.Stdin = io.TeeReader(stdin, &countWriter{Writer: io.Discard, n: &sess.BytesIn})
+	sshSess.Stdout = io.MultiWriter(&countWriter{Writer: stdout, n: &sess.BytesOut}, output)
+	sshSess.Stderr = io.MultiWriter(&countWriter{Writer: stderr, n: &sess.BytesOut}, output)
+	if err = sshSess.Start(command); err != nil {
+		err = &myErrors.ApiError{Code: myErrors.ErrConnectServer, Data: map[string]any{"err": err}}
+		return
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- sshSess.Wait() }()
+
+	select {
+	case err = <-done:
+		sess.SetCloseReason(model.SESSIONCLOSE_REMOTE_EXIT)
+	case <-sess.LifetimeC():
+		sess.SetCloseReason(model.SESSIONCLOSE_SESSION_TIMEOUT)
+		err = &myErrors.ApiError{Code: myErrors.ErrSessionTimeout, Data: map[string]any{"second": int(sess.Lifetime.Seconds())}}
+	case closeBy := <-sess.Chans.CloseChan:
+		logger.L().Info("closed by", zap.String("admin", closeBy))
+		sess.SetCloseReason(model.SESSIONCLOSE_ADMIN_CLOSE)
+		err = &myErrors.ApiError{Code: myErrors.ErrAdminClose, Data: map[string]any{"admin": closeBy}}
+	case <-sess.Gctx.Done():
+		sess.SetCloseReason(model.SESSIONCLOSE_CLIENT_DISCONNECT)
+		err = sess.Gctx.Err()
+	}
+
+	var exitErr *gossh.ExitError
+	switch {
+	case err == nil:
+		return 0, nil
+	case errors.As(err, &exitErr):
+		return exitErr.ExitStatus(), nil
+	default:
+		return 255, err
+	}
+}
+
+// scpAction returns the permission required by a scp command, empty if it is not scp
+func scpAction(command string) model.AuthAction {
+	fields := strings.Fields(command)
+	if len(fields) == 0 || fields[0] != "scp" {
+		return ""
+	}
+	for _, f := range fields[1:] {
+		if !strings.HasPrefix(f, "-") || strings.HasPrefix(f, "--") {
+			continue
+		}
+		switch {
+		case strings.Contains(f, "t"):
+			return model.ActionFileUpload
+		case strings.Contains(f, "f"):
+			return model.ActionFileDownload
+		}
+	}
+	return ""
+}
+
+// execOutput records the output of a command, the binary stream of scp is not recorded
+type execOutput struct {
+	mu     sync.Mutex
+	rec    *gsession.Asciinema
+	binary bool
+	buf    strings.Builder
+}
+
+func (o *execOutput) Write(p []byte) (int, error) {
+	if o.binary {
+		return len(p), nil
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.rec.Write(p)
+	if n := execResultLimit - o.buf.Len(); n > 0 {
+		o.buf.Write(p[:min(n, len(p))])
+	}
+	return len(p), nil
+}
+
+func (o *execOutput) String() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return o.buf.String()
+}
@@ -0,0 +1,121 @@
+package connector
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samber/lo"
+	"go.uber.org/zap"
+
+	"github.com/veops/oneterm/internal/model"
+	gsession "github.com/veops/oneterm/internal/session"
+	"github.com/veops/oneterm/internal/tunneling"
+	myErrors "github.com/veops/oneterm/pkg/errors"
+	"github.com/veops/oneterm/pkg/logger"
+)
+
+// DoForward forwards a tcp connection, e.g. of ssh -L, to the port of the asset in the request.
+// Every forward is audited as a session with the bytes transferred in both directions.
+// accept is called once the asset is reachable and returns the connection of the client.
+func DoForward(ctx *gin.Context, port int, accept func() (io.ReadWriteCloser, error)) (err error) {
+	ctx.Params = append(ctx.Params, gin.Param{Key: "protocol", Value: fmt.Sprintf("tcp:%d", port)})
+	sess, asset, _, gateway, err := newSession(ctx, nil)
+	if err != nil {
+		return
+	}
+
+	result, err := authorizeSession(ctx, sess, model.ActionConnect, model.ActionPortForward)
+	if err != nil {
+		return
+	}
+	if !result.IsAllowed(model.ActionPortForward) {
+		return &myErrors.ApiError{Code: myErrors.ErrUnauthorized, Data: map[string]any{"perm": string(model.ActionPortForward)}}
+	}
+
+	if asset.GatewayId == 0 {
+		gateway = nil
+	}
+	defer tunneling.CloseTunnels(sess.SessionId)
+	ip, p, err := tunneling.ProxyAddr(false, sess.SessionId, strings.Split(asset.Ip, ":")[0], port, gateway)
+	if err != nil {
+		return &myErrors.ApiError{Code: myErrors.ErrConnectServer, Data: map[string]any{"err": err}}
+	}
+	remote, err := net.DialTimeout("tcp", net.JoinHostPort(ip, strconv.Itoa(p)), time.Second*3)
+	if err != nil {
+		return &myErrors.ApiError{Code: myErrors.ErrConnectServer, Data: map[string]any{"err": err}}
+	}
+	defer remote.Close()
+
+	local, err := accept()
+	if err != nil {
+		return
+	}
+	defer local.Close()
+
+	gsession.GetOnlineSession().Store(sess.SessionId, sess)
+	gsession.UpsertSession(sess)
+	defer func() {
+		sess.Status = model.SESSIONSTATUS_OFFLINE
+		sess.ClosedAt = lo.ToPtr(time.Now())
+		if upsertErr := gsession.UpsertSession(sess); upsertErr != nil {
+			logger.L().Error("upsert session failed", zap.Error(upsertErr))
+		}
+		gsession.GetOnlineSession().Delete(sess.SessionId)
+	}()
+
+	// Each direction half closes its destination once its source reaches EOF,
+	// the side which reaches EOF first is why the session is closed
+	done := make(chan struct{}, 2)
+	pipe := func(dst io.Writer, src io.Reader, n *int64, reason string) {
+		io.Copy(&countWriter{Writer: dst, n: n}, src)
+		sess.SetCloseReason(reason)
+		if cw, ok := dst.(interface{ CloseWrite() error }); ok {
+			cw.CloseWrite()
+		}
+		done <- struct{}{}
+	}
+	go pipe(remote, local, &sess.BytesIn, model.SESSIONCLOSE_CLIENT_DISCONNECT)
+	go pipe(local, remote, &sess.BytesOut, model.SESSIONCLOSE_REMOTE_EXIT)
+
+	for running := 2; running > 0; {
+		select {
+		case <-done:
+			running--
+			continue
+		case <-sess.LifetimeC():
+			logger.L().Info("port forward timeout", zap.String("sessionId", sess.SessionId))
+			sess.SetCloseReason(model.SESSIONCLOSE_SESSION_TIMEOUT)
+		case closeBy := <-sess.Chans.CloseChan:
+			logger.L().Info("closed by", zap.String("admin", closeBy))
+			sess.SetCloseReason(model.SESSIONCLOSE_ADMIN_CLOSE)
+		case <-sess.Gctx.Done():
+			sess.SetCloseReason(model.SESSIONCLOSE_CLIENT_DISCONNECT)
+		}
+		// Stop both directions and wait for the counters to settle
+		local.Close()
+		remote.Close()
+		for ; running > 0; running-- {
+			<-done
+		}
+	}
+
+	return nil
+}
+
+// countWriter counts bytes written through it
+type countWriter struct {
+	io.Writer
+	n *int64
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	atomic.AddInt64(w.n, int64(n))
+	return n, err
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -131,6 +132,123 @@ func ConnectMonitor(ctx *gin.Context) {
 	logger.L().Info("monitor exit", zap.String("sessionId", sess.SessionId))
 }
 
+// ConnectAttach reattaches the owner to a detached web terminal, output written while detached is replayed first
+func ConnectAttach(ctx *gin.Context) {
+	currentUser, _ := acl.GetSessionFromCtx(ctx)
+
+	sessionId := ctx.Param("session_id")
+	ws, err := protocols.Upgrader.Upgrade(ctx.Writer, ctx.Request, http.Header{
+		"sec-websocket-protocol": {ctx.GetHeader("sec-websocket-protocol")},
+	})
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	defer ws.Close()
+
+	defer func() {
+		if err != nil {
+			ae, ok := err.(*myErrors.ApiError)
+			ws.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf("\r\n \033[31m %s \x1b[0m", lo.Ternary(ok, ae.MessageWithCtx(ctx), err.Error()))))
+		}
+	}()
+
+	sess := gsession.GetOnlineSessionById(sessionId)
+	if sess == nil || sess.SessionType != model.SESSIONTYPE_WEB || sess.IsGuacd() {
+		err = &myErrors.ApiError{Code: myErrors.ErrInvalidSessionId, Data: map[string]any{"sessionId": sessionId}}
+		return
+	}
+	if sess.Uid != currentUser.GetUid() {
+		err = &myErrors.ApiError{Code: myErrors.ErrNoPerm, Data: map[string]any{"perm": "attach session"}}
+		return
+	}
+
+	detachC, err := protocols.Attach(sess, ws)
+	if err != nil {
+		err = &myErrors.ApiError{Code: myErrors.ErrInvalidArgument, Data: map[string]any{"err": err}}
+		return
+	}
+
+	// The session reads ws from now on, wait until ws is dropped again or the session is done
+	select {
+	case <-detachC:
+	case <-sess.Gctx.Done():
+	}
+	logger.L().Info("attach exit", zap.String("sessionId", sess.SessionId))
+}
+
+// ConnectJoin connects a user invited to a terminal session, keystrokes are forwarded only while the user holds control
+func ConnectJoin(ctx *gin.Context) {
+	currentUser, _ := acl.GetSessionFromCtx(ctx)
+	uid := currentUser.GetUid()
+
+	sessionId := ctx.Param("session_id")
+	var sess *gsession.Session
+	ws, err := protocols.Upgrader.Upgrade(ctx.Writer, ctx.Request, http.Header{
+		"sec-websocket-protocol": {ctx.GetHeader("sec-websocket-protocol")},
+	})
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	defer ws.Close()
+
+	chs := gsession.NewSessionChans()
+	defer func() {
+		protocols.HandleError(ctx, sess, err, ws, chs)
+	}()
+
+	if sess = gsession.GetOnlineSessionById(sessionId); sess == nil || sess.IsGuacd() || sess.IsPortForward() {
+		err = &myErrors.ApiError{Code: myErrors.ErrInvalidSessionId, Data: map[string]any{"sessionId": sessionId}}
+		return
+	}
+	if _, ok := sess.Collab.Participant(uid); !ok {
+		err = &myErrors.ApiError{Code: myErrors.ErrNoPerm, Data: map[string]any{"perm": "join session"}}
+		return
+	}
+
+	// The invitation does not grant access, the user must be allowed to connect the same asset and account
+	asset, _, _, err := repository.GetAAG(sess.AssetId, sess.AccountId)
+	if err != nil {
+		return
+	}
+	result, err := service.DefaultAuthService.CheckPermission(ctx, asset.ParentId, sess.AssetId, sess.AccountId, model.ActionConnect)
+	if err != nil {
+		err = &myErrors.ApiError{Code: myErrors.ErrInvalidArgument, Data: map[string]any{"err": err}}
+		return
+	}
+	if !result.Allowed {
+		err = &myErrors.ApiError{Code: myErrors.ErrUnauthorized, Data: map[string]any{"perm": "connect"}}
+		return
+	}
+
+	if _, err = sess.Collab.Join(uid, currentUser.GetUserName(), ws); err != nil {
+		err = &myErrors.ApiError{Code: myErrors.ErrInvalidArgument, Data: map[string]any{"err": err}}
+		return
+	}
+	defer sess.Collab.Leave(uid)
+
+	for {
+		t, msg, err := ws.ReadMessage()
+		if err != nil {
+			break
+		}
+		if t != websocket.TextMessage || len(msg) <= 1 || msg[0] != '1' || !sess.Collab.IsController(uid) {
+			continue
+		}
+		if sess.SessionType != model.SESSIONTYPE_WEB {
+			msg = msg[1:]
+		}
+		select {
+		case sess.Chans.InChan <- msg:
+			sess.SetIdle()
+		case <-sess.Gctx.Done():
+			return
+		}
+	}
+	logger.L().Info("participant exit", zap.String("sessionId", sess.SessionId), zap.Int("uid", uid))
+}
+
 func ConnectClose(ctx *gin.Context) {
 	currentUser, _ := acl.GetSessionFromCtx(ctx)
 	if !acl.IsAdmin(currentUser) {
@@ -154,6 +272,7 @@ func ConnectClose(ctx *gin.Context) {
 
 	session.Status = model.SESSIONSTATUS_OFFLINE
 	session.ClosedAt = lo.ToPtr(time.Now())
+	session.SetCloseReason(model.SESSIONCLOSE_ADMIN_CLOSE)
 	gsession.UpsertSession(session)
 
 	ctx.JSON(http.StatusOK, gin.H{"code": 0, "message": "ok"})
@@ -161,71 +280,11 @@ func ConnectClose(ctx *gin.Context) {
 
 // DoConnect handles the connection setup process
 func DoConnect(ctx *gin.Context, ws *websocket.Conn) (sess *gsession.Session, err error) {
-	currentUser, _ := acl.GetSessionFromCtx(ctx)
-
-	assetId, accountId := cast.ToInt(ctx.Param("asset_id")), cast.ToInt(ctx.Param("account_id"))
-	asset, account, gateway, err := repository.GetAAG(assetId, accountId)
+	sess, asset, account, gateway, err := newSession(ctx, ws)
 	if err != nil {
 		return
 	}
-
-	sessionId := ctx.Query("session_id")
-	if sessionId == "" {
-		sessionId = uuid.New().String()
-	}
-
-	sess = gsession.NewSession(ctx)
-	sess.Ws = ws
-	sess.Session = &model.Session{
-		SessionType: ctx.GetInt("sessionType"),
-		SessionId:   sessionId,
-		Uid:         currentUser.GetUid(),
-		UserName:    currentUser.GetUserName(),
-		AssetId:     assetId,
-		Asset:       asset,
-		AssetInfo:   fmt.Sprintf("%s(%s)", asset.Name, asset.Ip),
-		AccountId:   accountId,
-		AccountInfo: fmt.Sprintf("%s(%s)", account.Name, account.Account),
-		GatewayId:   asset.GatewayId,
-		GatewayInfo: lo.Ternary(asset.GatewayId == 0, "", fmt.Sprintf("%s(%s)", gateway.Name, gateway.Host)),
-		Protocol:    ctx.Param("protocol"),
-		Status:      model.SESSIONSTATUS_ONLINE,
-		ShareId:     cast.ToInt(ctx.Value("shareId")),
-	}
-	if sess.ShareId != 0 {
-		sess.ShareEnd, _ = ctx.Value("shareEnd").(time.Time)
-		if shareErr, exists := ctx.Get("shareErr"); exists && shareErr != nil {
-			if apiErr, ok := shareErr.(*myErrors.ApiError); ok {
-				err = apiErr
-				return
-			}
-		}
-	}
-	if !sess.IsGuacd() {
-		w, h := cast.ToInt(ctx.Query("w")), cast.ToInt(ctx.Query("h"))
-		sess.SshParser = gsession.NewParser(sess.SessionId, w, h)
-		sess.SshParser.Protocol = sess.Protocol
-
-		// Use V2 command analyzer instead of legacy method
-		commandAnalyzer := service.NewCommandAnalyzer()
-		cmds, err := commandAnalyzer.AnalyzeSessionCommands(ctx, sess)
-		if err != nil {
-			logger.L().Error("Failed to analyze session commands", zap.String("sessionId", sess.SessionId), zap.Error(err))
-			// Continue with empty command list (no command restrictions)
-			cmds = []*model.Command{}
-		}
-		sess.SshParser.Cmds = cmds
-
-		if sess.SshRecoder, err = gsession.NewAsciinema(sess.SessionId, w, h); err != nil {
-			return sess, err
-		}
-	}
-	switch sess.SessionType {
-	case model.SESSIONTYPE_WEB:
-		sess.ClientIp = ctx.ClientIP()
-	case model.SESSIONTYPE_CLIENT:
-		sess.ClientIp = ctx.RemoteIP()
-	}
+	defer func() { discardRecording(sess, err) }()
 
 	// V2 authorization check - determine required permissions based on protocol
 	protocol := strings.Split(sess.Protocol, ":")[0]
@@ -247,15 +306,8 @@ func DoConnect(ctx *gin.Context, ws *websocket.Conn) (sess *gsession.Session, er
 	// RDP/VNC are handled separately in ConnectGuacd with their own batch permission check
 	// but we still check connect permission here for consistency
 
-	result, err := service.DefaultAuthService.HasAuthorizationV2(ctx, sess, requiredActions...)
+	result, err := authorizeSession(ctx, sess, requiredActions...)
 	if err != nil {
-		err = &myErrors.ApiError{Code: myErrors.ErrInvalidArgument, Data: map[string]any{"err": err}}
-		return sess, err
-	}
-
-	// Check connect permission (required for all protocols)
-	if !result.IsAllowed(model.ActionConnect) {
-		err = &myErrors.ApiError{Code: myErrors.ErrUnauthorized, Data: map[string]any{"perm": "connect"}}
 		return sess, err
 	}
 
@@ -281,7 +333,7 @@ func DoConnect(ctx *gin.Context, ws *websocket.Conn) (sess *gsession.Session, er
 	switch protocol {
 	case "ssh":
 		go protocols.ConnectSsh(ctx, sess, asset, account, gateway)
-	case "redis", "mysql", "mongodb", "postgresql":
+	case "redis", "mysql", "mongodb", "postgresql", "mssql", "oracle", "clickhouse":
 		go db.ConnectDB(sess, asset, account, gateway)
 	case "telnet":
 		go protocols.ConnectTelnet(ctx, sess, asset, account, gateway)
@@ -298,6 +350,12 @@ func DoConnect(ctx *gin.Context, ws *websocket.Conn) (sess *gsession.Session, er
 
 	if err = <-sess.Chans.ErrChan; err != nil {
 		logger.L().Error("failed to connect", zap.Error(err))
+		// Keep errors which are meaningful to user, e.g. host key verification failure
+		var ae *myErrors.ApiError
+		if errors.As(err, &ae) {
+			err = ae
+			return
+		}
 		err = &myErrors.ApiError{Code: myErrors.ErrConnectServer, Data: map[string]any{"err": err}}
 		return
 	}
@@ -338,6 +396,129 @@ func DoConnect(ctx *gin.Context, ws *websocket.Conn) (sess *gsession.Session, er
 	return
 }
 
+// newSession creates a session of the asset and account in the request, terminal sessions get a parser and a recorder
+func newSession(ctx *gin.Context, ws *websocket.Conn) (sess *gsession.Session, asset *model.Asset, account *model.Account, gateway *model.Gateway, err error) {
+	currentUser, _ := acl.GetSessionFromCtx(ctx)
+
+	assetId, accountId := cast.ToInt(ctx.Param("asset_id")), cast.ToInt(ctx.Param("account_id"))
+	asset, account, gateway, err = repository.GetAAG(assetId, accountId)
+	if err != nil {
+		return
+	}
+
+	sessionId := ctx.Query("session_id")
+	if sessionId == "" {
+		sessionId = uuid.New().String()
+	}
+
+	sess = gsession.NewSession(ctx)
+	sess.Ws = ws
+	sess.Session = &model.Session{
+		SessionType: ctx.GetInt("sessionType"),
+		SessionId:   sessionId,
+		Uid:         currentUser.GetUid(),
+		UserName:    currentUser.GetUserName(),
+		AssetId:     assetId,
+		Asset:       asset,
+		AssetInfo:   fmt.Sprintf("%s(%s)", asset.Name, asset.Ip),
+		AccountId:   accountId,
+		AccountInfo: fmt.Sprintf("%s(%s)", account.Name, account.Account),
+		GatewayId:   asset.GatewayId,
+		GatewayInfo: lo.Ternary(asset.GatewayId == 0, "", gateway.Path()),
+		Protocol:    ctx.Param("protocol"),
+		Status:      model.SESSIONSTATUS_ONLINE,
+		ShareId:     cast.ToInt(ctx.Value("shareId")),
+	}
+	if sess.ShareId != 0 {
+		sess.ShareEnd, _ = ctx.Value("shareEnd").(time.Time)
+		if shareErr, exists := ctx.Get("shareErr"); exists && shareErr != nil {
+			if apiErr, ok := shareErr.(*myErrors.ApiError); ok {
+				err = apiErr
+				return
+			}
+		}
+	}
+	if !sess.IsGuacd() && !sess.IsPortForward() {
+		w, h := cast.ToInt(ctx.Query("w")), cast.ToInt(ctx.Query("h"))
+		sess.SetWindow(w, h)
+		sess.SshParser = gsession.NewParser(sess.SessionId, w, h)
+		sess.SshParser.Protocol = sess.Protocol
+		sess.SshParser.Driver = sess.Collab.Controller
+
+		// Use V2 command analyzer instead of legacy method
+		commandAnalyzer := service.NewCommandAnalyzer()
+		cmds, allowlist, err := commandAnalyzer.AnalyzeSessionCommands(ctx, sess)
+		if err != nil {
+			logger.L().Error("Failed to analyze session commands", zap.String("sessionId", sess.SessionId), zap.Error(err))
+			// Continue with empty command list (no command restrictions)
+			cmds = []*model.Command{}
+		}
+		sess.SshParser.Cmds = cmds
+		sess.SshParser.CmdAllowlist = allowlist
+
+		if sess.SshRecoder, err = gsession.NewAsciinema(sess.SessionId, w, h); err != nil {
+			return sess, asset, account, gateway, err
+		}
+	}
+	switch sess.SessionType {
+	case model.SESSIONTYPE_WEB:
+		sess.ClientIp = ctx.ClientIP()
+	case model.SESSIONTYPE_CLIENT:
+		sess.ClientIp = ctx.RemoteIP()
+	}
+
+	return
+}
+
+// discardRecording removes the recording of a session which failed before it started, so that no replay is left of it
+func discardRecording(sess *gsession.Session, err error) {
+	if err != nil && sess != nil && sess.SshRecoder != nil {
+		sess.SshRecoder.Discard()
+	}
+}
+
+// authorizeSession checks the actions with V2 rules and enforces session control of the rule which allows connecting
+func authorizeSession(ctx *gin.Context, sess *gsession.Session, actions ...model.AuthAction) (result *model.BatchAuthResult, err error) {
+	result, err = service.DefaultAuthService.HasAuthorizationV2(ctx, sess, actions...)
+	if err != nil {
+		err = &myErrors.ApiError{Code: myErrors.ErrInvalidArgument, Data: map[string]any{"err": err}}
+		return
+	}
+
+	// Check connect permission (required for all protocols)
+	if !result.IsAllowed(model.ActionConnect) {
+		err = &myErrors.ApiError{Code: myErrors.ErrUnauthorized, Data: map[string]any{"perm": "connect"}}
+		return
+	}
+
+	// Enforce session control of the rule which allows connecting
+	connectResult := result.GetResult(model.ActionConnect)
+	if err = checkMaxSessions(sess, connectResult); err != nil {
+		return
+	}
+	sess.RuleId = connectResult.RuleId
+	sess.SetLifetime(connectResult.SessionTimeout())
+	sess.RecordInput = connectResult.RecordInput() || (sess.Session.Asset != nil && sess.Session.Asset.RecordInput)
+
+	return
+}
+
+// checkMaxSessions checks online sessions of current user which are allowed by the same rule.
+// Detached web terminals are counted too, they keep their connection to the asset until they are reattached or time out.
+func checkMaxSessions(sess *gsession.Session, result *model.AuthResult) error {
+	max := result.MaxSessions()
+	if max <= 0 || result.RuleId == 0 {
+		return nil
+	}
+	cnt := gsession.CountOnlineSession(func(s *gsession.Session) bool {
+		return s.Uid == sess.Uid && s.RuleId == result.RuleId
+	})
+	if cnt >= max {
+		return &myErrors.ApiError{Code: myErrors.ErrMaxSessions, Data: map[string]any{"rule": result.RuleName, "max": max}}
+	}
+	return nil
+}
+
 // HandleTerm handles terminal sessions
 func HandleTerm(sess *gsession.Session, ctx *gin.Context) (err error) {
 	defer func() {
@@ -361,6 +542,8 @@ func HandleTerm(sess *gsession.Session, ctx *gin.Context) (err error) {
 		sess.SshParser.Close(sess.Prompt)
 		sess.Status = model.SESSIONSTATUS_OFFLINE
 		sess.ClosedAt = lo.ToPtr(time.Now())
+		// Neither a policy nor the client closed the session, it ended on the remote side
+		sess.SetCloseReason(model.SESSIONCLOSE_REMOTE_EXIT)
 		if err = gsession.UpsertSession(sess); err != nil {
 			logger.L().Error("upsert session failed", zap.Error(err))
 		}
@@ -382,11 +565,18 @@ func HandleTerm(sess *gsession.Session, ctx *gin.Context) (err error) {
 			case <-chs.AwayChan:
 				// Flush any remaining output before terminating
 				protocols.Write(sess)
+				sess.SetCloseReason(model.SESSIONCLOSE_REMOTE_EXIT)
 				return
 			case <-sess.IdleTk.C:
+				sess.SetCloseReason(model.SESSIONCLOSE_IDLE_TIMEOUT)
 				msg := (&myErrors.ApiError{Code: myErrors.ErrIdleTimeout, Data: map[string]any{"second": model.GlobalConfig.Load().Timeout}}).MessageWithCtx(ctx)
 				protocols.WriteErrMsg(sess, msg)
 				return &myErrors.ApiError{Code: myErrors.ErrIdleTimeout, Data: map[string]any{"second": model.GlobalConfig.Load().Timeout}}
+			case <-sess.LifetimeC():
+				sess.SetCloseReason(model.SESSIONCLOSE_SESSION_TIMEOUT)
+				ae := &myErrors.ApiError{Code: myErrors.ErrSessionTimeout, Data: map[string]any{"second": int(sess.Lifetime.Seconds())}}
+				protocols.WriteErrMsg(sess, ae.MessageWithCtx(ctx))
+				return ae
 			case <-tk1m.C:
 				asset, err := assetService.GetById(sess.Gctx, sess.AssetId)
 				if err != nil {
@@ -395,8 +585,16 @@ func HandleTerm(sess *gsession.Session, ctx *gin.Context) (err error) {
 				if protocols.CheckTime(asset.AccessAuth) && (sess.ShareId == 0 || time.Now().Before(sess.ShareEnd)) {
 					continue
 				}
+				sess.SetCloseReason(model.SESSIONCLOSE_ACCESS_TIME)
 				return &myErrors.ApiError{Code: myErrors.ErrAccessTime}
+			case notice := <-chs.NoticeChan:
+				// Markers already attribute control in the recording
+				chs.OutBuf.WriteString(fmt.Sprintf("\r\n \033[36m[%s]\x1b[0m\r\n", notice))
+				if err = protocols.Write(sess, true); err != nil {
+					return
+				}
 			case closeBy := <-chs.CloseChan:
+				sess.SetCloseReason(model.SESSIONCLOSE_ADMIN_CLOSE)
 				msg := (&myErrors.ApiError{Code: myErrors.ErrAdminClose, Data: map[string]any{"admin": closeBy}}).MessageWithCtx(ctx)
 				protocols.WriteErrMsg(sess, msg)
 				logger.L().Info("closed by", zap.String("admin", closeBy))
@@ -415,6 +613,7 @@ func HandleTerm(sess *gsession.Session, ctx *gin.Context) (err error) {
 						if len(wh) < 2 {
 							continue
 						}
+						sess.SetWindow(cast.ToInt(wh[0]), cast.ToInt(wh[1]))
 						chs.WindowChan <- ssh.Window{
 							Width:  cast.ToInt(wh[0]),
 							Height: cast.ToInt(wh[1]),
@@ -422,29 +621,44 @@ func HandleTerm(sess *gsession.Session, ctx *gin.Context) (err error) {
 						continue
 					}
 				}
-				if cmd, forbidden := sess.SshParser.AddInput(in); forbidden {
+				if sess.RecordInput && sess.SshRecoder != nil {
+					sess.SshRecoder.Input(in)
+				}
+				cmd, res := sess.SshParser.AddInput(in)
+				if res != nil && !res.Allowed {
+					atomic.AddInt64(&sess.Forbidden, 1)
 					protocols.WriteErrMsg(sess, fmt.Sprintf("%s is forbidden\n", cmd))
 					sess.SshParser.AddInput(byteClearAll)
 					chs.Win.Write(byteClearAll)
 					continue
 				}
+				if res != nil && res.Action == model.CommandActionAudit {
+					protocols.AlertMonitors(sess, res)
+				}
 				if _, err = chs.Win.Write(in); err != nil {
 					return
 				}
+				atomic.AddInt64(&sess.BytesIn, int64(len(in)))
 			case out := <-chs.OutChan:
 				if _, err = chs.OutBuf.Write(out); err != nil {
 					return
 				}
+				atomic.AddInt64(&sess.BytesOut, int64(len(out)))
 				sess.SshParser.AddOutput(out)
 			case <-tk.C:
 				if err = protocols.Write(sess); err != nil {
 					return
 				}
 			case <-tk1s.C:
-				if sess.Ws == nil {
+				ws := sess.GetWs()
+				if ws == nil {
 					continue
 				}
-				if err = sess.Ws.WriteMessage(websocket.TextMessage, nil); err != nil {
+				if err = ws.WriteMessage(websocket.TextMessage, nil); err != nil {
+					if sess.Detach(ws) {
+						err = nil
+						continue
+					}
 					return
 				}
 			}
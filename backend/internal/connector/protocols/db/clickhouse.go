@@ -0,0 +1,33 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/veops/oneterm/internal/model"
+)
+
+// getClickHouseConfig returns ClickHouse client configuration, which connects to the native protocol port
+func getClickHouseConfig(ip string, port int, account *model.Account) DBClientConfig {
+	// The database may be given in the account like user/database
+	user, database, _ := strings.Cut(account.Account, "/")
+	args := []string{"--host", ip, "--port", fmt.Sprintf("%d", port)}
+	if user != "" {
+		args = append(args, "--user", user)
+	}
+	if database != "" {
+		args = append(args, "--database", database)
+	}
+	var env []string
+	if account.Password != "" {
+		// Passed in the environment, an argument is visible to everyone through ps
+		env = append(env, fmt.Sprintf("CLICKHOUSE_PASSWORD=%s", account.Password))
+	}
+
+	return DBClientConfig{
+		Command:     "clickhouse-client",
+		Args:        args,
+		Env:         env,
+		ExitAliases: []string{"exit", "quit", "logout", "q", ":q", "\\q"},
+	}
+}
@@ -20,7 +20,7 @@ import (
 	"github.com/veops/oneterm/pkg/logger"
 )
 
-// connectDB connects to other protocols (Redis, MySQL, PostgreSQL, MongoDB etc.)
+// connectDB connects to other protocols (Redis, MySQL, PostgreSQL, MongoDB, SQL Server, Oracle, ClickHouse etc.)
 func connectDB(sess *gsession.Session, asset *model.Asset, account *model.Account, gateway *model.Gateway) (err error) {
 	chs := sess.Chans
 	defer func() {
@@ -52,15 +52,27 @@ func connectDB(sess *gsession.Session, asset *model.Asset, account *model.Accoun
 		clientConfig = getPostgreSQLConfig(ip, port, account)
 	case sess.IsMongo():
 		clientConfig = getMongoDBConfig(ip, port, account)
+	case strings.HasPrefix(sess.Protocol, "mssql"):
+		clientConfig = getMSSQLConfig(ip, port, account)
+	case strings.HasPrefix(sess.Protocol, "oracle"):
+		if clientConfig, err = getOracleConfig(ip, port, account); err != nil {
+			logger.L().Error("Failed to configure database client", zap.Error(err))
+			return err
+		}
+	case strings.HasPrefix(sess.Protocol, "clickhouse"):
+		clientConfig = getClickHouseConfig(ip, port, account)
 	default:
 		return fmt.Errorf("unsupported protocol: %s", sess.Protocol)
 	}
 
 	// Create command and pseudo-terminal
 	cmd := exec.CommandContext(sess.Gctx, clientConfig.Command, clientConfig.Args...)
-	cmd.Env = append(os.Environ(), "TERM=xterm-256color")
+	cmd.Env = append(append(os.Environ(), "TERM=xterm-256color"), clientConfig.Env...)
 	ptmx, err := pty.Start(cmd)
 	if err != nil {
+		if clientConfig.Cleanup != nil {
+			clientConfig.Cleanup()
+		}
 		logger.L().Error("Failed to start database client with pty", zap.Error(err), zap.String("command", clientConfig.Command))
 		return fmt.Errorf("failed to start %s: %w", clientConfig.Command, err)
 	}
@@ -83,6 +95,9 @@ func connectDB(sess *gsession.Session, asset *model.Asset, account *model.Accoun
 	// Monitor process exit
 	sess.G.Go(func() error {
 		err := cmd.Wait()
+		if clientConfig.Cleanup != nil {
+			clientConfig.Cleanup()
+		}
 
 		// Log process exit - only log as error if there was an actual error
 		if err != nil {
@@ -9,7 +9,9 @@ import (
 type DBClientConfig struct {
 	Command     string
 	Args        []string
+	Env         []string // Environment of the client, e.g. the password which must not show up in the arguments
 	ExitAliases []string
+	Cleanup     func() // Removes files of the client, e.g. a logon script, after it exits
 }
 
 // ConnectDB connects to a database with the given session, asset, account, and gateway
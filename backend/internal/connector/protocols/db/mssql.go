@@ -0,0 +1,31 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/veops/oneterm/internal/model"
+)
+
+// getMSSQLConfig returns SQL Server client configuration
+func getMSSQLConfig(ip string, port int, account *model.Account) DBClientConfig {
+	// The database may be given in the account like user/database
+	user, database, _ := strings.Cut(account.Account, "/")
+	// -C trusts the certificate of the server, which is self-signed by default
+	args := []string{"-S", fmt.Sprintf("%s,%d", ip, port), "-U", user, "-C"}
+	if database != "" {
+		args = append(args, "-d", database)
+	}
+	var env []string
+	if account.Password != "" {
+		// Passed in the environment, an argument is visible to everyone through ps
+		env = append(env, fmt.Sprintf("SQLCMDPASSWORD=%s", account.Password))
+	}
+
+	return DBClientConfig{
+		Command:     "sqlcmd",
+		Args:        args,
+		Env:         env,
+		ExitAliases: []string{"exit", "quit", ":exit", ":quit"},
+	}
+}
@@ -9,13 +9,16 @@ import (
 // getMySQLConfig returns MySQL client configuration
 func getMySQLConfig(ip string, port int, account *model.Account) DBClientConfig {
 	args := []string{"-h", ip, "-P", fmt.Sprintf("%d", port), "-u", account.Account}
+	var env []string
 	if account.Password != "" {
-		args = append(args, fmt.Sprintf("-p%s", account.Password))
+		// Passed in the environment, an argument is visible to everyone through ps
+		env = append(env, fmt.Sprintf("MYSQL_PWD=%s", account.Password))
 	}
 
 	return DBClientConfig{
 		Command:     "mysql",
 		Args:        args,
+		Env:         env,
 		ExitAliases: []string{"exit", "quit", "\\q"},
 	}
 }
@@ -0,0 +1,57 @@
+package db
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/veops/oneterm/internal/model"
+	"github.com/veops/oneterm/pkg/logger"
+)
+
+const oracleLogonPattern = "oneterm-oracle-"
+
+// init removes logon scripts left behind by a process which was killed before its clients exited
+func init() {
+	dirs, _ := filepath.Glob(filepath.Join(os.TempDir(), oracleLogonPattern+"*"))
+	for _, dir := range dirs {
+		if err := os.RemoveAll(dir); err != nil {
+			logger.L().Warn("Failed to remove oracle logon script", zap.String("dir", dir), zap.Error(err))
+		}
+	}
+}
+
+// getOracleConfig returns Oracle client configuration
+func getOracleConfig(ip string, port int, account *model.Account) (DBClientConfig, error) {
+	// The service name may be given in the account like user/service
+	user, service, _ := strings.Cut(account.Account, "/")
+	if service == "" {
+		service = "ORCL"
+	}
+
+	// sqlplus takes no password from the environment, and input to the pty would be echoed to the recording.
+	// So the logon is in a script only the client may read, which sqlplus runs before its prompt.
+	// Oracle passwords may contain any character but " when quoted, & is not taken as a substitution variable.
+	// The script removes itself as soon as sqlplus has opened it, Cleanup is left for a client which fails earlier.
+	dir, err := os.MkdirTemp("", oracleLogonPattern)
+	if err != nil {
+		return DBClientConfig{}, err
+	}
+	script := filepath.Join(dir, "logon.sql")
+	logon := fmt.Sprintf("SET DEFINE OFF\nHOST rm -rf '%s'\nWHENEVER SQLERROR EXIT FAILURE\nCONNECT %s/\"%s\"@//%s:%d/%s\nWHENEVER SQLERROR CONTINUE\nSET DEFINE ON\n",
+		strings.ReplaceAll(dir, "'", `'\''`), user, account.Password, ip, port, service)
+	if err = os.WriteFile(script, []byte(logon), 0600); err != nil {
+		os.RemoveAll(dir)
+		return DBClientConfig{}, err
+	}
+
+	return DBClientConfig{
+		Command:     "sqlplus",
+		Args:        []string{"-L", "/nolog", "@" + script},
+		ExitAliases: []string{"exit", "quit", "exit;", "quit;"},
+		Cleanup:     func() { os.RemoveAll(dir) },
+	}, nil
+}
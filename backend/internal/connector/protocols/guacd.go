@@ -3,6 +3,7 @@ package protocols
 import (
 	"fmt"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -67,6 +68,7 @@ func ConnectGuacd(ctx *gin.Context, sess *gsession.Session, asset *model.Asset,
 
 	sess.ConnectionId = t.ConnectionId
 	sess.GuacdTunnel = t
+	sess.SetWindow(w, h)
 
 	chs.ErrChan <- nil
 
@@ -78,6 +80,7 @@ func ConnectGuacd(ctx *gin.Context, sess *gsession.Session, asset *model.Asset,
 			default:
 				p, err := t.Read()
 				if err != nil {
+					sess.SetCloseReason(model.SESSIONCLOSE_REMOTE_EXIT)
 					return err
 				}
 				if len(p) <= 0 {
@@ -97,6 +100,7 @@ func ConnectGuacd(ctx *gin.Context, sess *gsession.Session, asset *model.Asset,
 				return ErrSessionClosed
 			case in := <-chs.InChan:
 				t.Write(in)
+				atomic.AddInt64(&sess.BytesIn, int64(len(in)))
 			}
 		}
 	})
@@ -112,6 +116,11 @@ func HandleGuacd(sess *gsession.Session) (err error) {
 		sess.GuacdTunnel.Disconnect()
 		sess.Status = model.SESSIONSTATUS_OFFLINE
 		sess.ClosedAt = lo.ToPtr(time.Now())
+		go func(sessionId string, createdAt time.Time) {
+			if err := gsession.FinalizeGuacdReplay(sessionId, createdAt); err != nil {
+				logger.L().Error("finalize guacd replay failed", zap.String("id", sessionId), zap.Error(err))
+			}
+		}(sess.SessionId, sess.CreatedAt)
 		if err = gsession.UpsertSession(sess); err != nil {
 			logger.L().Error("offline guacd session failed", zap.Error(err))
 			return
@@ -129,7 +138,11 @@ func HandleGuacd(sess *gsession.Session) (err error) {
 			case <-sess.Gctx.Done():
 				return nil
 			case <-sess.IdleTk.C:
+				sess.SetCloseReason(model.SESSIONCLOSE_IDLE_TIMEOUT)
 				return &myErrors.ApiError{Code: myErrors.ErrIdleTimeout, Data: map[string]any{"second": model.GlobalConfig.Load().Timeout}}
+			case <-sess.LifetimeC():
+				sess.SetCloseReason(model.SESSIONCLOSE_SESSION_TIMEOUT)
+				return &myErrors.ApiError{Code: myErrors.ErrSessionTimeout, Data: map[string]any{"second": int(sess.Lifetime.Seconds())}}
 			case <-tk.C:
 				asset, err := assetService.GetById(sess.Gctx, sess.AssetId)
 				if err != nil {
@@ -138,13 +151,17 @@ func HandleGuacd(sess *gsession.Session) (err error) {
 				if CheckTime(asset.AccessAuth) && (sess.ShareId == 0 || time.Now().Before(sess.ShareEnd)) {
 					continue
 				}
+				sess.SetCloseReason(model.SESSIONCLOSE_ACCESS_TIME)
 				return &myErrors.ApiError{Code: myErrors.ErrAccessTime}
 			case closeBy := <-chs.CloseChan:
+				sess.SetCloseReason(model.SESSIONCLOSE_ADMIN_CLOSE)
 				return &myErrors.ApiError{Code: myErrors.ErrAdminClose, Data: map[string]any{"admin": closeBy}}
 			case err := <-chs.ErrChan:
+				sess.SetCloseReason(model.SESSIONCLOSE_REMOTE_EXIT)
 				return err
 			case out := <-chs.OutChan:
 				sess.Ws.WriteMessage(websocket.TextMessage, out)
+				atomic.AddInt64(&sess.BytesOut, int64(len(out)))
 			}
 		}
 	})
@@ -2,15 +2,18 @@ package protocols
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"time"
 	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
+	"github.com/samber/lo"
 	"github.com/spf13/cast"
 	"go.uber.org/zap"
 	gossh "golang.org/x/crypto/ssh"
 
+	"github.com/veops/oneterm/internal/hostkey"
 	"github.com/veops/oneterm/internal/model"
 	"github.com/veops/oneterm/internal/repository"
 	gsession "github.com/veops/oneterm/internal/session"
@@ -18,6 +21,31 @@ import (
 	"github.com/veops/oneterm/pkg/logger"
 )
 
+// DialSsh dials the asset as the account through the gateway of the session
+func DialSsh(sessionId string, asset *model.Asset, account *model.Account, gateway *model.Gateway) (*gossh.Client, error) {
+	ip, port, err := tunneling.Proxy(false, sessionId, "ssh", asset, gateway)
+	if err != nil {
+		return nil, err
+	}
+
+	auth, err := repository.GetAuth(account)
+	if err != nil {
+		return nil, err
+	}
+
+	sshCli, err := gossh.Dial("tcp", fmt.Sprintf("%s:%d", ip, port), hostkey.Apply(&gossh.ClientConfig{
+		User:    account.Account,
+		Auth:    []gossh.AuthMethod{auth},
+		Timeout: time.Second,
+	}, model.KnownHostTargetAsset, asset.Id))
+	if err != nil {
+		logger.L().Error("ssh dial failed", zap.Error(err))
+		return nil, err
+	}
+
+	return sshCli, nil
+}
+
 // ConnectSsh connects to SSH server
 func ConnectSsh(ctx *gin.Context, sess *gsession.Session, asset *model.Asset, account *model.Account, gateway *model.Gateway) (err error) {
 	w, h := cast.ToInt(ctx.Query("w")), cast.ToInt(ctx.Query("h"))
@@ -28,27 +56,11 @@ func ConnectSsh(ctx *gin.Context, sess *gsession.Session, asset *model.Asset, ac
 		}
 	}()
 
-	ip, port, err := tunneling.Proxy(false, sess.SessionId, "ssh", asset, gateway)
+	sshCli, err := DialSsh(sess.SessionId, asset, account, gateway)
 	if err != nil {
 		return
 	}
 
-	auth, err := repository.GetAuth(account)
-	if err != nil {
-		return
-	}
-
-	sshCli, err := gossh.Dial("tcp", fmt.Sprintf("%s:%d", ip, port), &gossh.ClientConfig{
-		User:            account.Account,
-		Auth:            []gossh.AuthMethod{auth},
-		HostKeyCallback: gossh.InsecureIgnoreHostKey(),
-		Timeout:         time.Second,
-	})
-	if err != nil {
-		logger.L().Error("ssh dial failed", zap.Error(err))
-		return
-	}
-
 	// CRITICAL: Store SSH client in session for file transfer reuse
 	sess.SetSSHClient(sshCli)
 	logger.L().Info("SSH client stored in session for reuse", zap.String("sessionId", sess.SessionId))
@@ -80,6 +92,14 @@ func ConnectSsh(ctx *gin.Context, sess *gsession.Session, asset *model.Asset, ac
 
 	sess.G.Go(func() error {
 		err = sshSess.Wait()
+		var exitErr *gossh.ExitError
+		switch {
+		case err == nil:
+			sess.ExitCode = lo.ToPtr(0)
+		case errors.As(err, &exitErr):
+			sess.ExitCode = lo.ToPtr(exitErr.ExitStatus())
+		}
+		sess.SetCloseReason(model.SESSIONCLOSE_REMOTE_EXIT)
 		// Always close AwayChan when SSH session ends
 		sess.Once.Do(func() { close(chs.AwayChan) })
 		if err != nil {
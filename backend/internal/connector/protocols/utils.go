@@ -51,6 +51,16 @@ func WriteToMonitors(monitors *sync.Map, out []byte) {
 	})
 }
 
+// AlertMonitors notifies monitoring sessions that an audited command is executed
+func AlertMonitors(sess *gsession.Session, res *model.CommandCheckResult) {
+	logger.L().Warn("audited command executed",
+		zap.String("sessionId", sess.SessionId),
+		zap.String("user", sess.UserName),
+		zap.String("filter", res.Reason),
+		zap.String("risk", res.RiskLevel.Text()))
+	WriteToMonitors(sess.Monitors, []byte(fmt.Sprintf("\r\n \033[33m [%s] %s: %s \x1b[0m\r\n", res.RiskLevel.Text(), sess.UserName, res.Reason)))
+}
+
 // CheckTime checks if the current time is within the allowed time range
 func CheckTime(data model.AccessAuth) bool {
 	now := time.Now()
@@ -138,11 +148,17 @@ func Write(sess *gsession.Session, skipRecording ...bool) (err error) {
 	chs := sess.Chans
 	out := chs.OutBuf.Bytes()
 
-	if sess.SessionType == model.SESSIONTYPE_WEB && sess.Ws != nil {
+	if sess.SessionType == model.SESSIONTYPE_WEB {
 		if len(out) > 0 || sess.IsGuacd() {
 			wsWriteMutex.Lock()
 			defer wsWriteMutex.Unlock()
-			err = sess.Ws.WriteMessage(websocket.TextMessage, out)
+			// Output of a detached web terminal is kept until a websocket is attached
+			if ws := sess.GetWs(); !sess.KeepBacklog(out) && ws != nil {
+				if err = ws.WriteMessage(websocket.TextMessage, out); err != nil && sess.Detach(ws) {
+					sess.KeepBacklog(out)
+					err = nil
+				}
+			}
 		}
 	} else if sess.SessionType == model.SESSIONTYPE_CLIENT && len(out) > 0 {
 		_, err = sess.CliRw.Write(out)
@@ -160,6 +176,23 @@ func Write(sess *gsession.Session, skipRecording ...bool) (err error) {
 	return
 }
 
+// Attach attaches ws to a detached web terminal, the output kept while detached is sent first.
+// The returned channel is closed when ws is dropped.
+func Attach(sess *gsession.Session, ws *websocket.Conn) (<-chan struct{}, error) {
+	wsWriteMutex.Lock()
+	defer wsWriteMutex.Unlock()
+
+	backlog, detachC, err := sess.Attach(ws)
+	if err != nil {
+		return nil, err
+	}
+	if len(backlog) > 0 {
+		ws.WriteMessage(websocket.TextMessage, backlog)
+	}
+
+	return detachC, nil
+}
+
 // Read reads data from the session input
 func Read(sess *gsession.Session) error {
 	chs := sess.Chans
@@ -187,8 +220,13 @@ func Read(sess *gsession.Session) error {
 			case <-sess.Chans.AwayChan:
 				return nil
 			case err := <-errChan:
+				sess.SetCloseReason(model.SESSIONCLOSE_CLIENT_DISCONNECT)
 				return err
 			case p := <-readChan:
+				// The owner's keystrokes are dropped while a participant holds control
+				if !sess.Collab.IsController(sess.Uid) {
+					continue
+				}
 				chs.InChan <- p
 				sess.SetIdle()
 			}
@@ -204,8 +242,23 @@ func Read(sess *gsession.Session) error {
 			return nil
 		default:
 			if sess.SessionType == model.SESSIONTYPE_WEB {
-				t, msg, err := sess.Ws.ReadMessage()
+				ws := sess.GetWs()
+				if ws == nil {
+					if err := sess.WaitAttach(); err != nil {
+						sess.SetCloseReason(model.SESSIONCLOSE_CLIENT_DISCONNECT)
+						return err
+					}
+					continue
+				}
+				t, msg, err := ws.ReadMessage()
 				if err != nil {
+					// The session is kept for reattaching if the websocket of a web terminal is dropped
+					if sess.Detach(ws) {
+						continue
+					}
+					if sess.Gctx.Err() == nil {
+						sess.SetCloseReason(model.SESSIONCLOSE_CLIENT_DISCONNECT)
+					}
 					return err
 				}
 				if len(msg) <= 0 {
@@ -213,6 +266,9 @@ func Read(sess *gsession.Session) error {
 				}
 				switch t {
 				case websocket.TextMessage:
+					if msg[0] == '1' && !sess.IsGuacd() && !sess.Collab.IsController(sess.Uid) {
+						continue
+					}
 					chs.InChan <- msg
 					if msg[0] != '9' && ((sess.IsGuacd() && len(msg) > 0) || (!sess.IsGuacd() && IsActive(msg))) {
 						sess.SetIdle() // TODO: performance issue
@@ -0,0 +1,115 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samber/lo"
+	"go.uber.org/zap"
+
+	"github.com/veops/oneterm/internal/connector/protocols"
+	"github.com/veops/oneterm/internal/model"
+	"github.com/veops/oneterm/internal/service"
+	gsession "github.com/veops/oneterm/internal/session"
+	"github.com/veops/oneterm/internal/tunneling"
+	"github.com/veops/oneterm/pkg/logger"
+)
+
+// ProxyServe relays a database client to addr, the address of the asset, until either side quits.
+// It must return soon after ctx is done.
+type ProxyServe func(ctx context.Context, sess *gsession.Session, addr string, account *model.Account) error
+
+// DoProxy audits a connection of a database client, e.g. of the mysql proxy, as a session of the asset in the request.
+// Statements are checked and recorded by serve, the session is closed by the same policies as a terminal.
+func DoProxy(ctx *gin.Context, serve ProxyServe) (err error) {
+	sess, asset, account, gateway, err := newSession(ctx, nil)
+	if err != nil {
+		return
+	}
+	started := false
+	defer func() {
+		if sess.SshRecoder == nil {
+			return
+		}
+		if !started {
+			sess.SshRecoder.Discard()
+			return
+		}
+		if closeErr := sess.SshRecoder.Close(); closeErr != nil {
+			logger.L().Error("Failed to close proxy recorder", zap.String("sessionId", sess.SessionId), zap.Error(closeErr))
+		}
+	}()
+
+	if _, err = authorizeSession(ctx, sess, model.ActionConnect); err != nil {
+		return
+	}
+
+	if asset.GatewayId == 0 {
+		gateway = nil
+	}
+	defer tunneling.CloseTunnels(sess.SessionId)
+	ip, port, err := tunneling.Proxy(false, sess.SessionId, strings.Split(sess.Protocol, ":")[0], asset, gateway)
+	if err != nil {
+		return
+	}
+
+	started = true
+	gsession.GetOnlineSession().Store(sess.SessionId, sess)
+	gsession.UpsertSession(sess)
+	defer func() {
+		sess.Status = model.SESSIONSTATUS_OFFLINE
+		sess.ClosedAt = lo.ToPtr(time.Now())
+		sess.SetCloseReason(model.SESSIONCLOSE_CLIENT_DISCONNECT)
+		if upsertErr := gsession.UpsertSession(sess); upsertErr != nil {
+			logger.L().Error("upsert session failed", zap.Error(upsertErr))
+		}
+		gsession.GetOnlineSession().Delete(sess.SessionId)
+	}()
+
+	sctx, cancel := context.WithCancel(sess.Gctx)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		// A malformed packet must only break this session
+		defer func() {
+			if r := recover(); r != nil {
+				logger.L().Error("Recovered from panic in proxy", zap.String("sessionId", sess.SessionId), zap.Any("panic", r))
+				done <- fmt.Errorf("panic: %v", r)
+			}
+		}()
+		done <- serve(sctx, sess, net.JoinHostPort(ip, strconv.Itoa(port)), account)
+	}()
+
+	tk1m := time.NewTicker(time.Minute)
+	defer tk1m.Stop()
+	assetService := service.NewAssetService()
+	for {
+		select {
+		case err = <-done:
+			return
+		case <-sess.IdleTk.C:
+			logger.L().Info("proxy idle timeout", zap.String("sessionId", sess.SessionId))
+			sess.SetCloseReason(model.SESSIONCLOSE_IDLE_TIMEOUT)
+		case <-sess.LifetimeC():
+			logger.L().Info("proxy session timeout", zap.String("sessionId", sess.SessionId))
+			sess.SetCloseReason(model.SESSIONCLOSE_SESSION_TIMEOUT)
+		case closeBy := <-sess.Chans.CloseChan:
+			logger.L().Info("closed by", zap.String("admin", closeBy))
+			sess.SetCloseReason(model.SESSIONCLOSE_ADMIN_CLOSE)
+		case <-tk1m.C:
+			if asset, err := assetService.GetById(sess.Gctx, sess.AssetId); err != nil || protocols.CheckTime(asset.AccessAuth) {
+				continue
+			}
+			sess.SetCloseReason(model.SESSIONCLOSE_ACCESS_TIME)
+		}
+		// The client is cut off by a policy, errors of the relay are expected
+		cancel()
+		<-done
+		return nil
+	}
+}
@@ -0,0 +1,110 @@
+package connector
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samber/lo"
+
+	"github.com/veops/oneterm/internal/acl"
+	"github.com/veops/oneterm/internal/model"
+)
+
+// Target is an asset with the accounts a user may connect with, which clients of the ssh server and the database proxies
+// name at login, e.g. alice@web01#root
+type Target struct {
+	Asset    *model.Asset
+	Accounts []*model.Account
+}
+
+// SplitLoginUser splits a login user like alice@web01#root into the username, the asset and the account.
+// The account may be omitted, ok is false if there is no asset.
+func SplitLoginUser(user string) (username, asset, account string, ok bool) {
+	if i := strings.LastIndex(user, "#"); i >= 0 {
+		user, account = user[:i], user[i+1:]
+	}
+	i := strings.LastIndex(user, "@")
+	if i <= 0 || i == len(user)-1 {
+		return "", "", "", false
+	}
+	return user[:i], user[i+1:], account, true
+}
+
+// FindTarget finds the target whose asset has the name, or else the ip
+func FindTarget(targets []*Target, asset string) (*Target, bool) {
+	found, ok := lo.Find(targets, func(t *Target) bool { return t.Asset.Name == asset })
+	if !ok {
+		found, ok = lo.Find(targets, func(t *Target) bool {
+			return t.Asset.Ip == asset || strings.Split(t.Asset.Ip, ":")[0] == asset
+		})
+	}
+	return found, ok
+}
+
+// ResolveTarget finds the asset in targets, its account by name or the only one if account is empty,
+// and the protocol of the asset with its port, e.g. ssh:22
+func ResolveTarget(targets []*Target, asset, account, protocol string) (*model.Asset, *model.Account, string, error) {
+	found, ok := FindTarget(targets, asset)
+	if !ok {
+		return nil, nil, "", fmt.Errorf("asset %s not found or not authorized", asset)
+	}
+
+	var acc *model.Account
+	switch {
+	case account != "":
+		if acc, ok = lo.Find(found.Accounts, func(a *model.Account) bool { return a.Name == account }); !ok {
+			return nil, nil, "", fmt.Errorf("account %s of asset %s not found or not authorized", account, asset)
+		}
+	case len(found.Accounts) == 1:
+		acc = found.Accounts[0]
+	default:
+		return nil, nil, "", fmt.Errorf("asset %s has %d authorized accounts, please specify one with %s#account",
+			asset, len(found.Accounts), asset)
+	}
+
+	port, ok := lo.Find(found.Asset.Protocols, func(p string) bool { return strings.HasPrefix(p, protocol+":") })
+	if !ok {
+		return nil, nil, "", fmt.Errorf("asset %s does not support %s", asset, protocol)
+	}
+
+	return found.Asset, acc, port, nil
+}
+
+// NewGinContext creates a gin.Context carrying the login session of a client which does not connect over http,
+// i.e. of the ssh server or a database proxy
+func NewGinContext(remoteAddr net.Addr, rawQuery string, sess *acl.Session) *gin.Context {
+	ctx, _ := gin.CreateTestContext(&responseWriter{})
+	ctx.Request = &http.Request{
+		RemoteAddr: remoteAddr.String(),
+		URL:        &url.URL{RawQuery: rawQuery},
+		Header:     make(http.Header),
+		Method:     "GET",
+		Host:       "localhost",
+	}
+	ctx.Set("sessionType", model.SESSIONTYPE_CLIENT)
+	ctx.Set("session", sess)
+
+	return ctx
+}
+
+// responseWriter implements http.ResponseWriter for gin.CreateTestContext
+type responseWriter struct {
+	headers http.Header
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (w *responseWriter) WriteHeader(status int) {}
+
+func (w *responseWriter) Header() http.Header {
+	if w.headers == nil {
+		w.headers = make(http.Header)
+	}
+	return w.headers
+}
@@ -0,0 +1,238 @@
+package dbproxy
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samber/lo"
+	"github.com/spf13/cast"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/veops/oneterm/internal/acl"
+	"github.com/veops/oneterm/internal/connector"
+	"github.com/veops/oneterm/internal/connector/protocols"
+	"github.com/veops/oneterm/internal/model"
+	"github.com/veops/oneterm/internal/repository"
+	gsession "github.com/veops/oneterm/internal/session"
+	"github.com/veops/oneterm/pkg/config"
+	myErrors "github.com/veops/oneterm/pkg/errors"
+	"github.com/veops/oneterm/pkg/logger"
+	"github.com/veops/oneterm/pkg/utils"
+)
+
+var (
+	ctx, cancel = context.WithCancel(context.Background())
+
+	// tlsConfig is the certificate which clients upgrade their connections to the proxies with
+	tlsConfig = sync.OnceValues(func() (*tls.Config, error) {
+		cfg := config.Cfg.DbProxy
+		if cfg.CertFile != "" {
+			cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+			return &tls.Config{Certificates: []tls.Certificate{cert}}, err
+		}
+		cert, err := selfSignedCert()
+		return &tls.Config{Certificates: []tls.Certificate{cert}}, err
+	})
+)
+
+// proxy is a listener of a database protocol
+type proxy struct {
+	Protocol string // Protocol of assets, e.g. mysql
+	Port     int
+	Serve    func(conn net.Conn)
+}
+
+func proxies() []*proxy {
+	cfg := config.Cfg.DbProxy
+	return []*proxy{
+		{Protocol: "mysql", Port: cfg.Mysql, Serve: serveMysql},
+		{Protocol: "postgresql", Port: cfg.Postgresql, Serve: servePostgres},
+		{Protocol: "redis", Port: cfg.Redis, Serve: serveRedis},
+		{Protocol: "mongodb", Port: cfg.Mongodb, Serve: serveMongo},
+	}
+}
+
+// RunDbProxy listens for database clients on the ports of the enabled proxies until StopDbProxy
+func RunDbProxy() error {
+	g, gctx := errgroup.WithContext(ctx)
+	for _, p := range proxies() {
+		if p.Port <= 0 {
+			continue
+		}
+		ln, err := net.Listen("tcp", fmt.Sprintf("%s:%d", config.Cfg.DbProxy.Host, p.Port))
+		if err != nil {
+			return err
+		}
+		logger.L().Info("database proxy listening", zap.String("protocol", p.Protocol), zap.String("addr", ln.Addr().String()))
+		g.Go(func() error {
+			<-gctx.Done()
+			return ln.Close()
+		})
+		g.Go(func() error {
+			for {
+				conn, err := ln.Accept()
+				if err != nil {
+					if gctx.Err() != nil {
+						return nil
+					}
+					return err
+				}
+				go safely(func() error {
+					p.Serve(conn)
+					return nil
+				})
+			}
+		})
+	}
+	g.Go(func() error {
+		<-gctx.Done()
+		return nil
+	})
+
+	return g.Wait()
+}
+
+func StopDbProxy() {
+	cancel()
+}
+
+// safely runs fn of a connection and returns a panic of it as an error,
+// so a malformed packet only breaks its own connection
+func safely(fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.L().Error("Recovered from panic in database proxy", zap.Any("panic", r), zap.Stack("stack"))
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return fn()
+}
+
+// login authenticates a client of the proxy with the oneterm password of the user in a login user like alice@mysql01#root,
+// and returns the context with the params of the asset and the account DoProxy expects.
+// The account may be omitted if the asset has only one account.
+func login(conn net.Conn, protocol, user, password string) (*gin.Context, *acl.Session, error) {
+	username, target, account, ok := connector.SplitLoginUser(user)
+	if !ok {
+		return nil, nil, fmt.Errorf("invalid user %q, expected user@asset#account", user)
+	}
+
+	sess, err := acl.LoginByPassword(ctx, username, password, utils.IpFromNetAddr(conn.RemoteAddr()))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	gctx := connector.NewGinContext(conn.RemoteAddr(), "w=160&h=48", sess)
+	asset, acc, port, err := resolve(gctx, protocol, target, account)
+	if err != nil {
+		acl.Logout(sess)
+		return nil, nil, err
+	}
+	gctx.Params = gin.Params{
+		{Key: "account_id", Value: cast.ToString(acc.Id)},
+		{Key: "asset_id", Value: cast.ToString(asset.Id)},
+		{Key: "protocol", Value: port},
+	}
+
+	return gctx, sess, nil
+}
+
+// resolve finds the asset by name or ip, the account of the asset by name and the protocol with the port of the asset.
+// Whether the user may connect is checked when the session is created.
+func resolve(ctx *gin.Context, protocol, target, account string) (*model.Asset, *model.Account, string, error) {
+	assets, err := repository.GetAllFromCacheDb(ctx, model.DefaultAsset)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	accounts, err := repository.GetAllFromCacheDb(ctx, model.DefaultAccount)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	targets := lo.Map(assets, func(asset *model.Asset, _ int) *connector.Target {
+		return &connector.Target{
+			Asset:    asset,
+			Accounts: lo.Filter(accounts, func(a *model.Account, _ int) bool { _, ok := asset.Authorization[a.Id]; return ok }),
+		}
+	})
+	return connector.ResolveTarget(targets, target, account, protocol)
+}
+
+// record stores a statement of the session with the policy decision,
+// it is written with its result to the recording and monitors like typed to the command line client
+func record(sess *gsession.Session, client string, m *model.SessionCmd, res *model.CommandCheckResult) {
+	sess.SshParser.Record(m, res)
+	if res != nil && res.Action == model.CommandActionAudit {
+		protocols.AlertMonitors(sess, res)
+	}
+
+	out := []byte(fmt.Sprintf("%s> %s\r\n%s\r\n\r\n", client, strings.ReplaceAll(m.Cmd, "\n", "\r\n"), m.Result))
+	if sess.SshRecoder != nil {
+		sess.SshRecoder.Write(out)
+	}
+	protocols.WriteToMonitors(sess.Monitors, out)
+}
+
+// countReader counts bytes read through it
+type countReader struct {
+	io.Reader
+	n *int64
+}
+
+func (r *countReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	atomic.AddInt64(r.n, int64(n))
+	return n, err
+}
+
+// isTls tells whether conn is encrypted, which clients sending a password in clear text must be
+func isTls(conn net.Conn) bool {
+	_, ok := conn.(*tls.Conn)
+	return ok
+}
+
+// errMessage returns the message of err for clients of the proxy
+func errMessage(err error) string {
+	var ae *myErrors.ApiError
+	if errors.As(err, &ae) {
+		return ae.MessageWithCtx(nil)
+	}
+	return err.Error()
+}
+
+// selfSignedCert generates the certificate of the listeners if none is configured
+func selfSignedCert() (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "oneterm"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(10, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
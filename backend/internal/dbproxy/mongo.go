@@ -0,0 +1,407 @@
+package dbproxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/samber/lo"
+	"go.uber.org/zap"
+
+	"github.com/veops/oneterm/internal/acl"
+	"github.com/veops/oneterm/internal/connector"
+	"github.com/veops/oneterm/internal/model"
+	gsession "github.com/veops/oneterm/internal/session"
+	"github.com/veops/oneterm/pkg/logger"
+)
+
+const (
+	mongoHandshakeTimeout = time.Second * 30
+	mongoDialTimeout      = time.Second * 10
+	mongoMaxRecordLen     = 4096 // Longer commands and replies are cut in records
+)
+
+var (
+	mongoConnId atomic.Int32
+
+	// mongoHelloCmds are answered by the proxy, so drivers see a standalone server and connect to nothing else
+	mongoHelloCmds = []string{"hello", "isMaster", "ismaster"}
+	// mongoAuthCmds would change the user of an authenticated connection
+	mongoAuthCmds = []string{"saslStart", "saslContinue", "authenticate", "logout"}
+)
+
+// serveMongo authenticates a mongodb client with oneterm credentials and relays it to the asset as an audited session.
+// Clients authenticate with PLAIN, e.g. authMechanism=PLAIN&authSource=$external, as SCRAM does not reveal the password.
+func serveMongo(conn net.Conn) {
+	client := newMongoConn(conn)
+	defer func() { client.Close() }()
+	connId := mongoConnId.Add(1)
+
+	conn.SetDeadline(time.Now().Add(mongoHandshakeTimeout))
+	// Drivers start tls without asking, which is told by the record type of a tls handshake
+	if b, err := client.r.Peek(1); err == nil && b[0] == 0x16 {
+		cfg, err := tlsConfig()
+		if err != nil {
+			logger.L().Error("mongodb proxy tls config failed", zap.Error(err))
+			return
+		}
+		if err = client.upgrade(func(c net.Conn) *tls.Conn { return tls.Server(c, cfg) }); err != nil {
+			return
+		}
+	}
+	authMsg, user, password, err := client.handshake(connId)
+	if err != nil {
+		logger.L().Debug("mongodb proxy handshake failed", zap.String("remote", conn.RemoteAddr().String()), zap.Error(err))
+		return
+	}
+
+	ctx, aclSess, err := login(client, "mongodb", user, password)
+	if err != nil {
+		logger.L().Info("mongodb proxy login failed", zap.String("user", user), zap.Error(err))
+		client.reply(authMsg, mongoErrDoc(mongoErrAuthenticationFailed, "AuthenticationFailed", fmt.Sprintf("Authentication failed: %s", err)))
+		return
+	}
+	defer acl.Logout(aclSess)
+
+	accepted := false
+	err = connector.DoProxy(ctx, func(ctx context.Context, sess *gsession.Session, addr string, account *model.Account) error {
+		server, err := dialMongo(ctx, addr, account)
+		if err != nil {
+			return err
+		}
+		defer server.Close()
+
+		conn.SetDeadline(time.Time{})
+		if err = client.reply(authMsg, bsonDoc{{"conversationId", 1}, {"done", true}, {"payload", []byte{}}, {"ok", 1.0}}); err != nil {
+			return err
+		}
+		accepted = true
+		go func() {
+			<-ctx.Done()
+			client.Close()
+			server.Close()
+		}()
+
+		client.count(&sess.BytesIn)
+		server.count(&sess.BytesOut)
+		r := &mongoRelay{sess: sess, client: client, server: server, connId: connId, pending: map[int32]*mongoPending{}}
+		done := make(chan error, 2)
+		go func() {
+			err := safely(r.fromClient)
+			sess.SetCloseReason(model.SESSIONCLOSE_CLIENT_DISCONNECT)
+			done <- err
+		}()
+		go func() {
+			err := safely(r.fromServer)
+			sess.SetCloseReason(model.SESSIONCLOSE_REMOTE_EXIT)
+			done <- err
+		}()
+		err = <-done
+		client.Close()
+		server.Close()
+		<-done
+
+		return err
+	})
+	if err != nil {
+		logger.L().Info("mongodb proxy session failed", zap.String("user", user), zap.Error(err))
+		if !accepted {
+			client.reply(authMsg, mongoErrDoc(mongoErrAuthenticationFailed, "AuthenticationFailed", errMessage(err)))
+		}
+	}
+}
+
+// handshake answers the client until it starts PLAIN authentication, whose message is returned to be answered after the login.
+// Connections which monitor the server never authenticate, they ask hello only.
+func (c *mongoConn) handshake(connId int32) (auth *mongoMsg, user, password string, err error) {
+	for {
+		m, err := c.readMsg()
+		if err != nil {
+			return nil, "", "", err
+		}
+		if m.OpCode != mongoOpMsg && m.OpCode != mongoOpQuery {
+			return nil, "", "", fmt.Errorf("unsupported mongodb opcode %d", m.OpCode)
+		}
+
+		name := m.Body.Name()
+		switch {
+		case lo.Contains(mongoHelloCmds, name):
+			err = c.reply(m, mongoHello(m.Body, connId))
+		case name == "ping":
+			err = c.reply(m, bsonDoc{{"ok", 1.0}})
+		case name == "saslStart" && m.Body.String("mechanism") == "PLAIN" && !isTls(c.Conn):
+			// The password would be readable on the network
+			err = c.reply(m, mongoErrDoc(mongoErrAuthenticationFailed, "AuthenticationFailed", "PLAIN authentication requires tls, e.g. tls=true"))
+		case name == "saslStart" && m.Body.String("mechanism") == "PLAIN":
+			// authzid \0 authcid \0 password
+			if parts := bytes.Split(mongoPayload(m.Body), []byte{0}); len(parts) == 3 {
+				return m, string(parts[1]), string(parts[2]), nil
+			}
+			err = c.reply(m, mongoErrDoc(mongoErrAuthenticationFailed, "AuthenticationFailed", "invalid PLAIN payload"))
+		case name == "saslStart":
+			err = c.reply(m, mongoErrDoc(mongoErrAuthenticationFailed, "AuthenticationFailed",
+				"oneterm supports PLAIN authentication only, e.g. authMechanism=PLAIN&authSource=$external with tls"))
+		default:
+			err = c.reply(m, mongoErrDoc(mongoErrUnauthorized, "Unauthorized", fmt.Sprintf("command %s requires authentication", name)))
+		}
+		if err != nil {
+			return nil, "", "", err
+		}
+	}
+}
+
+// mongoHello answers hello of a driver as a standalone server
+func mongoHello(body bsonDoc, connId int32) bsonDoc {
+	doc := bsonDoc{
+		{lo.Ternary(body.Name() == "hello", "isWritablePrimary", "ismaster"), true},
+		{"maxBsonObjectSize", mongoMaxBsonSize},
+		{"maxMessageSizeBytes", mongoMaxMessageSize},
+		{"maxWriteBatchSize", mongoMaxWriteBatch},
+		{"localTime", time.Now()},
+		{"logicalSessionTimeoutMinutes", 30},
+		{"connectionId", connId},
+		{"minWireVersion", 0},
+		{"maxWireVersion", mongoMaxWireVersion},
+		{"readOnly", false},
+	}
+	if _, ok := body.Get("helloOk"); ok {
+		doc = append(doc, bsonElem{"helloOk", true})
+	}
+	if _, ok := body.Get("saslSupportedMechs"); ok {
+		doc = append(doc, bsonElem{"saslSupportedMechs", []string{"PLAIN"}})
+	}
+	return append(doc, bsonElem{"ok", 1.0})
+}
+
+// dialMongo logs in to addr as account, an account like user/db authenticates with db instead of admin
+func dialMongo(ctx context.Context, addr string, account *model.Account) (*mongoConn, error) {
+	user, db, _ := strings.Cut(account.Account, "/")
+	db = lo.Ternary(db == "", "admin", db)
+	server, hello, err := mongoDial(ctx, addr, db+"."+user)
+	if err != nil {
+		return nil, err
+	}
+	if account.Password == "" {
+		return server, nil
+	}
+
+	server.SetDeadline(time.Now().Add(mongoDialTimeout))
+	defer server.SetDeadline(time.Time{})
+	v, _ := hello.Get("saslSupportedMechs")
+	mechanisms, _ := v.([]any)
+	if err = server.auth(user, account.Password, db, lo.Map(mechanisms, func(m any, _ int) string { s, _ := m.(string); return s })); err != nil {
+		server.Close()
+		return nil, err
+	}
+	return server, nil
+}
+
+// mongoDial connects to addr with tls if the server does not answer isMaster in plain text, and returns the reply.
+// Only the first connection to a tunnel of a gateway is accepted, so tls servers are supported directly only.
+func mongoDial(ctx context.Context, addr, user string) (*mongoConn, bsonDoc, error) {
+	dialer := &net.Dialer{Timeout: mongoDialTimeout}
+	isMaster := bsonDoc{{"isMaster", 1}, {"saslSupportedMechs", user}, {"$db", "admin"}}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	server := newMongoConn(conn)
+	conn.SetDeadline(time.Now().Add(mongoDialTimeout))
+	if hello, err := server.command(isMaster); err == nil {
+		conn.SetDeadline(time.Time{})
+		return server, hello, nil
+	}
+	conn.Close()
+
+	if conn, err = dialer.DialContext(ctx, "tcp", addr); err != nil {
+		return nil, nil, err
+	}
+	server = newMongoConn(conn)
+	conn.SetDeadline(time.Now().Add(mongoDialTimeout))
+	err = server.upgrade(func(c net.Conn) *tls.Conn {
+		host, _, _ := net.SplitHostPort(addr)
+		return tls.Client(c, &tls.Config{ServerName: host, InsecureSkipVerify: true})
+	})
+	var hello bsonDoc
+	if err == nil {
+		hello, err = server.command(isMaster)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	server.SetDeadline(time.Time{})
+	return server, hello, nil
+}
+
+// mongoPending is a command whose reply from the server is pending
+type mongoPending struct {
+	Cmd   string
+	Check *model.CommandCheckResult
+	Start time.Time
+}
+
+// mongoRelay relays messages in both directions, commands are checked before and recorded with their replies
+type mongoRelay struct {
+	sess   *gsession.Session
+	client *mongoConn
+	server *mongoConn
+	connId int32
+
+	mu      sync.Mutex
+	pending map[int32]*mongoPending // By request id, which replies respond to
+	wmu     sync.Mutex              // The client is answered by the proxy as well as the server
+}
+
+// fromClient checks and forwards commands of the client to the server
+func (r *mongoRelay) fromClient() error {
+	for {
+		m, err := r.client.readMsg()
+		if err != nil {
+			return err
+		}
+		r.sess.SetIdle()
+
+		cmd := m.Command()
+		name := cmd.Name()
+		switch {
+		case (m.OpCode == mongoOpMsg || m.OpCode == mongoOpQuery) && lo.Contains(mongoHelloCmds, name):
+			err = r.reply(m, mongoHello(m.Body, r.connId))
+		case m.OpCode == mongoOpQuery:
+			err = r.reply(m, mongoErrDoc(mongoErrCommandNotSupported, "CommandNotSupported", "OP_QUERY is supported for hello only"))
+		case m.OpCode != mongoOpMsg:
+			return fmt.Errorf("unsupported mongodb opcode %d", m.OpCode)
+		default:
+			err = r.command(m, cmd)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (r *mongoRelay) command(m *mongoMsg, cmd bsonDoc) error {
+	name := cmd.Name()
+	collection := ""
+	if len(cmd) > 0 {
+		collection, _ = cmd[0].Value.(string)
+	}
+	p := &mongoPending{Cmd: mongoCommandLine(cmd), Start: time.Now()}
+	moreToCome := m.Flags&mongoMsgMoreToCome != 0
+
+	deny := ""
+	if lo.Contains(mongoAuthCmds, name) {
+		p.Check = &model.CommandCheckResult{Action: model.CommandActionDeny, Reason: name}
+		deny = fmt.Sprintf("%s is not allowed as the connection is authenticated by oneterm", name)
+	} else if p.Check = r.sess.SshParser.CheckMongo(collection, name, mongoStages(cmd)...); !p.Check.Allowed {
+		deny = fmt.Sprintf("command %s is forbidden by oneterm: %s", name, p.Check.Reason)
+	}
+	if deny != "" {
+		atomic.AddInt64(&r.sess.Forbidden, 1)
+		record(r.sess, "mongosh", &model.SessionCmd{Cmd: p.Cmd, Result: "MongoServerError[Unauthorized]: " + deny}, p.Check)
+		if moreToCome {
+			return nil
+		}
+		return r.reply(m, mongoErrDoc(mongoErrUnauthorized, "Unauthorized", deny))
+	}
+
+	switch {
+	case name == "ping":
+	case moreToCome:
+		// Unacknowledged, e.g. a write with w: 0
+		record(r.sess, "mongosh", &model.SessionCmd{Cmd: p.Cmd}, p.Check)
+	default:
+		r.mu.Lock()
+		r.pending[m.RequestId] = p
+		r.mu.Unlock()
+	}
+	_, err := r.server.Write(m.Raw)
+	return err
+}
+
+// reply answers a message of the client by the proxy
+func (r *mongoRelay) reply(m *mongoMsg, doc bsonDoc) error {
+	r.wmu.Lock()
+	defer r.wmu.Unlock()
+	return r.client.reply(m, doc)
+}
+
+// fromServer relays replies of the server to the client and records the commands they respond to
+func (r *mongoRelay) fromServer() error {
+	for {
+		m, err := r.server.readMsg()
+		if err != nil {
+			return err
+		}
+
+		r.mu.Lock()
+		p := r.pending[m.ResponseTo]
+		delete(r.pending, m.ResponseTo)
+		r.mu.Unlock()
+		if p != nil {
+			elapsed := time.Since(p.Start)
+			result, rows := mongoResult(m.Body)
+			record(r.sess, "mongosh", &model.SessionCmd{Cmd: p.Cmd, Result: result, RowCount: rows, Elapsed: elapsed.Milliseconds()}, p.Check)
+		}
+
+		r.wmu.Lock()
+		_, err = r.client.Write(m.Raw)
+		r.wmu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// mongoCommandLine formats a command like run in mongosh, fields which drivers add like lsid are left out
+func mongoCommandLine(cmd bsonDoc) string {
+	doc := lo.Filter(cmd, func(e bsonElem, _ int) bool {
+		return !strings.HasPrefix(e.Key, "$") && e.Key != "lsid" && e.Key != "txnNumber"
+	})
+	return fmt.Sprintf("db.getSiblingDB(%q).runCommand(%s)", cmd.String("$db"), formatBson(bsonDoc(doc), mongoMaxRecordLen))
+}
+
+// mongoStages returns the names of the stages of an aggregation
+func mongoStages(cmd bsonDoc) []string {
+	if cmd.Name() != "aggregate" {
+		return nil
+	}
+	v, _ := cmd.Get("pipeline")
+	stages, _ := v.([]any)
+	return lo.FilterMap(stages, func(s any, _ int) (string, bool) {
+		d, ok := s.(bsonDoc)
+		return d.Name(), ok && len(d) > 0
+	})
+}
+
+// mongoResult summarizes a reply like mongosh, with the documents returned or the ones written
+func mongoResult(doc bsonDoc) (string, int64) {
+	if err := mongoErr(doc); err != nil {
+		return fmt.Sprintf("MongoServerError[%s]: %s", doc.String("codeName"), doc.String("errmsg")), 0
+	}
+	n, _ := doc.Int("n")
+	if v, ok := doc.Get("writeErrors"); ok {
+		if errs, _ := v.([]any); len(errs) > 0 {
+			first, _ := errs[0].(bsonDoc)
+			return fmt.Sprintf("MongoBulkWriteError: %s (%d written, %d errors)", first.String("errmsg"), n, len(errs)), n
+		}
+	}
+	if v, ok := doc.Get("cursor"); ok {
+		cursor, _ := v.(bsonDoc)
+		batch, ok := cursor.Get("firstBatch")
+		if !ok {
+			batch, _ = cursor.Get("nextBatch")
+		}
+		docs, _ := batch.([]any)
+		return fmt.Sprintf("%d documents", len(docs)), int64(len(docs))
+	}
+
+	doc = lo.Filter(doc, func(e bsonElem, _ int) bool { return !strings.HasPrefix(e.Key, "$") && e.Key != "operationTime" })
+	return formatBson(doc, mongoMaxRecordLen), n
+}
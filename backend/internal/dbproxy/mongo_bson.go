@@ -0,0 +1,426 @@
+package dbproxy
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// bsonDoc is a bson document with the order of its fields, which tells the name of a command
+type bsonDoc []bsonElem
+
+type bsonElem struct {
+	Key   string
+	Value any
+}
+
+// Values of bson types which have no go counterpart
+type (
+	bsonBinary struct {
+		Subtype byte
+		Data    []byte
+	}
+	bsonObjectId  [12]byte
+	bsonTimestamp struct{ T, I uint32 }
+	bsonDecimal   [16]byte
+	bsonRegex     struct{ Pattern, Options string }
+	bsonOther     string // Deprecated types and min or max keys, as formatted
+)
+
+const (
+	bsonMaxDepth = 100 // The nesting depth of documents the server accepts
+)
+
+var (
+	errBsonShort = errors.New("bson is too short")
+	errBsonDeep  = errors.New("bson is nested too deeply")
+)
+
+// Get returns the value of the field key
+func (d bsonDoc) Get(key string) (any, bool) {
+	for _, e := range d {
+		if e.Key == key {
+			return e.Value, true
+		}
+	}
+	return nil, false
+}
+
+// String returns the value of the field key if it is a string
+func (d bsonDoc) String(key string) string {
+	v, _ := d.Get(key)
+	s, _ := v.(string)
+	return s
+}
+
+// Int returns the value of the field key if it is a number
+func (d bsonDoc) Int(key string) (int64, bool) {
+	v, _ := d.Get(key)
+	switch v := v.(type) {
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case float64:
+		return int64(v), true
+	}
+	return 0, false
+}
+
+// Name returns the first key, which is the name of a command
+func (d bsonDoc) Name() string {
+	if len(d) == 0 {
+		return ""
+	}
+	return d[0].Key
+}
+
+// appendBson encodes d, values are of the types parseBson returns, or int, []byte or []string for convenience
+func appendBson(dst []byte, d bsonDoc) []byte {
+	start := len(dst)
+	dst = append(dst, 0, 0, 0, 0)
+	for _, e := range d {
+		dst = appendBsonElem(dst, e.Key, e.Value)
+	}
+	dst = append(dst, 0)
+	binary.LittleEndian.PutUint32(dst[start:], uint32(len(dst)-start))
+	return dst
+}
+
+func appendBsonElem(dst []byte, key string, v any) []byte {
+	elem := func(t byte) {
+		dst = append(append(append(dst, t), key...), 0)
+	}
+	switch v := v.(type) {
+	case float64:
+		elem(0x01)
+		dst = binary.LittleEndian.AppendUint64(dst, math.Float64bits(v))
+	case string:
+		elem(0x02)
+		dst = binary.LittleEndian.AppendUint32(dst, uint32(len(v)+1))
+		dst = append(append(dst, v...), 0)
+	case bsonDoc:
+		elem(0x03)
+		dst = appendBson(dst, v)
+	case []any:
+		elem(0x04)
+		arr := make(bsonDoc, len(v))
+		for i, e := range v {
+			arr[i] = bsonElem{Key: strconv.Itoa(i), Value: e}
+		}
+		dst = appendBson(dst, arr)
+	case []string:
+		return appendBsonElem(dst, key, toAnys(v))
+	case bsonBinary:
+		elem(0x05)
+		dst = binary.LittleEndian.AppendUint32(dst, uint32(len(v.Data)))
+		dst = append(append(dst, v.Subtype), v.Data...)
+	case []byte:
+		return appendBsonElem(dst, key, bsonBinary{Data: v})
+	case bsonObjectId:
+		elem(0x07)
+		dst = append(dst, v[:]...)
+	case bool:
+		elem(0x08)
+		dst = append(dst, map[bool]byte{false: 0, true: 1}[v])
+	case time.Time:
+		elem(0x09)
+		dst = binary.LittleEndian.AppendUint64(dst, uint64(v.UnixMilli()))
+	case nil:
+		elem(0x0a)
+	case int32:
+		elem(0x10)
+		dst = binary.LittleEndian.AppendUint32(dst, uint32(v))
+	case int:
+		if v >= math.MinInt32 && v <= math.MaxInt32 {
+			return appendBsonElem(dst, key, int32(v))
+		}
+		return appendBsonElem(dst, key, int64(v))
+	case bsonTimestamp:
+		elem(0x11)
+		dst = binary.LittleEndian.AppendUint32(dst, v.I)
+		dst = binary.LittleEndian.AppendUint32(dst, v.T)
+	case int64:
+		elem(0x12)
+		dst = binary.LittleEndian.AppendUint64(dst, uint64(v))
+	default:
+		panic(fmt.Sprintf("bson: unsupported type %T", v))
+	}
+	return dst
+}
+
+func toAnys[T any](s []T) []any {
+	r := make([]any, len(s))
+	for i, v := range s {
+		r[i] = v
+	}
+	return r
+}
+
+// parseBson decodes a document at the start of b and returns its length
+func parseBson(b []byte) (bsonDoc, int, error) {
+	return parseBsonDoc(b, 0)
+}
+
+// parseBsonDoc decodes a document nested in depth documents
+func parseBsonDoc(b []byte, depth int) (bsonDoc, int, error) {
+	if depth >= bsonMaxDepth {
+		return nil, 0, errBsonDeep
+	}
+	if len(b) < 5 {
+		return nil, 0, errBsonShort
+	}
+	n := int(binary.LittleEndian.Uint32(b))
+	if n < 5 || n > len(b) || b[n-1] != 0 {
+		return nil, 0, fmt.Errorf("invalid bson length %d", n)
+	}
+
+	var d bsonDoc
+	for i := 4; i < n-1; {
+		t := b[i]
+		key, j, err := bsonCString(b[:n-1], i+1)
+		if err != nil {
+			return nil, 0, err
+		}
+		var v any
+		if v, i, err = parseBsonValue(b[:n-1], t, j, depth); err != nil {
+			return nil, 0, err
+		}
+		d = append(d, bsonElem{Key: key, Value: v})
+	}
+	return d, n, nil
+}
+
+// parseBsonValue decodes a value of type t at b[i:] of a document nested in depth documents, and returns the index after it
+func parseBsonValue(b []byte, t byte, i, depth int) (v any, end int, err error) {
+	need := func(n int) bool {
+		if n < 0 || i+n > len(b) {
+			err = errBsonShort
+			return false
+		}
+		return true
+	}
+	str := func() (string, bool) {
+		if !need(4) {
+			return "", false
+		}
+		n := int(int32(binary.LittleEndian.Uint32(b[i:])))
+		if i += 4; n < 1 || !need(n) {
+			err = errBsonShort
+			return "", false
+		}
+		s := string(b[i : i+n-1])
+		i += n
+		return s, true
+	}
+
+	switch t {
+	case 0x01:
+		if need(8) {
+			v, i = math.Float64frombits(binary.LittleEndian.Uint64(b[i:])), i+8
+		}
+	case 0x02, 0x0d, 0x0e:
+		var s string
+		if s, _ = str(); t == 0x02 {
+			v = s
+		} else {
+			v = bsonOther(fmt.Sprintf("Code(%s)", strconv.Quote(s)))
+		}
+	case 0x03, 0x04:
+		var (
+			d bsonDoc
+			n int
+		)
+		if d, n, err = parseBsonDoc(b[i:], depth+1); err != nil {
+			break
+		}
+		i += n
+		if v = d; t == 0x04 {
+			arr := make([]any, len(d))
+			for k, e := range d {
+				arr[k] = e.Value
+			}
+			v = arr
+		}
+	case 0x05:
+		if !need(5) {
+			break
+		}
+		n := int(int32(binary.LittleEndian.Uint32(b[i:])))
+		sub := b[i+4]
+		if i += 5; need(n) {
+			v, i = bsonBinary{Subtype: sub, Data: b[i : i+n]}, i+n
+		}
+	case 0x06:
+		v = bsonOther("undefined")
+	case 0x07:
+		if need(12) {
+			var id bsonObjectId
+			copy(id[:], b[i:])
+			v, i = id, i+12
+		}
+	case 0x08:
+		if need(1) {
+			v, i = b[i] != 0, i+1
+		}
+	case 0x09:
+		if need(8) {
+			v, i = time.UnixMilli(int64(binary.LittleEndian.Uint64(b[i:]))).UTC(), i+8
+		}
+	case 0x0a:
+	case 0x0b:
+		var re bsonRegex
+		if re.Pattern, i, err = bsonCString(b, i); err == nil {
+			re.Options, i, err = bsonCString(b, i)
+		}
+		v = re
+	case 0x0c:
+		if _, ok := str(); ok && need(12) {
+			v, i = bsonOther("DBPointer()"), i+12
+		}
+	case 0x0f:
+		if need(4) {
+			n := int(int32(binary.LittleEndian.Uint32(b[i:])))
+			if need(n) {
+				v, i = bsonOther("CodeWScope()"), i+n
+			}
+		}
+	case 0x10:
+		if need(4) {
+			v, i = int32(binary.LittleEndian.Uint32(b[i:])), i+4
+		}
+	case 0x11:
+		if need(8) {
+			v, i = bsonTimestamp{I: binary.LittleEndian.Uint32(b[i:]), T: binary.LittleEndian.Uint32(b[i+4:])}, i+8
+		}
+	case 0x12:
+		if need(8) {
+			v, i = int64(binary.LittleEndian.Uint64(b[i:])), i+8
+		}
+	case 0x13:
+		if need(16) {
+			var d bsonDecimal
+			copy(d[:], b[i:])
+			v, i = d, i+16
+		}
+	case 0xff:
+		v = bsonOther("MinKey()")
+	case 0x7f:
+		v = bsonOther("MaxKey()")
+	default:
+		err = fmt.Errorf("unknown bson type 0x%02x", t)
+	}
+	return v, i, err
+}
+
+func bsonCString(b []byte, i int) (string, int, error) {
+	for j := i; j < len(b); j++ {
+		if b[j] == 0 {
+			return string(b[i:j]), j + 1, nil
+		}
+	}
+	return "", 0, errBsonShort
+}
+
+// formatBson formats v like mongosh prints it, output longer than limit is cut
+func formatBson(v any, limit int) string {
+	f := &bsonFormatter{limit: limit}
+	f.format(v)
+	if f.sb.Len() > limit {
+		return f.sb.String()[:limit] + "..."
+	}
+	return f.sb.String()
+}
+
+type bsonFormatter struct {
+	sb    strings.Builder
+	limit int
+}
+
+func (f *bsonFormatter) format(v any) {
+	if f.sb.Len() > f.limit {
+		return
+	}
+	sb := &f.sb
+	switch v := v.(type) {
+	case bsonDoc:
+		sb.WriteString("{")
+		for i, e := range v {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			sb.WriteString(strconv.Quote(e.Key) + ": ")
+			f.format(e.Value)
+			if sb.Len() > f.limit {
+				return
+			}
+		}
+		sb.WriteString("}")
+	case []any:
+		sb.WriteString("[")
+		for i, e := range v {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			f.format(e)
+			if sb.Len() > f.limit {
+				return
+			}
+		}
+		sb.WriteString("]")
+	case string:
+		sb.WriteString(strconv.Quote(v))
+	case float64:
+		sb.WriteString(strconv.FormatFloat(v, 'g', -1, 64))
+	case int32, int64, bool:
+		fmt.Fprint(sb, v)
+	case nil:
+		sb.WriteString("null")
+	case time.Time:
+		fmt.Fprintf(sb, "ISODate(%q)", v.Format("2006-01-02T15:04:05.000Z"))
+	case bsonObjectId:
+		fmt.Fprintf(sb, "ObjectId(%q)", hex.EncodeToString(v[:]))
+	case bsonBinary:
+		fmt.Fprintf(sb, "BinData(%d, %q)", v.Subtype, base64.StdEncoding.EncodeToString(v.Data[:min(len(v.Data), f.limit)]))
+	case bsonTimestamp:
+		fmt.Fprintf(sb, "Timestamp(%d, %d)", v.T, v.I)
+	case bsonDecimal:
+		fmt.Fprintf(sb, "NumberDecimal(%q)", v.String())
+	case bsonRegex:
+		fmt.Fprintf(sb, "/%s/%s", v.Pattern, v.Options)
+	case bsonOther:
+		sb.WriteString(string(v))
+	}
+}
+
+// String formats a decimal128 as its significand and exponent, e.g. 15E-1
+func (d bsonDecimal) String() string {
+	lo, hi := binary.LittleEndian.Uint64(d[:8]), binary.LittleEndian.Uint64(d[8:])
+	sign := ""
+	if hi>>63 == 1 {
+		sign = "-"
+	}
+	switch {
+	case hi>>58&0x1f == 0x1f:
+		return "NaN"
+	case hi>>58&0x1f == 0x1e:
+		return sign + "Infinity"
+	case hi>>61&3 == 3:
+		// The significand would exceed 34 digits, which is non-canonical and taken as 0
+		return sign + "0E" + strconv.Itoa(int(hi>>47&0x3fff)-6176)
+	}
+	exp := int(hi>>49&0x3fff) - 6176
+	sig := new(big.Int).Lsh(new(big.Int).SetUint64(hi&(1<<49-1)), 64)
+	sig.Or(sig, new(big.Int).SetUint64(lo))
+	if exp == 0 {
+		return sign + sig.String()
+	}
+	return fmt.Sprintf("%s%sE%+d", sign, sig.String(), exp)
+}
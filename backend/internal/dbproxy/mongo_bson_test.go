@@ -0,0 +1,106 @@
+package dbproxy
+
+import (
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// nestedBson returns a document with depth documents nested in it
+func nestedBson(depth int) []byte {
+	d := bsonDoc{{"x", 1}}
+	for i := 0; i < depth; i++ {
+		d = bsonDoc{{"d", d}}
+	}
+	return appendBson(nil, d)
+}
+
+func TestParseBson(t *testing.T) {
+	at := time.UnixMilli(1700000000123).UTC()
+	doc := bsonDoc{
+		{"find", "users"},
+		{"filter", bsonDoc{{"age", bsonDoc{{"$gt", int32(18)}}}}},
+		{"projection", []any{"a", int64(1), 1.5, nil, true}},
+		{"id", bsonObjectId{1, 2, 3}},
+		{"at", at},
+		{"bin", bsonBinary{Subtype: 4, Data: []byte{1, 2}}},
+		{"ts", bsonTimestamp{T: 7, I: 8}},
+	}
+	b := appendBson(nil, doc)
+	got, n, err := parseBson(append(b, 0xaa))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(b) || !reflect.DeepEqual(got, doc) {
+		t.Errorf("parseBson() = %v, %d, want %v, %d", got, n, doc, len(b))
+	}
+	if got.Name() != "find" || got.String("find") != "users" {
+		t.Errorf("Name() = %q, String() = %q", got.Name(), got.String("find"))
+	}
+
+	if _, _, err = parseBson(nestedBson(bsonMaxDepth - 1)); err != nil {
+		t.Errorf("parseBson() of %d nested documents: %v", bsonMaxDepth-1, err)
+	}
+	if _, _, err = parseBson(nestedBson(bsonMaxDepth)); !errors.Is(err, errBsonDeep) {
+		t.Errorf("parseBson() of %d nested documents: %v, want %v", bsonMaxDepth, err, errBsonDeep)
+	}
+}
+
+func TestParseBsonMalformed(t *testing.T) {
+	str := appendBson(nil, bsonDoc{{"s", "abc"}})
+	negative := append([]byte{}, str...)
+	binary.LittleEndian.PutUint32(negative[7:], 0xffffffff)
+	oversized := append([]byte{}, str...)
+	binary.LittleEndian.PutUint32(oversized[7:], 1000)
+	bin := appendBson(nil, bsonDoc{{"b", []byte{1, 2, 3}}})
+	binary.LittleEndian.PutUint32(bin[7:], 0x7fffffff)
+
+	tests := []struct {
+		name string
+		b    []byte
+	}{
+		{name: "empty", b: nil},
+		{name: "short", b: []byte{5, 0, 0}},
+		{name: "length beyond input", b: []byte{10, 0, 0, 0, 0}},
+		{name: "length below minimum", b: []byte{4, 0, 0, 0, 0}},
+		{name: "negative length", b: []byte{0xff, 0xff, 0xff, 0xff, 0}},
+		{name: "unterminated", b: []byte{5, 0, 0, 0, 1}},
+		{name: "unterminated key", b: []byte{7, 0, 0, 0, 0x10, 'a', 0}},
+		{name: "truncated int", b: []byte{9, 0, 0, 0, 0x10, 'a', 0, 1, 0}},
+		{name: "negative string length", b: negative},
+		{name: "string beyond document", b: oversized},
+		{name: "binary beyond document", b: bin},
+		{name: "truncated nested document", b: []byte{12, 0, 0, 0, 0x03, 'd', 0, 9, 0, 0, 0, 0}},
+		{name: "unknown type", b: []byte{8, 0, 0, 0, 0x20, 'a', 0, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if d, _, err := parseBson(tt.b); err == nil {
+				t.Errorf("parseBson(%x) = %v, want an error", tt.b, d)
+			}
+		})
+	}
+}
+
+func TestFormatBson(t *testing.T) {
+	tests := []struct {
+		name  string
+		v     any
+		limit int
+		want  string
+	}{
+		{name: "document", v: bsonDoc{{"a", int32(1)}, {"b", []any{"x", nil, false}}}, limit: 100, want: `{"a": 1, "b": ["x", null, false]}`},
+		{name: "object id", v: bsonObjectId{0xab}, limit: 100, want: `ObjectId("ab0000000000000000000000")`},
+		{name: "date", v: time.UnixMilli(0).UTC(), limit: 100, want: `ISODate("1970-01-01T00:00:00.000Z")`},
+		{name: "cut", v: bsonDoc{{"a", "0123456789"}}, limit: 8, want: `{"a": "0...`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatBson(tt.v, tt.limit); got != tt.want {
+				t.Errorf("formatBson() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
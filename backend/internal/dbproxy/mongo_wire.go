@@ -0,0 +1,347 @@
+package dbproxy
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net"
+	"strings"
+	"sync/atomic"
+
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/text/secure/precis"
+)
+
+// Opcodes and flags of the mongodb wire protocol
+const (
+	mongoOpReply = 1
+	mongoOpQuery = 2004
+	mongoOpMsg   = 2013
+
+	mongoMsgChecksumPresent = 1 << 0
+	mongoMsgMoreToCome      = 1 << 1
+
+	mongoHeaderLen      = 16
+	mongoMaxMessageSize = 48000000
+	mongoMaxBsonSize    = 16 * 1024 * 1024
+	mongoMaxWriteBatch  = 100000
+	mongoMaxWireVersion = 17 // MongoDB 6.0, servers of older versions reject what they do not support
+
+	mongoErrUnauthorized         = 13
+	mongoErrAuthenticationFailed = 18
+	mongoErrCommandNotSupported  = 115
+)
+
+// mongoMsg is a message of the mongodb wire protocol
+type mongoMsg struct {
+	RequestId  int32
+	ResponseTo int32
+	OpCode     int32
+	Flags      uint32  // Of OP_MSG
+	Body       bsonDoc // The body of OP_MSG, the query of OP_QUERY, or the first document of OP_REPLY
+	Seqs       bsonDoc // Document sequences of OP_MSG, e.g. documents of an insert
+	Collection string  // Of OP_QUERY, e.g. admin.$cmd
+	Raw        []byte
+}
+
+// mongoConn reads and writes messages of the mongodb wire protocol
+type mongoConn struct {
+	net.Conn
+	r         *bufio.Reader
+	requestId atomic.Int32
+}
+
+func newMongoConn(conn net.Conn) *mongoConn {
+	return &mongoConn{Conn: conn, r: bufio.NewReader(conn)}
+}
+
+// upgrade switches the connection to tls
+func (c *mongoConn) upgrade(wrap func(net.Conn) *tls.Conn) error {
+	conn := wrap(&bufferedConn{Conn: c.Conn, r: c.r})
+	if err := conn.Handshake(); err != nil {
+		return err
+	}
+	c.Conn, c.r = conn, bufio.NewReader(conn)
+	return nil
+}
+
+// count adds bytes read from now on to n
+func (c *mongoConn) count(n *int64) {
+	c.r = bufio.NewReader(&countReader{Reader: c.r, n: n})
+}
+
+// readMsg reads a message, its documents are decoded for OP_MSG, OP_QUERY and OP_REPLY
+func (c *mongoConn) readMsg() (*mongoMsg, error) {
+	header := make([]byte, mongoHeaderLen)
+	if _, err := io.ReadFull(c.r, header); err != nil {
+		return nil, err
+	}
+	n := int(int32(binary.LittleEndian.Uint32(header)))
+	if n < mongoHeaderLen || n > mongoMaxMessageSize {
+		return nil, fmt.Errorf("invalid mongodb message length %d", n)
+	}
+	m := &mongoMsg{
+		RequestId:  int32(binary.LittleEndian.Uint32(header[4:])),
+		ResponseTo: int32(binary.LittleEndian.Uint32(header[8:])),
+		OpCode:     int32(binary.LittleEndian.Uint32(header[12:])),
+		Raw:        append(header, make([]byte, n-mongoHeaderLen)...),
+	}
+	if _, err := io.ReadFull(c.r, m.Raw[mongoHeaderLen:]); err != nil {
+		return nil, err
+	}
+
+	return m, m.parse()
+}
+
+func (m *mongoMsg) parse() (err error) {
+	b := m.Raw[mongoHeaderLen:]
+	switch m.OpCode {
+	case mongoOpMsg:
+		if len(b) < 4 {
+			return errBsonShort
+		}
+		m.Flags = binary.LittleEndian.Uint32(b)
+		if b = b[4:]; m.Flags&mongoMsgChecksumPresent != 0 && len(b) >= 4 {
+			b = b[:len(b)-4]
+		}
+		for len(b) > 0 {
+			kind := b[0]
+			b = b[1:]
+			switch kind {
+			case 0:
+				var n int
+				if m.Body, n, err = parseBson(b); err != nil {
+					return err
+				}
+				b = b[n:]
+			case 1:
+				if len(b) < 4 {
+					return errBsonShort
+				}
+				size := int(int32(binary.LittleEndian.Uint32(b)))
+				if size < 5 || size > len(b) {
+					return errBsonShort
+				}
+				id, i, err := bsonCString(b[:size], 4)
+				if err != nil {
+					return err
+				}
+				var docs []any
+				for i < size {
+					d, n, err := parseBson(b[i:size])
+					if err != nil {
+						return err
+					}
+					docs, i = append(docs, d), i+n
+				}
+				m.Seqs = append(m.Seqs, bsonElem{Key: id, Value: docs})
+				b = b[size:]
+			default:
+				return fmt.Errorf("unknown op_msg section kind %d", kind)
+			}
+		}
+	case mongoOpQuery:
+		var i int
+		if len(b) < 4 {
+			return errBsonShort
+		}
+		if m.Collection, i, err = bsonCString(b, 4); err != nil {
+			return err
+		}
+		if i += 8; i > len(b) {
+			return errBsonShort
+		}
+		m.Body, _, err = parseBson(b[i:])
+	case mongoOpReply:
+		if len(b) < 20 {
+			return errBsonShort
+		}
+		if binary.LittleEndian.Uint32(b[16:]) > 0 {
+			m.Body, _, err = parseBson(b[20:])
+		}
+	}
+	return err
+}
+
+// Command returns the body of an OP_MSG with its document sequences, as they are fields of the command
+func (m *mongoMsg) Command() bsonDoc {
+	if len(m.Seqs) == 0 {
+		return m.Body
+	}
+	return append(append(bsonDoc{}, m.Body...), m.Seqs...)
+}
+
+// newMongoMsg encodes an OP_MSG with body
+func newMongoMsg(requestId, responseTo int32, body bsonDoc) []byte {
+	b := mongoHeader(requestId, responseTo, mongoOpMsg)
+	b = binary.LittleEndian.AppendUint32(b, 0)
+	b = appendBson(append(b, 0), body)
+	binary.LittleEndian.PutUint32(b, uint32(len(b)))
+	return b
+}
+
+// newMongoReply encodes an OP_REPLY with doc, which answers OP_QUERY
+func newMongoReply(requestId, responseTo int32, doc bsonDoc) []byte {
+	b := mongoHeader(requestId, responseTo, mongoOpReply)
+	b = binary.LittleEndian.AppendUint32(b, 0)
+	b = binary.LittleEndian.AppendUint64(b, 0)
+	b = binary.LittleEndian.AppendUint32(b, 0)
+	b = binary.LittleEndian.AppendUint32(b, 1)
+	b = appendBson(b, doc)
+	binary.LittleEndian.PutUint32(b, uint32(len(b)))
+	return b
+}
+
+func mongoHeader(requestId, responseTo int32, opCode int32) []byte {
+	b := make([]byte, 4, 64)
+	b = binary.LittleEndian.AppendUint32(b, uint32(requestId))
+	b = binary.LittleEndian.AppendUint32(b, uint32(responseTo))
+	return binary.LittleEndian.AppendUint32(b, uint32(opCode))
+}
+
+// reply answers m with doc in the opcode m expects
+func (c *mongoConn) reply(m *mongoMsg, doc bsonDoc) error {
+	id := c.requestId.Add(1)
+	if m.OpCode == mongoOpQuery {
+		_, err := c.Write(newMongoReply(id, m.RequestId, doc))
+		return err
+	}
+	_, err := c.Write(newMongoMsg(id, m.RequestId, doc))
+	return err
+}
+
+// command runs a command on the server and returns the reply, which is an error if not ok
+func (c *mongoConn) command(body bsonDoc) (bsonDoc, error) {
+	id := c.requestId.Add(1)
+	if _, err := c.Write(newMongoMsg(id, 0, body)); err != nil {
+		return nil, err
+	}
+	m, err := c.readMsg()
+	if err != nil {
+		return nil, err
+	}
+	if m.OpCode != mongoOpMsg || m.ResponseTo != id {
+		return nil, fmt.Errorf("unexpected mongodb reply of opcode %d", m.OpCode)
+	}
+	return m.Body, mongoErr(m.Body)
+}
+
+// mongoErr returns the error of a reply which is not ok
+func mongoErr(doc bsonDoc) error {
+	if ok, _ := doc.Int("ok"); ok == 1 {
+		return nil
+	}
+	msg := doc.String("errmsg")
+	if name := doc.String("codeName"); name != "" {
+		msg = fmt.Sprintf("%s: %s", name, msg)
+	}
+	return errors.New(msg)
+}
+
+// mongoErrDoc is a reply of an error like the server sends
+func mongoErrDoc(code int, codeName, msg string) bsonDoc {
+	return bsonDoc{{"ok", 0.0}, {"errmsg", msg}, {"code", code}, {"codeName", codeName}}
+}
+
+// auth authenticates the connection as user of db with SCRAM, SHA-256 is used if the server supports it
+func (c *mongoConn) auth(user, password, db string, mechanisms []string) error {
+	mechanism, h := "SCRAM-SHA-1", sha1.New
+	if strings.Contains(strings.Join(mechanisms, ","), "SCRAM-SHA-256") {
+		mechanism, h = "SCRAM-SHA-256", sha256.New
+		if p, err := precis.OpaqueString.String(password); err == nil {
+			password = p
+		}
+	} else {
+		// SCRAM-SHA-1 of mongodb hashes the password like MONGODB-CR
+		sum := md5.Sum([]byte(user + ":mongo:" + password))
+		password = hex.EncodeToString(sum[:])
+	}
+
+	nonce := make([]byte, 24)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	clientNonce := base64.StdEncoding.EncodeToString(nonce)
+	username := strings.NewReplacer("=", "=3D", ",", "=2C").Replace(user)
+	clientFirst := fmt.Sprintf("n=%s,r=%s", username, clientNonce)
+	reply, err := c.command(bsonDoc{
+		{"saslStart", 1}, {"mechanism", mechanism}, {"payload", []byte("n,," + clientFirst)},
+		{"autoAuthorize", 1}, {"options", bsonDoc{{"skipEmptyExchange", true}}}, {"$db", db},
+	})
+	if err != nil {
+		return err
+	}
+	serverFirst := string(mongoPayload(reply))
+	attrs := scramAttrs(serverFirst)
+	salt, err := base64.StdEncoding.DecodeString(attrs["s"])
+	if err != nil {
+		return fmt.Errorf("invalid scram salt: %w", err)
+	}
+	iterations := 0
+	fmt.Sscan(attrs["i"], &iterations)
+	if !strings.HasPrefix(attrs["r"], clientNonce) || iterations < 4096 {
+		return errors.New("invalid scram server first message")
+	}
+
+	salted := pbkdf2.Key([]byte(password), salt, iterations, h().Size(), h)
+	clientFinal := "c=biws,r=" + attrs["r"]
+	authMessage := clientFirst + "," + serverFirst + "," + clientFinal
+	clientKey := scramHmac(h, salted, "Client Key")
+	storedKey := h()
+	storedKey.Write(clientKey)
+	proof := xorBytes(clientKey, scramHmac(h, storedKey.Sum(nil), authMessage))
+	serverSig := scramHmac(h, scramHmac(h, salted, "Server Key"), authMessage)
+
+	conversationId, _ := reply.Get("conversationId")
+	reply, err = c.command(bsonDoc{
+		{"saslContinue", 1}, {"conversationId", conversationId},
+		{"payload", []byte(clientFinal + ",p=" + base64.StdEncoding.EncodeToString(proof))}, {"$db", db},
+	})
+	if err != nil {
+		return err
+	}
+	if v := scramAttrs(string(mongoPayload(reply)))["v"]; v != base64.StdEncoding.EncodeToString(serverSig) {
+		return errors.New("invalid scram server signature")
+	}
+	for done, _ := reply.Get("done"); done != true; done, _ = reply.Get("done") {
+		if reply, err = c.command(bsonDoc{{"saslContinue", 1}, {"conversationId", conversationId}, {"payload", []byte{}}, {"$db", db}}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// mongoPayload returns the payload of a sasl reply
+func mongoPayload(doc bsonDoc) []byte {
+	v, _ := doc.Get("payload")
+	b, _ := v.(bsonBinary)
+	return b.Data
+}
+
+func scramAttrs(msg string) map[string]string {
+	attrs := map[string]string{}
+	for _, kv := range strings.Split(msg, ",") {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			attrs[k] = v
+		}
+	}
+	return attrs
+}
+
+func scramHmac(h func() hash.Hash, key []byte, msg string) []byte {
+	mac := hmac.New(h, key)
+	mac.Write([]byte(msg))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,549 @@
+package dbproxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/samber/lo"
+	"go.uber.org/zap"
+
+	"github.com/veops/oneterm/internal/acl"
+	"github.com/veops/oneterm/internal/connector"
+	"github.com/veops/oneterm/internal/model"
+	gsession "github.com/veops/oneterm/internal/session"
+	"github.com/veops/oneterm/pkg/logger"
+)
+
+// Commands of the mysql protocol
+const (
+	comQuit             = 0x01
+	comInitDB           = 0x02
+	comQuery            = 0x03
+	comFieldList        = 0x04
+	comRefresh          = 0x07
+	comStatistics       = 0x09
+	comProcessKill      = 0x0c
+	comDebug            = 0x0d
+	comPing             = 0x0e
+	comStmtPrepare      = 0x16
+	comStmtExecute      = 0x17
+	comStmtSendLongData = 0x18
+	comStmtClose        = 0x19
+	comStmtReset        = 0x1a
+	comSetOption        = 0x1b
+	comStmtFetch        = 0x1c
+	comResetConnection  = 0x1f
+)
+
+var (
+	mysqlConnId atomic.Uint32
+
+	// mysqlRsaKey is the key clients without tls encrypt their password with
+	mysqlRsaKey = sync.OnceValues(func() (*rsa.PrivateKey, error) {
+		return rsa.GenerateKey(rand.Reader, 2048)
+	})
+)
+
+// serveMysql authenticates a mysql client with oneterm credentials and relays it to the asset as an audited session
+func serveMysql(conn net.Conn) {
+	client := newMysqlConn(conn)
+	defer func() { client.Close() }()
+
+	conn.SetDeadline(time.Now().Add(mysqlHandshakeTimeout))
+	auth, err := client.handshake()
+	if err != nil {
+		logger.L().Debug("mysql proxy handshake failed", zap.String("remote", conn.RemoteAddr().String()), zap.Error(err))
+		return
+	}
+
+	ctx, aclSess, err := login(client, "mysql", auth.User, auth.Password)
+	if err != nil {
+		logger.L().Info("mysql proxy login failed", zap.String("user", auth.User), zap.Error(err))
+		client.writeErr(mysqlErrAccessDenied, mysqlStateAccessDenied, fmt.Sprintf("Access denied for user '%s': %s", auth.User, err))
+		return
+	}
+	defer acl.Logout(aclSess)
+
+	accepted := false
+	err = connector.DoProxy(ctx, func(ctx context.Context, sess *gsession.Session, addr string, account *model.Account) error {
+		server, err := dialMysql(ctx, addr, account, auth)
+		if err != nil {
+			return err
+		}
+		defer server.Close()
+
+		conn.SetDeadline(time.Time{})
+		if err = client.writeOK(); err != nil {
+			return err
+		}
+		accepted = true
+		go func() {
+			<-ctx.Done()
+			client.Close()
+			server.Close()
+		}()
+
+		r := &mysqlRelay{sess: sess, client: client, server: server, stmts: map[uint32]string{}}
+		err = r.run()
+		sess.SetCloseReason(lo.Ternary(server.broken, model.SESSIONCLOSE_REMOTE_EXIT, model.SESSIONCLOSE_CLIENT_DISCONNECT))
+		return err
+	})
+	if err != nil {
+		logger.L().Info("mysql proxy session failed", zap.String("user", auth.User), zap.Error(err))
+		if !accepted {
+			client.writeErr(mysqlErrUnknown, mysqlStateUnknown, errMessage(err))
+		}
+	}
+}
+
+// handshake authenticates the client as the server with caching_sha2_password.
+// The password is always asked for in full, it is sent over tls or encrypted with the rsa key of the proxy.
+func (c *mysqlConn) handshake() (auth *mysqlAuth, err error) {
+	scramble := make([]byte, 20)
+	if _, err = rand.Read(scramble); err != nil {
+		return
+	}
+	for i, b := range scramble {
+		// Printable without \0 which clients take as the end of the scramble
+		scramble[i] = b%94 + 33
+	}
+
+	// Protocol::HandshakeV10
+	capabilities := uint32(mysqlProxyCapabilities | clientSSL)
+	hs := append([]byte{10}, mysqlServerVersion...)
+	hs = binary.LittleEndian.AppendUint32(append(hs, 0), mysqlConnId.Add(1))
+	hs = append(append(hs, scramble[:8]...), 0)
+	hs = binary.LittleEndian.AppendUint16(hs, uint16(capabilities))
+	hs = append(hs, mysqlCharsetUtf8mb4)
+	hs = binary.LittleEndian.AppendUint16(hs, serverStatusAutocommit)
+	hs = binary.LittleEndian.AppendUint16(hs, uint16(capabilities>>16))
+	hs = append(append(hs, byte(len(scramble)+1)), make([]byte, 10)...)
+	hs = append(append(hs, scramble[8:]...), 0)
+	hs = append(append(hs, mysqlCachingSha2Password...), 0)
+	c.seq = 0
+	if err = c.writePacket(hs); err != nil {
+		return
+	}
+	if err = c.flush(); err != nil {
+		return
+	}
+
+	payload, _, err := c.readPacket()
+	if err != nil {
+		return
+	}
+	r := &mysqlReader{b: payload}
+	flags := r.uint32()
+	if flags&clientProtocol41 == 0 {
+		c.writeErr(mysqlErrUnknown, mysqlStateUnknown, "protocol 4.1 is required")
+		return nil, errors.New("client without protocol 4.1")
+	}
+	if flags&clientSSL != 0 && len(payload) == 32 {
+		// Protocol::SSLRequest, the handshake response follows over tls
+		cfg, err := tlsConfig()
+		if err != nil {
+			return nil, err
+		}
+		if err = c.upgrade(func(conn net.Conn) *tls.Conn { return tls.Server(conn, cfg) }); err != nil {
+			return nil, err
+		}
+		if payload, _, err = c.readPacket(); err != nil {
+			return nil, err
+		}
+		r = &mysqlReader{b: payload}
+		flags = r.uint32()
+	}
+
+	// Protocol::HandshakeResponse41
+	auth = &mysqlAuth{Capabilities: flags & capabilities &^ clientSSL}
+	r.uint32()
+	auth.Charset = byte(uint32n(r.next(1)))
+	r.next(23)
+	auth.User = r.cstring()
+	var data []byte
+	switch {
+	case flags&clientPluginAuthLenencData != 0:
+		data = r.next(int(r.lenenc()))
+	case flags&clientSecureConn != 0:
+		data = r.next(int(uint32n(r.next(1))))
+	default:
+		data = []byte(r.cstring())
+	}
+	if flags&clientConnectWithDB != 0 {
+		auth.Db = r.cstring()
+	}
+	plugin := mysqlNativePassword
+	if flags&clientPluginAuth != 0 {
+		plugin = r.cstring()
+	}
+	if r.err != nil {
+		c.writeErr(mysqlErrUnknown, mysqlStateUnknown, "malformed handshake response")
+		return nil, r.err
+	}
+
+	switch plugin {
+	case mysqlClearPassword:
+		// The password would be readable on the network
+		if !c.tls {
+			c.writeErr(mysqlErrAccessDenied, mysqlStateAccessDenied, "Access denied, mysql_clear_password requires ssl")
+			return nil, errors.New("mysql_clear_password without tls")
+		}
+		auth.Password = string(bytes.TrimSuffix(data, []byte{0}))
+		return
+	case mysqlCachingSha2Password:
+	default:
+		// Protocol::AuthSwitchRequest
+		req := append(append([]byte{mysqlAuthSwitch}, mysqlCachingSha2Password...), 0)
+		req = append(append(req, scramble...), 0)
+		if err = c.writePacket(req); err != nil {
+			return
+		}
+		if err = c.flush(); err != nil {
+			return
+		}
+		// The response is empty for an empty password
+		if data, _, err = c.readPayload(); err != nil {
+			return
+		}
+	}
+	if len(data) == 0 {
+		// An empty password
+		return
+	}
+
+	// Full authentication of caching_sha2_password
+	if err = c.writePacket([]byte{mysqlAuthMoreData, mysqlPerformFullAuth}); err != nil {
+		return
+	}
+	if err = c.flush(); err != nil {
+		return
+	}
+	if data, _, err = c.readPacket(); err != nil {
+		return
+	}
+	if c.tls {
+		auth.Password = string(bytes.TrimSuffix(data, []byte{0}))
+		return
+	}
+
+	key, err := mysqlRsaKey()
+	if err != nil {
+		return
+	}
+	if len(data) == 1 && data[0] == mysqlRequestPublicKey {
+		der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		pemData := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+		if err = c.writePacket(append([]byte{mysqlAuthMoreData}, pemData...)); err != nil {
+			return nil, err
+		}
+		if err = c.flush(); err != nil {
+			return nil, err
+		}
+		if data, _, err = c.readPacket(); err != nil {
+			return nil, err
+		}
+	}
+	plain, err := rsa.DecryptOAEP(sha1.New(), nil, key, data, nil)
+	if err != nil {
+		c.writeErr(mysqlErrAccessDenied, mysqlStateAccessDenied, "Access denied, please connect with ssl or allow public key retrieval")
+		return nil, err
+	}
+	auth.Password = string(bytes.TrimSuffix(xorScramble(plain, scramble), []byte{0}))
+
+	return
+}
+
+// mysqlRelay relays commands of the client to the server, statements are checked before and recorded after they are executed
+type mysqlRelay struct {
+	sess   *gsession.Session
+	client *mysqlConn
+	server *mysqlConn
+	stmts  map[uint32]string // Prepared statements by id
+}
+
+// mysqlResult is the summary of the response to a statement
+type mysqlResult struct {
+	Sets     int
+	Rows     int64
+	Affected int64
+	Err      string
+	Cursor   bool // Rows are fetched with COM_STMT_FETCH
+}
+
+// Summary formats the result like the mysql client
+func (m *mysqlResult) Summary(elapsed time.Duration) string {
+	sec := fmt.Sprintf("(%.2f sec)", elapsed.Seconds())
+	switch {
+	case m.Err != "":
+		return fmt.Sprintf("ERROR %s", m.Err)
+	case m.Sets > 0:
+		return fmt.Sprintf("%d %s in set %s", m.Rows, lo.Ternary(m.Rows == 1, "row", "rows"), sec)
+	}
+	return fmt.Sprintf("Query OK, %d %s affected %s", m.Affected, lo.Ternary(m.Affected == 1, "row", "rows"), sec)
+}
+
+// RowCount returns the rows returned, or affected if no rows are returned
+func (m *mysqlResult) RowCount() int64 {
+	return lo.Ternary(m.Sets > 0, m.Rows, m.Affected)
+}
+
+func (r *mysqlRelay) run() error {
+	for {
+		payload, raw, err := r.client.readPacket()
+		if err != nil {
+			return nil
+		}
+		r.sess.SetIdle()
+		if len(payload) == 0 {
+			return errors.New("empty mysql command")
+		}
+
+		switch payload[0] {
+		case comQuit:
+			return nil
+		case comQuery:
+			err = r.statement(string(payload[1:]), raw, false)
+		case comInitDB:
+			err = r.statement(fmt.Sprintf("USE `%s`", strings.ReplaceAll(string(payload[1:]), "`", "``")), raw, false)
+		case comStmtPrepare:
+			err = r.prepare(string(payload[1:]), raw)
+		case comStmtExecute:
+			err = r.execute(payload, raw)
+		case comStmtFetch:
+			if err = r.forward(raw); err == nil {
+				_, err = r.rows(&mysqlResult{})
+				err = r.endReply(err)
+			}
+		case comStmtClose:
+			delete(r.stmts, uint32n(payload[1:min(5, len(payload))]))
+			err = r.forward(raw)
+		case comStmtSendLongData:
+			// No response
+			err = r.forward(raw)
+		case comFieldList:
+			if err = r.forward(raw); err == nil {
+				err = r.until(func(p []byte) bool { return isMysqlEOF(p) || p[0] == mysqlERR })
+			}
+		case comPing, comStatistics, comStmtReset, comSetOption, comResetConnection, comRefresh, comDebug, comProcessKill:
+			if err = r.forward(raw); err == nil {
+				err = r.until(func([]byte) bool { return true })
+			}
+		default:
+			// e.g. COM_CHANGE_USER, which would log in again without oneterm, or binlog and replication
+			err = r.client.writeErr(mysqlErrUnknownCommand, mysqlStateCommand, fmt.Sprintf("Command 0x%02x is not supported by oneterm", payload[0]))
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// statement checks and executes a text statement, i.e. COM_QUERY or COM_INIT_DB
+func (r *mysqlRelay) statement(query string, raw []byte, binary bool) error {
+	res := r.sess.SshParser.CheckSQL(query, gsession.SQLMySQL)
+	if !res.Allowed {
+		return r.deny(query, res)
+	}
+
+	start := time.Now()
+	if err := r.forward(raw); err != nil {
+		return err
+	}
+	result, err := r.results(binary)
+	if err != nil {
+		return err
+	}
+	elapsed := time.Since(start)
+	record(r.sess, "mysql", &model.SessionCmd{Cmd: query, Result: result.Summary(elapsed), RowCount: result.RowCount(), Elapsed: elapsed.Milliseconds()}, res)
+
+	return nil
+}
+
+// prepare checks and prepares a statement, it is recorded when executed
+func (r *mysqlRelay) prepare(query string, raw []byte) error {
+	res := r.sess.SshParser.CheckSQL(query, gsession.SQLMySQL)
+	if !res.Allowed {
+		return r.deny(query, res)
+	}
+
+	if err := r.forward(raw); err != nil {
+		return err
+	}
+	payload, err := r.reply()
+	if err != nil || payload[0] != mysqlOK {
+		return r.endReply(err)
+	}
+
+	// COM_STMT_PREPARE_OK is followed by the definitions of the params and the columns, each ended with EOF
+	p := &mysqlReader{b: payload[1:]}
+	id, columns, params := p.uint32(), p.uint16(), p.uint16()
+	r.stmts[id] = query
+	for _, n := range []uint16{params, columns} {
+		if n == 0 {
+			continue
+		}
+		for i := 0; i <= int(n); i++ {
+			if _, err = r.reply(); err != nil {
+				return err
+			}
+		}
+	}
+	return r.endReply(nil)
+}
+
+// execute executes a prepared statement and records it
+func (r *mysqlRelay) execute(payload, raw []byte) error {
+	id := uint32n(payload[1:min(5, len(payload))])
+	query, ok := r.stmts[id]
+	if !ok {
+		query = fmt.Sprintf("EXECUTE %d", id)
+	}
+
+	start := time.Now()
+	if err := r.forward(raw); err != nil {
+		return err
+	}
+	result, err := r.results(true)
+	if err != nil {
+		return err
+	}
+	elapsed := time.Since(start)
+	record(r.sess, "mysql", &model.SessionCmd{Cmd: query, Result: result.Summary(elapsed), RowCount: result.RowCount(), Elapsed: elapsed.Milliseconds()}, nil)
+
+	return nil
+}
+
+// deny answers a forbidden statement with an error instead of executing it
+func (r *mysqlRelay) deny(query string, res *model.CommandCheckResult) error {
+	atomic.AddInt64(&r.sess.Forbidden, 1)
+	msg := fmt.Sprintf("Statement is forbidden by oneterm: %s", res.Reason)
+	record(r.sess, "mysql", &model.SessionCmd{Cmd: query, Result: fmt.Sprintf("ERROR %d (%s): %s", mysqlErrSpecificAccess, mysqlStateSyntaxOrAccess, msg)}, res)
+	return r.client.writeErr(mysqlErrSpecificAccess, mysqlStateSyntaxOrAccess, msg)
+}
+
+// results relays the response to a statement, which is OK, ERR or result sets, more of them follow if the status tells
+func (r *mysqlRelay) results(binary bool) (result *mysqlResult, err error) {
+	result = &mysqlResult{}
+	defer func() { err = r.endReply(err) }()
+
+	for {
+		payload, err := r.reply()
+		if err != nil {
+			return nil, err
+		}
+
+		var status uint16
+		switch payload[0] {
+		case mysqlOK:
+			p := &mysqlReader{b: payload[1:]}
+			result.Affected += int64(p.lenenc())
+			p.lenenc()
+			status = p.uint16()
+		case mysqlERR:
+			result.Err = parseMysqlErr(payload)
+			return result, nil
+		case mysqlLocalInfile:
+			return nil, errors.New("LOAD DATA LOCAL is not supported by oneterm")
+		default:
+			// Column count, the column definitions and EOF, then the rows and EOF
+			result.Sets++
+			n := (&mysqlReader{b: payload}).lenenc()
+			for i := uint64(0); i <= n; i++ {
+				if payload, err = r.reply(); err != nil {
+					return nil, err
+				}
+			}
+			status = (&mysqlReader{b: payload[min(3, len(payload)):]}).uint16()
+			if binary && status&serverStatusCursorExists != 0 {
+				result.Cursor = true
+				return result, nil
+			}
+			if status, err = r.rows(result); err != nil || result.Err != "" {
+				return result, err
+			}
+		}
+		if status&serverMoreResultsExists == 0 {
+			return result, nil
+		}
+	}
+}
+
+// rows relays rows until EOF and returns its status
+func (r *mysqlRelay) rows(result *mysqlResult) (status uint16, err error) {
+	for {
+		payload, err := r.reply()
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case isMysqlEOF(payload):
+			return (&mysqlReader{b: payload[min(3, len(payload)):]}).uint16(), nil
+		case payload[0] == mysqlERR:
+			result.Err = parseMysqlErr(payload)
+			return 0, nil
+		}
+		result.Rows++
+	}
+}
+
+// until relays packets until the last one
+func (r *mysqlRelay) until(last func(payload []byte) bool) (err error) {
+	defer func() { err = r.endReply(err) }()
+	for {
+		payload, err := r.reply()
+		if err != nil || last(payload) {
+			return err
+		}
+	}
+}
+
+// forward sends a command of the client to the server
+func (r *mysqlRelay) forward(raw []byte) error {
+	atomic.AddInt64(&r.sess.BytesIn, int64(len(raw)))
+	if err := r.server.writeRaw(raw); err != nil {
+		return err
+	}
+	return r.server.flush()
+}
+
+// reply relays a packet of the server to the client, which is sent when the response ends
+func (r *mysqlRelay) reply() ([]byte, error) {
+	payload, raw, err := r.server.readPacket()
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) == 0 {
+		return nil, errors.New("empty mysql packet")
+	}
+	atomic.AddInt64(&r.sess.BytesOut, int64(len(raw)))
+	return payload, r.client.writeRaw(raw)
+}
+
+// endReply sends the response to the client
+func (r *mysqlRelay) endReply(err error) error {
+	if err != nil {
+		return err
+	}
+	return r.client.flush()
+}
+
+func isMysqlEOF(payload []byte) bool {
+	return payload[0] == mysqlEOF && len(payload) < 9
+}
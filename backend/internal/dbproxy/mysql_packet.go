@@ -0,0 +1,518 @@
+package dbproxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/veops/oneterm/internal/model"
+)
+
+// Capabilities of the mysql protocol
+const (
+	clientLongPassword         = 1 << 0
+	clientFoundRows            = 1 << 1
+	clientLongFlag             = 1 << 2
+	clientConnectWithDB        = 1 << 3
+	clientIgnoreSpace          = 1 << 8
+	clientProtocol41           = 1 << 9
+	clientInteractive          = 1 << 10
+	clientSSL                  = 1 << 11
+	clientTransactions         = 1 << 13
+	clientSecureConn           = 1 << 15
+	clientMultiStatements      = 1 << 16
+	clientMultiResults         = 1 << 17
+	clientPSMultiResults       = 1 << 18
+	clientPluginAuth           = 1 << 19
+	clientPluginAuthLenencData = 1 << 21
+
+	// mysqlProxyCapabilities leaves out what changes the packets the proxy parses, e.g. CLIENT_DEPRECATE_EOF,
+	// or what an older server may not support, e.g. CLIENT_SESSION_TRACK
+	mysqlProxyCapabilities = clientLongPassword | clientFoundRows | clientLongFlag | clientConnectWithDB | clientIgnoreSpace |
+		clientProtocol41 | clientInteractive | clientTransactions | clientSecureConn | clientMultiStatements |
+		clientMultiResults | clientPSMultiResults | clientPluginAuth | clientPluginAuthLenencData
+)
+
+// Status flags and packets of the mysql protocol
+const (
+	serverStatusAutocommit   = 0x0002
+	serverMoreResultsExists  = 0x0008
+	serverStatusCursorExists = 0x0040
+
+	mysqlOK               = 0x00
+	mysqlERR              = 0xff
+	mysqlEOF              = 0xfe
+	mysqlLocalInfile      = 0xfb
+	mysqlAuthMoreData     = 0x01
+	mysqlAuthSwitch       = 0xfe
+	mysqlRequestPublicKey = 0x02
+	mysqlFastAuthSuccess  = 0x03
+	mysqlPerformFullAuth  = 0x04
+
+	mysqlNativePassword      = "mysql_native_password"
+	mysqlCachingSha2Password = "caching_sha2_password"
+	mysqlSha256Password      = "sha256_password"
+	mysqlClearPassword       = "mysql_clear_password"
+)
+
+// Errors the proxy answers with
+const (
+	mysqlErrAccessDenied     = 1045
+	mysqlErrUnknownCommand   = 1047
+	mysqlErrUnknown          = 1105
+	mysqlErrSpecificAccess   = 1227
+	mysqlStateAccessDenied   = "28000"
+	mysqlStateCommand        = "08S01"
+	mysqlStateUnknown        = "HY000"
+	mysqlStateSyntaxOrAccess = "42000"
+)
+
+const (
+	mysqlServerVersion    = "8.0.36-oneterm"
+	mysqlCharsetUtf8mb4   = 45 // utf8mb4_general_ci, known to 5.x and 8.x
+	mysqlMaxPacket        = 1<<24 - 1
+	mysqlPacketHeaderLen  = 4
+	mysqlHandshakeTimeout = time.Second * 30
+	mysqlDialTimeout      = time.Second * 10
+)
+
+// mysqlConn reads and writes packets of the mysql protocol
+type mysqlConn struct {
+	net.Conn
+	r      *bufio.Reader
+	w      *bufio.Writer
+	seq    byte
+	tls    bool
+	broken bool // A read or write failed
+}
+
+func newMysqlConn(conn net.Conn) *mysqlConn {
+	return &mysqlConn{Conn: conn, r: bufio.NewReader(conn), w: bufio.NewWriter(conn)}
+}
+
+// upgrade switches the connection to tls after the ssl request
+func (c *mysqlConn) upgrade(wrap func(net.Conn) *tls.Conn) error {
+	// The tls handshake may follow the ssl request in the buffer already
+	conn := wrap(&bufferedConn{Conn: c.Conn, r: c.r})
+	if err := conn.Handshake(); err != nil {
+		return err
+	}
+	c.Conn, c.r, c.w, c.tls = conn, bufio.NewReader(conn), bufio.NewWriter(conn), true
+	return nil
+}
+
+// bufferedConn reads what is buffered before the connection
+type bufferedConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+var (
+	errMysqlMalformed = errors.New("malformed mysql packet")
+)
+
+// readPacket reads a payload which starts with its type, so it must not be empty, and returns the raw packets as well
+func (c *mysqlConn) readPacket() (payload, raw []byte, err error) {
+	if payload, raw, err = c.readPayload(); err == nil && len(payload) == 0 {
+		c.broken, err = true, errMysqlMalformed
+	}
+	return
+}
+
+// readPayload reads a payload, which is split into packets of 16M, and returns the raw packets as well
+func (c *mysqlConn) readPayload() (payload, raw []byte, err error) {
+	defer func() { c.broken = c.broken || err != nil }()
+
+	header := make([]byte, mysqlPacketHeaderLen)
+	for {
+		if _, err = io.ReadFull(c.r, header); err != nil {
+			return
+		}
+		n := int(uint32(header[0]) | uint32(header[1])<<8 | uint32(header[2])<<16)
+		c.seq = header[3] + 1
+		data := make([]byte, n)
+		if _, err = io.ReadFull(c.r, data); err != nil {
+			return
+		}
+		payload = append(payload, data...)
+		raw = append(append(raw, header...), data...)
+		if n < mysqlMaxPacket {
+			return
+		}
+	}
+}
+
+// writePacket writes a payload with the next sequence id, it is sent on flush
+func (c *mysqlConn) writePacket(payload []byte) (err error) {
+	defer func() { c.broken = c.broken || err != nil }()
+
+	for {
+		n := min(len(payload), mysqlMaxPacket)
+		header := []byte{byte(n), byte(n >> 8), byte(n >> 16), c.seq}
+		c.seq++
+		if _, err = c.w.Write(header); err != nil {
+			return
+		}
+		if _, err = c.w.Write(payload[:n]); err != nil {
+			return
+		}
+		if payload = payload[n:]; n < mysqlMaxPacket {
+			return
+		}
+	}
+}
+
+// writeRaw writes packets read from the other side of the proxy, it is sent on flush
+func (c *mysqlConn) writeRaw(raw []byte) (err error) {
+	_, err = c.w.Write(raw)
+	c.broken = c.broken || err != nil
+	return
+}
+
+func (c *mysqlConn) flush() (err error) {
+	err = c.w.Flush()
+	c.broken = c.broken || err != nil
+	return
+}
+
+// writeOK writes an OK packet and flushes
+func (c *mysqlConn) writeOK() error {
+	if err := c.writePacket([]byte{mysqlOK, 0, 0, serverStatusAutocommit, 0, 0, 0}); err != nil {
+		return err
+	}
+	return c.flush()
+}
+
+// writeErr writes an ERR packet and flushes
+func (c *mysqlConn) writeErr(code uint16, state, msg string) error {
+	payload := []byte{mysqlERR, byte(code), byte(code >> 8), '#'}
+	payload = append(append(payload, state...), msg...)
+	if err := c.writePacket(payload); err != nil {
+		return err
+	}
+	return c.flush()
+}
+
+// mysqlReader reads the fields of a payload, err is set once a field is out of the payload
+type mysqlReader struct {
+	b   []byte
+	err error
+}
+
+// next reads n bytes, the rest of the payload is dropped if there are less of them or n is negative
+func (r *mysqlReader) next(n int) []byte {
+	if n < 0 || n > len(r.b) {
+		r.b, r.err = nil, errMysqlMalformed
+		return nil
+	}
+	bs := r.b[:n]
+	r.b = r.b[n:]
+	return bs
+}
+
+func (r *mysqlReader) uint16() uint16 {
+	return uint16(uint32n(r.next(2)))
+}
+
+func (r *mysqlReader) uint32() uint32 {
+	return uint32n(r.next(4))
+}
+
+// lenenc reads a length-encoded integer
+func (r *mysqlReader) lenenc() uint64 {
+	bs := r.next(1)
+	if len(bs) == 0 {
+		return 0
+	}
+	switch bs[0] {
+	case 0xfc:
+		return uint64(uint32n(r.next(2)))
+	case 0xfd:
+		return uint64(uint32n(r.next(3)))
+	case 0xfe:
+		bs := append(r.next(8), make([]byte, 8)...)
+		return binary.LittleEndian.Uint64(bs)
+	}
+	return uint64(bs[0])
+}
+
+// cstring reads a null-terminated string
+func (r *mysqlReader) cstring() string {
+	i := bytes.IndexByte(r.b, 0)
+	if i < 0 {
+		return string(r.next(len(r.b)))
+	}
+	s := string(r.b[:i])
+	r.b = r.b[i+1:]
+	return s
+}
+
+func uint32n(bs []byte) (n uint32) {
+	for i, b := range bs {
+		n |= uint32(b) << (8 * i)
+	}
+	return
+}
+
+// appendLenenc appends a length-encoded integer
+func appendLenenc(b []byte, n uint64) []byte {
+	switch {
+	case n < 0xfb:
+		return append(b, byte(n))
+	case n < 1<<16:
+		return append(b, 0xfc, byte(n), byte(n>>8))
+	case n < 1<<24:
+		return append(b, 0xfd, byte(n), byte(n>>8), byte(n>>16))
+	}
+	return binary.LittleEndian.AppendUint64(append(b, 0xfe), n)
+}
+
+// parseMysqlErr returns the message of an ERR packet like the mysql client prints it
+func parseMysqlErr(payload []byte) string {
+	r := &mysqlReader{b: payload[1:]}
+	code := r.uint16()
+	if len(r.b) > 0 && r.b[0] == '#' {
+		r.next(1)
+		return fmt.Sprintf("%d (%s): %s", code, r.next(5), r.b)
+	}
+	return fmt.Sprintf("%d: %s", code, r.b)
+}
+
+// mysqlAuth is the credentials the client of the proxy logs in with
+type mysqlAuth struct {
+	User         string
+	Password     string
+	Db           string
+	Capabilities uint32
+	Charset      byte
+}
+
+// dialMysql connects to addr and logs in as account with the capabilities and the database the client of the proxy asked for
+func dialMysql(ctx context.Context, addr string, account *model.Account, auth *mysqlAuth) (c *mysqlConn, err error) {
+	dialer := &net.Dialer{Timeout: mysqlDialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return
+	}
+	c = newMysqlConn(conn)
+	defer func() {
+		if err != nil {
+			conn.Close()
+		}
+	}()
+	conn.SetDeadline(time.Now().Add(mysqlHandshakeTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	payload, _, err := c.readPacket()
+	if err != nil {
+		return
+	}
+	if payload[0] == mysqlERR {
+		return nil, errors.New(parseMysqlErr(payload))
+	}
+
+	// Protocol::HandshakeV10
+	r := &mysqlReader{b: payload[1:]}
+	r.cstring()
+	r.uint32()
+	scramble := bytes.Clone(r.next(8))
+	r.next(1)
+	capabilities := uint32(r.uint16())
+	r.next(3)
+	capabilities |= uint32(r.uint16()) << 16
+	authLen := int(uint32n(r.next(1)))
+	r.next(10)
+	if capabilities&clientSecureConn != 0 {
+		scramble = append(scramble, r.next(max(13, authLen-8)-1)...)
+		r.next(1)
+	}
+	plugin := mysqlNativePassword
+	if capabilities&clientPluginAuth != 0 {
+		plugin = r.cstring()
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if capabilities&clientProtocol41 == 0 {
+		return nil, errors.New("mysql server is too old, protocol 4.1 is required")
+	}
+
+	flags := auth.Capabilities&capabilities&mysqlProxyCapabilities | clientProtocol41 | clientSecureConn | clientPluginAuth
+	if auth.Db == "" {
+		flags &^= clientConnectWithDB
+	}
+	if capabilities&clientSSL != 0 {
+		// Like ssl-mode=PREFERRED of the mysql client, assets rarely have a certificate of a trusted CA
+		flags |= clientSSL
+		req := binary.LittleEndian.AppendUint32(nil, flags)
+		req = binary.LittleEndian.AppendUint32(req, mysqlMaxPacket)
+		req = append(append(req, auth.Charset), make([]byte, 23)...)
+		if err = c.writePacket(req); err != nil {
+			return
+		}
+		if err = c.flush(); err != nil {
+			return
+		}
+		if err = c.upgrade(func(conn net.Conn) *tls.Conn { return tls.Client(conn, &tls.Config{InsecureSkipVerify: true}) }); err != nil {
+			return
+		}
+	}
+
+	password := account.Password
+	data, err := mysqlAuthData(plugin, scramble, password, c.tls)
+	if err != nil {
+		return
+	}
+
+	// Protocol::HandshakeResponse41
+	resp := binary.LittleEndian.AppendUint32(nil, flags)
+	resp = binary.LittleEndian.AppendUint32(resp, mysqlMaxPacket)
+	resp = append(append(resp, auth.Charset), make([]byte, 23)...)
+	resp = append(append(resp, account.Account...), 0)
+	if flags&clientPluginAuthLenencData != 0 {
+		resp = appendLenenc(resp, uint64(len(data)))
+	} else {
+		resp = append(resp, byte(len(data)))
+	}
+	resp = append(resp, data...)
+	if flags&clientConnectWithDB != 0 {
+		resp = append(append(resp, auth.Db...), 0)
+	}
+	resp = append(append(resp, plugin...), 0)
+	if err = c.writePacket(resp); err != nil {
+		return
+	}
+	if err = c.flush(); err != nil {
+		return
+	}
+
+	for {
+		if payload, _, err = c.readPacket(); err != nil {
+			return
+		}
+		var reply []byte
+		switch payload[0] {
+		case mysqlOK:
+			return
+		case mysqlERR:
+			return nil, errors.New(parseMysqlErr(payload))
+		case mysqlAuthSwitch:
+			r := &mysqlReader{b: payload[1:]}
+			plugin = r.cstring()
+			scramble = bytes.TrimSuffix(r.b, []byte{0})
+			if reply, err = mysqlAuthData(plugin, scramble, password, c.tls); err != nil {
+				return
+			}
+		case mysqlAuthMoreData:
+			switch {
+			case plugin == mysqlCachingSha2Password && len(payload) == 2 && payload[1] == mysqlFastAuthSuccess:
+				continue
+			case plugin == mysqlCachingSha2Password && len(payload) == 2 && payload[1] == mysqlPerformFullAuth:
+				reply = append([]byte(password), 0)
+				if !c.tls {
+					reply = []byte{mysqlRequestPublicKey}
+				}
+			default:
+				// The public key of the server to encrypt the password with
+				if reply, err = mysqlEncryptPassword(payload[1:], scramble, password); err != nil {
+					return
+				}
+			}
+		default:
+			return nil, fmt.Errorf("unexpected mysql packet 0x%02x during authentication", payload[0])
+		}
+		if err = c.writePacket(reply); err != nil {
+			return
+		}
+		if err = c.flush(); err != nil {
+			return
+		}
+	}
+}
+
+// mysqlAuthData returns the auth response of the password for the plugin
+func mysqlAuthData(plugin string, scramble []byte, password string, secure bool) ([]byte, error) {
+	switch plugin {
+	case mysqlNativePassword:
+		if password == "" {
+			return nil, nil
+		}
+		// SHA1(password) XOR SHA1(scramble + SHA1(SHA1(password)))
+		h1 := sha1.Sum([]byte(password))
+		h2 := sha1.Sum(h1[:])
+		h3 := sha1.Sum(append(bytes.Clone(scramble[:min(20, len(scramble))]), h2[:]...))
+		return xorBytes(h1[:], h3[:]), nil
+	case mysqlCachingSha2Password:
+		if password == "" {
+			return nil, nil
+		}
+		// SHA256(password) XOR SHA256(SHA256(SHA256(password)) + scramble)
+		h1 := sha256.Sum256([]byte(password))
+		h2 := sha256.Sum256(h1[:])
+		h3 := sha256.Sum256(append(h2[:], scramble[:min(20, len(scramble))]...))
+		return xorBytes(h1[:], h3[:]), nil
+	case mysqlSha256Password:
+		if password == "" {
+			return []byte{0}, nil
+		}
+		if !secure {
+			// Asks for the public key of the server
+			return []byte{1}, nil
+		}
+		return append([]byte(password), 0), nil
+	case mysqlClearPassword:
+		return append([]byte(password), 0), nil
+	}
+	return nil, fmt.Errorf("unsupported mysql auth plugin %s", plugin)
+}
+
+// mysqlEncryptPassword encrypts the password XOR the scramble with the public key in pem
+func mysqlEncryptPassword(pemData, scramble []byte, password string) ([]byte, error) {
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		return nil, errors.New("invalid public key of mysql server")
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("public key of mysql server is not rsa")
+	}
+	return rsa.EncryptOAEP(sha1.New(), rand.Reader, key, xorScramble(append([]byte(password), 0), scramble), nil)
+}
+
+func xorBytes(a, b []byte) []byte {
+	out := make([]byte, len(a))
+	for i := range a {
+		out[i] = a[i] ^ b[i]
+	}
+	return out
+}
+
+// xorScramble xors bs with the scramble repeated
+func xorScramble(bs, scramble []byte) []byte {
+	out := make([]byte, len(bs))
+	for i := range bs {
+		out[i] = bs[i] ^ scramble[i%len(scramble)]
+	}
+	return out
+}
@@ -0,0 +1,115 @@
+package dbproxy
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestMysqlReader(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+		read    func(r *mysqlReader) []byte
+		want    []byte
+		wantErr bool
+	}{
+		{name: "lenenc string", payload: []byte{2, 'a', 'b', 'c'}, read: func(r *mysqlReader) []byte { return r.next(int(r.lenenc())) }, want: []byte("ab")},
+		{name: "lenenc beyond payload", payload: []byte{0xfc, 0x10, 0x00, 'a'}, read: func(r *mysqlReader) []byte { return r.next(int(r.lenenc())) }, wantErr: true},
+		{name: "lenenc negative", payload: []byte{0xfe, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 'a'}, read: func(r *mysqlReader) []byte { return r.next(int(r.lenenc())) }, wantErr: true},
+		{name: "truncated lenenc", payload: []byte{0xfd, 0x01}, read: func(r *mysqlReader) []byte { return r.next(int(r.lenenc())) }, wantErr: true},
+		{name: "truncated field", payload: []byte{1, 2}, read: func(r *mysqlReader) []byte { return r.next(4) }, wantErr: true},
+		{name: "negative", payload: []byte{1, 2}, read: func(r *mysqlReader) []byte { return r.next(-1) }, wantErr: true},
+		{name: "cstring", payload: []byte{'a', 0, 'b'}, read: func(r *mysqlReader) []byte { return []byte(r.cstring()) }, want: []byte("a")},
+		{name: "unterminated cstring", payload: []byte{'a', 'b'}, read: func(r *mysqlReader) []byte { return []byte(r.cstring()) }, want: []byte("ab")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &mysqlReader{b: tt.payload}
+			got := tt.read(r)
+			if (r.err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", r.err, tt.wantErr)
+			}
+			if !tt.wantErr && !bytes.Equal(got, tt.want) {
+				t.Errorf("read %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// pipeMysql returns the proxy side of a connection whose client writes data and then reads everything
+func pipeMysql(data []byte) *mysqlConn {
+	server, client := net.Pipe()
+	go func() {
+		defer client.Close()
+		go io.Copy(io.Discard, client)
+		client.Write(data)
+	}()
+	return newMysqlConn(server)
+}
+
+func mysqlPacket(seq byte, payload []byte) []byte {
+	n := len(payload)
+	return append([]byte{byte(n), byte(n >> 8), byte(n >> 16), seq}, payload...)
+}
+
+func TestMysqlReadPacket(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		want    []byte
+		wantErr error
+	}{
+		{name: "packet", data: mysqlPacket(0, []byte{comQuery, 's'}), want: []byte{comQuery, 's'}},
+		{name: "empty", data: mysqlPacket(0, nil), wantErr: errMysqlMalformed},
+		{name: "truncated header", data: []byte{1, 0}, wantErr: io.ErrUnexpectedEOF},
+		{name: "truncated payload", data: []byte{10, 0, 0, 0, comQuery}, wantErr: io.ErrUnexpectedEOF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := pipeMysql(tt.data)
+			defer c.Close()
+			payload, _, err := c.readPacket()
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("readPacket() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && !bytes.Equal(payload, tt.want) {
+				t.Errorf("readPacket() = %q, want %q", payload, tt.want)
+			}
+			if err != nil && !c.broken {
+				t.Error("connection is not broken after a failed read")
+			}
+		})
+	}
+}
+
+func TestMysqlHandshakeRejected(t *testing.T) {
+	flags := binary.LittleEndian.AppendUint32(nil, clientProtocol41|clientSecureConn|clientPluginAuth|clientPluginAuthLenencData)
+	response := func(tail ...byte) []byte {
+		b := binary.LittleEndian.AppendUint32(bytes.Clone(flags), mysqlMaxPacket)
+		b = append(append(b, mysqlCharsetUtf8mb4), make([]byte, 23)...)
+		return append(append(b, "alice@db01"...), append([]byte{0}, tail...)...)
+	}
+	tests := []struct {
+		name     string
+		response []byte
+	}{
+		{name: "flags only", response: flags},
+		{name: "truncated filler", response: append(bytes.Clone(flags), 0, 0, 0, 0, mysqlCharsetUtf8mb4)},
+		{name: "auth beyond payload", response: response(0xfc, 0xff, 0x00, 'x')},
+		{name: "negative auth length", response: response(0xfe, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff)},
+		{name: "clear password without tls", response: response(append([]byte{3, 'p', 'w', 0}, mysqlClearPassword+"\x00"...)...)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := pipeMysql(mysqlPacket(1, tt.response))
+			defer c.Close()
+			if _, err := c.handshake(); err == nil {
+				t.Error("handshake() accepted the response")
+			}
+		})
+	}
+}
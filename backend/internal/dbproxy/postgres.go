@@ -0,0 +1,537 @@
+package dbproxy
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/samber/lo"
+	"github.com/spf13/cast"
+	"go.uber.org/zap"
+
+	"github.com/veops/oneterm/internal/acl"
+	"github.com/veops/oneterm/internal/connector"
+	"github.com/veops/oneterm/internal/model"
+	gsession "github.com/veops/oneterm/internal/session"
+	"github.com/veops/oneterm/pkg/logger"
+)
+
+const (
+	pgHandshakeTimeout = time.Second * 30
+	pgDialTimeout      = time.Second * 10
+	pgMaxParamLen      = 256 // Longer params are cut in records
+
+	pgStateInvalidAuth     = "28000"
+	pgStateInvalidPassword = "28P01"
+	pgStateConnection      = "08006"
+	pgStateFeature         = "0A000"
+	pgStateForbidden       = "42501"
+)
+
+var (
+	// pgCancelKeys maps the keys of the servers, which clients are given as they are, to the addresses of the servers
+	pgCancelKeys = &sync.Map{}
+)
+
+// pgCancelKey identifies a connection to a server for cancel requests
+type pgCancelKey struct {
+	ProcessID uint32
+	SecretKey uint32
+}
+
+// servePostgres authenticates a postgresql client with oneterm credentials and relays it to the asset as an audited session
+func servePostgres(conn net.Conn) {
+	defer func() { conn.Close() }()
+
+	conn.SetDeadline(time.Now().Add(pgHandshakeTimeout))
+	conn, params, err := pgStartup(conn)
+	if err != nil || params == nil {
+		if err != nil {
+			logger.L().Debug("postgresql proxy startup failed", zap.String("remote", conn.RemoteAddr().String()), zap.Error(err))
+		}
+		return
+	}
+	backend := pgproto3.NewBackend(conn, conn)
+	fatal := func(code, msg string) {
+		backend.Send(&pgproto3.ErrorResponse{Severity: "FATAL", Code: code, Message: msg})
+		backend.Flush()
+	}
+	if v := params["replication"]; v != "" && !lo.Contains([]string{"false", "off", "no", "0"}, v) {
+		fatal(pgStateFeature, "replication is not supported by oneterm")
+		return
+	}
+
+	// The password of the oneterm user is asked for in clear text, which would be readable on the network without tls.
+	// Clients use tls by default with sslmode=prefer.
+	if !isTls(conn) {
+		logger.L().Info("postgresql proxy refused a client without tls", zap.String("remote", conn.RemoteAddr().String()))
+		fatal(pgStateInvalidAuth, "oneterm requires ssl, please connect with sslmode=require")
+		return
+	}
+	backend.Send(&pgproto3.AuthenticationCleartextPassword{})
+	if err = backend.Flush(); err != nil {
+		return
+	}
+	backend.SetAuthType(pgproto3.AuthTypeCleartextPassword)
+	msg, err := backend.Receive()
+	if err != nil {
+		return
+	}
+	pw, ok := msg.(*pgproto3.PasswordMessage)
+	if !ok {
+		fatal(pgStateInvalidPassword, "password authentication is expected")
+		return
+	}
+
+	user := params["user"]
+	ctx, aclSess, err := login(conn, "postgresql", user, pw.Password)
+	if err != nil {
+		logger.L().Info("postgresql proxy login failed", zap.String("user", user), zap.Error(err))
+		fatal(pgStateInvalidPassword, fmt.Sprintf("password authentication failed for user \"%s\": %s", user, err))
+		return
+	}
+	defer acl.Logout(aclSess)
+
+	accepted := false
+	err = connector.DoProxy(ctx, func(ctx context.Context, sess *gsession.Session, addr string, account *model.Account) error {
+		hc, err := dialPostgres(ctx, addr, account, user, params)
+		if err != nil {
+			return err
+		}
+		server := hc.Conn
+		defer server.Close()
+
+		key := pgCancelKey{ProcessID: hc.PID, SecretKey: hc.SecretKey}
+		pgCancelKeys.Store(key, addr)
+		defer pgCancelKeys.Delete(key)
+
+		conn.SetDeadline(time.Time{})
+		backend.Send(&pgproto3.AuthenticationOk{})
+		for k, v := range hc.ParameterStatuses {
+			backend.Send(&pgproto3.ParameterStatus{Name: k, Value: v})
+		}
+		backend.Send(&pgproto3.BackendKeyData{ProcessID: hc.PID, SecretKey: hc.SecretKey})
+		backend.Send(&pgproto3.ReadyForQuery{TxStatus: hc.TxStatus})
+		if err = backend.Flush(); err != nil {
+			return err
+		}
+		accepted = true
+		go func() {
+			<-ctx.Done()
+			conn.Close()
+			server.Close()
+		}()
+
+		r := &pgRelay{
+			sess:     sess,
+			backend:  pgproto3.NewBackend(&countReader{Reader: conn, n: &sess.BytesIn}, conn),
+			frontend: pgproto3.NewFrontend(&countReader{Reader: server, n: &sess.BytesOut}, server),
+			stmts:    map[string]string{},
+			portals:  map[string]*pgPending{},
+		}
+		done := make(chan error, 2)
+		go func() {
+			err := safely(r.fromClient)
+			sess.SetCloseReason(model.SESSIONCLOSE_CLIENT_DISCONNECT)
+			done <- err
+		}()
+		go func() {
+			err := safely(r.fromServer)
+			sess.SetCloseReason(model.SESSIONCLOSE_REMOTE_EXIT)
+			done <- err
+		}()
+		err = <-done
+		conn.Close()
+		server.Close()
+		<-done
+
+		return err
+	})
+	if err != nil {
+		logger.L().Info("postgresql proxy session failed", zap.String("user", user), zap.Error(err))
+		if !accepted {
+			fatal(pgStateConnection, errMessage(err))
+		}
+	}
+}
+
+// pgStartup negotiates tls and returns the params of the startup message, nil if it is a cancel request
+func pgStartup(conn net.Conn) (net.Conn, map[string]string, error) {
+	backend := pgproto3.NewBackend(conn, conn)
+	for {
+		msg, err := backend.ReceiveStartupMessage()
+		if err != nil {
+			return conn, nil, err
+		}
+		switch msg := msg.(type) {
+		case *pgproto3.SSLRequest:
+			cfg, err := tlsConfig()
+			if err != nil {
+				conn.Write([]byte{'N'})
+				continue
+			}
+			if _, err = conn.Write([]byte{'S'}); err != nil {
+				return conn, nil, err
+			}
+			tlsConn := tls.Server(conn, cfg)
+			if err = tlsConn.Handshake(); err != nil {
+				return conn, nil, err
+			}
+			conn = tlsConn
+			backend = pgproto3.NewBackend(conn, conn)
+		case *pgproto3.GSSEncRequest:
+			if _, err = conn.Write([]byte{'N'}); err != nil {
+				return conn, nil, err
+			}
+		case *pgproto3.CancelRequest:
+			return conn, nil, pgCancel(msg)
+		case *pgproto3.StartupMessage:
+			return conn, msg.Parameters, nil
+		}
+	}
+}
+
+// pgCancel passes a cancel request to the server of the key
+func pgCancel(req *pgproto3.CancelRequest) error {
+	addr, ok := pgCancelKeys.Load(pgCancelKey{ProcessID: req.ProcessID, SecretKey: req.SecretKey})
+	if !ok {
+		return errors.New("unknown cancel key")
+	}
+	conn, err := net.DialTimeout("tcp", addr.(string), pgDialTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	buf, err := req.Encode(nil)
+	if err != nil {
+		return err
+	}
+	_, err = conn.Write(buf)
+	return err
+}
+
+// dialPostgres logs in to addr as account with the params of the client.
+// Clients default the database to the login user, it is the one in an account like user/database then, or postgres.
+func dialPostgres(ctx context.Context, addr string, account *model.Account, user string, params map[string]string) (*pgconn.HijackedConn, error) {
+	username, database, _ := strings.Cut(account.Account, "/")
+	if db := params["database"]; db != "" && db != user {
+		database = db
+	}
+	if database == "" {
+		database = "postgres"
+	}
+	u := &url.URL{Scheme: "postgres", Host: addr, Path: "/" + database}
+	u.RawQuery = url.Values{"sslmode": {"disable"}}.Encode()
+	cfg, err := pgconn.ParseConfig(u.String())
+	if err != nil {
+		return nil, err
+	}
+	cfg.DialFunc = pgDial
+	cfg.User, cfg.Password = username, account.Password
+	for k, v := range params {
+		if k != "user" && k != "database" {
+			cfg.RuntimeParams[k] = v
+		}
+	}
+
+	conn, err := pgconn.ConnectConfig(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err = conn.SyncConn(ctx); err != nil {
+		conn.Close(ctx)
+		return nil, err
+	}
+	return conn.Hijack()
+}
+
+// pgDial connects to addr with tls if the server supports it.
+// It is negotiated here as pgconn dials again without tls if refused, but a tunnel of a gateway accepts only one connection.
+func pgDial(ctx context.Context, network, addr string) (net.Conn, error) {
+	conn, err := (&net.Dialer{Timeout: pgDialTimeout}).DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(pgDialTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	req, err := (&pgproto3.SSLRequest{}).Encode(nil)
+	if err == nil {
+		_, err = conn.Write(req)
+	}
+	b := make([]byte, 1)
+	if err == nil {
+		_, err = io.ReadFull(conn, b)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if b[0] != 'S' {
+		return conn, nil
+	}
+	tlsConn := tls.Client(conn, &tls.Config{InsecureSkipVerify: true})
+	if err = tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+const (
+	pgPendingQuery = iota // A simple query, or a function call, which ends with ReadyForQuery
+	pgPendingExecute
+	pgPendingSync
+	pgPendingDeny // A denied statement whose error is sent in order
+)
+
+// pgPending is a message of the client whose response from the server is pending
+type pgPending struct {
+	Kind   int
+	Query  string
+	Params string
+	Check  *model.CommandCheckResult
+	Start  time.Time
+	Rows   int64
+	Tags   []string
+	Err    string
+	Deny   *pgproto3.ErrorResponse
+}
+
+// pgRelay relays messages in both directions, statements are checked before and recorded after they are executed
+type pgRelay struct {
+	sess     *gsession.Session
+	backend  *pgproto3.Backend  // To the client
+	frontend *pgproto3.Frontend // To the server
+
+	mu      sync.Mutex
+	pending []*pgPending
+	skip    bool                  // Discard extended query messages until Sync, after a statement is denied
+	stmts   map[string]string     // Prepared statements by name
+	portals map[string]*pgPending // Bound portals by name
+}
+
+func (r *pgRelay) push(p *pgPending) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pending = append(r.pending, p)
+}
+
+// fromClient checks and forwards messages of the client to the server
+func (r *pgRelay) fromClient() error {
+	for {
+		msg, err := r.backend.Receive()
+		if err != nil {
+			return err
+		}
+		r.sess.SetIdle()
+
+		switch m := msg.(type) {
+		case *pgproto3.Query:
+			if res := r.sess.SshParser.CheckSQL(m.String, gsession.SQLPostgres); !res.Allowed {
+				r.deny(m.String, res)
+				msg = &pgproto3.Sync{}
+			} else {
+				r.push(&pgPending{Kind: pgPendingQuery, Query: m.String, Check: res, Start: time.Now()})
+			}
+		case *pgproto3.FunctionCall:
+			// Calls a function by oid around statement rules
+			r.deny(fmt.Sprintf("FUNCTION CALL %d", m.Function), &model.CommandCheckResult{Action: model.CommandActionDeny, Reason: "function calls are not supported"})
+			msg = &pgproto3.Sync{}
+		case *pgproto3.Parse:
+			if r.skip {
+				continue
+			}
+			if res := r.sess.SshParser.CheckSQL(m.Query, gsession.SQLPostgres); !res.Allowed {
+				r.skip = true
+				r.deny(m.Query, res)
+				continue
+			}
+			r.stmts[m.Name] = m.Query
+		case *pgproto3.Bind:
+			if r.skip {
+				continue
+			}
+			r.portals[m.DestinationPortal] = &pgPending{Query: r.stmts[m.PreparedStatement], Params: pgParams(m)}
+		case *pgproto3.Execute:
+			if r.skip {
+				continue
+			}
+			p := &pgPending{Kind: pgPendingExecute, Start: time.Now()}
+			if portal, ok := r.portals[m.Portal]; ok {
+				p.Query, p.Params = portal.Query, portal.Params
+			}
+			r.push(p)
+		case *pgproto3.Describe:
+			if r.skip {
+				continue
+			}
+		case *pgproto3.Close:
+			if r.skip {
+				continue
+			}
+			if m.ObjectType == 'S' {
+				delete(r.stmts, m.Name)
+			} else {
+				delete(r.portals, m.Name)
+			}
+		case *pgproto3.Sync:
+			r.skip = false
+			r.push(&pgPending{Kind: pgPendingSync})
+		}
+
+		r.frontend.Send(msg)
+		if err = r.frontend.Flush(); err != nil {
+			return err
+		}
+		if _, ok := msg.(*pgproto3.Terminate); ok {
+			return nil
+		}
+	}
+}
+
+// deny records a forbidden statement, its error is sent before the ReadyForQuery of the Sync which follows
+func (r *pgRelay) deny(query string, res *model.CommandCheckResult) {
+	atomic.AddInt64(&r.sess.Forbidden, 1)
+	msg := fmt.Sprintf("statement is forbidden by oneterm: %s", res.Reason)
+	record(r.sess, "psql", &model.SessionCmd{Cmd: query, Result: fmt.Sprintf("ERROR:  %s", msg)}, res)
+	r.push(&pgPending{Kind: pgPendingDeny, Deny: &pgproto3.ErrorResponse{Severity: "ERROR", Code: pgStateForbidden, Message: msg}})
+	if r.skip {
+		return
+	}
+	// A simple query is answered by the ReadyForQuery of a Sync sent instead
+	r.push(&pgPending{Kind: pgPendingSync})
+}
+
+// fromServer relays messages of the server to the client and records the statements they complete
+func (r *pgRelay) fromServer() error {
+	for {
+		msg, err := r.frontend.Receive()
+		if err != nil {
+			return err
+		}
+
+		r.mu.Lock()
+		for len(r.pending) > 0 && r.pending[0].Kind == pgPendingDeny {
+			r.backend.Send(r.pending[0].Deny)
+			r.pending = r.pending[1:]
+		}
+		var head *pgPending
+		if len(r.pending) > 0 {
+			head = r.pending[0]
+		}
+		switch m := msg.(type) {
+		case *pgproto3.DataRow:
+			if head != nil {
+				head.Rows++
+			}
+		case *pgproto3.CommandComplete:
+			if head != nil && head.Kind != pgPendingSync {
+				head.Tags = append(head.Tags, string(m.CommandTag))
+				if head.Kind == pgPendingExecute {
+					r.done(head)
+				}
+			}
+		case *pgproto3.EmptyQueryResponse, *pgproto3.PortalSuspended:
+			if head != nil && head.Kind == pgPendingExecute {
+				r.done(head)
+			}
+		case *pgproto3.ErrorResponse:
+			if head != nil && head.Kind != pgPendingSync {
+				head.Err = fmt.Sprintf("%s:  %s", m.Severity, m.Message)
+				if head.Kind == pgPendingExecute {
+					r.done(head)
+					// The server discards messages until Sync, so do pending executes and errors
+					for len(r.pending) > 0 && r.pending[0].Kind != pgPendingSync {
+						r.pending = r.pending[1:]
+					}
+				}
+			}
+		case *pgproto3.ReadyForQuery:
+			for len(r.pending) > 0 {
+				head = r.pending[0]
+				r.pending = r.pending[1:]
+				if head.Kind == pgPendingQuery {
+					r.record(head)
+				}
+				if head.Kind == pgPendingQuery || head.Kind == pgPendingSync {
+					break
+				}
+			}
+		}
+		r.mu.Unlock()
+
+		r.backend.Send(msg)
+		if r.frontend.ReadBufferLen() == 0 {
+			if err = r.backend.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// done records the execute at the head of pending ones
+func (r *pgRelay) done(p *pgPending) {
+	r.pending = r.pending[1:]
+	r.record(p)
+}
+
+func (r *pgRelay) record(p *pgPending) {
+	elapsed := time.Since(p.Start)
+	cmd := p.Query
+	if p.Params != "" {
+		cmd = fmt.Sprintf("%s\n-- params: %s", cmd, p.Params)
+	}
+	result := p.Err
+	if result == "" {
+		result = strings.Join(p.Tags, "\n")
+	}
+	rows := p.Rows
+	if rows == 0 {
+		// Affected rows are in tags like INSERT 0 3, UPDATE 2
+		for _, tag := range p.Tags {
+			if fields := strings.Fields(tag); len(fields) > 1 {
+				rows += cast.ToInt64(fields[len(fields)-1])
+			}
+		}
+	}
+	record(r.sess, "psql", &model.SessionCmd{Cmd: cmd, Result: fmt.Sprintf("%s (%.2f sec)", result, elapsed.Seconds()), RowCount: rows, Elapsed: elapsed.Milliseconds()}, p.Check)
+}
+
+// pgParams formats the params of a bind like $1 = 'a', $2 = NULL, binary ones are in hex
+func pgParams(m *pgproto3.Bind) string {
+	params := make([]string, len(m.Parameters))
+	for i, v := range m.Parameters {
+		var code int16
+		switch len(m.ParameterFormatCodes) {
+		case 0:
+		case 1:
+			code = m.ParameterFormatCodes[0]
+		default:
+			code = m.ParameterFormatCodes[min(i, len(m.ParameterFormatCodes)-1)]
+		}
+		s := "NULL"
+		switch {
+		case v == nil:
+		case code == 1:
+			s = fmt.Sprintf("'\\x%x'", v[:min(len(v), pgMaxParamLen/2)])
+		default:
+			s = fmt.Sprintf("'%s'", strings.ReplaceAll(string(v[:min(len(v), pgMaxParamLen)]), "'", "''"))
+		}
+		if len(v) > pgMaxParamLen {
+			s += "..."
+		}
+		params[i] = fmt.Sprintf("$%d = %s", i+1, s)
+	}
+	return strings.Join(params, ", ")
+}
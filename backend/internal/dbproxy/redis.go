@@ -0,0 +1,398 @@
+package dbproxy
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/samber/lo"
+	"go.uber.org/zap"
+
+	"github.com/veops/oneterm/internal/acl"
+	"github.com/veops/oneterm/internal/connector"
+	"github.com/veops/oneterm/internal/model"
+	gsession "github.com/veops/oneterm/internal/session"
+	"github.com/veops/oneterm/pkg/logger"
+)
+
+const (
+	redisHandshakeTimeout = time.Second * 30
+	redisDialTimeout      = time.Second * 10
+
+	// redisDeniedCmd replaces a denied command to the server, which rejects it as unknown.
+	// So the error is sent in order with replies of pipelined commands, and a transaction is aborted
+	// like for a command the server refuses.
+	redisDeniedCmd = "ONETERM_DENIED"
+)
+
+var (
+	// redisSubscribeCmds are commands after which pushes of the server do not follow commands one by one
+	redisSubscribeCmds = []string{"SUBSCRIBE", "PSUBSCRIBE", "SSUBSCRIBE"}
+)
+
+// serveRedis authenticates a redis client with oneterm credentials and relays it to the asset as an audited session
+func serveRedis(conn net.Conn) {
+	client := newRedisConn(conn)
+	defer func() { client.Close() }()
+
+	conn.SetDeadline(time.Now().Add(redisHandshakeTimeout))
+	// Redis clients start tls without asking, which is told by the record type of a tls handshake
+	if b, err := client.r.Peek(1); err == nil && b[0] == 0x16 {
+		cfg, err := tlsConfig()
+		if err != nil {
+			logger.L().Error("redis proxy tls config failed", zap.Error(err))
+			return
+		}
+		if err = client.upgrade(func(c net.Conn) *tls.Conn { return tls.Server(c, cfg) }); err != nil {
+			return
+		}
+	}
+	hello, user, password, err := client.handshake()
+	if err != nil {
+		logger.L().Debug("redis proxy handshake failed", zap.String("remote", conn.RemoteAddr().String()), zap.Error(err))
+		return
+	}
+
+	ctx, aclSess, err := login(client, "redis", user, password)
+	if err != nil {
+		logger.L().Info("redis proxy login failed", zap.String("user", user), zap.Error(err))
+		client.writeErr(fmt.Sprintf("WRONGPASS invalid username-password pair: %s", err))
+		client.flush()
+		return
+	}
+	defer acl.Logout(aclSess)
+
+	accepted := false
+	err = connector.DoProxy(ctx, func(ctx context.Context, sess *gsession.Session, addr string, account *model.Account) error {
+		server, reply, err := dialRedis(ctx, addr, account, hello)
+		if err != nil {
+			return err
+		}
+		defer server.Close()
+
+		conn.SetDeadline(time.Time{})
+		if _, err = client.w.Write(reply); err != nil {
+			return err
+		}
+		if err = client.flush(); err != nil {
+			return err
+		}
+		accepted = true
+		go func() {
+			<-ctx.Done()
+			client.Close()
+			server.Close()
+		}()
+
+		client.count(&sess.BytesIn)
+		server.count(&sess.BytesOut)
+		r := &redisRelay{sess: sess, client: client, server: server}
+		done := make(chan error, 2)
+		go func() {
+			err := safely(r.fromClient)
+			sess.SetCloseReason(model.SESSIONCLOSE_CLIENT_DISCONNECT)
+			done <- err
+		}()
+		go func() {
+			err := safely(r.fromServer)
+			sess.SetCloseReason(model.SESSIONCLOSE_REMOTE_EXIT)
+			done <- err
+		}()
+		err = <-done
+		client.Close()
+		server.Close()
+		<-done
+
+		return lo.Ternary(err == io.EOF, nil, err)
+	})
+	if err != nil {
+		logger.L().Info("redis proxy session failed", zap.String("user", user), zap.Error(err))
+		if !accepted {
+			client.writeErr("ERR " + errMessage(err))
+			client.flush()
+		}
+	}
+}
+
+// handshake reads commands of the client until it authenticates with AUTH or HELLO, either with a user like alice@redis01#default.
+// HELLO is returned without the credentials to be sent to the server.
+func (c *redisConn) handshake() (hello []string, user, password string, err error) {
+	for {
+		args, err := c.readCommand()
+		if err != nil {
+			return nil, "", "", err
+		}
+		switch strings.ToUpper(args[0]) {
+		case "AUTH":
+			if len(args) == 3 {
+				return nil, args[1], args[2], nil
+			}
+			c.writeErr("ERR AUTH needs a user like user@asset#account, e.g. redis-cli --user user@asset#account")
+		case "HELLO":
+			if hello, user, password = redisHello(args); user != "" {
+				return hello, user, password, nil
+			}
+			c.writeErr("NOAUTH HELLO must be called with the client already authenticated, otherwise the HELLO <proto> AUTH <user> <pass> option can be used")
+		case "QUIT":
+			c.w.WriteString("+OK\r\n")
+			c.flush()
+			return nil, "", "", io.EOF
+		default:
+			c.writeErr("NOAUTH Authentication required.")
+		}
+		if err = c.flush(); err != nil {
+			return nil, "", "", err
+		}
+	}
+}
+
+// redisHello splits the credentials off a HELLO command
+func redisHello(args []string) (hello []string, user, password string) {
+	for i := 0; i < len(args); i++ {
+		if strings.EqualFold(args[i], "AUTH") && i+2 < len(args) {
+			user, password = args[i+1], args[i+2]
+			i += 2
+			continue
+		}
+		hello = append(hello, args[i])
+	}
+	return
+}
+
+// dialRedis logs in to addr as account and returns the reply to the client for its AUTH or HELLO.
+// The account is an acl user of redis 6 or later, or the password alone is sent if it is empty or default.
+func dialRedis(ctx context.Context, addr string, account *model.Account, hello []string) (*redisConn, []byte, error) {
+	server, err := redisDial(ctx, addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	server.SetDeadline(time.Now().Add(redisDialTimeout))
+	defer server.SetDeadline(time.Time{})
+
+	var (
+		v     *redisValue
+		reply = []byte("+OK\r\n")
+	)
+	switch {
+	case hello != nil:
+		// HELLO protover [AUTH username password] [SETNAME clientname]
+		n := min(len(hello), 2)
+		args := append([]string{}, hello[:n]...)
+		if account.Password != "" {
+			args = append(args, "AUTH", lo.Ternary(account.Account == "", "default", account.Account), account.Password)
+		}
+		v, reply, err = server.do(append(args, hello[n:]...)...)
+	case account.Password == "":
+	case account.Account == "" || account.Account == "default":
+		v, _, err = server.do("AUTH", account.Password)
+	default:
+		v, _, err = server.do("AUTH", account.Account, account.Password)
+	}
+	if err == nil && v != nil {
+		err = redisErr(v)
+	}
+	if err != nil {
+		server.Close()
+		return nil, nil, err
+	}
+
+	return server, reply, nil
+}
+
+// redisDial connects to addr with tls if the server does not answer a PING in plain text.
+// Only the first connection to a tunnel of a gateway is accepted, so tls servers are supported directly only.
+func redisDial(ctx context.Context, addr string) (*redisConn, error) {
+	dialer := &net.Dialer{Timeout: redisDialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	server := newRedisConn(conn)
+	conn.SetDeadline(time.Now().Add(redisDialTimeout))
+	// Any reply, e.g. NOAUTH, tells it is not tls
+	if _, _, err = server.do("PING"); err == nil {
+		return server, nil
+	}
+	conn.Close()
+
+	if conn, err = dialer.DialContext(ctx, "tcp", addr); err != nil {
+		return nil, err
+	}
+	server = newRedisConn(conn)
+	conn.SetDeadline(time.Now().Add(redisDialTimeout))
+	if err = server.upgrade(func(c net.Conn) *tls.Conn {
+		host, _, _ := net.SplitHostPort(addr)
+		return tls.Client(c, &tls.Config{ServerName: host, InsecureSkipVerify: true})
+	}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return server, nil
+}
+
+// redisPending is a command whose reply from the server is pending
+type redisPending struct {
+	Args   []string
+	Check  *model.CommandCheckResult
+	Start  time.Time
+	Deny   string // The error of a denied command, which is sent instead of the reply to redisDeniedCmd
+	Stream bool
+}
+
+// redisRelay relays commands and replies, commands are checked before and recorded with their replies
+type redisRelay struct {
+	sess   *gsession.Session
+	client *redisConn
+	server *redisConn
+
+	mu         sync.Mutex
+	pending    []*redisPending
+	subscribed bool       // Pushes follow SUBSCRIBE until the server confirms no subscription is left
+	monitoring bool       // Commands run by the server follow MONITOR until RESET
+	replyOff   bool       // No command is answered after CLIENT REPLY OFF until CLIENT REPLY ON
+	skipped    int        // Commands left unanswered after CLIENT REPLY SKIP, which is one of them
+	wmu        sync.Mutex // Denied commands are answered by fromClient in the stream mode
+}
+
+// fromClient checks and forwards commands of the client to the server
+func (r *redisRelay) fromClient() error {
+	for {
+		args, err := r.client.readCommand()
+		if err != nil {
+			return err
+		}
+		r.sess.SetIdle()
+
+		p := &redisPending{Args: args, Start: time.Now()}
+		name := strings.ToUpper(args[0])
+		switch name {
+		case "AUTH":
+			p.Check = &model.CommandCheckResult{Action: model.CommandActionDeny, Reason: "AUTH"}
+			p.Deny = "ERR AUTH is not allowed as the connection is authenticated by oneterm"
+		case "HELLO":
+			// The connection keeps the account of oneterm
+			p.Args, _, _ = redisHello(args)
+		case "QUIT":
+			r.sess.SetCloseReason(model.SESSIONCLOSE_CLIENT_DISCONNECT)
+		}
+		if p.Check == nil {
+			if p.Check = r.sess.SshParser.CheckRedis(p.Args); !p.Check.Allowed {
+				p.Deny = fmt.Sprintf("NOPERM this command is forbidden by oneterm: %s", p.Check.Reason)
+			}
+		}
+		if len(args) > 1 {
+			name += " " + strings.ToUpper(args[1])
+		}
+		subscribe := lo.ContainsBy(redisSubscribeCmds, func(s string) bool { return strings.HasPrefix(name, s) })
+		p.Stream = p.Deny == "" && (subscribe || name == "MONITOR")
+
+		// Replies follow commands one by one but in the stream mode after SUBSCRIBE or MONITOR,
+		// and commands are not answered at all after CLIENT REPLY OFF or SKIP
+		r.mu.Lock()
+		if p.Deny == "" {
+			switch {
+			case name == "RESET":
+				r.subscribed, r.monitoring, r.replyOff, r.skipped = false, false, false, 0
+			case name == "CLIENT REPLY" && len(args) > 2:
+				switch strings.ToUpper(args[2]) {
+				case "ON":
+					r.replyOff, r.skipped = false, 0
+				case "OFF":
+					r.replyOff = true
+				case "SKIP":
+					r.skipped = 2
+				}
+			}
+		}
+		answered := !r.replyOff && r.skipped == 0
+		r.skipped = max(r.skipped-1, 0)
+		stream := r.subscribed || r.monitoring || !answered
+		if !stream {
+			r.pending = append(r.pending, p)
+		}
+		r.subscribed = r.subscribed || (p.Stream && subscribe)
+		r.monitoring = r.monitoring || (p.Stream && !subscribe)
+		r.mu.Unlock()
+
+		if p.Deny != "" {
+			atomic.AddInt64(&r.sess.Forbidden, 1)
+			record(r.sess, "redis", &model.SessionCmd{Cmd: gsession.RedisCommandLine(p.Args), Result: "(error) " + p.Deny}, p.Check)
+			if !answered {
+				continue
+			}
+			if stream {
+				r.wmu.Lock()
+				r.client.writeErr(p.Deny)
+				err = r.client.flush()
+				r.wmu.Unlock()
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			p.Args = []string{redisDeniedCmd}
+		} else if stream {
+			record(r.sess, "redis", &model.SessionCmd{Cmd: gsession.RedisCommandLine(p.Args)}, p.Check)
+		}
+
+		r.server.writeCommand(p.Args)
+		if r.client.r.Buffered() == 0 {
+			if err = r.server.flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// fromServer relays replies of the server to the client and records the commands they answer.
+// Replies are copied as they are read, denied commands are answered instead of the replies to redisDeniedCmd.
+func (r *redisRelay) fromServer() error {
+	for {
+		t, err := r.server.r.Peek(1)
+		if err != nil {
+			return err
+		}
+
+		// Pushes like pubsub messages of RESP3 answer no command, but the one which starts them
+		var p *redisPending
+		r.mu.Lock()
+		if len(r.pending) > 0 && (t[0] != '>' || r.pending[0].Stream) {
+			p, r.pending = r.pending[0], r.pending[1:]
+		}
+		r.mu.Unlock()
+
+		var v *redisValue
+		r.wmu.Lock()
+		if p != nil && p.Deny != "" {
+			if _, err = r.server.readValueTo(io.Discard); err == nil {
+				err = r.client.writeErr(p.Deny)
+			}
+		} else {
+			v, err = r.server.readValueTo(r.client.w)
+		}
+		if err == nil && r.server.r.Buffered() == 0 {
+			err = r.client.flush()
+		}
+		r.wmu.Unlock()
+		if err != nil {
+			return err
+		}
+
+		if v != nil && redisUnsubscribed(v) {
+			r.mu.Lock()
+			r.subscribed = false
+			r.mu.Unlock()
+		}
+
+		if p != nil && p.Deny == "" {
+			elapsed := time.Since(p.Start)
+			record(r.sess, "redis", &model.SessionCmd{Cmd: gsession.RedisCommandLine(p.Args), Result: v.Summary(), RowCount: v.RowCount(), Elapsed: elapsed.Milliseconds()}, p.Check)
+		}
+	}
+}
@@ -0,0 +1,287 @@
+package dbproxy
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/samber/lo"
+)
+
+const (
+	redisMaxBulkLen  = 512 << 20 // proto-max-bulk-len of the server
+	redisMaxValueLen = 256       // Longer strings are cut in records
+	redisMaxElems    = 20        // More elements are left out of records
+)
+
+// redisConn reads and writes the redis serialization protocol, RESP2 or RESP3
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+func newRedisConn(conn net.Conn) *redisConn {
+	return &redisConn{Conn: conn, r: bufio.NewReader(conn), w: bufio.NewWriter(conn)}
+}
+
+// upgrade switches the connection to tls
+func (c *redisConn) upgrade(wrap func(net.Conn) *tls.Conn) error {
+	conn := wrap(&bufferedConn{Conn: c.Conn, r: c.r})
+	if err := conn.Handshake(); err != nil {
+		return err
+	}
+	c.Conn, c.r, c.w = conn, bufio.NewReader(conn), bufio.NewWriter(conn)
+	return nil
+}
+
+// count adds bytes read from now on to n
+func (c *redisConn) count(n *int64) {
+	c.r = bufio.NewReader(&countReader{Reader: c.r, n: n})
+}
+
+// readLine reads a line without the trailing \r\n
+func (c *redisConn) readLine() (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"), nil
+}
+
+// readCommand reads a command of a client, an array of bulk strings or an inline command like typed to telnet
+func (c *redisConn) readCommand() ([]string, error) {
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(line, "*") {
+			if args := strings.Fields(line); len(args) > 0 {
+				return args, nil
+			}
+			continue
+		}
+
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n > 1024*1024 {
+			return nil, fmt.Errorf("invalid multibulk length %q", line)
+		}
+		if n <= 0 {
+			continue
+		}
+		args := make([]string, n)
+		for i := range args {
+			if line, err = c.readLine(); err != nil {
+				return nil, err
+			}
+			l, err := strconv.Atoi(strings.TrimPrefix(line, "$"))
+			if !strings.HasPrefix(line, "$") || err != nil || l < 0 || l > redisMaxBulkLen {
+				return nil, fmt.Errorf("invalid bulk length %q", line)
+			}
+			b := make([]byte, l+2)
+			if _, err = io.ReadFull(c.r, b); err != nil {
+				return nil, err
+			}
+			args[i] = string(b[:l])
+		}
+		return args, nil
+	}
+}
+
+// writeCommand writes a command as an array of bulk strings
+func (c *redisConn) writeCommand(args []string) error {
+	_, err := fmt.Fprintf(c.w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		_, err = fmt.Fprintf(c.w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	return err
+}
+
+func (c *redisConn) writeErr(msg string) error {
+	_, err := c.w.WriteString("-" + msg + "\r\n")
+	return err
+}
+
+func (c *redisConn) flush() error {
+	return c.w.Flush()
+}
+
+// do sends a command and reads the reply
+func (c *redisConn) do(args ...string) (*redisValue, []byte, error) {
+	c.writeCommand(args)
+	if err := c.flush(); err != nil {
+		return nil, nil, err
+	}
+	return c.readValue()
+}
+
+// redisValue is a reply of the server, which is kept as much as records need
+type redisValue struct {
+	Type  byte
+	Str   string // Cut to redisMaxValueLen
+	Cut   bool
+	Null  bool
+	Len   int           // Elements of an aggregate, pairs of a map
+	Elems []*redisValue // At most redisMaxElems
+}
+
+// readValue reads a reply and returns it with the raw bytes to relay
+func (c *redisConn) readValue() (*redisValue, []byte, error) {
+	var raw bytes.Buffer
+	v, err := c.readValueTo(&raw)
+	return v, raw.Bytes(), err
+}
+
+// readValueTo reads a reply and writes the raw bytes to w as they are read, so large bulk strings are not buffered
+func (c *redisConn) readValueTo(w io.Writer) (*redisValue, error) {
+	line, err := c.r.ReadBytes('\n')
+	if err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(line); err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("invalid redis reply %q", line)
+	}
+	v := &redisValue{Type: line[0], Str: string(line[1 : len(line)-2])}
+
+	switch v.Type {
+	case '+', '-', ':', ',', '(', '#', '_':
+		v.Str, v.Cut = cut(v.Str)
+	case '$', '!', '=':
+		n, err := strconv.Atoi(v.Str)
+		if err != nil || n > redisMaxBulkLen {
+			return nil, fmt.Errorf("invalid bulk length %q", line)
+		}
+		if v.Null = n < 0; v.Null {
+			break
+		}
+		// The head of the string is kept for records, the rest is copied
+		head := make([]byte, min(n, redisMaxValueLen+1))
+		if _, err = io.ReadFull(c.r, head); err != nil {
+			return nil, err
+		}
+		if _, err = w.Write(head); err != nil {
+			return nil, err
+		}
+		if _, err = io.CopyN(w, c.r, int64(n-len(head)+2)); err != nil {
+			return nil, lo.Ternary(err == io.EOF, io.ErrUnexpectedEOF, err)
+		}
+		v.Str, v.Cut = cut(string(head))
+	case '*', '%', '~', '>', '|':
+		n, err := strconv.Atoi(v.Str)
+		if err != nil {
+			return nil, fmt.Errorf("invalid aggregate length %q", line)
+		}
+		if v.Null = n < 0; v.Null {
+			break
+		}
+		v.Len = n
+		if v.Type == '%' || v.Type == '|' {
+			n *= 2
+		}
+		for i := 0; i < n; i++ {
+			e, err := c.readValueTo(w)
+			if err != nil {
+				return nil, err
+			}
+			if len(v.Elems) < redisMaxElems {
+				v.Elems = append(v.Elems, e)
+			}
+		}
+		if v.Type == '|' {
+			// Attributes precede the reply they describe
+			return c.readValueTo(w)
+		}
+	default:
+		return nil, fmt.Errorf("unexpected redis reply type %q", v.Type)
+	}
+
+	return v, nil
+}
+
+func cut(s string) (string, bool) {
+	if len(s) <= redisMaxValueLen {
+		return s, false
+	}
+	return s[:redisMaxValueLen], true
+}
+
+// Summary formats the reply like redis-cli
+func (v *redisValue) Summary() string {
+	return v.summary("")
+}
+
+func (v *redisValue) summary(indent string) string {
+	s := v.Str
+	if v.Cut {
+		s += "..."
+	}
+	switch {
+	case v.Null, v.Type == '_':
+		return "(nil)"
+	case v.Type == '-', v.Type == '!':
+		return "(error) " + s
+	case v.Type == ':':
+		return "(integer) " + s
+	case v.Type == ',':
+		return "(double) " + s
+	case v.Type == '(':
+		return "(big number) " + s
+	case v.Type == '#':
+		return lo.Ternary(s == "t", "(true)", "(false)")
+	case v.Type == '$':
+		return strconv.Quote(s)
+	case v.Type == '=':
+		// The format precedes the text, e.g. txt:
+		return strconv.Quote(s[min(len(s), 4):])
+	case v.Type == '+':
+		return s
+	case v.Len == 0:
+		return lo.Ternary(v.Type == '%', "(empty hash)", lo.Ternary(v.Type == '~', "(empty set)", "(empty array)"))
+	}
+
+	var sb strings.Builder
+	total := lo.Ternary(v.Type == '%', v.Len*2, v.Len)
+	for i, e := range v.Elems {
+		prefix := fmt.Sprintf("%d) ", i+1)
+		if i > 0 {
+			sb.WriteString("\n" + indent)
+		}
+		sb.WriteString(prefix + e.summary(indent+strings.Repeat(" ", len(prefix))))
+	}
+	if total > len(v.Elems) {
+		fmt.Fprintf(&sb, "\n%s... (%d more)", indent, total-len(v.Elems))
+	}
+	return sb.String()
+}
+
+// RowCount returns the elements of an aggregate reply
+func (v *redisValue) RowCount() int64 {
+	return int64(v.Len)
+}
+
+// redisErr returns the error of an error reply
+func redisErr(v *redisValue) error {
+	if v.Type != '-' && v.Type != '!' {
+		return nil
+	}
+	return errors.New(v.Str)
+}
+
+// redisUnsubscribed tells whether v confirms an unsubscription which leaves the client no subscription
+func redisUnsubscribed(v *redisValue) bool {
+	if (v.Type != '*' && v.Type != '>') || len(v.Elems) != 3 {
+		return false
+	}
+	kind, count := strings.ToLower(v.Elems[0].Str), v.Elems[2]
+	return lo.Contains([]string{"unsubscribe", "punsubscribe", "sunsubscribe"}, kind) && count.Type == ':' && count.Str == "0"
+}
@@ -0,0 +1,153 @@
+package dbproxy
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func readerConn(data string) *redisConn {
+	return &redisConn{r: bufio.NewReader(strings.NewReader(data))}
+}
+
+func TestRedisReadCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    []string
+		wantErr bool
+	}{
+		{name: "multibulk", data: "*2\r\n$3\r\nGET\r\n$1\r\nk\r\n", want: []string{"GET", "k"}},
+		{name: "binary", data: "*2\r\n$4\r\nECHO\r\n$4\r\na\r\nb\r\n", want: []string{"ECHO", "a\r\nb"}},
+		{name: "inline", data: "\r\nset k  v\r\n", want: []string{"set", "k", "v"}},
+		{name: "empty multibulk", data: "*0\r\n*1\r\n$4\r\nPING\r\n", want: []string{"PING"}},
+		{name: "invalid multibulk length", data: "*x\r\n", wantErr: true},
+		{name: "oversized multibulk", data: "*2000000\r\n", wantErr: true},
+		{name: "not a bulk", data: "*1\r\n:1\r\n", wantErr: true},
+		{name: "negative bulk length", data: "*1\r\n$-1\r\n", wantErr: true},
+		{name: "oversized bulk", data: "*1\r\n$1000000000\r\n", wantErr: true},
+		{name: "truncated bulk", data: "*1\r\n$10\r\nPING\r\n", wantErr: true},
+		{name: "eof", data: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readerConn(tt.data).readCommand()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readCommand() error = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readCommand() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedisReadValue(t *testing.T) {
+	long := strings.Repeat("x", redisMaxValueLen+10)
+	tests := []struct {
+		name    string
+		data    string
+		summary string
+		rows    int64
+		wantErr bool
+	}{
+		{name: "status", data: "+OK\r\n", summary: "OK"},
+		{name: "error", data: "-ERR unknown\r\n", summary: "(error) ERR unknown"},
+		{name: "integer", data: ":42\r\n", summary: "(integer) 42"},
+		{name: "bulk", data: "$5\r\nhe\r\no\r\n", summary: `"he\r\no"`},
+		{name: "null bulk", data: "$-1\r\n", summary: "(nil)"},
+		{name: "long bulk", data: "$" + "266" + "\r\n" + long + "\r\n", summary: `"` + long[:redisMaxValueLen] + `..."`},
+		{name: "verbatim", data: "=7\r\ntxt:abc\r\n", summary: `"abc"`},
+		{name: "array", data: "*2\r\n$1\r\na\r\n*1\r\n:1\r\n", summary: "1) \"a\"\n2) 1) (integer) 1", rows: 2},
+		{name: "empty map", data: "%0\r\n", summary: "(empty hash)"},
+		{name: "map", data: "%1\r\n+k\r\n+v\r\n", summary: "1) k\n2) v", rows: 1},
+		{name: "attribute", data: "|1\r\n+ttl\r\n:3\r\n:7\r\n", summary: "(integer) 7"},
+		{name: "boolean", data: "#t\r\n", summary: "(true)"},
+		{name: "missing cr", data: "+OK\n", wantErr: true},
+		{name: "unknown type", data: "?1\r\n", wantErr: true},
+		{name: "invalid bulk length", data: "$x\r\n", wantErr: true},
+		{name: "oversized bulk", data: "$1000000000\r\n", wantErr: true},
+		{name: "truncated bulk", data: "$10\r\nabc\r\n", wantErr: true},
+		{name: "truncated long bulk", data: "$300\r\n" + long, wantErr: true},
+		{name: "truncated array", data: "*2\r\n:1\r\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, raw, err := readerConn(tt.data).readValue()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readValue() error = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if string(raw) != tt.data {
+				t.Errorf("readValue() raw = %q, want %q", raw, tt.data)
+			}
+			if got := v.Summary(); got != tt.summary {
+				t.Errorf("Summary() = %q, want %q", got, tt.summary)
+			}
+			if got := v.RowCount(); got != tt.rows {
+				t.Errorf("RowCount() = %d, want %d", got, tt.rows)
+			}
+		})
+	}
+}
+
+// limitWriter fails once more than n bytes are written
+type limitWriter struct {
+	n int
+}
+
+func (w *limitWriter) Write(p []byte) (int, error) {
+	if w.n -= len(p); w.n < 0 {
+		return 0, io.ErrShortWrite
+	}
+	return len(p), nil
+}
+
+func TestRedisReadValueTo(t *testing.T) {
+	// A bulk string is copied as it is read rather than held in memory
+	n := 8 << 20
+	data := "$8388608\r\n" + strings.Repeat("x", n) + "\r\n+OK\r\n"
+	c := readerConn(data)
+	var out bytes.Buffer
+	v, err := c.readValueTo(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !v.Cut || len(v.Str) != redisMaxValueLen || out.String() != data[:len(data)-5] {
+		t.Errorf("readValueTo() = %d bytes with cut %v, relayed %d bytes", len(v.Str), v.Cut, out.Len())
+	}
+	if v, _, err = c.readValue(); err != nil || v.Str != "OK" {
+		t.Errorf("readValue() after the bulk = %+v, %v", v, err)
+	}
+
+	if _, err = readerConn(data).readValueTo(&limitWriter{n: 1 << 20}); err != io.ErrShortWrite {
+		t.Errorf("readValueTo() error = %v, want %v", err, io.ErrShortWrite)
+	}
+}
+
+func TestRedisUnsubscribed(t *testing.T) {
+	tests := []struct {
+		data string
+		want bool
+	}{
+		{"*3\r\n$11\r\nunsubscribe\r\n$2\r\nch\r\n:0\r\n", true},
+		{">3\r\n$12\r\npunsubscribe\r\n$2\r\np*\r\n:0\r\n", true},
+		{"*3\r\n$11\r\nunsubscribe\r\n$2\r\nch\r\n:1\r\n", false},
+		{"*3\r\n$7\r\nmessage\r\n$2\r\nch\r\n$1\r\n0\r\n", false},
+		{":0\r\n", false},
+	}
+	for _, tt := range tests {
+		v, _, err := readerConn(tt.data).readValue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := redisUnsubscribed(v); got != tt.want {
+			t.Errorf("redisUnsubscribed(%q) = %v, want %v", tt.data, got, tt.want)
+		}
+	}
+}
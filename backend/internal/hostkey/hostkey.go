@@ -0,0 +1,193 @@
+package hostkey
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ssh"
+	"gorm.io/gorm"
+
+	"github.com/veops/oneterm/internal/model"
+	dbpkg "github.com/veops/oneterm/pkg/db"
+	myErrors "github.com/veops/oneterm/pkg/errors"
+	"github.com/veops/oneterm/pkg/logger"
+)
+
+// Policy returns the host key policy from global config, tofu by default
+func Policy() string {
+	cfg := model.GlobalConfig.Load()
+	if cfg == nil {
+		return model.HostKeyPolicyTOFU
+	}
+	switch cfg.HostKeyPolicy {
+	case model.HostKeyPolicyStrict, model.HostKeyPolicyPinned:
+		return cfg.HostKeyPolicy
+	default:
+		return model.HostKeyPolicyTOFU
+	}
+}
+
+// Apply sets the host key callback of cfg for the given target, and restricts the
+// negotiated host key algorithms to the trusted key type so that servers offering
+// several keys are always verified against the same one
+func Apply(cfg *ssh.ClientConfig, targetType string, targetId int) *ssh.ClientConfig {
+	cfg.HostKeyCallback = Callback(targetType, targetId)
+	if kh, err := Get(targetType, targetId); err == nil && kh.KeyType != "" {
+		cfg.HostKeyAlgorithms = algorithms(kh.KeyType)
+	}
+	return cfg
+}
+
+// Callback returns a ssh.HostKeyCallback verifying keys against the known host store of the target
+func Callback(targetType string, targetId int) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		return Verify(targetType, targetId, hostname, key)
+	}
+}
+
+// Verify checks key against the known host of the target according to the current policy
+func Verify(targetType string, targetId int, address string, key ssh.PublicKey) (err error) {
+	fingerprint := ssh.FingerprintSHA256(key)
+	now := time.Now()
+
+	kh, err := Get(targetType, targetId)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		logger.L().Error("get known host failed", zap.String("targetType", targetType), zap.Int("targetId", targetId), zap.Error(err))
+		return err
+	}
+
+	if kh == nil {
+		switch Policy() {
+		case model.HostKeyPolicyPinned:
+			return &myErrors.ApiError{Code: myErrors.ErrHostKeyUnknown, Data: map[string]any{"host": address, "fingerprint": fingerprint}}
+		case model.HostKeyPolicyStrict:
+			kh = &model.KnownHost{
+				TargetType:         targetType,
+				TargetId:           targetId,
+				Address:            address,
+				Status:             model.KnownHostStatusPending,
+				PendingKeyType:     key.Type(),
+				PendingFingerprint: fingerprint,
+				PendingPublicKey:   MarshalKey(key),
+				LastSeenAt:         &now,
+			}
+			if err = dbpkg.DB.Create(kh).Error; err != nil {
+				return err
+			}
+			return &myErrors.ApiError{Code: myErrors.ErrHostKeyUnknown, Data: map[string]any{"host": address, "fingerprint": fingerprint}}
+		default:
+			kh = &model.KnownHost{
+				TargetType:  targetType,
+				TargetId:    targetId,
+				Address:     address,
+				Status:      model.KnownHostStatusTrusted,
+				KeyType:     key.Type(),
+				Fingerprint: fingerprint,
+				PublicKey:   MarshalKey(key),
+				LastSeenAt:  &now,
+			}
+			logger.L().Info("trust host key on first use", zap.String("targetType", targetType), zap.Int("targetId", targetId), zap.String("fingerprint", fingerprint))
+			return dbpkg.DB.Create(kh).Error
+		}
+	}
+
+	if kh.Fingerprint != "" && kh.Fingerprint == fingerprint {
+		return dbpkg.DB.Model(kh).Updates(map[string]any{"address": address, "last_seen_at": now}).Error
+	}
+
+	// Key has not been trusted yet, keep waiting for admin review
+	if kh.Fingerprint == "" {
+		if kh.PendingFingerprint != fingerprint {
+			if err = dbpkg.DB.Model(kh).Updates(map[string]any{
+				"address":             address,
+				"pending_key_type":    key.Type(),
+				"pending_fingerprint": fingerprint,
+				"pending_public_key":  MarshalKey(key),
+				"last_seen_at":        now,
+			}).Error; err != nil {
+				return err
+			}
+		}
+		return &myErrors.ApiError{Code: myErrors.ErrHostKeyUnknown, Data: map[string]any{"host": address, "fingerprint": fingerprint}}
+	}
+
+	// Trusted key does not match, block and record the change
+	if kh.PendingFingerprint != fingerprint || kh.Status != model.KnownHostStatusChanged {
+		old := map[string]any{"fingerprint": kh.Fingerprint, "key_type": kh.KeyType, "address": kh.Address}
+		if err = dbpkg.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(kh).Updates(map[string]any{
+				"address":             address,
+				"status":              model.KnownHostStatusChanged,
+				"pending_key_type":    key.Type(),
+				"pending_fingerprint": fingerprint,
+				"pending_public_key":  MarshalKey(key),
+				"last_seen_at":        now,
+			}).Error; err != nil {
+				return err
+			}
+			return tx.Create(&model.History{
+				Type:       kh.TableName(),
+				TargetId:   kh.Id,
+				ActionType: model.ACTION_UPDATE,
+				Old:        old,
+				New: map[string]any{
+					"fingerprint": fingerprint,
+					"key_type":    key.Type(),
+					"address":     address,
+					"status":      model.KnownHostStatusChanged,
+					"target_type": targetType,
+					"target_id":   targetId,
+				},
+				CreatedAt: now,
+			}).Error
+		}); err != nil {
+			return err
+		}
+	}
+	logger.L().Warn("host key changed", zap.String("targetType", targetType), zap.Int("targetId", targetId),
+		zap.String("address", address), zap.String("trusted", kh.Fingerprint), zap.String("offered", fingerprint))
+
+	return &myErrors.ApiError{Code: myErrors.ErrHostKeyChanged, Data: map[string]any{"host": address, "fingerprint": fingerprint}}
+}
+
+// Get returns the known host of the target
+func Get(targetType string, targetId int) (*model.KnownHost, error) {
+	kh := &model.KnownHost{}
+	if err := dbpkg.DB.
+		Where("target_type = ? AND target_id = ?", targetType, targetId).
+		First(kh).Error; err != nil {
+		return nil, err
+	}
+	return kh, nil
+}
+
+// ParseKey parses a public key in authorized_keys or known_hosts format
+func ParseKey(s string) (ssh.PublicKey, error) {
+	s = strings.TrimSpace(s)
+	if key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(s)); err == nil {
+		return key, nil
+	}
+	_, _, key, _, _, err := ssh.ParseKnownHosts([]byte(s))
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+	return key, nil
+}
+
+// MarshalKey marshals key in authorized_keys format
+func MarshalKey(key ssh.PublicKey) string {
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+}
+
+func algorithms(keyType string) []string {
+	switch keyType {
+	case ssh.KeyAlgoRSA:
+		return []string{ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA}
+	default:
+		return []string{keyType}
+	}
+}
@@ -103,6 +103,31 @@ var (
 		One:   "Bad Request: idle timeout more than {{.second}} seconds",
 		Other: "Bad Request: idle timeout more than {{.second}} seconds",
 	}
+	MsgSessionTimeout = &i18n.Message{
+		ID:    "MsgSessionTimeout",
+		One:   "Bad Request: session lasts more than {{.second}} seconds",
+		Other: "Bad Request: session lasts more than {{.second}} seconds",
+	}
+	MsgMaxSessions = &i18n.Message{
+		ID:    "MsgMaxSessions",
+		One:   "Bad Request: rule {{.rule}} allows at most {{.max}} concurrent sessions",
+		Other: "Bad Request: rule {{.rule}} allows at most {{.max}} concurrent sessions",
+	}
+	MsgHostKeyUnknown = &i18n.Message{
+		ID:    "MsgHostKeyUnknown",
+		One:   "Bad Request: host key of {{.host}} is not trusted, fingerprint {{.fingerprint}} needs to be reviewed by admin",
+		Other: "Bad Request: host key of {{.host}} is not trusted, fingerprint {{.fingerprint}} needs to be reviewed by admin",
+	}
+	MsgHostKeyChanged = &i18n.Message{
+		ID:    "MsgHostKeyChanged",
+		One:   "Bad Request: host key of {{.host}} has changed to {{.fingerprint}}, connection is refused",
+		Other: "Bad Request: host key of {{.host}} has changed to {{.fingerprint}}, connection is refused",
+	}
+	MsgGatewayHasChild = &i18n.Message{
+		ID:    "MsgGatewayHasChild",
+		One:   "Bad Request: Gateway {{.name}} is reached through this, cannot be deleted",
+		Other: "Bad Request: Gateway {{.name}} is reached through this, cannot be deleted",
+	}
 	MsgUnauthorized = &i18n.Message{
 		ID:    "MsgUnauthorized",
 		One:   "Unauthorized",
@@ -161,6 +186,11 @@ var (
 		One:   "Node",
 		Other: "Node",
 	}
+	MsgTypeMappingKnownHost = &i18n.Message{
+		ID:    "MsgTypeMappingKnownHost",
+		One:   "Known Host",
+		Other: "Known Host",
+	}
 	MsgTypeMappingPublicKey = &i18n.Message{
 		ID:    "MsgTypeMappingPublicKey",
 		One:   "Public Key",
@@ -14,6 +14,7 @@ type Account struct {
 	Password    string `json:"password,omitempty" gorm:"column:password"`
 	Pk          string `json:"pk,omitempty" gorm:"column:pk"`
 	Phrase      string `json:"phrase,omitempty" gorm:"column:phrase"`
+	Tags        Tags   `json:"tags,omitempty" gorm:"column:tags;type:json"`
 
 	Permissions []string              `json:"permissions,omitempty" gorm:"-"`
 	ResourceId  int                   `json:"resource_id,omitempty" gorm:"column:resource_id"`
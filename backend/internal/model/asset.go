@@ -132,7 +132,9 @@ type Asset struct {
 	Authorization AuthorizationMap `json:"authorization" gorm:"column:authorization;type:text"`
 	AccessAuth    AccessAuth       `json:"access_auth" gorm:"embedded;column:access_auth"` // Deprecated: Use V2 fields below
 	Connectable   bool             `json:"connectable" gorm:"column:connectable"`
+	RecordInput   bool             `json:"record_input" gorm:"column:record_input"` // Record keystrokes of terminal sessions
 	NodeChain     string           `json:"node_chain" gorm:"-"`
+	Tags          Tags             `json:"tags" gorm:"column:tags;type:json"`
 
 	// V2 Access Control (replaces AccessAuth)
 	AccessTimeControl   *AccessTimeControl   `json:"access_time_control,omitempty" gorm:"column:access_time_control;type:json"`
@@ -165,6 +167,7 @@ func getDefaultPermissionsForAsset() AuthPermissions {
 		Copy:         false,
 		Paste:        false,
 		Share:        false,
+		PortForward:  false,
 	}
 }
 
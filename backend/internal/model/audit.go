@@ -0,0 +1,85 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+// AuditChain is a link of the hash chain over history and session_cmd rows.
+// Hash is the sha256 of the previous hash, the target and the digest of the row, it is signed with the audit key.
+type AuditChain struct {
+	Id         int    `json:"id" gorm:"column:id;primarykey;autoIncrement"`
+	TargetType string `json:"target_type" gorm:"column:target_type;size:32;index:target_type_id"`
+	TargetId   int    `json:"target_id" gorm:"column:target_id;index:target_type_id"`
+	Digest     string `json:"digest" gorm:"column:digest;size:64"`
+	PrevHash   string `json:"prev_hash" gorm:"column:prev_hash;size:64"`
+	Hash       string `json:"hash" gorm:"column:hash;size:64"`
+	Signature  string `json:"signature" gorm:"column:signature;size:128"`
+
+	CreatedAt time.Time `json:"created_at" gorm:"column:created_at"`
+}
+
+func (m *AuditChain) TableName() string {
+	return "audit_chain"
+}
+
+// AuditIssue is a problem found when verifying the audit chain
+type AuditIssue struct {
+	ChainId    int    `json:"chain_id"`
+	TargetType string `json:"target_type"`
+	TargetId   int    `json:"target_id"`
+	Problem    string `json:"problem"` // "gap", "modified", "deleted", "signature", "unchained"
+}
+
+// AuditReport is the result of verifying the audit chain
+type AuditReport struct {
+	Checked   int           `json:"checked"`
+	Head      string        `json:"head"`
+	Valid     bool          `json:"valid"`
+	Issues    []*AuditIssue `json:"issues"`
+	PublicKey string        `json:"public_key"` // base64 ed25519 key of the signatures
+}
+
+// ReplaySignature is the signed sha256 digest of a finalized session recording
+type ReplaySignature struct {
+	Id        int    `json:"id" gorm:"column:id;primarykey;autoIncrement"`
+	SessionId string `json:"session_id" gorm:"column:session_id;size:128;uniqueIndex"`
+	Digest    string `json:"digest" gorm:"column:digest;size:64"`
+	Size      int64  `json:"size" gorm:"column:size"`
+	Signature string `json:"signature" gorm:"column:signature;size:128"`
+
+	CreatedAt time.Time `json:"created_at" gorm:"column:created_at"`
+}
+
+func (m *ReplaySignature) TableName() string {
+	return "session_replay_signature"
+}
+
+// ReplayVerification is the result of verifying a recording against its signature
+type ReplayVerification struct {
+	SessionId string `json:"session_id"`
+	Signed    bool   `json:"signed"`
+	Valid     bool   `json:"valid"`
+	Digest    string `json:"digest"`
+	Expected  string `json:"expected"`
+	Size      int64  `json:"size"`
+	Error     string `json:"error,omitempty"`
+}
+
+// AuditDigest returns the digest of the fields of the row which are covered by the audit chain
+func (m *History) AuditDigest() string {
+	return auditDigest([]any{m.Id, m.RemoteIp, m.Type, m.TargetId, m.ActionType, m.Old, m.New, m.CreatorId, m.CreatedAt.UnixMicro()})
+}
+
+// AuditDigest returns the digest of the fields of the row which are covered by the audit chain
+func (m *SessionCmd) AuditDigest() string {
+	return auditDigest([]any{m.Id, m.SessionId, m.Uid, m.UserName, m.Cmd, m.Result, m.Level, m.Action, m.CreatedAt.UnixMicro()})
+}
+
+func auditDigest(fields []any) string {
+	bs, _ := json.Marshal(fields)
+	sum := sha256.Sum256(bs)
+	return hex.EncodeToString(sum[:])
+}
@@ -7,6 +7,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/spf13/cast"
 	"gorm.io/plugin/soft_delete"
 )
 
@@ -69,6 +70,7 @@ const (
 	ActionCopy         AuthAction = "copy"
 	ActionPaste        AuthAction = "paste"
 	ActionShare        AuthAction = "share"
+	ActionPortForward  AuthAction = "port_forward"
 )
 
 // TimeRange defines time restrictions
@@ -128,6 +130,7 @@ type AssetCommandControl struct {
 	CmdIds      Slice[int] `json:"cmd_ids" gorm:"column:cmd_ids"`           // Command IDs to control
 	TemplateIds Slice[int] `json:"template_ids" gorm:"column:template_ids"` // Command template IDs
 	Comment     string     `json:"comment" gorm:"column:comment"`           // Description of the command restriction
+	Allowlist   bool       `json:"allowlist" gorm:"column:allowlist"`       // Reject commands which are not explicitly allowed
 }
 
 func (a *AssetCommandControl) Scan(value interface{}) error {
@@ -167,6 +170,7 @@ type AuthPermissions struct {
 	Copy         bool `json:"copy" gorm:"column:copy"`
 	Paste        bool `json:"paste" gorm:"column:paste"`
 	Share        bool `json:"share" gorm:"column:share"`
+	PortForward  bool `json:"port_forward" gorm:"column:port_forward"`
 }
 
 func (p *AuthPermissions) Scan(value interface{}) error {
@@ -194,6 +198,8 @@ func (p *AuthPermissions) HasPermission(action AuthAction) bool {
 		return p.Paste
 	case ActionShare:
 		return p.Share
+	case ActionPortForward:
+		return p.PortForward
 	default:
 		return false
 	}
@@ -208,6 +214,16 @@ const (
 	CommandActionAudit CommandAction = "audit" // Log but allow
 )
 
+// IsValid checks if the action is one of the defined actions
+func (a CommandAction) IsValid() bool {
+	switch a {
+	case CommandActionAllow, CommandActionDeny, CommandActionAudit:
+		return true
+	default:
+		return false
+	}
+}
+
 // AccessControl defines access control restrictions for authorization rules with time template support
 type AccessControl struct {
 	IPWhitelist Slice[string] `json:"ip_whitelist" gorm:"column:ip_whitelist"`
@@ -218,11 +234,25 @@ type AccessControl struct {
 	Timezone         string                 `json:"timezone" gorm:"column:timezone;size:64"`
 
 	// Command control
-	CmdIds      Slice[int] `json:"cmd_ids" gorm:"column:cmd_ids"`
-	TemplateIds Slice[int] `json:"template_ids" gorm:"column:template_ids"`
+	CmdIds       Slice[int] `json:"cmd_ids" gorm:"column:cmd_ids"`
+	TemplateIds  Slice[int] `json:"template_ids" gorm:"column:template_ids"`
+	CmdAllowlist bool       `json:"cmd_allowlist" gorm:"column:cmd_allowlist"` // Reject commands which are not explicitly allowed
 
-	MaxSessions    int `json:"max_sessions" gorm:"column:max_sessions"`
-	SessionTimeout int `json:"session_timeout" gorm:"column:session_timeout"`
+	// Session control, 0 means no limit
+	MaxSessions    int `json:"max_sessions" gorm:"column:max_sessions"`       // Concurrent sessions of a user
+	SessionTimeout int `json:"session_timeout" gorm:"column:session_timeout"` // Absolute session lifetime in seconds
+
+	// Record keystrokes of terminal sessions as input events of the replay
+	RecordInput bool `json:"record_input" gorm:"column:record_input"`
+}
+
+// Restrictions returns the session restrictions which are enforced after the rule matched
+func (a AccessControl) Restrictions() map[string]any {
+	return map[string]any{
+		"max_sessions":    a.MaxSessions,
+		"session_timeout": a.SessionTimeout,
+		"record_input":    a.RecordInput,
+	}
 }
 
 func (a *AccessControl) Scan(value interface{}) error {
@@ -362,6 +392,31 @@ type AuthResult struct {
 	Restrictions map[string]interface{} `json:"restrictions"`
 }
 
+// MaxSessions returns the concurrent session limit of the matched rule, 0 means no limit
+func (r *AuthResult) MaxSessions() int {
+	if r == nil {
+		return 0
+	}
+	// Restrictions loaded from cache are decoded from json
+	return cast.ToInt(r.Restrictions["max_sessions"])
+}
+
+// SessionTimeout returns the absolute session lifetime of the matched rule, 0 means no limit
+func (r *AuthResult) SessionTimeout() time.Duration {
+	if r == nil {
+		return 0
+	}
+	return time.Duration(cast.ToInt(r.Restrictions["session_timeout"])) * time.Second
+}
+
+// RecordInput returns whether the matched rule records keystrokes of terminal sessions
+func (r *AuthResult) RecordInput() bool {
+	if r == nil {
+		return false
+	}
+	return cast.ToBool(r.Restrictions["record_input"])
+}
+
 // BatchAuthResult represents the result of a batch authorization check
 type BatchAuthResult struct {
 	Results map[AuthAction]*AuthResult `json:"results"`
@@ -382,9 +437,10 @@ func (r *BatchAuthResult) GetResult(action AuthAction) *AuthResult {
 
 // CommandCheckResult represents the result of a command permission check
 type CommandCheckResult struct {
-	Allowed bool          `json:"allowed"`
-	Action  CommandAction `json:"action"`
-	Reason  string        `json:"reason"`
+	Allowed   bool             `json:"allowed"`
+	Action    CommandAction    `json:"action"`
+	Reason    string           `json:"reason"`
+	RiskLevel CommandRiskLevel `json:"risk_level"`
 }
 
 // DefaultAuthorizationV2 for caching
@@ -43,7 +43,8 @@ type Command struct {
 	RiskLevel   CommandRiskLevel `json:"risk_level" gorm:"column:risk_level;default:0"`
 	Description string           `json:"description" gorm:"column:description"`
 	Tags        Slice[string]    `json:"tags" gorm:"column:tags;type:json"`
-	IsGlobal    bool             `json:"is_global" gorm:"column:is_global;default:false"` // Global predefined command
+	IsGlobal    bool             `json:"is_global" gorm:"column:is_global;default:false"`  // Global predefined command
+	Action      CommandAction    `json:"action" gorm:"column:action;size:16;default:deny"` // Action taken when the command matches
 
 	Permissions []string              `json:"permissions" gorm:"-"`
 	ResourceId  int                   `json:"resource_id" gorm:"column:resource_id"`
@@ -83,9 +84,22 @@ func (m *Command) SetPerms(perms []string) {
 	m.Permissions = perms
 }
 
+// GetAction returns the action taken when the command matches, deny by default
+func (m *Command) GetAction() CommandAction {
+	if m.Action.IsValid() {
+		return m.Action
+	}
+	return CommandActionDeny
+}
+
 // GetRiskLevelText returns human readable risk level
 func (m *Command) GetRiskLevelText() string {
-	switch m.RiskLevel {
+	return m.RiskLevel.Text()
+}
+
+// Text returns human readable risk level
+func (l CommandRiskLevel) Text() string {
+	switch l {
 	case RiskLevelSafe:
 		return "Safe"
 	case RiskLevelWarning:
@@ -107,6 +121,7 @@ type CommandTemplate struct {
 	Category    CommandCategory `json:"category" gorm:"column:category"`
 	CmdIds      Slice[int]      `json:"cmd_ids" gorm:"column:cmd_ids;type:json"`
 	IsBuiltin   bool            `json:"is_builtin" gorm:"column:is_builtin;default:false"` // Built-in template
+	Action      CommandAction   `json:"action" gorm:"column:action;size:16"`               // Overrides action of its commands if set
 	ResourceId  int             `json:"resource_id" gorm:"column:resource_id"`
 	CreatorId   int             `json:"creator_id" gorm:"column:creator_id"`
 	UpdaterId   int             `json:"updater_id" gorm:"column:updater_id"`
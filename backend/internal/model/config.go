@@ -9,6 +9,12 @@ import (
 
 var (
 	GlobalConfig atomic.Pointer[Config]
+
+	// DefaultDetachTimeout is how long a web terminal is kept for reattaching after its websocket is dropped
+	DefaultDetachTimeout = time.Minute * 5
+
+	// DefaultInputMaskPrompts matches common password prompts, e.g. of sudo, su, ssh and mysql
+	DefaultInputMaskPrompts = []string{`(?i)(password|passphrase|passcode|密码)[^\n]*[:：]\s*$`}
 )
 
 // DefaultPermissions defines default permissions for authorization
@@ -19,12 +25,24 @@ type DefaultPermissions struct {
 	Copy         bool `json:"copy" gorm:"column:copy"`
 	Paste        bool `json:"paste" gorm:"column:paste"`
 	Share        bool `json:"share" gorm:"column:share"`
+	PortForward  bool `json:"port_forward" gorm:"column:port_forward"`
 }
 
 type Config struct {
 	Id      int `json:"id" gorm:"column:id;primarykey;autoIncrement"`
 	Timeout int `json:"timeout" gorm:"column:timeout"`
 
+	// DetachTimeout is the seconds a web terminal is kept after its websocket is dropped, 0 means DefaultDetachTimeout
+	// and a negative value closes the session at once
+	DetachTimeout int `json:"detach_timeout" gorm:"column:detach_timeout"`
+
+	// HostKeyPolicy controls how target SSH host keys are verified: tofu, strict or pinned
+	HostKeyPolicy string `json:"host_key_policy" gorm:"column:host_key_policy;size:16;default:tofu"`
+
+	// InputMaskPrompts are regular expressions of password prompts, keystrokes recorded after a matching prompt are masked.
+	// Empty means DefaultInputMaskPrompts.
+	InputMaskPrompts Slice[string] `json:"input_mask_prompts" gorm:"column:input_mask_prompts;type:text"`
+
 	// Default permissions for authorization creation
 	DefaultPermissions DefaultPermissions `json:"default_permissions" gorm:"embedded;embeddedPrefix:default_"`
 
@@ -39,6 +57,25 @@ func (m *Config) TableName() string {
 	return "config"
 }
 
+// GetInputMaskPrompts returns the password prompts after which recorded keystrokes are masked
+func (c *Config) GetInputMaskPrompts() []string {
+	if c == nil || len(c.InputMaskPrompts) == 0 {
+		return DefaultInputMaskPrompts
+	}
+	return c.InputMaskPrompts
+}
+
+// GetDetachTimeout returns how long a detached web terminal is kept, 0 means it is not kept
+func (c *Config) GetDetachTimeout() time.Duration {
+	switch {
+	case c == nil || c.DetachTimeout == 0:
+		return DefaultDetachTimeout
+	case c.DetachTimeout < 0:
+		return 0
+	}
+	return time.Second * time.Duration(c.DetachTimeout)
+}
+
 // GetDefaultPermissions returns the default permissions configuration
 func (c *Config) GetDefaultPermissions() DefaultPermissions {
 	return c.DefaultPermissions
@@ -53,6 +90,7 @@ func (c *Config) GetDefaultPermissionsAsAuthPermissions() AuthPermissions {
 		Copy:         c.DefaultPermissions.Copy,
 		Paste:        c.DefaultPermissions.Paste,
 		Share:        c.DefaultPermissions.Share,
+		PortForward:  c.DefaultPermissions.PortForward,
 	}
 }
 
@@ -79,7 +117,8 @@ func GetDefaultScheduleConfig() *ScheduleConfig {
 // GetDefaultConfig returns a default configuration with reasonable defaults
 func GetDefaultConfig() *Config {
 	return &Config{
-		Timeout: 1800, // 30 minutes
+		Timeout:       1800, // 30 minutes
+		HostKeyPolicy: HostKeyPolicyTOFU,
 		DefaultPermissions: DefaultPermissions{
 			Connect:      true,
 			FileUpload:   true,
@@ -87,6 +126,7 @@ func GetDefaultConfig() *Config {
 			Copy:         true,
 			Paste:        true,
 			Share:        false, // Share is disabled by default for security
+			PortForward:  false, // Port forwarding is disabled by default for security
 		},
 	}
 }
@@ -1,24 +1,30 @@
 package model
 
 var (
-	DefaultAccount         = &Account{}
-	DefaultAsset           = &Asset{}
-	DefaultAuthorization   = &Authorization{}
-	DefaultCommand         = &Command{}
-	DefaultCommandTemplate = &CommandTemplate{}
-	DefaultConfig          = &Config{}
-	DefaultFileHistory     = &FileHistory{}
-	DefaultGateway         = &Gateway{}
-	DefaultHistory         = &History{}
-	DefaultNode            = &Node{}
-	DefaultPublicKey       = &PublicKey{}
-	DefaultSession         = &Session{}
-	DefaultSessionCmd      = &SessionCmd{}
-	DefaultShare           = &Share{}
-	DefaultQuickCommand    = &QuickCommand{}
-	DefaultUserPreference  = &UserPreference{}
-	DefaultStorageConfig   = &StorageConfig{}
-	DefaultStorageMetrics  = &StorageMetrics{}
-	DefaultMigrationRecord = &MigrationRecord{}
-	DefaultSystemConfig    = &SystemConfig{}
+	DefaultAccount           = &Account{}
+	DefaultAuditChain        = &AuditChain{}
+	DefaultAsset             = &Asset{}
+	DefaultAuthorization     = &Authorization{}
+	DefaultCommand           = &Command{}
+	DefaultCommandTemplate   = &CommandTemplate{}
+	DefaultConfig            = &Config{}
+	DefaultFileHistory       = &FileHistory{}
+	DefaultGateway           = &Gateway{}
+	DefaultHistory           = &History{}
+	DefaultKnownHost         = &KnownHost{}
+	DefaultNode              = &Node{}
+	DefaultPublicKey         = &PublicKey{}
+	DefaultSession           = &Session{}
+	DefaultSessionCmd        = &SessionCmd{}
+	DefaultSessionOutput     = &SessionOutput{}
+	DefaultSessionOutputTerm = &SessionOutputTerm{}
+	DefaultReplayIndex       = &ReplayIndex{}
+	DefaultReplaySignature   = &ReplaySignature{}
+	DefaultShare             = &Share{}
+	DefaultQuickCommand      = &QuickCommand{}
+	DefaultUserPreference    = &UserPreference{}
+	DefaultStorageConfig     = &StorageConfig{}
+	DefaultStorageMetrics    = &StorageMetrics{}
+	DefaultMigrationRecord   = &MigrationRecord{}
+	DefaultSystemConfig      = &SystemConfig{}
 )
@@ -9,6 +9,10 @@ const (
 	FILE_ACTION_MKDIR
 	FILE_ACTION_UPLOAD
 	FILE_ACTION_DOWNLOAD
+	FILE_ACTION_REMOVE
+	FILE_ACTION_RMDIR
+	FILE_ACTION_RENAME
+	FILE_ACTION_SETSTAT
 )
 
 type FileHistory struct {
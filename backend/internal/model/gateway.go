@@ -1,11 +1,18 @@
 package model
 
 import (
+	"fmt"
+	"strings"
 	"time"
 
 	"gorm.io/plugin/soft_delete"
 )
 
+const (
+	// MaxGatewayHops is the max length of a gateway chain
+	MaxGatewayHops = 8
+)
+
 type Gateway struct {
 	Id          int    `json:"id" gorm:"column:id;primarykey;autoIncrement"`
 	Name        string `json:"name" gorm:"column:name;uniqueIndex:name_del;size:128"`
@@ -16,6 +23,8 @@ type Gateway struct {
 	Password    string `json:"password" gorm:"column:password"`
 	Pk          string `json:"pk" gorm:"column:pk"`
 	Phrase      string `json:"phrase" gorm:"column:phrase"`
+	// ParentId is the gateway this one is reached through, 0 means it is reached directly
+	ParentId int `json:"parent_id" gorm:"column:parent_id"`
 
 	Permissions []string              `json:"permissions" gorm:"-"`
 	ResourceId  int                   `json:"resource_id" gorm:"column:resource_id"`
@@ -25,7 +34,9 @@ type Gateway struct {
 	UpdatedAt   time.Time             `json:"updated_at" gorm:"column:updated_at"`
 	DeletedAt   soft_delete.DeletedAt `json:"-" gorm:"column:deleted_at;uniqueIndex:name_del"`
 
-	AssetCount int64 `json:"asset_count" gorm:"-"`
+	AssetCount int64         `json:"asset_count" gorm:"-"`
+	Hops       []*GatewayHop `json:"hops" gorm:"-"`
+	Parent     *Gateway      `json:"-" gorm:"-"`
 }
 
 func (m *Gateway) TableName() string {
@@ -57,6 +68,36 @@ func (m *Gateway) SetPerms(perms []string) {
 	m.Permissions = perms
 }
 
+// Chain returns the hops from the one dialed directly to the gateway itself
+func (m *Gateway) Chain() []*Gateway {
+	chain := make([]*Gateway, 0)
+	for g := m; g != nil; g = g.Parent {
+		chain = append([]*Gateway{g}, chain...)
+	}
+	return chain
+}
+
+// Path describes the chain, e.g. dmz(10.0.0.1) -> vpc(172.16.0.1)
+func (m *Gateway) Path() string {
+	hops := make([]string, 0)
+	for _, g := range m.Chain() {
+		hops = append(hops, fmt.Sprintf("%s(%s)", g.Name, g.Host))
+	}
+	return strings.Join(hops, " -> ")
+}
+
+// GatewayHop is a hop of a gateway chain with its latest health check
+type GatewayHop struct {
+	Id        int       `json:"id"`
+	Name      string    `json:"name"`
+	Host      string    `json:"host"`
+	Port      int       `json:"port"`
+	Healthy   bool      `json:"healthy"`
+	Latency   int64     `json:"latency"` // milliseconds
+	Error     string    `json:"error"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
 type GatewayCount struct {
 	Id    int   `gorm:"column:id"`
 	Count int64 `gorm:"column:count"`
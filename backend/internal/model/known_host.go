@@ -0,0 +1,81 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/plugin/soft_delete"
+)
+
+// Host key verification policies
+const (
+	// HostKeyPolicyTOFU trusts the key offered on the first connection and blocks any later change
+	HostKeyPolicyTOFU = "tofu"
+	// HostKeyPolicyStrict records unknown keys as pending and refuses to connect until an admin accepts them
+	HostKeyPolicyStrict = "strict"
+	// HostKeyPolicyPinned only accepts keys pinned by an admin beforehand, unknown keys are refused without being recorded
+	HostKeyPolicyPinned = "pinned"
+)
+
+// Known host target types
+const (
+	KnownHostTargetAsset   = "asset"
+	KnownHostTargetGateway = "gateway"
+)
+
+// Known host status
+const (
+	KnownHostStatusTrusted = "trusted"
+	KnownHostStatusPending = "pending"
+	KnownHostStatusChanged = "changed"
+)
+
+// KnownHost stores the SSH host key trusted for an asset or a gateway
+type KnownHost struct {
+	Id         int    `json:"id" gorm:"column:id;primarykey;autoIncrement"`
+	TargetType string `json:"target_type" gorm:"column:target_type;uniqueIndex:target_del;size:32"`
+	TargetId   int    `json:"target_id" gorm:"column:target_id;uniqueIndex:target_del"`
+	Address    string `json:"address" gorm:"column:address;size:255"`
+	Status     string `json:"status" gorm:"column:status;size:16"`
+
+	// Trusted key
+	KeyType     string `json:"key_type" gorm:"column:key_type;size:64"`
+	Fingerprint string `json:"fingerprint" gorm:"column:fingerprint;size:128"`
+	PublicKey   string `json:"public_key" gorm:"column:public_key;type:text"`
+
+	// Key offered by the host which is waiting for review
+	PendingKeyType     string `json:"pending_key_type" gorm:"column:pending_key_type;size:64"`
+	PendingFingerprint string `json:"pending_fingerprint" gorm:"column:pending_fingerprint;size:128"`
+	PendingPublicKey   string `json:"pending_public_key" gorm:"column:pending_public_key;type:text"`
+
+	LastSeenAt *time.Time `json:"last_seen_at" gorm:"column:last_seen_at"`
+
+	CreatorId int                   `json:"creator_id" gorm:"column:creator_id"`
+	UpdaterId int                   `json:"updater_id" gorm:"column:updater_id"`
+	CreatedAt time.Time             `json:"created_at" gorm:"column:created_at"`
+	UpdatedAt time.Time             `json:"updated_at" gorm:"column:updated_at"`
+	DeletedAt soft_delete.DeletedAt `json:"-" gorm:"column:deleted_at;uniqueIndex:target_del"`
+}
+
+func (m *KnownHost) TableName() string {
+	return "known_host"
+}
+func (m *KnownHost) SetId(id int) {
+	m.Id = id
+}
+func (m *KnownHost) SetCreatorId(creatorId int) {
+	m.CreatorId = creatorId
+}
+func (m *KnownHost) SetUpdaterId(updaterId int) {
+	m.UpdaterId = updaterId
+}
+func (m *KnownHost) SetResourceId(resourceId int) {}
+func (m *KnownHost) GetResourceId() int {
+	return 0
+}
+func (m *KnownHost) GetName() string {
+	return m.Address
+}
+func (m *KnownHost) GetId() int {
+	return m.Id
+}
+func (m *KnownHost) SetPerms(perms []string) {}
@@ -11,9 +11,13 @@ const (
 	ACTION_UPDATE
 )
 
-type Slice[T int | string | Range] []T
+type Slice[T int | string | Range | ReplayPoint | ReplayCheckpoint] []T
 
 func (s *Slice[T]) Scan(value any) error {
+	if value == nil {
+		*s = nil
+		return nil
+	}
 	return json.Unmarshal(value.([]byte), s)
 }
 
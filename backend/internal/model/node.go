@@ -19,6 +19,7 @@ type Node struct {
 	AccessAuth    AccessAuth       `json:"access_auth" gorm:"embedded;column:access_auth"`
 	Protocols     Slice[string]    `json:"protocols" gorm:"column:protocols;type:text"`
 	GatewayId     int              `json:"gateway_id" gorm:"column:gateway_id"`
+	Tags          Tags             `json:"tags" gorm:"column:tags;type:json"` // Inherited by child nodes and assets
 
 	Permissions []string              `json:"permissions" gorm:"-"`
 	ResourceId  int                   `json:"resource_id" gorm:"column:resource_id"`
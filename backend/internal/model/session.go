@@ -13,6 +13,17 @@ const (
 const (
 	SESSIONSTATUS_ONLINE = iota + 1
 	SESSIONSTATUS_OFFLINE
+	SESSIONSTATUS_DETACHED // web terminal whose websocket is dropped, it is kept for reattaching
+)
+
+// Reasons why sessions are closed
+const (
+	SESSIONCLOSE_IDLE_TIMEOUT      = "idle_timeout"
+	SESSIONCLOSE_SESSION_TIMEOUT   = "session_timeout"
+	SESSIONCLOSE_ADMIN_CLOSE       = "admin_close"
+	SESSIONCLOSE_ACCESS_TIME       = "access_time"
+	SESSIONCLOSE_CLIENT_DISCONNECT = "client_disconnect"
+	SESSIONCLOSE_REMOTE_EXIT       = "remote_exit"
 )
 
 const (
@@ -40,6 +51,13 @@ type Session struct {
 	Duration    int64      `json:"duration" gorm:"-"`
 	ClosedAt    *time.Time `json:"closed_at" gorm:"column:closed_at"`
 	ShareId     int        `json:"share_id" gorm:"column:share_id"`
+	ExitCode    *int       `json:"exit_code" gorm:"column:exit_code"`
+	BytesIn     int64      `json:"bytes_in" gorm:"column:bytes_in"`
+	BytesOut    int64      `json:"bytes_out" gorm:"column:bytes_out"`
+	CloseReason string     `json:"close_reason" gorm:"column:close_reason;size:32"`
+	PeakWidth   int        `json:"peak_width" gorm:"column:peak_width"`
+	PeakHeight  int        `json:"peak_height" gorm:"column:peak_height"`
+	Forbidden   int64      `json:"forbidden" gorm:"column:forbidden"` // Hits of forbidden commands
 
 	CreatedAt time.Time `json:"created_at" gorm:"column:created_at"`
 	UpdatedAt time.Time `json:"updated_at" gorm:"column:updated_at"`
@@ -54,9 +72,14 @@ func (m *Session) TableName() string {
 type SessionCmd struct {
 	Id        int    `json:"id" gorm:"column:id;primarykey;autoIncrement"`
 	SessionId string `json:"session_id" gorm:"column:session_id"`
+	Uid       int    `json:"uid" gorm:"column:uid"` // User who typed the command, a participant may hold control
+	UserName  string `json:"user_name" gorm:"column:user_name"`
 	Cmd       string `json:"cmd" gorm:"column:cmd"`
 	Result    string `json:"result" gorm:"column:result"`
 	Level     int    `json:"level" gorm:"column:level"`
+	Action    string `json:"action" gorm:"column:action;size:16"`
+	RowCount  int64  `json:"row_count" gorm:"column:row_count"` // Rows returned or affected by a statement of a database proxy
+	Elapsed   int64  `json:"elapsed" gorm:"column:elapsed"`     // Milliseconds a statement of a database proxy took
 
 	CreatedAt time.Time `json:"created_at" gorm:"column:created_at"`
 }
@@ -65,6 +88,118 @@ func (m *SessionCmd) TableName() string {
 	return "session_cmd"
 }
 
+// SessionOutput is a line of the terminal output of a recorded session, it is indexed for full-text search
+type SessionOutput struct {
+	Id        int     `json:"id" gorm:"column:id;primarykey;autoIncrement"`
+	SessionId string  `json:"session_id" gorm:"column:session_id;index;size:128"`
+	Offset    float64 `json:"offset" gorm:"column:replay_offset"` // Seconds from the start of the replay
+	Line      string  `json:"line" gorm:"column:line;type:text"`
+
+	CreatedAt time.Time `json:"created_at" gorm:"column:created_at"`
+}
+
+func (m *SessionOutput) TableName() string {
+	return "session_output"
+}
+
+// SessionOutputTerm is an entry of the inverted index of session output lines
+type SessionOutputTerm struct {
+	Term     string `gorm:"column:term;primarykey;size:64"`
+	OutputId int    `gorm:"column:output_id;primarykey;index"`
+}
+
+func (m *SessionOutputTerm) TableName() string {
+	return "session_output_term"
+}
+
+// ReplayIndex is the seek index of a recording, it maps times of the recording to byte offsets
+type ReplayIndex struct {
+	Id        int                `json:"-" gorm:"column:id;primarykey;autoIncrement"`
+	SessionId string             `json:"session_id" gorm:"column:session_id;uniqueIndex;size:128"`
+	Duration  float64            `json:"duration" gorm:"column:duration"` // Seconds
+	Size      int64              `json:"size" gorm:"column:size"`         // Bytes of the whole recording
+	Points    Slice[ReplayPoint] `json:"points" gorm:"column:points;type:text"`
+	Markers   []*ReplayMarker    `json:"markers" gorm:"-"`
+
+	// Checkpoints are screens of a terminal recording which slices of it start from
+	Checkpoints Slice[ReplayCheckpoint] `json:"-" gorm:"column:checkpoints;type:longtext"`
+
+	CreatedAt time.Time `json:"created_at" gorm:"column:created_at"`
+}
+
+func (m *ReplayIndex) TableName() string {
+	return "session_replay_index"
+}
+
+// Seek returns the last point at or before t, the zero point is the start of the recording
+func (m *ReplayIndex) Seek(t float64) ReplayPoint {
+	p := ReplayPoint{}
+	for _, point := range m.Points {
+		if point.Time > t {
+			break
+		}
+		p = point
+	}
+	return p
+}
+
+// Checkpoint returns the last checkpoint before t
+func (m *ReplayIndex) Checkpoint(t float64) (ReplayCheckpoint, bool) {
+	cp, ok := ReplayCheckpoint{}, false
+	for _, checkpoint := range m.Checkpoints {
+		if checkpoint.Time >= t {
+			break
+		}
+		cp, ok = checkpoint, true
+	}
+	return cp, ok
+}
+
+// ReplayPoint is a time of the recording and the byte offset of the first event at that time
+type ReplayPoint struct {
+	Time   float64 `json:"time"`
+	Offset int64   `json:"offset"`
+}
+
+// ReplayCheckpoint is the screen of a terminal recording before the event at Offset, which is at Time
+type ReplayCheckpoint struct {
+	Time   float64 `json:"time"`
+	Offset int64   `json:"offset"`
+	Cols   int     `json:"cols"`
+	Rows   int     `json:"rows"`
+	Screen string  `json:"screen"` // The output which draws the screen on a reset terminal
+}
+
+// ReplayMarker marks the time a command ran in the recording
+type ReplayMarker struct {
+	Time   float64 `json:"time"`
+	CmdId  int     `json:"cmd_id"`
+	Cmd    string  `json:"cmd"`
+	Level  int     `json:"level"`
+	Action string  `json:"action"`
+}
+
+// SessionSearchHit is a command or an output line found by searching across sessions
+type SessionSearchHit struct {
+	Id          int     `json:"id" gorm:"column:id"`
+	SessionId   string  `json:"session_id" gorm:"column:session_id"`
+	Cmd         string  `json:"cmd,omitempty" gorm:"column:cmd"`
+	Result      string  `json:"result,omitempty" gorm:"column:result"`
+	Level       int     `json:"level,omitempty" gorm:"column:level"`
+	Action      string  `json:"action,omitempty" gorm:"column:action"`
+	Line        string  `json:"line,omitempty" gorm:"column:line"`
+	Offset      float64 `json:"offset" gorm:"column:replay_offset"` // Seconds from the start of the replay
+	Uid         int     `json:"uid" gorm:"column:uid"`
+	UserName    string  `json:"user_name" gorm:"column:user_name"`
+	AssetId     int     `json:"asset_id" gorm:"column:asset_id"`
+	AssetInfo   string  `json:"asset_info" gorm:"column:asset_info"`
+	AccountInfo string  `json:"account_info" gorm:"column:account_info"`
+	Protocol    string  `json:"protocol" gorm:"column:protocol"`
+
+	SessionCreatedAt time.Time `json:"session_created_at" gorm:"column:session_created_at"`
+	CreatedAt        time.Time `json:"created_at" gorm:"column:created_at"`
+}
+
 func (m *Session) IsGuacd() bool {
 	return m.IsRdp() || m.IsVnc()
 }
@@ -86,6 +221,9 @@ func (m *Session) IsMysql() bool {
 func (m *Session) IsMongo() bool {
 	return strings.HasPrefix(m.Protocol, "mongo")
 }
+func (m *Session) IsPortForward() bool {
+	return strings.HasPrefix(m.Protocol, "tcp")
+}
 
 type CmdCount struct {
 	SessionId string `gorm:"column:session_id"`
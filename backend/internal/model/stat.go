@@ -38,6 +38,23 @@ type StatAsset struct {
 	Time    string `json:"time" gorm:"column:time"`
 }
 
+// StatSession summarizes metadata of sessions created in a time range
+type StatSession struct {
+	Session      int64              `json:"session" gorm:"column:session"`
+	BytesIn      int64              `json:"bytes_in" gorm:"column:bytes_in"`
+	BytesOut     int64              `json:"bytes_out" gorm:"column:bytes_out"`
+	Forbidden    int64              `json:"forbidden" gorm:"column:forbidden"`
+	Failed       int64              `json:"failed" gorm:"column:failed"` // Sessions whose remote shell exited with non-zero status
+	PeakWidth    int                `json:"peak_width" gorm:"column:peak_width"`
+	PeakHeight   int                `json:"peak_height" gorm:"column:peak_height"`
+	CloseReasons []*StatCloseReason `json:"close_reasons" gorm:"-"`
+}
+
+type StatCloseReason struct {
+	CloseReason string `json:"close_reason" gorm:"column:close_reason"`
+	Count       int64  `json:"count" gorm:"column:count"`
+}
+
 type StatCountOfUser struct {
 	Connect    int64 `json:"connect" gorm:"column:connect"`
 	Session    int64 `json:"session" gorm:"column:session"`
@@ -26,5 +26,6 @@ func (m *SystemConfig) TableName() string {
 
 // System config key constants
 const (
-	SysConfigSSHPrivateKey = "ssh_private_key"
+	SysConfigSSHPrivateKey   = "ssh_private_key"
+	SysConfigAuditSigningKey = "audit_signing_key"
 )
@@ -0,0 +1,188 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/samber/lo"
+)
+
+// Tags are key/value labels of assets, nodes and accounts
+type Tags map[string]string
+
+func (t *Tags) Scan(value any) error {
+	switch v := value.(type) {
+	case nil:
+		*t = nil
+		return nil
+	case string:
+		return json.Unmarshal([]byte(v), t)
+	case []byte:
+		return json.Unmarshal(v, t)
+	default:
+		return fmt.Errorf("unsupported tags type %T", value)
+	}
+}
+
+func (t Tags) Value() (driver.Value, error) {
+	return json.Marshal(t)
+}
+
+// Merge returns a copy of t overridden by other
+func (t Tags) Merge(other Tags) Tags {
+	res := make(Tags, len(t)+len(other))
+	for k, v := range t {
+		res[k] = v
+	}
+	for k, v := range other {
+		res[k] = v
+	}
+	return res
+}
+
+// TagOperator defines operators of tag requirements
+type TagOperator string
+
+const (
+	TagOpEquals       TagOperator = "="
+	TagOpNotEquals    TagOperator = "!="
+	TagOpIn           TagOperator = "in"
+	TagOpNotIn        TagOperator = "notin"
+	TagOpExists       TagOperator = "exists"
+	TagOpDoesNotExist TagOperator = "!"
+)
+
+var (
+	tagSetRe = regexp.MustCompile(`(?i)^([^\s=!(),]+)\s+(in|notin)\s*\((.*)\)$`)
+	tagKeyRe = regexp.MustCompile(`^[^\s=!(),]+$`)
+)
+
+// TagRequirement is a single condition on a tag, e.g. env=prod or team in (db, infra)
+type TagRequirement struct {
+	Key    string
+	Op     TagOperator
+	Values []string
+}
+
+// Matches checks if tags satisfy the requirement
+func (r TagRequirement) Matches(tags Tags) bool {
+	v, ok := tags[r.Key]
+	switch r.Op {
+	case TagOpEquals:
+		return ok && v == r.Values[0]
+	case TagOpNotEquals:
+		return !ok || v != r.Values[0]
+	case TagOpIn:
+		return ok && lo.Contains(r.Values, v)
+	case TagOpNotIn:
+		return !ok || !lo.Contains(r.Values, v)
+	case TagOpExists:
+		return ok
+	case TagOpDoesNotExist:
+		return !ok
+	default:
+		return false
+	}
+}
+
+// TagSelector is a list of requirements which must all be satisfied
+type TagSelector []TagRequirement
+
+// ParseTagSelector parses an expression like "env=prod, team in (db, infra), !deprecated".
+// Supported requirements are key=value, key!=value, key in (...), key notin (...), key and !key.
+func ParseTagSelector(expr string) (TagSelector, error) {
+	var selector TagSelector
+	for _, part := range splitTopLevel(expr) {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		req, err := parseTagRequirement(part)
+		if err != nil {
+			return nil, err
+		}
+		selector = append(selector, req)
+	}
+	if len(selector) == 0 {
+		return nil, fmt.Errorf("empty tag expression")
+	}
+	return selector, nil
+}
+
+// Matches checks if tags satisfy all requirements
+func (s TagSelector) Matches(tags Tags) bool {
+	for _, r := range s {
+		if !r.Matches(tags) {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchTagExpressions checks if tags match any of the expressions, invalid expressions never match
+func MatchTagExpressions(exprs []string, tags Tags) bool {
+	for _, expr := range exprs {
+		selector, err := ParseTagSelector(expr)
+		if err != nil {
+			continue
+		}
+		if selector.Matches(tags) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseTagRequirement(s string) (TagRequirement, error) {
+	if m := tagSetRe.FindStringSubmatch(s); m != nil {
+		values := lo.FilterMap(strings.Split(m[3], ","), func(v string, _ int) (string, bool) {
+			v = strings.TrimSpace(v)
+			return v, v != ""
+		})
+		if len(values) == 0 {
+			return TagRequirement{}, fmt.Errorf("empty value set in tag expression %q", s)
+		}
+		return TagRequirement{Key: m[1], Op: TagOperator(strings.ToLower(m[2])), Values: values}, nil
+	}
+
+	for _, op := range []string{"!=", "==", "="} {
+		if k, v, ok := strings.Cut(s, op); ok {
+			k, v = strings.TrimSpace(k), strings.TrimSpace(v)
+			if !tagKeyRe.MatchString(k) {
+				return TagRequirement{}, fmt.Errorf("invalid tag key in expression %q", s)
+			}
+			return TagRequirement{Key: k, Op: lo.Ternary(op == "!=", TagOpNotEquals, TagOpEquals), Values: []string{v}}, nil
+		}
+	}
+
+	op := TagOpExists
+	if strings.HasPrefix(s, "!") {
+		op, s = TagOpDoesNotExist, strings.TrimSpace(s[1:])
+	}
+	if !tagKeyRe.MatchString(s) {
+		return TagRequirement{}, fmt.Errorf("invalid tag expression %q", s)
+	}
+	return TagRequirement{Key: s, Op: op}, nil
+}
+
+// splitTopLevel splits s by commas which are not inside parentheses
+func splitTopLevel(s string) (parts []string) {
+	depth, start := 0, 0
+	for i, c := range s {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
@@ -49,6 +49,13 @@ func (r *accountRepository) BuildQuery(ctx *gin.Context) *gorm.DB {
 			func(s string, _ int) int { return cast.ToInt(s) }))
 	}
 
+	// Filter by tags, invalid expression fails the query
+	if tagDb, err := FilterTags(ctx, db, TagTargetAccount); err != nil {
+		db.AddError(err)
+	} else {
+		db = tagDb
+	}
+
 	// Sort by name
 	db = db.Order("name")
 
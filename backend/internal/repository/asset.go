@@ -69,6 +69,12 @@ func (r *assetRepository) BuildQuery(ctx *gin.Context) (*gorm.DB, error) {
 	// Filter by CMDB CI Type ID
 	db = dbpkg.FilterEqual(ctx, db, "ci_type_id")
 
+	// Filter by tags including inherited ones
+	db, err := FilterTags(ctx, db, TagTargetAsset)
+	if err != nil {
+		return nil, err
+	}
+
 	// Sort by name
 	db = db.Order("name")
 
@@ -246,7 +252,7 @@ func HandleAssetIds(ctx context.Context, dbFind *gorm.DB, resIds []int) (db *gor
 	return
 }
 
-// GetAAG retrieves Asset, Account, and Gateway by their IDs with decrypted credentials
+// GetAAG retrieves Asset, Account, and Gateway with its chain by their IDs with decrypted credentials
 func GetAAG(assetId int, accountId int) (asset *model.Asset, account *model.Account, gateway *model.Gateway, err error) {
 	asset, account, gateway = &model.Asset{}, &model.Account{}, &model.Gateway{}
 	if err = dbpkg.DB.Model(asset).Where("id = ?", assetId).First(asset).Error; err != nil {
@@ -259,12 +265,9 @@ func GetAAG(assetId int, accountId int) (asset *model.Asset, account *model.Acco
 	account.Pk = utils.DecryptAES(account.Pk)
 	account.Phrase = utils.DecryptAES(account.Phrase)
 	if asset.GatewayId != 0 {
-		if err = dbpkg.DB.Model(gateway).Where("id = ?", asset.GatewayId).First(gateway).Error; err != nil {
+		if gateway, err = GetGatewayChain(context.Background(), asset.GatewayId); err != nil {
 			return
 		}
-		gateway.Password = utils.DecryptAES(gateway.Password)
-		gateway.Pk = utils.DecryptAES(gateway.Pk)
-		gateway.Phrase = utils.DecryptAES(gateway.Phrase)
 	}
 
 	return
@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"errors"
+	"fmt"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -10,6 +11,7 @@ import (
 	"github.com/spf13/cast"
 	"github.com/veops/oneterm/internal/model"
 	dbpkg "github.com/veops/oneterm/pkg/db"
+	"github.com/veops/oneterm/pkg/utils"
 	"gorm.io/gorm"
 )
 
@@ -17,6 +19,7 @@ import (
 type GatewayRepository interface {
 	AttachAssetCount(ctx context.Context, gateways []*model.Gateway) error
 	CheckAssetDependencies(ctx context.Context, id int) (string, error)
+	CheckChildDependencies(ctx context.Context, id int) (string, error)
 	BuildQuery(ctx *gin.Context) *gorm.DB
 	FilterByAssetIds(db *gorm.DB, assetIds []int) *gorm.DB
 }
@@ -104,3 +107,51 @@ func (r *gatewayRepository) CheckAssetDependencies(ctx context.Context, id int)
 
 	return assetName, errors.New("gateway has dependent assets")
 }
+
+// CheckChildDependencies returns the name of a gateway which is reached through the gateway
+func (r *gatewayRepository) CheckChildDependencies(ctx context.Context, id int) (string, error) {
+	var gatewayName string
+	err := dbpkg.DB.
+		Model(&model.Gateway{}).
+		Select("name").
+		Where("parent_id = ?", id).
+		First(&gatewayName).
+		Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", nil
+	}
+
+	return gatewayName, err
+}
+
+// GetGatewayChain retrieves the gateway with decrypted credentials, Parent of every hop is linked to the previous one
+func GetGatewayChain(ctx context.Context, id int) (*model.Gateway, error) {
+	gateways, err := GetAllFromCacheDb(ctx, model.DefaultGateway)
+	if err != nil {
+		return nil, err
+	}
+	id2gateway := lo.SliceToMap(gateways, func(g *model.Gateway) (int, *model.Gateway) { return g.Id, g })
+
+	var res, child *model.Gateway
+	for hops := 0; id != 0; hops++ {
+		g, ok := id2gateway[id]
+		if !ok {
+			return nil, fmt.Errorf("gateway %d not found", id)
+		}
+		if hops >= model.MaxGatewayHops {
+			return nil, fmt.Errorf("gateway chain exceeds %d hops", model.MaxGatewayHops)
+		}
+		g.Password = utils.DecryptAES(g.Password)
+		g.Pk = utils.DecryptAES(g.Pk)
+		g.Phrase = utils.DecryptAES(g.Phrase)
+		if child == nil {
+			res = g
+		} else {
+			child.Parent = g
+		}
+		child, id = g, g.ParentId
+	}
+
+	return res, nil
+}
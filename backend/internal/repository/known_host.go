@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/veops/oneterm/internal/model"
+	dbpkg "github.com/veops/oneterm/pkg/db"
+)
+
+// KnownHostRepository defines the interface for known host repository
+type KnownHostRepository interface {
+	GetKnownHostByID(ctx context.Context, id int) (*model.KnownHost, error)
+	GetKnownHostByTarget(ctx context.Context, targetType string, targetId int) (*model.KnownHost, error)
+	SaveKnownHost(ctx context.Context, knownHost *model.KnownHost) error
+	BuildQuery(ctx *gin.Context) *gorm.DB
+}
+
+type knownHostRepository struct{}
+
+// NewKnownHostRepository creates a new known host repository
+func NewKnownHostRepository() KnownHostRepository {
+	return &knownHostRepository{}
+}
+
+// GetKnownHostByID retrieves a known host by ID
+func (r *knownHostRepository) GetKnownHostByID(ctx context.Context, id int) (*model.KnownHost, error) {
+	knownHost := &model.KnownHost{}
+	if err := dbpkg.DB.Where("id = ?", id).First(knownHost).Error; err != nil {
+		return nil, err
+	}
+	return knownHost, nil
+}
+
+// GetKnownHostByTarget retrieves the known host of an asset or a gateway
+func (r *knownHostRepository) GetKnownHostByTarget(ctx context.Context, targetType string, targetId int) (*model.KnownHost, error) {
+	knownHost := &model.KnownHost{}
+	if err := dbpkg.DB.Where("target_type = ? AND target_id = ?", targetType, targetId).First(knownHost).Error; err != nil {
+		return nil, err
+	}
+	return knownHost, nil
+}
+
+// SaveKnownHost creates or updates a known host
+func (r *knownHostRepository) SaveKnownHost(ctx context.Context, knownHost *model.KnownHost) error {
+	return dbpkg.DB.Save(knownHost).Error
+}
+
+// BuildQuery constructs a query for known hosts with filters
+func (r *knownHostRepository) BuildQuery(ctx *gin.Context) *gorm.DB {
+	db := dbpkg.DB.Model(&model.KnownHost{})
+
+	db = dbpkg.FilterEqual(ctx, db, "id", "target_type", "target_id", "status", "key_type")
+	db = dbpkg.FilterSearch(ctx, db, "address", "fingerprint", "pending_fingerprint")
+
+	return db
+}
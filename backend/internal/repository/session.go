@@ -2,13 +2,17 @@ package repository
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/samber/lo"
 	"github.com/veops/oneterm/internal/model"
 	gsession "github.com/veops/oneterm/internal/session"
 	dbpkg "github.com/veops/oneterm/pkg/db"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // SessionRepository defines the interface for session repository
@@ -16,6 +20,12 @@ type SessionRepository interface {
 	GetSession(ctx context.Context, sessionId string) (*model.Session, error)
 	BuildQuery(ctx *gin.Context, isAdmin bool, uid int) (*gorm.DB, error)
 	BuildCmdQuery(ctx *gin.Context, sessionId string) *gorm.DB
+	BuildCmdSearchQuery(ctx *gin.Context, isAdmin bool, uid int) (*gorm.DB, error)
+	BuildOutputSearchQuery(ctx *gin.Context, isAdmin bool, uid int) (*gorm.DB, error)
+	GetSessionCmds(ctx context.Context, sessionId string) ([]*model.SessionCmd, error)
+	GetReplayIndex(ctx context.Context, sessionId string) (*model.ReplayIndex, error)
+	GetReplaySignature(ctx context.Context, sessionId string) (*model.ReplaySignature, error)
+	SaveReplayIndex(ctx context.Context, index *model.ReplayIndex) error
 	GetSessionOptionAssets(ctx context.Context) ([]*model.SessionOptionAsset, error)
 	GetSessionOptionClientIps(ctx context.Context) ([]string, error)
 	CreateSessionCmd(ctx context.Context, cmd *model.SessionCmd) error
@@ -75,12 +85,19 @@ func (r *sessionRepository) BuildQuery(ctx *gin.Context, isAdmin bool, uid int)
 	}
 
 	// Apply exact match filters
-	for _, field := range []string{"status", "uid", "asset_id", "client_ip"} {
+	for _, field := range []string{"status", "uid", "asset_id", "client_ip", "close_reason", "exit_code"} {
 		if q, ok := ctx.GetQuery(field); ok && q != "" {
 			db = db.Where(field+" = ?", q)
 		}
 	}
 
+	// Apply lower bound filters, e.g. min_bytes_out=1048576 or min_forbidden=1
+	for _, field := range []string{"bytes_in", "bytes_out", "peak_width", "peak_height", "forbidden"} {
+		if q, ok := ctx.GetQuery("min_" + field); ok && q != "" {
+			db = db.Where(field+" >= ?", q)
+		}
+	}
+
 	return db, nil
 }
 
@@ -97,6 +114,156 @@ func (r *sessionRepository) BuildCmdQuery(ctx *gin.Context, sessionId string) *g
 	return db
 }
 
+// BuildCmdSearchQuery constructs a query for commands across sessions.
+// Commands are matched by text or regular expression of the command and text of the result.
+func (r *sessionRepository) BuildCmdSearchQuery(ctx *gin.Context, isAdmin bool, uid int) (*gorm.DB, error) {
+	db := dbpkg.DB.
+		Table("session_cmd").
+		Select("session_cmd.id, session_cmd.session_id, session_cmd.cmd, session_cmd.result, session_cmd.level, session_cmd.action, " +
+			"session_cmd.created_at, " + sessionHitColumns).
+		Joins("JOIN session ON session.session_id = session_cmd.session_id")
+
+	if q, ok := ctx.GetQuery("search"); ok && q != "" {
+		db = db.Where("session_cmd.cmd LIKE ?", "%"+q+"%")
+	}
+	if q, ok := ctx.GetQuery("regex"); ok && q != "" {
+		// The pattern is matched in the regex dialect of the database, which validates it as well
+		op := lo.Ternary(dbpkg.DB.Dialector.Name() == "postgres", "~", "REGEXP")
+		var matched any
+		if err := dbpkg.DB.Raw("SELECT '' "+op+" ?", q).Row().Scan(&matched); err != nil {
+			return nil, err
+		}
+		db = db.Where("session_cmd.cmd "+op+" ?", q)
+	}
+	if q, ok := ctx.GetQuery("result"); ok && q != "" {
+		db = db.Where("session_cmd.result LIKE ?", "%"+q+"%")
+	}
+	for _, field := range []string{"level", "action"} {
+		if q, ok := ctx.GetQuery(field); ok && q != "" {
+			db = db.Where("session_cmd."+field+" = ?", q)
+		}
+	}
+
+	db, err := searchSessionFilters(ctx, db, "session_cmd.created_at", isAdmin, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	// Wrap the join so that callers can count, page and order by id
+	return dbpkg.DB.Table("(?) AS hit", db), nil
+}
+
+// BuildOutputSearchQuery constructs a query for lines of recorded output across sessions.
+// Lines are found by the terms of the search through the inverted index, then matched by the whole search text.
+func (r *sessionRepository) BuildOutputSearchQuery(ctx *gin.Context, isAdmin bool, uid int) (*gorm.DB, error) {
+	q := ctx.Query("search")
+	terms := gsession.OutputTerms(q)
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("search must contain a word of at least 2 characters")
+	}
+
+	ids := dbpkg.DB.
+		Model(model.DefaultSessionOutputTerm).
+		Select("output_id").
+		Where("term IN ?", terms).
+		Group("output_id").
+		Having("COUNT(*) = ?", len(terms))
+	db := dbpkg.DB.
+		Table("session_output").
+		Select("session_output.id, session_output.session_id, session_output.line, session_output.replay_offset, "+
+			"session_output.created_at, "+sessionHitColumns).
+		Joins("JOIN session ON session.session_id = session_output.session_id").
+		Where("session_output.id IN (?)", ids).
+		Where("LOWER(session_output.line) LIKE ?", "%"+strings.ToLower(q)+"%")
+
+	db, err := searchSessionFilters(ctx, db, "session.created_at", isAdmin, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	return dbpkg.DB.Table("(?) AS hit", db), nil
+}
+
+// sessionHitColumns are the columns of the session of a search hit
+const sessionHitColumns = "session.uid, session.user_name, session.asset_id, session.asset_info, session.account_info, " +
+	"session.protocol, session.created_at AS session_created_at"
+
+// searchSessionFilters applies the filters on the session and the time window of a search
+func searchSessionFilters(ctx *gin.Context, db *gorm.DB, timeColumn string, isAdmin bool, uid int) (*gorm.DB, error) {
+	if !isAdmin {
+		db = db.Where("session.uid = ?", uid)
+	}
+
+	if start, ok := ctx.GetQuery("start"); ok {
+		t, err := time.Parse(time.RFC3339, start)
+		if err != nil {
+			return nil, err
+		}
+		db = db.Where(timeColumn+" >= ?", t)
+	}
+	if end, ok := ctx.GetQuery("end"); ok {
+		t, err := time.Parse(time.RFC3339, end)
+		if err != nil {
+			return nil, err
+		}
+		db = db.Where(timeColumn+" <= ?", t)
+	}
+
+	for _, field := range []string{"uid", "asset_id"} {
+		if q, ok := ctx.GetQuery(field); ok && q != "" {
+			db = db.Where("session."+field+" = ?", q)
+		}
+	}
+	if q, ok := ctx.GetQuery("user_name"); ok && q != "" {
+		db = db.Where("session.user_name LIKE ?", "%"+q+"%")
+	}
+	if q, ok := ctx.GetQuery("protocol"); ok && q != "" {
+		db = db.Where("session.protocol LIKE ?", q+"%")
+	}
+
+	return db, nil
+}
+
+// GetSessionCmds retrieves commands of a session in the order they ran
+func (r *sessionRepository) GetSessionCmds(ctx context.Context, sessionId string) ([]*model.SessionCmd, error) {
+	cmds := make([]*model.SessionCmd, 0)
+	err := dbpkg.DB.
+		Where("session_id = ?", sessionId).
+		Order("id").
+		Find(&cmds).
+		Error
+	return cmds, err
+}
+
+// GetReplayIndex retrieves the seek index of a recording
+func (r *sessionRepository) GetReplayIndex(ctx context.Context, sessionId string) (*model.ReplayIndex, error) {
+	index := &model.ReplayIndex{}
+	if err := dbpkg.DB.Where("session_id = ?", sessionId).First(index).Error; err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+// GetReplaySignature retrieves the signed digest of a recording
+func (r *sessionRepository) GetReplaySignature(ctx context.Context, sessionId string) (*model.ReplaySignature, error) {
+	signature := &model.ReplaySignature{}
+	if err := dbpkg.DB.Where("session_id = ?", sessionId).First(signature).Error; err != nil {
+		return nil, err
+	}
+	return signature, nil
+}
+
+// SaveReplayIndex saves the seek index of a recording
+func (r *sessionRepository) SaveReplayIndex(ctx context.Context, index *model.ReplayIndex) error {
+	return dbpkg.DB.
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "session_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"duration", "size", "points", "checkpoints"}),
+		}).
+		Create(index).
+		Error
+}
+
 // GetSessionOptionAssets retrieves session option assets
 func (r *sessionRepository) GetSessionOptionAssets(ctx context.Context) ([]*model.SessionOptionAsset, error) {
 	opts := make([]*model.SessionOptionAsset, 0)
@@ -160,7 +327,7 @@ func (r *sessionRepository) GetOnlineSessionByID(ctx context.Context, sessionID
 	err := dbpkg.DB.
 		Model(session).
 		Where("session_id = ?", sessionID).
-		Where("status = ?", model.SESSIONSTATUS_ONLINE).
+		Where("status IN ?", []int{model.SESSIONSTATUS_ONLINE, model.SESSIONSTATUS_DETACHED}).
 		First(session).
 		Error
 	return session, err
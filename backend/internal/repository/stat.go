@@ -14,6 +14,7 @@ type StatRepository interface {
 	GetStatCount(ctx context.Context) (*model.StatCount, error)
 	GetStatAccount(ctx context.Context, start, end time.Time) ([]*model.StatAccount, error)
 	GetStatAsset(ctx context.Context, start, end time.Time, dateFmt string) ([]*model.StatAsset, error)
+	GetStatSession(ctx context.Context, start, end time.Time) (*model.StatSession, error)
 	GetStatCountOfUser(ctx context.Context, uid int, assetIds []int) (*model.StatCountOfUser, error)
 	GetStatRankOfUser(ctx context.Context, limit int) ([]*model.StatRankOfUser, error)
 }
@@ -46,7 +47,7 @@ func (r *statRepository) GetStatCount(ctx context.Context) (*model.StatCount, er
 	if err := dbpkg.DB.
 		Model(model.DefaultSession).
 		Select("COUNT(DISTINCT asset_id, account_id) as connect, COUNT(DISTINCT uid) as user, COUNT(DISTINCT gateway_id) as gateway, COUNT(*) as session").
-		Where("status = 1").
+		Where("status IN ?", []int{model.SESSIONSTATUS_ONLINE, model.SESSIONSTATUS_DETACHED}).
 		First(&stat).
 		Error; err != nil {
 		return nil, err
@@ -103,6 +104,35 @@ func (r *statRepository) GetStatAsset(ctx context.Context, start, end time.Time,
 	return stat, err
 }
 
+// GetStatSession gets metadata stats of sessions
+func (r *statRepository) GetStatSession(ctx context.Context, start, end time.Time) (*model.StatSession, error) {
+	stat := &model.StatSession{}
+
+	if err := dbpkg.DB.
+		Model(model.DefaultSession).
+		Select("COUNT(*) AS session, COALESCE(SUM(bytes_in), 0) AS bytes_in, COALESCE(SUM(bytes_out), 0) AS bytes_out, "+
+			"COALESCE(SUM(forbidden), 0) AS forbidden, COUNT(CASE WHEN exit_code <> 0 THEN 1 END) AS failed, "+
+			"COALESCE(MAX(peak_width), 0) AS peak_width, COALESCE(MAX(peak_height), 0) AS peak_height").
+		Where("created_at >= ? AND created_at <= ?", start, end).
+		Scan(stat).
+		Error; err != nil {
+		return nil, err
+	}
+
+	stat.CloseReasons = make([]*model.StatCloseReason, 0)
+	err := dbpkg.DB.
+		Model(model.DefaultSession).
+		Select("close_reason, COUNT(*) AS count").
+		Where("created_at >= ? AND created_at <= ?", start, end).
+		Where("close_reason <> ''").
+		Group("close_reason").
+		Order("count DESC").
+		Find(&stat.CloseReasons).
+		Error
+
+	return stat, err
+}
+
 // GetStatCountOfUser gets stats count for a specific user
 func (r *statRepository) GetStatCountOfUser(ctx context.Context, uid int, assetIds []int) (*model.StatCountOfUser, error) {
 	stat := &model.StatCountOfUser{}
@@ -111,7 +141,7 @@ func (r *statRepository) GetStatCountOfUser(ctx context.Context, uid int, assetI
 	if err := dbpkg.DB.
 		Model(model.DefaultSession).
 		Select("COUNT(DISTINCT asset_id, account_id) as connect, COUNT(DISTINCT asset_id) as asset, COUNT(*) as session").
-		Where("status = 1").
+		Where("status IN ?", []int{model.SESSIONSTATUS_ONLINE, model.SESSIONSTATUS_DETACHED}).
 		Where("uid = ?", uid).
 		First(&stat).
 		Error; err != nil {
@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samber/lo"
+	"gorm.io/gorm"
+
+	"github.com/veops/oneterm/internal/model"
+)
+
+const (
+	TagTargetNode    = "node"
+	TagTargetAsset   = "asset"
+	TagTargetAccount = "account"
+)
+
+// GetNodeTags returns effective tags of all nodes, a node inherits tags of its ancestors and overrides them with its own
+func GetNodeTags(ctx context.Context) (map[int]model.Tags, error) {
+	nodes, err := GetAllFromCacheDb(ctx, model.DefaultNode)
+	if err != nil {
+		return nil, err
+	}
+	id2node := lo.SliceToMap(nodes, func(n *model.Node) (int, *model.Node) { return n.Id, n })
+
+	res := make(map[int]model.Tags, len(nodes))
+	var dfs func(id int, visiting map[int]bool) model.Tags
+	dfs = func(id int, visiting map[int]bool) model.Tags {
+		if tags, ok := res[id]; ok {
+			return tags
+		}
+		n, ok := id2node[id]
+		if !ok || visiting[id] {
+			return model.Tags{}
+		}
+		visiting[id] = true
+		res[id] = dfs(n.ParentId, visiting).Merge(n.Tags)
+		return res[id]
+	}
+	for _, n := range nodes {
+		dfs(n.Id, map[int]bool{})
+	}
+
+	return res, nil
+}
+
+// GetAssetTags returns effective tags of all assets, including tags inherited from node tree
+func GetAssetTags(ctx context.Context) (map[int]model.Tags, error) {
+	assets, err := GetAllFromCacheDb(ctx, model.DefaultAsset)
+	if err != nil {
+		return nil, err
+	}
+	nodeTags, err := GetNodeTags(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return lo.SliceToMap(assets, func(a *model.Asset) (int, model.Tags) {
+		return a.Id, nodeTags[a.ParentId].Merge(a.Tags)
+	}), nil
+}
+
+// GetAccountTags returns tags of all accounts
+func GetAccountTags(ctx context.Context) (map[int]model.Tags, error) {
+	accounts, err := GetAllFromCacheDb(ctx, model.DefaultAccount)
+	if err != nil {
+		return nil, err
+	}
+
+	return lo.SliceToMap(accounts, func(a *model.Account) (int, model.Tags) {
+		return a.Id, a.Tags
+	}), nil
+}
+
+// GetTargetTags returns effective tags of all targets of the type
+func GetTargetTags(ctx context.Context, targetType string) (map[int]model.Tags, error) {
+	switch targetType {
+	case TagTargetNode:
+		return GetNodeTags(ctx)
+	case TagTargetAsset:
+		return GetAssetTags(ctx)
+	case TagTargetAccount:
+		return GetAccountTags(ctx)
+	default:
+		return nil, fmt.Errorf("unknown target type: %s", targetType)
+	}
+}
+
+// GetTargetIdsByTags returns ids of targets whose effective tags match any of the expressions
+func GetTargetIdsByTags(ctx context.Context, targetType string, exprs []string) ([]int, error) {
+	all, err := GetTargetTags(ctx, targetType)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int, 0)
+	for id, tags := range all {
+		if model.MatchTagExpressions(exprs, tags) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// FilterTags filters targets by the tags query parameter, e.g. tags=env=prod,team in (db, infra)
+func FilterTags(ctx *gin.Context, db *gorm.DB, targetType string) (*gorm.DB, error) {
+	q, ok := ctx.GetQuery("tags")
+	if !ok || q == "" {
+		return db, nil
+	}
+	if _, err := model.ParseTagSelector(q); err != nil {
+		return nil, err
+	}
+
+	ids, err := GetTargetIdsByTags(ctx, targetType, []string{q})
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return db.Where("1 = 0"), nil
+	}
+	return db.Where("id IN ?", ids), nil
+}
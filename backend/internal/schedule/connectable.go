@@ -13,10 +13,11 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/veops/oneterm/internal/model"
+	"github.com/veops/oneterm/internal/repository"
+	"github.com/veops/oneterm/internal/sshsrv/icons"
 	"github.com/veops/oneterm/internal/tunneling"
 	dbpkg "github.com/veops/oneterm/pkg/db"
 	"github.com/veops/oneterm/pkg/logger"
-	"github.com/veops/oneterm/pkg/utils"
 )
 
 // ConnectableResult represents the result of a connectivity check
@@ -101,17 +102,15 @@ func getGatewayMap(assets []*model.Asset) (map[int]*model.Gateway, error) {
 		return make(map[int]*model.Gateway), nil
 	}
 
-	gateways := make([]*model.Gateway, 0)
-	if err := dbpkg.DB.Model(gateways).Where("id IN ?", gids).Find(&gateways).Error; err != nil {
-		logger.L().Error("Failed to get gateways for connectivity check", zap.Error(err))
-		return nil, err
-	}
-
-	// Decrypt gateway credentials
-	for _, g := range gateways {
-		g.Password = utils.DecryptAES(g.Password)
-		g.Pk = utils.DecryptAES(g.Pk)
-		g.Phrase = utils.DecryptAES(g.Phrase)
+	// Load gateways with their chains and decrypted credentials
+	gateways := make([]*model.Gateway, 0, len(gids))
+	for _, gid := range gids {
+		g, err := repository.GetGatewayChain(ctx, gid)
+		if err != nil {
+			logger.L().Error("Failed to get gateways for connectivity check", zap.Int("gateway_id", gid), zap.Error(err))
+			continue
+		}
+		gateways = append(gateways, g)
 	}
 
 	return lo.SliceToMap(gateways, func(g *model.Gateway) (int, *model.Gateway) {
@@ -251,7 +250,16 @@ func updateConnectable(asset *model.Asset, gateway *model.Gateway) (sid string,
 		return strings.Split(p, ":")[0]
 	}), ",")
 
-	ip, port, err := tunneling.Proxy(true, sid, ps, asset, gateway)
+	// Protocols saved before their default ports were known have none, e.g. mssql, so check them at the default port
+	checked := *asset
+	checked.Protocols = lo.Map(asset.Protocols, func(p string, _ int) string {
+		if defaultPort := icons.GetDefaultPort(p); !strings.Contains(p, ":") && defaultPort != "" {
+			return p + ":" + defaultPort
+		}
+		return p
+	})
+
+	ip, port, err := tunneling.Proxy(true, sid, ps, &checked, gateway)
 	if err != nil {
 		logger.L().Debug("Proxy connection failed",
 			zap.String("protocol", ps),
@@ -0,0 +1,42 @@
+package schedule
+
+import (
+	"sync"
+
+	"go.uber.org/zap"
+
+	"github.com/veops/oneterm/internal/model"
+	"github.com/veops/oneterm/internal/repository"
+	"github.com/veops/oneterm/internal/tunneling"
+	"github.com/veops/oneterm/pkg/logger"
+)
+
+// UpdateGatewayHealth checks every gateway through its chain, the results are shown on the gateway list
+func UpdateGatewayHealth() error {
+	gateways, err := repository.GetAllFromCacheDb(ctx, model.DefaultGateway)
+	if err != nil {
+		return err
+	}
+
+	semaphore := make(chan struct{}, scheduleConfig.ConcurrentWorkers)
+	var wg sync.WaitGroup
+	for _, g := range gateways {
+		chain, err := repository.GetGatewayChain(ctx, g.Id)
+		if err != nil {
+			logger.L().Warn("Failed to get gateway chain for health check", zap.Int("gateway_id", g.Id), zap.Error(err))
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			tunneling.CheckGateway(chain)
+		}()
+	}
+	wg.Wait()
+
+	return nil
+}
@@ -25,6 +25,8 @@ func RunSchedule() (err error) {
 		zap.Int("batch_size", scheduleConfig.BatchSize),
 		zap.Int("concurrent_workers", scheduleConfig.ConcurrentWorkers))
 
+	go updateGatewayHealth()
+
 	connectableTicker := time.NewTicker(scheduleConfig.ConnectableCheckInterval)
 	// configTicker := time.NewTicker(scheduleConfig.ConfigUpdateInterval)
 
@@ -42,12 +44,19 @@ func RunSchedule() (err error) {
 					logger.L().Error("Failed to update connectables", zap.Error(err))
 				}
 			}()
+			go updateGatewayHealth()
 			// case <-configTicker.C:
 			// 	UpdateConfig()
 		}
 	}
 }
 
+func updateGatewayHealth() {
+	if err := UpdateGatewayHealth(); err != nil {
+		logger.L().Error("Failed to update gateway health", zap.Error(err))
+	}
+}
+
 func StopSchedule() {
 	defer cancel()
 	logger.L().Info("Stopping scheduler")
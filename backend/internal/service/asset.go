@@ -74,6 +74,7 @@ func (s *AssetService) ensureAuthorizationFormat(asset *model.Asset) {
 				Copy:         false, // Default: deny copy
 				Paste:        false, // Default: deny paste
 				Share:        false, // Default: deny share
+				PortForward:  false, // Default: deny port forwarding
 			}
 			asset.Authorization[accountId] = authData
 		}
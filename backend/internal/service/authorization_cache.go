@@ -0,0 +1,203 @@
+package service
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/samber/lo"
+	"go.uber.org/zap"
+
+	"github.com/veops/oneterm/internal/model"
+	"github.com/veops/oneterm/internal/repository"
+	redis "github.com/veops/oneterm/pkg/cache"
+	"github.com/veops/oneterm/pkg/logger"
+)
+
+const (
+	authCachePrefix = "auth_v2:"
+	authCacheTTL    = 10 * time.Minute
+
+	// Targets whose changes invalidate cached decisions
+	AuthCacheTargetRule    = "rule"
+	AuthCacheTargetRole    = "role"
+	AuthCacheTargetNode    = "node"
+	AuthCacheTargetAsset   = "asset"
+	AuthCacheTargetAccount = "account"
+)
+
+var (
+	// DefaultAuthCache caches authorization decisions of the V2 matcher
+	DefaultAuthCache = NewAuthorizationCache(authCacheTTL)
+)
+
+// AuthorizationCache caches authorization decisions in redis.
+// Every decision is indexed by the rules, roles, nodes, assets and accounts it depends on,
+// so a change of any of them only drops the affected decisions.
+type AuthorizationCache struct {
+	ttl           time.Duration
+	hits          atomic.Int64
+	misses        atomic.Int64
+	invalidations atomic.Int64
+}
+
+// AuthCacheStats are the hit/miss metrics of the authorization cache
+type AuthCacheStats struct {
+	Hits          int64   `json:"hits"`
+	Misses        int64   `json:"misses"`
+	HitRate       float64 `json:"hit_rate"`
+	Invalidations int64   `json:"invalidations"`
+}
+
+// NewAuthorizationCache creates an authorization cache whose entries live at most ttl
+func NewAuthorizationCache(ttl time.Duration) *AuthorizationCache {
+	return &AuthorizationCache{ttl: ttl}
+}
+
+// Get loads the cached decision of key into dst
+func (c *AuthorizationCache) Get(ctx context.Context, key string, dst any) bool {
+	if err := redis.Get(ctx, key, dst); err != nil {
+		c.misses.Add(1)
+		return false
+	}
+	c.hits.Add(1)
+	return true
+}
+
+// Set caches the decision and indexes it by its dependencies, ttl is capped by the cache ttl
+func (c *AuthorizationCache) Set(ctx context.Context, key string, src any, ttl time.Duration, deps map[string][]int) {
+	if ttl <= 0 || ttl > c.ttl {
+		ttl = c.ttl
+	}
+	bs, err := json.Marshal(src)
+	if err != nil {
+		return
+	}
+
+	pipe := redis.RC.TxPipeline()
+	pipe.SetEx(ctx, key, bs, ttl)
+	for target, ids := range deps {
+		for _, id := range lo.Uniq(ids) {
+			k := authCacheIndexKey(target, id)
+			pipe.SAdd(ctx, k, key)
+			pipe.Expire(ctx, k, c.ttl)
+		}
+	}
+	if _, err = pipe.Exec(ctx); err != nil {
+		logger.L().Warn("cache authorization decision failed", zap.String("key", key), zap.Error(err))
+	}
+}
+
+// Invalidate drops all decisions depending on the targets
+func (c *AuthorizationCache) Invalidate(ctx context.Context, target string, ids ...int) {
+	for _, id := range lo.Uniq(ids) {
+		k := authCacheIndexKey(target, id)
+		keys, err := redis.RC.SMembers(ctx, k).Result()
+		if err != nil {
+			logger.L().Warn("load authorization cache index failed", zap.String("key", k), zap.Error(err))
+			continue
+		}
+		if err = redis.RC.Del(ctx, append(keys, k)...).Err(); err != nil {
+			logger.L().Warn("invalidate authorization cache failed", zap.String("key", k), zap.Error(err))
+			continue
+		}
+		c.invalidations.Add(int64(len(keys)))
+	}
+}
+
+// InvalidateModel drops all decisions depending on the node, asset or account
+func (c *AuthorizationCache) InvalidateModel(ctx context.Context, md model.Model) {
+	switch md.(type) {
+	case *model.Node:
+		c.Invalidate(ctx, AuthCacheTargetNode, md.GetId())
+	case *model.Asset:
+		c.Invalidate(ctx, AuthCacheTargetAsset, md.GetId())
+	case *model.Account:
+		c.Invalidate(ctx, AuthCacheTargetAccount, md.GetId())
+	}
+}
+
+// Flush drops all cached decisions
+func (c *AuthorizationCache) Flush(ctx context.Context) error {
+	return redis.DeleteByPattern(ctx, authCachePrefix+"*")
+}
+
+// Stats returns the hit/miss metrics since the process started
+func (c *AuthorizationCache) Stats() *AuthCacheStats {
+	stats := &AuthCacheStats{
+		Hits:          c.hits.Load(),
+		Misses:        c.misses.Load(),
+		Invalidations: c.invalidations.Load(),
+	}
+	if total := stats.Hits + stats.Misses; total > 0 {
+		stats.HitRate = float64(stats.Hits) / float64(total)
+	}
+	return stats
+}
+
+// authCacheKey generates the cache key of a decision, the scope identifies the rules which were evaluated
+func authCacheKey(scope string, req *model.BatchAuthRequest) string {
+	actions := lo.Map(req.Actions, func(a model.AuthAction, _ int) string { return string(a) })
+	sort.Strings(actions)
+	return fmt.Sprintf("%sdecision:%s:%d:%d:%d:%s:%s", authCachePrefix, scope,
+		req.NodeId, req.AssetId, req.AccountId, req.ClientIP, strings.Join(actions, ","))
+}
+
+// authCacheScope generates a short stable identifier of a set of ids
+func authCacheScope(prefix string, ids []int) string {
+	sorted := lo.Uniq(ids)
+	sort.Ints(sorted)
+	sum := sha1.Sum([]byte(fmt.Sprint(sorted)))
+	return prefix + hex.EncodeToString(sum[:8])
+}
+
+func authCacheIndexKey(target string, id int) string {
+	return fmt.Sprintf("%sindex:%s:%d", authCachePrefix, target, id)
+}
+
+// authCacheDeps returns the targets a decision depends on, including all ancestors of the node
+func authCacheDeps(ctx context.Context, req *model.BatchAuthRequest, rules []*model.AuthorizationV2) map[string][]int {
+	deps := map[string][]int{
+		AuthCacheTargetAsset:   {req.AssetId},
+		AuthCacheTargetAccount: {req.AccountId},
+		AuthCacheTargetRule:    lo.Map(rules, func(r *model.AuthorizationV2, _ int) int { return r.Id }),
+	}
+
+	nodeIds := []int{req.NodeId}
+	if nodes, err := repository.GetAllFromCacheDb(ctx, model.DefaultNode); err == nil {
+		parents := lo.SliceToMap(nodes, func(n *model.Node) (int, int) { return n.Id, n.ParentId })
+		for id, ok := parents[req.NodeId]; ok && id != 0 && !lo.Contains(nodeIds, id); id, ok = parents[id] {
+			nodeIds = append(nodeIds, id)
+		}
+	}
+	deps[AuthCacheTargetNode] = nodeIds
+
+	return deps
+}
+
+// authCacheTTLOf returns how long a decision over the rules stays valid, 0 means it must not be cached.
+// Decisions depending on the time of day are never cached, validity periods cap the ttl.
+func authCacheTTLOf(rules []*model.AuthorizationV2, asset *model.Asset, now time.Time) time.Duration {
+	if asset != nil && asset.AccessTimeControl != nil && asset.AccessTimeControl.Enabled {
+		return 0
+	}
+
+	ttl := authCacheTTL
+	for _, rule := range rules {
+		if rule.AccessControl.TimeTemplate != nil || len(rule.AccessControl.CustomTimeRanges) > 0 {
+			return 0
+		}
+		for _, t := range []*model.CustomTime{rule.ValidFrom, rule.ValidTo} {
+			if t != nil && t.After(now) && t.Sub(now) < ttl {
+				ttl = t.Sub(now)
+			}
+		}
+	}
+	return ttl
+}
@@ -29,7 +29,7 @@ type IAuthorizationMatcher interface {
 	MatchBatchWithScope(ctx *gin.Context, req *model.BatchAuthRequest, ruleIds []int) (*model.BatchAuthResult, error)
 
 	GetTargetName(targetType string, targetId int) (string, error)
-	GetTargetTags(targetType string, targetId int) ([]string, error)
+	GetTargetTags(targetType string, targetId int) (model.Tags, error)
 }
 
 // AuthorizationMatcher implements IAuthorizationMatcher
@@ -46,17 +46,18 @@ func NewAuthorizationMatcher(repo repository.IAuthorizationV2Repository) IAuthor
 
 // Match performs authorization matching against rules
 func (m *AuthorizationMatcher) Match(ctx *gin.Context, req *model.AuthRequest) (*model.AuthResult, error) {
+	// Get user's role IDs from context (assuming it's passed through ctx)
+	userRids := m.getUserRoleIds(ctx, req.UserId)
+
 	// Get cache key for this request
-	cacheKey := m.getCacheKey(req)
+	batchReq := toBatchAuthRequest(req)
+	cacheKey := m.getCacheKey(authCacheScope("role-", userRids), batchReq)
 
 	// Try to get result from cache first
-	if cached := m.getCachedResult(cacheKey); cached != nil {
+	if cached := m.getCachedResult(ctx, cacheKey); cached != nil {
 		return cached, nil
 	}
 
-	// Get user's role IDs from context (assuming it's passed through ctx)
-	userRids := m.getUserRoleIds(ctx, req.UserId)
-
 	// Get user's authorization rules
 	rules, err := m.repo.GetUserRules(ctx, userRids)
 	if err != nil {
@@ -71,15 +72,16 @@ func (m *AuthorizationMatcher) Match(ctx *gin.Context, req *model.AuthRequest) (
 			// If this rule allows the requested action, grant permission immediately
 			if rule.Permissions.HasPermission(req.Action) {
 				result := &model.AuthResult{
-					Allowed:     true,
-					Permissions: rule.Permissions,
-					Reason:      fmt.Sprintf("Allowed by rule: %s", rule.Name),
-					RuleId:      rule.Id,
-					RuleName:    rule.Name,
+					Allowed:      true,
+					Permissions:  rule.Permissions,
+					Reason:       fmt.Sprintf("Allowed by rule: %s", rule.Name),
+					RuleId:       rule.Id,
+					RuleName:     rule.Name,
+					Restrictions: rule.AccessControl.Restrictions(),
 				}
 
 				// Cache the result
-				m.cacheResult(cacheKey, result)
+				m.cacheResult(ctx, cacheKey, result, batchReq, rules, userRids)
 				return result, nil
 			}
 		}
@@ -91,7 +93,7 @@ func (m *AuthorizationMatcher) Match(ctx *gin.Context, req *model.AuthRequest) (
 			Allowed: false,
 			Reason:  fmt.Sprintf("Action '%s' denied by %d matching rule(s)", req.Action, len(matchedRules)),
 		}
-		m.cacheResult(cacheKey, result)
+		m.cacheResult(ctx, cacheKey, result, batchReq, rules, userRids)
 		return result, nil
 	}
 
@@ -101,7 +103,7 @@ func (m *AuthorizationMatcher) Match(ctx *gin.Context, req *model.AuthRequest) (
 		Reason:  "No matching authorization rule found",
 	}
 
-	m.cacheResult(cacheKey, result)
+	m.cacheResult(ctx, cacheKey, result, batchReq, rules, userRids)
 	return result, nil
 }
 
@@ -188,7 +190,7 @@ func (m *AuthorizationMatcher) matchSelector(ctx context.Context, selector model
 		if err != nil {
 			return false
 		}
-		return len(lo.Intersect(selector.Values, targetTags)) > 0
+		return model.MatchTagExpressions(selector.Values, targetTags)
 
 	default:
 		return false
@@ -223,7 +225,7 @@ func (m *AuthorizationMatcher) checkAccessControl(accessControl model.AccessCont
 		return false
 	}
 
-	// TODO: Check max sessions and session timeout (requires session management)
+	// Max sessions and session timeout are enforced by connector with the matched result
 
 	return true
 }
@@ -502,28 +504,65 @@ func (m *AuthorizationMatcher) GetTargetName(targetType string, targetId int) (s
 	}
 }
 
-// GetTargetTags retrieves tags for a target (placeholder implementation)
-func (m *AuthorizationMatcher) GetTargetTags(targetType string, targetId int) ([]string, error) {
-	// TODO: Implement tag system for nodes, assets, and accounts
-	// For now, return empty tags
-	return []string{}, nil
+// GetTargetTags retrieves effective tags of a target, including tags inherited from node tree
+func (m *AuthorizationMatcher) GetTargetTags(targetType string, targetId int) (model.Tags, error) {
+	all, err := repository.GetTargetTags(context.Background(), targetType)
+	if err != nil {
+		return nil, err
+	}
+	return all[targetId], nil
 }
 
-// getCacheKey generates a cache key for the request
-func (m *AuthorizationMatcher) getCacheKey(req *model.AuthRequest) string {
-	return fmt.Sprintf("auth_v2:%d:%d:%d:%d:%s",
-		req.UserId, req.NodeId, req.AssetId, req.AccountId, req.Action)
+// getCacheKey generates a cache key for the request evaluated against the rule scope
+func (m *AuthorizationMatcher) getCacheKey(scope string, req *model.BatchAuthRequest) string {
+	return authCacheKey(scope, req)
 }
 
 // getCachedResult retrieves cached authorization result
-func (m *AuthorizationMatcher) getCachedResult(cacheKey string) *model.AuthResult {
-	// TODO: Implement Redis caching
-	return nil
+func (m *AuthorizationMatcher) getCachedResult(ctx context.Context, cacheKey string) *model.AuthResult {
+	result := &model.AuthResult{}
+	if !DefaultAuthCache.Get(ctx, cacheKey, result) {
+		return nil
+	}
+	return result
+}
+
+// getCachedBatchResult retrieves cached batch authorization result
+func (m *AuthorizationMatcher) getCachedBatchResult(ctx context.Context, cacheKey string) *model.BatchAuthResult {
+	result := &model.BatchAuthResult{}
+	if !DefaultAuthCache.Get(ctx, cacheKey, result) {
+		return nil
+	}
+	return result
 }
 
-// cacheResult caches the authorization result
-func (m *AuthorizationMatcher) cacheResult(cacheKey string, result *model.AuthResult) {
-	// TODO: Implement Redis caching with TTL
+// cacheResult caches the authorization result unless it depends on the time of day
+func (m *AuthorizationMatcher) cacheResult(ctx context.Context, cacheKey string, result any, req *model.BatchAuthRequest, rules []*model.AuthorizationV2, rids []int) {
+	asset, _ := m.getAssetById(req.AssetId)
+	ttl := authCacheTTLOf(rules, asset, lo.Ternary(req.Timestamp.IsZero(), time.Now(), req.Timestamp))
+	if ttl <= 0 {
+		return
+	}
+
+	deps := authCacheDeps(ctx, req, rules)
+	if len(rids) > 0 {
+		deps[AuthCacheTargetRole] = rids
+	}
+	DefaultAuthCache.Set(ctx, cacheKey, result, ttl, deps)
+}
+
+// toBatchAuthRequest converts a single action request to a batch request
+func toBatchAuthRequest(req *model.AuthRequest) *model.BatchAuthRequest {
+	return &model.BatchAuthRequest{
+		UserId:    req.UserId,
+		NodeId:    req.NodeId,
+		AssetId:   req.AssetId,
+		AccountId: req.AccountId,
+		Actions:   []model.AuthAction{req.Action},
+		ClientIP:  req.ClientIP,
+		UserAgent: req.UserAgent,
+		Timestamp: req.Timestamp,
+	}
 }
 
 // MatchWithScope checks if a request is authorized using only specified rule IDs (like V1's AuthorizationIds filtering)
@@ -535,6 +574,12 @@ func (m *AuthorizationMatcher) MatchWithScope(ctx *gin.Context, req *model.AuthR
 		}, nil
 	}
 
+	batchReq := toBatchAuthRequest(req)
+	cacheKey := m.getCacheKey(authCacheScope("one-", ruleIds), batchReq)
+	if cached := m.getCachedResult(ctx, cacheKey); cached != nil {
+		return cached, nil
+	}
+
 	// Get only the rules that user has permission to access (already filtered by enabled=true)
 	enabledRules, err := m.repo.GetByResourceIds(ctx, ruleIds)
 	if err != nil {
@@ -544,26 +589,31 @@ func (m *AuthorizationMatcher) MatchWithScope(ctx *gin.Context, req *model.AuthR
 		}, err
 	}
 
+	result := &model.AuthResult{
+		Allowed: false,
+		Reason:  "No matching authorization rule found in scope",
+	}
+
 	// Check each rule in the filtered scope
 	for _, rule := range enabledRules {
 		if m.matchRule(ctx, rule, req) {
 			// If this rule allows the requested action, grant permission immediately
 			if rule.Permissions.HasPermission(req.Action) {
-				return &model.AuthResult{
-					Allowed:     true,
-					Permissions: rule.Permissions,
-					Reason:      fmt.Sprintf("Allowed by rule: %s", rule.Name),
-					RuleId:      rule.Id,
-					RuleName:    rule.Name,
-				}, nil
+				result = &model.AuthResult{
+					Allowed:      true,
+					Permissions:  rule.Permissions,
+					Reason:       fmt.Sprintf("Allowed by rule: %s", rule.Name),
+					RuleId:       rule.Id,
+					RuleName:     rule.Name,
+					Restrictions: rule.AccessControl.Restrictions(),
+				}
+				break
 			}
 		}
 	}
 
-	return &model.AuthResult{
-		Allowed: false,
-		Reason:  "No matching authorization rule found in scope",
-	}, nil
+	m.cacheResult(ctx, cacheKey, result, batchReq, enabledRules, nil)
+	return result, nil
 }
 
 // MatchBatchWithScope checks if batch requests are authorized using only specified rule IDs
@@ -585,6 +635,11 @@ func (m *AuthorizationMatcher) MatchBatchWithScope(ctx *gin.Context, req *model.
 		return &model.BatchAuthResult{Results: results}, nil
 	}
 
+	cacheKey := m.getCacheKey(authCacheScope("batch-", ruleIds), req)
+	if cached := m.getCachedBatchResult(ctx, cacheKey); cached != nil {
+		return cached, nil
+	}
+
 	// Single database query for all rules
 	enabledRules, err := m.repo.GetByResourceIds(ctx, ruleIds)
 	if err != nil {
@@ -614,11 +669,12 @@ func (m *AuthorizationMatcher) MatchBatchWithScope(ctx *gin.Context, req *model.
 			for _, action := range req.Actions {
 				if rule.Permissions.HasPermission(action) && !results[action].Allowed {
 					results[action] = &model.AuthResult{
-						Allowed:     true,
-						Permissions: rule.Permissions,
-						Reason:      fmt.Sprintf("Allowed by rule: %s", rule.Name),
-						RuleId:      rule.Id,
-						RuleName:    rule.Name,
+						Allowed:      true,
+						Permissions:  rule.Permissions,
+						Reason:       fmt.Sprintf("Allowed by rule: %s", rule.Name),
+						RuleId:       rule.Id,
+						RuleName:     rule.Name,
+						Restrictions: rule.AccessControl.Restrictions(),
 					}
 				}
 			}
@@ -637,5 +693,7 @@ func (m *AuthorizationMatcher) MatchBatchWithScope(ctx *gin.Context, req *model.
 		}
 	}
 
-	return &model.BatchAuthResult{Results: results}, nil
+	result := &model.BatchAuthResult{Results: results}
+	m.cacheResult(ctx, cacheKey, result, req, enabledRules, nil)
+	return result, nil
 }
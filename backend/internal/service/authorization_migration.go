@@ -221,6 +221,7 @@ func (s *AuthorizationMigrationService) convertV1ToV2(v1 *model.Authorization) *
 		Copy:         s.getDefaultCopyPermission(),
 		Paste:        s.getDefaultPastePermission(),
 		Share:        false, // Default to false for security
+		PortForward:  false,
 	}
 
 	// Set default access control
@@ -567,6 +568,7 @@ func getDefaultAuthPermissions() model.AuthPermissions {
 		Copy:         false,
 		Paste:        false,
 		Share:        false,
+		PortForward:  false,
 	}
 }
 
@@ -732,6 +734,7 @@ func (s *AuthorizationMigrationService) getDefaultAuthPermissions() model.AuthPe
 		Copy:         false,
 		Paste:        false,
 		Share:        false,
+		PortForward:  false,
 	}
 }
 
@@ -83,6 +83,20 @@ func (s *AuthorizationV2Service) ValidateRule(ctx context.Context, rule *model.A
 	}
 	// Note: User selection is handled via Rids field, no regex validation needed
 
+	// Validate tag expressions if type is tags
+	for name, selector := range map[string]model.TargetSelector{
+		"node":    rule.NodeSelector,
+		"asset":   rule.AssetSelector,
+		"account": rule.AccountSelector,
+	} {
+		if selector.Type != model.SelectorTypeTags {
+			continue
+		}
+		if err := s.validateTagExpressions(selector.Values); err != nil {
+			return fmt.Errorf("invalid %s selector tags: %w", name, err)
+		}
+	}
+
 	// Validate time template reference if present
 	if rule.AccessControl.TimeTemplate != nil {
 		if err := s.validateTimeTemplateReference(ctx, rule.AccessControl.TimeTemplate); err != nil {
@@ -325,6 +339,16 @@ func (s *AuthorizationV2Service) validateRegexPatterns(patterns []string) error
 	return nil
 }
 
+// validateTagExpressions validates tag expressions
+func (s *AuthorizationV2Service) validateTagExpressions(exprs []string) error {
+	for _, expr := range exprs {
+		if _, err := model.ParseTagSelector(expr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // GetAuthorizedAssetIds returns asset IDs that the user has permission to access using V2 authorization
 func (s *AuthorizationV2Service) GetAuthorizedAssetIds(ctx *gin.Context, action model.AuthAction) ([]int, error) {
 	currentUser, _ := acl.GetSessionFromCtx(ctx)
@@ -560,6 +584,7 @@ func (s *AuthorizationV2Service) GetAssetPermissions(ctx *gin.Context, assetId i
 		model.ActionCopy,
 		model.ActionPaste,
 		model.ActionShare,
+		model.ActionPortForward,
 	}
 
 	createBatchResult := func(allowed bool, reason string, permissions *model.AuthPermissions) *model.BatchAuthResult {
@@ -590,6 +615,7 @@ func (s *AuthorizationV2Service) GetAssetPermissions(ctx *gin.Context, assetId i
 			Copy:         true,
 			Paste:        true,
 			Share:        true,
+			PortForward:  true,
 		}
 		return createBatchResult(true, "Administrator access", adminPermissions), nil
 	}
@@ -764,8 +790,12 @@ func (s *AuthorizationV2Service) extractNodeIdsEfficient(ctx context.Context, ru
 			}
 
 		case model.SelectorTypeTags:
-			// Tags selector not supported for nodes (no tags field)
-			logger.L().Warn("Tags selector not supported for nodes")
+			ids, err := repository.GetTargetIdsByTags(ctx, repository.TagTargetNode, rule.NodeSelector.Values)
+			if err != nil {
+				logger.L().Error("Failed to get nodes by tags", zap.Error(err))
+				continue
+			}
+			nodeIds = append(nodeIds, ids...)
 		}
 	}
 
@@ -822,8 +852,12 @@ func (s *AuthorizationV2Service) extractAssetIdsEfficient(ctx context.Context, r
 			}
 
 		case model.SelectorTypeTags:
-			// Tags selector not supported for assets (no tags field)
-			logger.L().Warn("Tags selector not supported for assets")
+			ids, err := repository.GetTargetIdsByTags(ctx, repository.TagTargetAsset, rule.AssetSelector.Values)
+			if err != nil {
+				logger.L().Error("Failed to get assets by tags", zap.Error(err))
+				continue
+			}
+			assetIds = append(assetIds, ids...)
 		}
 	}
 
@@ -880,8 +914,12 @@ func (s *AuthorizationV2Service) extractAccountIdsEfficient(ctx context.Context,
 			}
 
 		case model.SelectorTypeTags:
-			// Tags selector not supported for accounts (no tags field)
-			logger.L().Warn("Tags selector not supported for accounts")
+			ids, err := repository.GetTargetIdsByTags(ctx, repository.TagTargetAccount, rule.AccountSelector.Values)
+			if err != nil {
+				logger.L().Error("Failed to get accounts by tags", zap.Error(err))
+				continue
+			}
+			accountIds = append(accountIds, ids...)
 		}
 	}
 
@@ -979,6 +1017,7 @@ func (s *AuthorizationV2Service) CloneRule(ctx context.Context, sourceId int, ne
 		}
 		return nil, err
 	}
+	DefaultAuthCache.Invalidate(ctx, AuthCacheTargetRole, result.Rids...)
 
 	logger.L().Info("Authorization rule cloned successfully",
 		zap.Int("source_id", sourceId),
@@ -1008,7 +1047,7 @@ func (s *AuthorizationV2Service) CreateRule(ctx context.Context, rule *model.Aut
 	rule.UpdatedAt = time.Now()
 
 	// Use transaction to ensure consistency
-	return dbpkg.DB.Transaction(func(tx *gorm.DB) error {
+	err := dbpkg.DB.Transaction(func(tx *gorm.DB) error {
 		// Create ACL resource
 		resourceId, err := acl.CreateAcl(ctx, currentUser, config.RESOURCE_AUTHORIZATION, rule.Name)
 		if err != nil {
@@ -1030,6 +1069,13 @@ func (s *AuthorizationV2Service) CreateRule(ctx context.Context, rule *model.Aut
 
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+
+	// Decisions of the roles which were evaluated without this rule are stale now
+	DefaultAuthCache.Invalidate(ctx, AuthCacheTargetRole, rule.Rids...)
+	return nil
 }
 
 // UpdateRule updates an existing authorization rule with ACL handling
@@ -1061,7 +1107,7 @@ func (s *AuthorizationV2Service) UpdateRule(ctx context.Context, rule *model.Aut
 	rule.UpdatedAt = time.Now()
 
 	// Use transaction to ensure consistency
-	return dbpkg.DB.Transaction(func(tx *gorm.DB) error {
+	err = dbpkg.DB.Transaction(func(tx *gorm.DB) error {
 		// Update role permissions if Rids changed
 		if !reflect.DeepEqual(rule.Rids, existingRule.Rids) {
 			// Revoke permissions from removed roles
@@ -1088,6 +1134,13 @@ func (s *AuthorizationV2Service) UpdateRule(ctx context.Context, rule *model.Aut
 
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+
+	DefaultAuthCache.Invalidate(ctx, AuthCacheTargetRule, rule.Id)
+	DefaultAuthCache.Invalidate(ctx, AuthCacheTargetRole, lo.Union(existingRule.Rids, rule.Rids)...)
+	return nil
 }
 
 // DeleteRule deletes an authorization rule with ACL cleanup
@@ -1107,7 +1160,7 @@ func (s *AuthorizationV2Service) DeleteRule(ctx context.Context, id int) error {
 	}
 
 	// Use transaction to ensure consistency
-	return dbpkg.DB.Transaction(func(tx *gorm.DB) error {
+	err = dbpkg.DB.Transaction(func(tx *gorm.DB) error {
 		// Delete ACL resource
 		if err := acl.DeleteResource(ctx, currentUser.GetUid(), rule.ResourceId); err != nil {
 			return fmt.Errorf("failed to delete ACL resource: %w", err)
@@ -1120,6 +1173,13 @@ func (s *AuthorizationV2Service) DeleteRule(ctx context.Context, id int) error {
 
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+
+	DefaultAuthCache.Invalidate(ctx, AuthCacheTargetRule, rule.Id)
+	DefaultAuthCache.Invalidate(ctx, AuthCacheTargetRole, rule.Rids...)
+	return nil
 }
 
 // GetRuleById retrieves a rule by ID
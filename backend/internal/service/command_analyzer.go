@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"fmt"
 	"regexp"
 	"strconv"
 
@@ -28,13 +29,14 @@ func NewCommandAnalyzer() *CommandAnalyzer {
 }
 
 // AnalyzeSessionCommands analyzes and builds the final command list for a session
-// This combines asset-level and authorization-level command controls
-func (ca *CommandAnalyzer) AnalyzeSessionCommands(ctx *gin.Context, sess *gsession.Session) ([]*model.Command, error) {
+// This combines asset-level and authorization-level command controls, allowlist is true
+// if any of them only permits explicitly allowed commands
+func (ca *CommandAnalyzer) AnalyzeSessionCommands(ctx *gin.Context, sess *gsession.Session) (cmds []*model.Command, allowlist bool, err error) {
 	// Get all available commands from cache
 	allCommands, err := repository.GetAllFromCacheDb(ctx, model.DefaultCommand)
 	if err != nil {
 		logger.L().Error("Failed to get commands from cache", zap.Error(err))
-		return nil, err
+		return nil, false, err
 	}
 
 	// Filter enabled commands
@@ -43,14 +45,14 @@ func (ca *CommandAnalyzer) AnalyzeSessionCommands(ctx *gin.Context, sess *gsessi
 	})
 
 	// Analyze asset-level command control
-	assetCommands := ca.analyzeAssetCommands(sess.Session.Asset, enabledCommands)
+	assetCommands, assetAllowlist := ca.analyzeAssetCommands(sess.Session.Asset, enabledCommands)
 
 	// Analyze authorization-level command control
-	authCommands, err := ca.analyzeAuthorizationCommands(ctx, sess, enabledCommands)
+	authCommands, authAllowlist, err := ca.analyzeAuthorizationCommands(ctx, sess, enabledCommands)
 	if err != nil {
 		logger.L().Error("Failed to analyze authorization commands", zap.Error(err))
 		// Continue with asset-level commands only
-		authCommands = []*model.Command{}
+		authCommands, authAllowlist = []*model.Command{}, false
 	}
 
 	// Merge and deduplicate command lists
@@ -74,14 +76,14 @@ func (ca *CommandAnalyzer) AnalyzeSessionCommands(ctx *gin.Context, sess *gsessi
 		zap.String("sessionId", sess.SessionId),
 		zap.Int("assetCommands", len(assetCommands)),
 		zap.Int("authCommands", len(authCommands)),
-		zap.Int("finalCommands", len(finalCommands)))
+		zap.Int("finalCommands", len(finalCommands)),
+		zap.Bool("allowlist", assetAllowlist || authAllowlist))
 
-	return finalCommands, nil
+	return finalCommands, assetAllowlist || authAllowlist, nil
 }
 
 // analyzeAssetCommands analyzes asset-level command controls from V2 system
-func (ca *CommandAnalyzer) analyzeAssetCommands(asset *model.Asset, allCommands []*model.Command) []*model.Command {
-	var result []*model.Command
+func (ca *CommandAnalyzer) analyzeAssetCommands(asset *model.Asset, allCommands []*model.Command) (result []*model.Command, allowlist bool) {
 
 	// V2 asset command control
 	if asset.AssetCommandControl != nil && asset.AssetCommandControl.Enabled {
@@ -107,38 +109,37 @@ func (ca *CommandAnalyzer) analyzeAssetCommands(asset *model.Asset, allCommands
 			v2Commands = append(v2Commands, templateCommands...)
 		}
 
-		// All configured commands are intercepted
+		// Configured commands are handled by their actions
 		result = append(result, v2Commands...)
+		allowlist = asset.AssetCommandControl.Allowlist
 
 		logger.L().Debug("Asset V2 command control applied",
 			zap.Int("assetId", asset.Id),
 			zap.Int("cmdCount", len(v2Commands)))
 	}
 
-	return lo.UniqBy(result, func(cmd *model.Command) int { return cmd.Id })
+	return lo.UniqBy(result, commandKey), allowlist
 }
 
 // analyzeAuthorizationCommands analyzes authorization-level command controls from V2 rules
-func (ca *CommandAnalyzer) analyzeAuthorizationCommands(ctx *gin.Context, sess *gsession.Session, allCommands []*model.Command) ([]*model.Command, error) {
+func (ca *CommandAnalyzer) analyzeAuthorizationCommands(ctx *gin.Context, sess *gsession.Session, allCommands []*model.Command) (result []*model.Command, allowlist bool, err error) {
 	// Get user's authorized V2 rules
 	authV2ResourceIds, err := ca.getAuthorizedV2ResourceIds(ctx)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
 	if len(authV2ResourceIds) == 0 {
-		return []*model.Command{}, nil
+		return []*model.Command{}, false, nil
 	}
 
 	// Get V2 rules that apply to this session
 	authV2Service := NewAuthorizationV2Service()
 	rules, err := authV2Service.repo.GetByResourceIds(ctx, authV2ResourceIds)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
-	var result []*model.Command
-
 	// Analyze each applicable rule
 	for _, rule := range rules {
 		if !rule.Enabled {
@@ -149,10 +150,11 @@ func (ca *CommandAnalyzer) analyzeAuthorizationCommands(ctx *gin.Context, sess *
 		if ca.ruleMatchesSession(rule, sess) {
 			ruleCommands := ca.extractCommandsFromRule(rule, allCommands)
 			result = append(result, ruleCommands...)
+			allowlist = allowlist || rule.AccessControl.CmdAllowlist
 		}
 	}
 
-	return lo.UniqBy(result, func(cmd *model.Command) int { return cmd.Id }), nil
+	return lo.UniqBy(result, commandKey), allowlist, nil
 }
 
 // ruleMatchesSession checks if a V2 rule matches the current session (simplified)
@@ -213,7 +215,7 @@ func (ca *CommandAnalyzer) extractCommandsFromRule(rule *model.AuthorizationV2,
 		result = append(result, templateCommands...)
 	}
 
-	// All configured commands are intercepted
+	// Configured commands are handled by their actions
 	return result
 }
 
@@ -244,6 +246,15 @@ func (ca *CommandAnalyzer) expandCommandTemplates(templateIds []int, allCommands
 			return lo.Contains(templateCmdIds, cmd.Id)
 		})
 
+		// Action of template overrides action of its commands, copy to keep cached commands untouched
+		if template.Action.IsValid() {
+			templateCommands = lo.Map(templateCommands, func(cmd *model.Command, _ int) *model.Command {
+				c := *cmd
+				c.Action = template.Action
+				return &c
+			})
+		}
+
 		expandedCommands = append(expandedCommands, templateCommands...)
 	}
 
@@ -255,8 +266,13 @@ func (ca *CommandAnalyzer) mergeCommands(assetCommands, authCommands []*model.Co
 	// Combine all commands
 	allCommands := append(assetCommands, authCommands...)
 
-	// Deduplicate by ID
-	return lo.UniqBy(allCommands, func(cmd *model.Command) int { return cmd.Id })
+	// Deduplicate by ID and action, the same command may be configured with different actions
+	return lo.UniqBy(allCommands, commandKey)
+}
+
+// commandKey identifies a command with its effective action
+func commandKey(cmd *model.Command) string {
+	return fmt.Sprintf("%d-%s", cmd.Id, cmd.GetAction())
 }
 
 // getAuthorizedV2ResourceIds gets V2 authorization rule resource IDs that user has permission to
@@ -145,6 +145,11 @@ func (s *CommandTemplateService) ValidateCommandTemplate(template *model.Command
 		return fmt.Errorf("invalid category: %s. Valid categories: %v", template.Category, validCategories)
 	}
 
+	// Empty action keeps actions of the commands
+	if template.Action != "" && !template.Action.IsValid() {
+		return fmt.Errorf("invalid action: %s", template.Action)
+	}
+
 	// Validate command IDs if provided
 	if len(template.CmdIds) > 0 {
 		if err := s.validateCommandIds(template.CmdIds); err != nil {
@@ -105,6 +105,7 @@ func (s *ConfigService) MigrateConfigStructure(ctx context.Context) error {
 				Copy:         oldConfig.SSHCopy || oldConfig.RDPCopy || oldConfig.VNCCopy,
 				Paste:        oldConfig.SSHPaste || oldConfig.RDPPaste || oldConfig.VNCPaste,
 				Share:        false, // Default to deny share for security
+				PortForward:  false, // Default to deny port forwarding for security
 			},
 			CreatorId: oldConfig.CreatorId,
 			UpdaterId: oldConfig.UpdaterId,
@@ -591,6 +591,14 @@ func (s *FileService) GetActionCode(operation string) int {
 		return model.FILE_ACTION_DOWNLOAD
 	case "mkdir":
 		return model.FILE_ACTION_MKDIR
+	case "remove":
+		return model.FILE_ACTION_REMOVE
+	case "rmdir":
+		return model.FILE_ACTION_RMDIR
+	case "rename":
+		return model.FILE_ACTION_RENAME
+	case "setstat":
+		return model.FILE_ACTION_SETSTAT
 	default:
 		return model.FILE_ACTION_LS
 	}
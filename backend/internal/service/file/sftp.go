@@ -12,6 +12,8 @@ import (
 	"go.uber.org/zap"
 	"golang.org/x/crypto/ssh"
 
+	"github.com/veops/oneterm/internal/hostkey"
+	"github.com/veops/oneterm/internal/model"
 	"github.com/veops/oneterm/internal/repository"
 	gsession "github.com/veops/oneterm/internal/session"
 	"github.com/veops/oneterm/internal/tunneling"
@@ -85,11 +87,10 @@ func AssetBasedTransfer(transferId, tempFilePath, targetPath string, assetId, ac
 	}
 
 	// Create SSH client with maximum performance optimizations for SFTP
-	sshClient, err := ssh.Dial("tcp", fmt.Sprintf("%s:%d", ip, port), &ssh.ClientConfig{
-		User:            account.Account,
-		Auth:            []ssh.AuthMethod{auth},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-		Timeout:         30 * time.Second,
+	sshClient, err := ssh.Dial("tcp", fmt.Sprintf("%s:%d", ip, port), hostkey.Apply(&ssh.ClientConfig{
+		User:    account.Account,
+		Auth:    []ssh.AuthMethod{auth},
+		Timeout: 30 * time.Second,
 		// Ultra-high performance optimizations - fastest algorithms first
 		Config: ssh.Config{
 			Ciphers: []string{
@@ -114,7 +115,7 @@ func AssetBasedTransfer(transferId, tempFilePath, targetPath string, assetId, ac
 			"rsa-sha2-512", // Alternative fast RSA
 			"ssh-ed25519",  // Modern EdDSA (very fast verification)
 		},
-	})
+	}, model.KnownHostTargetAsset, asset.Id))
 	if err != nil {
 		return fmt.Errorf("failed to connect SSH: %w", err)
 	}
@@ -21,6 +21,7 @@ import (
 	"gorm.io/gorm"
 
 	"github.com/veops/oneterm/internal/guacd"
+	"github.com/veops/oneterm/internal/hostkey"
 	"github.com/veops/oneterm/internal/model"
 	"github.com/veops/oneterm/internal/repository"
 	gsession "github.com/veops/oneterm/internal/session"
@@ -121,12 +122,11 @@ func (fm *FileManager) GetFileClient(assetId, accountId int) (cli *sftp.Client,
 		return
 	}
 
-	sshCli, err := ssh.Dial("tcp", fmt.Sprintf("%s:%d", ip, port), &ssh.ClientConfig{
-		User:            account.Account,
-		Auth:            []ssh.AuthMethod{auth},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-		Timeout:         time.Second,
-	})
+	sshCli, err := ssh.Dial("tcp", fmt.Sprintf("%s:%d", ip, port), hostkey.Apply(&ssh.ClientConfig{
+		User:    account.Account,
+		Auth:    []ssh.AuthMethod{auth},
+		Timeout: time.Second,
+	}, model.KnownHostTargetAsset, asset.Id))
 	if err != nil {
 		return
 	}
@@ -193,12 +193,11 @@ func (sfm *SessionFileManager) InitSessionSFTP(sessionId string, assetId, accoun
 			return err
 		}
 
-		sshClient, err = ssh.Dial("tcp", fmt.Sprintf("%s:%d", ip, port), &ssh.ClientConfig{
-			User:            account.Account,
-			Auth:            []ssh.AuthMethod{auth},
-			HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-			Timeout:         10 * time.Second,
-		})
+		sshClient, err = ssh.Dial("tcp", fmt.Sprintf("%s:%d", ip, port), hostkey.Apply(&ssh.ClientConfig{
+			User:    account.Account,
+			Auth:    []ssh.AuthMethod{auth},
+			Timeout: 10 * time.Second,
+		}, model.KnownHostTargetAsset, asset.Id))
 		if err != nil {
 			return fmt.Errorf("failed to connect SSH for session %s: %w", sessionId, err)
 		}
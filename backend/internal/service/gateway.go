@@ -2,8 +2,11 @@ package service
 
 import (
 	"context"
+	"errors"
+	"fmt"
 
 	"github.com/gin-gonic/gin"
+	"github.com/samber/lo"
 	"github.com/veops/oneterm/internal/model"
 	"github.com/veops/oneterm/internal/repository"
 	"github.com/veops/oneterm/internal/tunneling"
@@ -67,6 +70,66 @@ func (s *GatewayService) CheckAssetDependencies(ctx context.Context, id int) (st
 	return s.repo.CheckAssetDependencies(ctx, id)
 }
 
+// CheckChildDependencies checks if gateway is the parent of other gateways
+func (s *GatewayService) CheckChildDependencies(ctx context.Context, id int) (string, error) {
+	return s.repo.CheckChildDependencies(ctx, id)
+}
+
+// CheckCycle checks if a gateway change would create a cycle or a too long chain
+func (s *GatewayService) CheckCycle(ctx context.Context, data *model.Gateway, gatewayId int) error {
+	if data.ParentId == 0 {
+		return nil
+	}
+
+	gateways, err := repository.GetAllFromCacheDb(ctx, model.DefaultGateway)
+	if err != nil {
+		return err
+	}
+	parents := lo.SliceToMap(gateways, func(g *model.Gateway) (int, int) { return g.Id, g.ParentId })
+	if _, ok := parents[data.ParentId]; !ok {
+		return fmt.Errorf("parent gateway %d not found", data.ParentId)
+	}
+
+	hops := 1
+	for id := data.ParentId; id != 0; id = parents[id] {
+		if id == gatewayId {
+			return errors.New("gateway change would create cycle")
+		}
+		if hops++; hops > model.MaxGatewayHops {
+			return fmt.Errorf("gateway chain exceeds %d hops", model.MaxGatewayHops)
+		}
+	}
+
+	return nil
+}
+
+// AttachHops attaches every hop of the gateway chains with its latest health check
+func (s *GatewayService) AttachHops(ctx context.Context, gateways []*model.Gateway) error {
+	all, err := repository.GetAllFromCacheDb(ctx, model.DefaultGateway)
+	if err != nil {
+		return err
+	}
+	id2gateway := lo.SliceToMap(all, func(g *model.Gateway) (int, *model.Gateway) { return g.Id, g })
+
+	for _, g := range gateways {
+		g.Hops = make([]*model.GatewayHop, 0)
+		for id, hops := g.Id, 0; id != 0 && hops < model.MaxGatewayHops; hops++ {
+			hop, ok := id2gateway[id]
+			if !ok {
+				break
+			}
+			h := tunneling.GetGatewayHealth(id)
+			if h == nil {
+				h = &model.GatewayHop{Id: hop.Id, Name: hop.Name, Host: hop.Host, Port: hop.Port}
+			}
+			g.Hops = append([]*model.GatewayHop{h}, g.Hops...)
+			id = hop.ParentId
+		}
+	}
+
+	return nil
+}
+
 // BuildQuery constructs gateway query with basic filters
 func (s *GatewayService) BuildQuery(ctx *gin.Context) *gorm.DB {
 	return s.repo.BuildQuery(ctx)
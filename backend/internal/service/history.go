@@ -9,6 +9,7 @@ import (
 	"github.com/nicksnyder/go-i18n/v2/i18n"
 	"gorm.io/gorm"
 
+	"github.com/veops/oneterm/internal/audit"
 	myi18n "github.com/veops/oneterm/internal/i18n"
 	"github.com/veops/oneterm/internal/model"
 	"github.com/veops/oneterm/internal/repository"
@@ -76,6 +77,18 @@ func (s *HistoryService) BuildQuery(ctx *gin.Context) (*gorm.DB, error) {
 	return db, nil
 }
 
+// VerifyAuditChain verifies the hash chain over history and session_cmd rows from fromId, limit <= 0 checks to the end
+func (s *HistoryService) VerifyAuditChain(ctx context.Context, fromId, limit int) (*model.AuditReport, error) {
+	report, err := audit.VerifyChain(ctx, fromId, limit)
+	if err != nil {
+		return nil, err
+	}
+	if report.PublicKey, err = audit.PublicKey(); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
 // GetTypeMapping gets mapping between history types and localized strings
 func (s *HistoryService) GetTypeMapping(ctx *gin.Context) (map[string]string, error) {
 	lang := ctx.PostForm("lang")
@@ -88,6 +101,7 @@ func (s *HistoryService) GetTypeMapping(ctx *gin.Context) (map[string]string, er
 		"asset":      myi18n.MsgTypeMappingAsset,
 		"command":    myi18n.MsgTypeMappingCommand,
 		"gateway":    myi18n.MsgTypeMappingGateway,
+		"known_host": myi18n.MsgTypeMappingKnownHost,
 		"node":       myi18n.MsgTypeMappingNode,
 		"public_key": myi18n.MsgTypeMappingPublicKey,
 	}
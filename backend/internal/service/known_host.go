@@ -0,0 +1,135 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samber/lo"
+	"golang.org/x/crypto/ssh"
+	"gorm.io/gorm"
+
+	"github.com/veops/oneterm/internal/hostkey"
+	"github.com/veops/oneterm/internal/model"
+	"github.com/veops/oneterm/internal/repository"
+	dbpkg "github.com/veops/oneterm/pkg/db"
+)
+
+// KnownHostService handles review of target SSH host keys
+type KnownHostService struct {
+	repo           repository.KnownHostRepository
+	historyService *HistoryService
+}
+
+// NewKnownHostService creates a new known host service
+func NewKnownHostService() *KnownHostService {
+	return &KnownHostService{
+		repo:           repository.NewKnownHostRepository(),
+		historyService: NewHistoryService(),
+	}
+}
+
+// PinKnownHostRequest pins a host key to an asset or a gateway
+type PinKnownHostRequest struct {
+	TargetType string `json:"target_type" binding:"required,oneof=asset gateway"`
+	TargetId   int    `json:"target_id" binding:"required,gt=0"`
+	PublicKey  string `json:"public_key" binding:"required"`
+}
+
+// BuildQuery constructs known host query with basic filters
+func (s *KnownHostService) BuildQuery(ctx *gin.Context) *gorm.DB {
+	return s.repo.BuildQuery(ctx)
+}
+
+// GetKnownHostByID retrieves a known host by ID
+func (s *KnownHostService) GetKnownHostByID(ctx context.Context, id int) (*model.KnownHost, error) {
+	return s.repo.GetKnownHostByID(ctx, id)
+}
+
+// Pin trusts the given public key for the target, replacing any previous key
+func (s *KnownHostService) Pin(ctx context.Context, req *PinKnownHostRequest, uid int) (*model.KnownHost, error) {
+	key, err := hostkey.ParseKey(req.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	old, err := s.repo.GetKnownHostByTarget(ctx, req.TargetType, req.TargetId)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	kh := &model.KnownHost{
+		TargetType: req.TargetType,
+		TargetId:   req.TargetId,
+		CreatorId:  uid,
+	}
+	if old != nil {
+		copied := *old
+		kh = &copied
+	}
+	kh.Status = model.KnownHostStatusTrusted
+	kh.KeyType = key.Type()
+	kh.Fingerprint = ssh.FingerprintSHA256(key)
+	kh.PublicKey = hostkey.MarshalKey(key)
+	kh.PendingKeyType, kh.PendingFingerprint, kh.PendingPublicKey = "", "", ""
+	kh.UpdaterId = uid
+
+	err = dbpkg.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(kh).Error; err != nil {
+			return err
+		}
+		return s.saveHistory(ctx, tx, lo.Ternary(old == nil, model.ACTION_CREATE, model.ACTION_UPDATE), kh, old, uid)
+	})
+
+	return kh, err
+}
+
+// Accept trusts the pending key offered by the host
+func (s *KnownHostService) Accept(ctx context.Context, id int, uid int) (*model.KnownHost, error) {
+	old, err := s.repo.GetKnownHostByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if old.PendingFingerprint == "" {
+		return nil, fmt.Errorf("known host %d has no pending key", id)
+	}
+
+	kh := *old
+	kh.Status = model.KnownHostStatusTrusted
+	kh.KeyType, kh.Fingerprint, kh.PublicKey = old.PendingKeyType, old.PendingFingerprint, old.PendingPublicKey
+	kh.PendingKeyType, kh.PendingFingerprint, kh.PendingPublicKey = "", "", ""
+	kh.UpdaterId = uid
+
+	err = dbpkg.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&kh).Error; err != nil {
+			return err
+		}
+		return s.saveHistory(ctx, tx, model.ACTION_UPDATE, &kh, old, uid)
+	})
+
+	return &kh, err
+}
+
+// Reset forgets the known host, the next connection will be verified as an unknown host
+func (s *KnownHostService) Reset(ctx context.Context, id int, uid int) error {
+	old, err := s.repo.GetKnownHostByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	return dbpkg.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(old).Error; err != nil {
+			return err
+		}
+		return s.saveHistory(ctx, tx, model.ACTION_DELETE, old, nil, uid)
+	})
+}
+
+func (s *KnownHostService) saveHistory(ctx context.Context, tx *gorm.DB, actionType int, kh *model.KnownHost, old *model.KnownHost, uid int) error {
+	var oldModel model.Model
+	if old != nil {
+		oldModel = old
+	}
+	return tx.Create(s.historyService.CreateHistoryRecord(ctx, actionType, kh, oldModel, uid)).Error
+}
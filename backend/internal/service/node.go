@@ -102,6 +102,12 @@ func (s *NodeService) BuildQuery(ctx *gin.Context, currentUser interface{}, info
 		db = db.Where("id IN ?", ids)
 	}
 
+	// Filter by tags including inherited ones
+	db, err := repository.FilterTags(ctx, db, repository.TagTargetNode)
+	if err != nil {
+		return nil, err
+	}
+
 	// Info mode handling
 	if info {
 		db = db.Select("id", "parent_id", "name")
@@ -157,6 +163,12 @@ func (s *NodeService) BuildQueryWithAuthorization(ctx *gin.Context) (*gorm.DB, e
 		db = db.Where("id IN ?", ids)
 	}
 
+	// Filter by tags including inherited ones
+	db, err := repository.FilterTags(ctx, db, repository.TagTargetNode)
+	if err != nil {
+		return nil, err
+	}
+
 	currentUser, _ := acl.GetSessionFromCtx(ctx)
 
 	// Administrators have access to all nodes
@@ -0,0 +1,308 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/veops/oneterm/internal/model"
+	gsession "github.com/veops/oneterm/internal/session"
+	"github.com/veops/oneterm/pkg/asciicast"
+	"github.com/veops/oneterm/pkg/logger"
+)
+
+const (
+	ReplayExportText = "text"
+	ReplayExportGIF  = "gif"
+	ReplayExportMP4  = "mp4"
+)
+
+var (
+	// replayExportExts are the file extensions of the export formats
+	replayExportExts = map[string]string{
+		ReplayExportText: ".txt",
+		ReplayExportGIF:  ".gif",
+		ReplayExportMP4:  ".mp4",
+	}
+
+	// DefaultReplayExportManager tracks export jobs, at most 2 are rendered at the same time
+	DefaultReplayExportManager = &ReplayExportManager{
+		exports: make(map[string]*ReplayExport),
+		slots:   make(chan struct{}, 2),
+	}
+)
+
+// ReplayExportExt returns the file extension of an export format
+func ReplayExportExt(format string) (string, bool) {
+	ext, ok := replayExportExts[format]
+	return ext, ok
+}
+
+// ReplayExport is a job rendering a recording to a transcript or video
+type ReplayExport struct {
+	ID        string
+	SessionID string
+	Format    string
+	Size      int64  // bytes of the recording
+	Offset    int64  // bytes of the recording rendered
+	Status    string // "pending", "rendering", "uploading", "completed", "failed"
+	Created   time.Time
+	Updated   time.Time
+	Error     string
+	mutex     sync.Mutex
+}
+
+type ReplayExportProgress struct {
+	ID         string    `json:"id"`
+	SessionID  string    `json:"session_id"`
+	Format     string    `json:"format"`
+	Percentage float64   `json:"percentage"`
+	Status     string    `json:"status"`
+	Created    time.Time `json:"created"`
+	Updated    time.Time `json:"updated"`
+	Error      string    `json:"error,omitempty"`
+}
+
+func (e *ReplayExport) setStatus(status string) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.Status = status
+	e.Updated = time.Now()
+}
+
+func (e *ReplayExport) updateProgress(offset int64) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.Offset = offset
+	e.Updated = time.Now()
+}
+
+func (e *ReplayExport) setError(err error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.Error = err.Error()
+	e.Status = "failed"
+	e.Updated = time.Now()
+}
+
+// GetProgress returns the current progress information
+func (e *ReplayExport) GetProgress() *ReplayExportProgress {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	var percentage float64
+	switch {
+	case e.Status == "completed":
+		percentage = 100
+	case e.Size > 0:
+		// Uploading is the last 1%
+		percentage = min(float64(e.Offset)/float64(e.Size)*100, 99)
+	}
+
+	return &ReplayExportProgress{
+		ID:         e.ID,
+		SessionID:  e.SessionID,
+		Format:     e.Format,
+		Percentage: percentage,
+		Status:     e.Status,
+		Created:    e.Created,
+		Updated:    e.Updated,
+		Error:      e.Error,
+	}
+}
+
+// ReplayExportManager keeps export jobs in memory, finished ones are removed after an hour
+type ReplayExportManager struct {
+	exports map[string]*ReplayExport
+	mutex   sync.RWMutex
+	slots   chan struct{}
+}
+
+// CreateExport returns the unfinished or completed job of the session and format, or creates a new one
+func (m *ReplayExportManager) CreateExport(sessionID, format string, size int64) (export *ReplayExport, created bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, e := range m.exports {
+		if e.SessionID == sessionID && e.Format == format && e.GetProgress().Status != "failed" {
+			return e, false
+		}
+	}
+
+	id := make([]byte, 16)
+	rand.Read(id)
+	export = &ReplayExport{
+		ID:        hex.EncodeToString(id),
+		SessionID: sessionID,
+		Format:    format,
+		Size:      size,
+		Status:    "pending",
+		Created:   time.Now(),
+		Updated:   time.Now(),
+	}
+	m.exports[export.ID] = export
+	return export, true
+}
+
+func (m *ReplayExportManager) GetExport(id string) *ReplayExport {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.exports[id]
+}
+
+// CleanupFinishedExports removes completed and failed jobs older than maxAge
+func (m *ReplayExportManager) CleanupFinishedExports(maxAge time.Duration) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	cutoff := time.Now().Add(-maxAge)
+	for id, e := range m.exports {
+		p := e.GetProgress()
+		if (p.Status == "completed" || p.Status == "failed") && p.Updated.Before(cutoff) {
+			delete(m.exports, id)
+		}
+	}
+}
+
+// exportProgressReader reports the bytes of the recording read by the renderer
+type exportProgressReader struct {
+	reader io.Reader
+	export *ReplayExport
+	read   int64
+	last   int64
+}
+
+func (r *exportProgressReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.read += int64(n)
+	// Update progress every 256KB
+	if r.read-r.last >= 262144 || err != nil {
+		r.export.updateProgress(r.read)
+		r.last = r.read
+	}
+	return n, err
+}
+
+// CreateReplayExport starts rendering the recording of a closed session to a text transcript, GIF or MP4,
+// the rendered file is saved to replay storage. An existing job of the same format is returned instead.
+func (s *SessionService) CreateReplayExport(ctx context.Context, sessionId, format string) (*ReplayExportProgress, error) {
+	if _, ok := replayExportExts[format]; !ok {
+		return nil, fmt.Errorf("unsupported export format %s", format)
+	}
+	session, err := s.repo.GetSession(ctx, sessionId)
+	if err != nil {
+		return nil, err
+	}
+	if session.IsGuacd() {
+		return nil, fmt.Errorf("export is not supported by %s recordings", strings.Split(session.Protocol, ":")[0])
+	}
+	if session.Status != model.SESSIONSTATUS_OFFLINE {
+		return nil, fmt.Errorf("session %s is still online", sessionId)
+	}
+	index, err := s.GetSessionReplayIndex(ctx, sessionId)
+	if err != nil {
+		return nil, err
+	}
+
+	DefaultReplayExportManager.CleanupFinishedExports(time.Hour)
+	export, created := DefaultReplayExportManager.CreateExport(sessionId, format, index.Size)
+	if created {
+		go s.runReplayExport(export, session)
+	}
+
+	return export.GetProgress(), nil
+}
+
+func (s *SessionService) runReplayExport(export *ReplayExport, session *model.Session) {
+	DefaultReplayExportManager.slots <- struct{}{}
+	defer func() { <-DefaultReplayExportManager.slots }()
+	defer func() {
+		if r := recover(); r != nil {
+			logger.L().Error("Recovered from panic in replay export", zap.String("session_id", session.SessionId),
+				zap.String("format", export.Format), zap.Any("panic", r))
+			export.setError(fmt.Errorf("panic during export: %v", r))
+		}
+	}()
+
+	if err := s.renderReplayExport(export, session); err != nil {
+		logger.L().Error("Failed to export replay", zap.String("session_id", session.SessionId),
+			zap.String("format", export.Format), zap.Error(err))
+		export.setError(err)
+		return
+	}
+	export.setStatus("completed")
+}
+
+func (s *SessionService) renderReplayExport(export *ReplayExport, session *model.Session) error {
+	export.setStatus("rendering")
+	ext := replayExportExts[export.Format]
+	path, err := gsession.ExportSpoolPath(export.ID, ext)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(path)
+
+	reader, err := s.GetSessionReplay(context.Background(), session.SessionId)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	r := &exportProgressReader{reader: reader, export: export}
+	switch export.Format {
+	case ReplayExportText:
+		err = asciicast.WriteTranscript(file, r)
+	case ReplayExportGIF:
+		err = asciicast.RenderGIF(file, r, asciicast.Options{})
+	case ReplayExportMP4:
+		err = asciicast.RenderMP4(file, r, asciicast.Options{})
+	}
+	if err != nil {
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+
+	export.setStatus("uploading")
+	return gsession.SaveExport(session.SessionId, ext, path, session.CreatedAt)
+}
+
+// GetReplayExport returns the progress of an export job
+func (s *SessionService) GetReplayExport(ctx context.Context, exportId string) (*ReplayExportProgress, error) {
+	export := DefaultReplayExportManager.GetExport(exportId)
+	if export == nil {
+		return nil, fmt.Errorf("export %s not found", exportId)
+	}
+	return export.GetProgress(), nil
+}
+
+// GetReplayExportFile gets the rendered export of a session in the format
+func (s *SessionService) GetReplayExportFile(ctx context.Context, sessionId, format string) (io.ReadCloser, error) {
+	ext, ok := replayExportExts[format]
+	if !ok {
+		return nil, fmt.Errorf("unsupported export format %s", format)
+	}
+	session, err := s.repo.GetSession(ctx, sessionId)
+	if err != nil {
+		return nil, err
+	}
+	return gsession.GetExport(sessionId, ext, session.CreatedAt)
+}
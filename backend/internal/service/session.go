@@ -2,10 +2,12 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -13,6 +15,7 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/veops/oneterm/internal/acl"
+	"github.com/veops/oneterm/internal/audit"
 	"github.com/veops/oneterm/internal/model"
 	"github.com/veops/oneterm/internal/repository"
 	gsession "github.com/veops/oneterm/internal/session"
@@ -92,6 +95,135 @@ func (s *SessionService) BuildQuery(ctx *gin.Context) (*gorm.DB, error) {
 	return s.repo.BuildQuery(ctx, isAdmin, currentUser.GetUid())
 }
 
+// BuildCmdSearchQuery constructs a query for commands across sessions which are visible to current user
+func (s *SessionService) BuildCmdSearchQuery(ctx *gin.Context) (*gorm.DB, error) {
+	currentUser, _ := acl.GetSessionFromCtx(ctx)
+	return s.repo.BuildCmdSearchQuery(ctx, acl.IsAdmin(currentUser), currentUser.GetUid())
+}
+
+// BuildOutputSearchQuery constructs a query for recorded output across sessions which are visible to current user
+func (s *SessionService) BuildOutputSearchQuery(ctx *gin.Context) (*gorm.DB, error) {
+	currentUser, _ := acl.GetSessionFromCtx(ctx)
+	return s.repo.BuildOutputSearchQuery(ctx, acl.IsAdmin(currentUser), currentUser.GetUid())
+}
+
+// GetSessionReplayIndex gets the seek index of the recording with markers of the commands which ran.
+// The index is built by scanning the recording once, it is kept after the session is closed.
+func (s *SessionService) GetSessionReplayIndex(ctx context.Context, sessionId string) (*model.ReplayIndex, error) {
+	session, err := s.repo.GetSession(ctx, sessionId)
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := s.repo.GetReplayIndex(ctx, sessionId)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		if index, err = s.buildReplayIndex(ctx, session); err != nil {
+			return nil, err
+		}
+	}
+
+	cmds, err := s.repo.GetSessionCmds(ctx, sessionId)
+	if err != nil {
+		return nil, err
+	}
+	index.Markers = lo.Map(cmds, func(cmd *model.SessionCmd, _ int) *model.ReplayMarker {
+		return &model.ReplayMarker{
+			Time:   max(cmd.CreatedAt.Sub(session.CreatedAt).Seconds(), 0),
+			CmdId:  cmd.Id,
+			Cmd:    cmd.Cmd,
+			Level:  cmd.Level,
+			Action: cmd.Action,
+		}
+	})
+
+	return index, nil
+}
+
+func (s *SessionService) buildReplayIndex(ctx context.Context, session *model.Session) (*model.ReplayIndex, error) {
+	reader, err := s.GetSessionReplay(ctx, session.SessionId)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	index, err := gsession.BuildReplayIndex(reader, session.IsGuacd())
+	if err != nil {
+		return nil, err
+	}
+	index.SessionId = session.SessionId
+
+	// Recordings of online sessions are still growing
+	if session.Status == model.SESSIONSTATUS_OFFLINE {
+		if err = s.repo.SaveReplayIndex(ctx, index); err != nil {
+			logger.L().Warn("save replay index failed", zap.String("session_id", session.SessionId), zap.Error(err))
+		}
+	}
+
+	return index, nil
+}
+
+// SliceSessionReplay writes the part of an asciicast recording from start to end seconds
+func (s *SessionService) SliceSessionReplay(ctx context.Context, sessionId string, start, end float64, w io.Writer) error {
+	session, err := s.repo.GetSession(ctx, sessionId)
+	if err != nil {
+		return err
+	}
+	if session.IsGuacd() {
+		return fmt.Errorf("time range is not supported by %s recordings", strings.Split(session.Protocol, ":")[0])
+	}
+
+	// Recordings of online sessions are still growing, they are played from the start
+	var index *model.ReplayIndex
+	if session.Status == model.SESSIONSTATUS_OFFLINE {
+		index, err = s.repo.GetReplayIndex(ctx, sessionId)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			index, err = s.buildReplayIndex(ctx, session)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	reader, err := s.GetSessionReplay(ctx, sessionId)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	return gsession.SliceReplay(w, reader, start, end, index)
+}
+
+// VerifySessionReplay checks the recording of a session against the digest signed when it was finalized
+func (s *SessionService) VerifySessionReplay(ctx context.Context, sessionId string) (*model.ReplayVerification, error) {
+	signature, err := s.repo.GetReplaySignature(ctx, sessionId)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &model.ReplayVerification{SessionId: sessionId, Error: "recording is not signed"}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := s.GetSessionReplay(ctx, sessionId)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return audit.VerifyReplay(signature, reader)
+}
+
+// AttachReplayOffsets sets the replay offsets of commands, i.e. seconds from the start of their sessions
+func (s *SessionService) AttachReplayOffsets(hits []*model.SessionSearchHit) {
+	for _, h := range hits {
+		if h.Cmd != "" && !h.SessionCreatedAt.IsZero() {
+			h.Offset = max(h.CreatedAt.Sub(h.SessionCreatedAt).Seconds(), 0)
+		}
+	}
+}
+
 // BuildCmdQuery constructs a query for session commands
 func (s *SessionService) BuildCmdQuery(ctx *gin.Context, sessionId string) *gorm.DB {
 	return s.repo.BuildCmdQuery(ctx, sessionId)
@@ -146,5 +278,9 @@ func (s *SessionService) GetSessionReplayFilename(ctx context.Context, sessionId
 
 // GetSessionReplay gets session replay file reader
 func (s *SessionService) GetSessionReplay(ctx context.Context, sessionId string) (io.ReadCloser, error) {
+	session, err := s.repo.GetSession(ctx, sessionId)
+	if err == nil && session.IsGuacd() {
+		return gsession.GetGuacdReplay(sessionId, session.CreatedAt)
+	}
 	return gsession.GetReplay(sessionId)
 }
@@ -170,6 +170,40 @@ func (s *StatService) GetStatAsset(ctx context.Context, timeRange string) ([]*mo
 	return stat, nil
 }
 
+// GetStatSession gets metadata statistics of sessions, e.g. bytes transferred and why they are closed
+func (s *StatService) GetStatSession(ctx context.Context, timeRange string) (*model.StatSession, error) {
+	// Calculate time range
+	start, end := time.Now(), time.Now()
+	switch timeRange {
+	case "day":
+		start = start.Add(-time.Hour * 24)
+	case "week":
+		start = start.Add(-time.Hour * 24 * 7)
+	case "month":
+		start = start.Add(-time.Hour * 24 * 30)
+	default:
+		return nil, fmt.Errorf("wrong time range %s", timeRange)
+	}
+
+	// Try to get from cache first
+	stat := &model.StatSession{}
+	key := "stat-session-" + timeRange
+	if cache.Get(ctx, key, stat) == nil {
+		return stat, nil
+	}
+
+	// Get stat data
+	stat, err := s.repo.GetStatSession(ctx, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	// Save to cache
+	cache.SetEx(ctx, key, stat, time.Minute)
+
+	return stat, nil
+}
+
 // GetStatCountOfUser gets statistics for current user
 func (s *StatService) GetStatCountOfUser(ctx *gin.Context) (*model.StatCountOfUser, error) {
 	currentUser, _ := acl.GetSessionFromCtx(ctx)
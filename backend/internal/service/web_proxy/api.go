@@ -12,8 +12,10 @@ import (
 
 	"github.com/veops/oneterm/internal/acl"
 	"github.com/veops/oneterm/internal/model"
+	"github.com/veops/oneterm/internal/repository"
 	"github.com/veops/oneterm/internal/service"
 	gsession "github.com/veops/oneterm/internal/session"
+	myErrors "github.com/veops/oneterm/pkg/errors"
 	"github.com/veops/oneterm/pkg/logger"
 )
 
@@ -71,6 +73,13 @@ func StartWebSession(ctx *gin.Context, req StartWebSessionRequest) (*StartWebSes
 		return nil, fmt.Errorf("connection not allowed: %s", reason)
 	}
 
+	// Check concurrent sessions limit of the authorization rule
+	if maxSessions := connectResult.MaxSessions(); maxSessions > 0 && connectResult.RuleId > 0 {
+		if GetCore().CountActiveSessionsForRule(currentUser.GetUserName(), connectResult.RuleId) >= maxSessions {
+			return nil, &myErrors.ApiError{Code: myErrors.ErrMaxSessions, Data: map[string]any{"rule": connectResult.RuleName, "max": maxSessions}}
+		}
+	}
+
 	permissions := &SessionPermissions{
 		CanRead:     true,
 		CanWrite:    true,
@@ -112,6 +121,13 @@ func StartWebSession(ctx *gin.Context, req StartWebSessionRequest) (*StartWebSes
 	if err != nil {
 		return nil, err
 	}
+	session.RuleId = connectResult.RuleId
+	if lifetime := connectResult.SessionTimeout(); lifetime > 0 {
+		session.ExpiresAt = session.CreatedAt.Add(lifetime)
+		if legacySession, exists := GetSession(session.ID); exists {
+			legacySession.ExpiresAt = session.ExpiresAt
+		}
+	}
 
 	// Generate proxy URL
 	baseDomain := strings.Split(ctx.Request.Host, ":")[0]
@@ -149,6 +165,9 @@ func StartWebSession(ctx *gin.Context, req StartWebSessionRequest) (*StartWebSes
 
 	if asset.GatewayId > 0 {
 		dbSession.GatewayInfo = fmt.Sprintf("Gateway_%d", asset.GatewayId)
+		if gateway, err := repository.GetGatewayChain(ctx, asset.GatewayId); err == nil {
+			dbSession.GatewayInfo = gateway.Path()
+		}
 	}
 
 	fullSession := &gsession.Session{Session: dbSession}
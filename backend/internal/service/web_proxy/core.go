@@ -43,6 +43,10 @@ type WebSession struct {
 
 	// Permissions
 	Permissions *SessionPermissions
+
+	// Session control of the authorization rule
+	RuleId    int
+	ExpiresAt time.Time // Zero means no lifetime limit
 }
 
 type SessionPermissions struct {
@@ -130,6 +134,11 @@ func (c *WebProxyCore) GetSession(sessionID string) (*WebSession, bool) {
 			return nil, false
 		}
 
+		if !session.ExpiresAt.IsZero() && time.Now().After(session.ExpiresAt) {
+			c.CloseSession(sessionID)
+			return nil, false
+		}
+
 		return session, true
 	}
 	return nil, false
@@ -187,6 +196,19 @@ func (c *WebProxyCore) GetActiveSessionsForAsset(assetID int) int {
 	return count
 }
 
+// CountActiveSessionsForRule returns the number of active sessions of a user allowed by the rule
+func (c *WebProxyCore) CountActiveSessionsForRule(userID string, ruleId int) int {
+	count := 0
+	c.sessions.Range(func(key, value any) bool {
+		session := value.(*WebSession)
+		if session.UserID == userID && session.RuleId == ruleId && session.IsActive {
+			count++
+		}
+		return true
+	})
+	return count
+}
+
 // ParseRequestContext extracts session and asset information from request
 func (c *WebProxyCore) ParseRequestContext(ctx *gin.Context) (*RequestContext, error) {
 	var sessionID string
@@ -33,6 +33,7 @@ type WebProxySession struct {
 	CurrentHost   string
 	SessionPerms  *SessionPermissions // Cached session permissions for proxy phase
 	WebConfig     *model.WebConfig
+	ExpiresAt     time.Time // Absolute lifetime limit from authorization rule, zero means no limit
 }
 
 func cleanupExpiredSessions(systemMaxInactiveTime time.Duration) {
@@ -43,6 +44,13 @@ func cleanupExpiredSessions(systemMaxInactiveTime time.Duration) {
 	heartbeatTimeout := 30 * time.Second
 
 	for sessionID, session := range webProxySessions {
+		if !session.ExpiresAt.IsZero() && now.After(session.ExpiresAt) {
+			GetCore().CloseSession(sessionID)
+			CloseWebSession(sessionID)
+			cleanedCount++
+			continue
+		}
+
 		if session.IsActive && !session.LastHeartbeat.IsZero() &&
 			now.Sub(session.LastHeartbeat) > heartbeatTimeout {
 			session.IsActive = false
@@ -0,0 +1,240 @@
+package session
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	CollabRoleViewer = "viewer"
+	CollabRoleDriver = "driver"
+)
+
+// Participant is a user invited to a session, Joined is set while the user is connected.
+// UserName is taken from the login of the user when joining, it is empty until then.
+type Participant struct {
+	Uid       int       `json:"uid"`
+	UserName  string    `json:"user_name"`
+	Role      string    `json:"role"`
+	InvitedBy string    `json:"invited_by"`
+	InvitedAt time.Time `json:"invited_at"`
+	Joined    bool      `json:"joined"`
+
+	ws *websocket.Conn
+}
+
+// CollabState is the participants of a session and who holds control
+type CollabState struct {
+	OwnerUid       int            `json:"owner_uid"`
+	OwnerName      string         `json:"owner_name"`
+	ControllerUid  int            `json:"controller_uid"`
+	ControllerName string         `json:"controller_name"`
+	Participants   []*Participant `json:"participants"`
+}
+
+// Collaboration tracks the users invited to a terminal session.
+// Only the controller's keystrokes reach the session, control starts with the owner and is handed over explicitly.
+type Collaboration struct {
+	sess           *Session
+	participants   map[int]*Participant
+	controllerUid  int
+	controllerName string
+	mu             sync.Mutex
+}
+
+func newCollaboration(sess *Session) *Collaboration {
+	return &Collaboration{sess: sess, participants: map[int]*Participant{}}
+}
+
+// controller returns the uid and name of who holds control, the owner until control is handed over
+func (c *Collaboration) controller() (int, string) {
+	if c.controllerUid == 0 {
+		return c.sess.Uid, c.sess.UserName
+	}
+	return c.controllerUid, c.controllerName
+}
+
+// Controller returns the uid and name of the user who holds control
+func (c *Collaboration) Controller() (int, string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.controller()
+}
+
+// IsController checks if the user holds control
+func (c *Collaboration) IsController(uid int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	controller, _ := c.controller()
+	return controller == uid
+}
+
+// Invite adds a user as a viewer or driver, the role of an invited user is replaced
+func (c *Collaboration) Invite(uid int, role, invitedBy string) (*Participant, error) {
+	if role != CollabRoleViewer && role != CollabRoleDriver {
+		return nil, fmt.Errorf("invalid role %s", role)
+	}
+	if uid == c.sess.Uid {
+		return nil, fmt.Errorf("user %d owns the session", uid)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	p, ok := c.participants[uid]
+	if !ok {
+		p = &Participant{Uid: uid, InvitedAt: time.Now()}
+		c.participants[uid] = p
+	}
+	p.Role, p.InvitedBy = role, invitedBy
+	// A driver turned into a viewer gives control back to the owner
+	if controller, _ := c.controller(); controller == uid && role == CollabRoleViewer {
+		c.setController(c.sess.Uid, c.sess.UserName)
+	}
+
+	return p, nil
+}
+
+// Revoke removes an invitation and disconnects the user
+func (c *Collaboration) Revoke(uid int) error {
+	c.mu.Lock()
+	p, ok := c.participants[uid]
+	if ok {
+		delete(c.participants, uid)
+		if controller, _ := c.controller(); controller == uid {
+			c.setController(c.sess.Uid, c.sess.UserName)
+		}
+	}
+	c.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("user %d is not invited", uid)
+	}
+	if p.ws != nil {
+		p.ws.Close()
+	}
+	return nil
+}
+
+// Join connects an invited user with the name of its login, output of the session is sent to ws until Leave
+func (c *Collaboration) Join(uid int, userName string, ws *websocket.Conn) (*Participant, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	p, ok := c.participants[uid]
+	if !ok {
+		return nil, fmt.Errorf("user %d is not invited", uid)
+	}
+	if p.ws != nil {
+		return nil, fmt.Errorf("%s already joined", p.UserName)
+	}
+	p.ws, p.Joined, p.UserName = ws, true, userName
+	c.sess.Monitors.Store(collabMonitorKey(uid), ws)
+	c.mark(fmt.Sprintf("%s joined as %s", p.UserName, p.Role))
+	c.notify(fmt.Sprintf("%s joined as %s", p.UserName, p.Role))
+
+	return p, nil
+}
+
+// Leave disconnects a user, control goes back to the owner if the user held it
+func (c *Collaboration) Leave(uid int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.sess.Monitors.Delete(collabMonitorKey(uid))
+	p, ok := c.participants[uid]
+	if !ok {
+		return
+	}
+	p.ws, p.Joined = nil, false
+	c.mark(fmt.Sprintf("%s left", p.UserName))
+	c.notify(fmt.Sprintf("%s left", p.UserName))
+	if controller, _ := c.controller(); controller == uid {
+		c.setController(c.sess.Uid, c.sess.UserName)
+	}
+}
+
+// HandOver gives control to the owner or a joined driver
+func (c *Collaboration) HandOver(uid int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if uid == c.sess.Uid {
+		c.setController(c.sess.Uid, c.sess.UserName)
+		return nil
+	}
+	p, ok := c.participants[uid]
+	switch {
+	case !ok:
+		return fmt.Errorf("user %d is not invited", uid)
+	case p.Role != CollabRoleDriver:
+		return fmt.Errorf("user %d is a viewer", uid)
+	case p.ws == nil:
+		return fmt.Errorf("user %d has not joined", uid)
+	}
+	c.setController(p.Uid, p.UserName)
+
+	return nil
+}
+
+// setController changes control and marks the recording, keystrokes after the marker are the controller's
+func (c *Collaboration) setController(uid int, userName string) {
+	if controller, _ := c.controller(); controller == uid {
+		return
+	}
+	c.controllerUid, c.controllerName = uid, userName
+	c.mark(fmt.Sprintf("control: %s", userName))
+	c.notify(fmt.Sprintf("%s has control", userName))
+}
+
+// notify shows a message to everyone in the session, it is dropped if the session is not reading notices
+func (c *Collaboration) notify(msg string) {
+	select {
+	case c.sess.Chans.NoticeChan <- msg:
+	default:
+	}
+}
+
+func (c *Collaboration) mark(label string) {
+	if c.sess.SshRecoder != nil {
+		c.sess.SshRecoder.Marker(label)
+	}
+}
+
+// State returns the participants and who holds control
+func (c *Collaboration) State() *CollabState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	state := &CollabState{
+		OwnerUid:     c.sess.Uid,
+		OwnerName:    c.sess.UserName,
+		Participants: make([]*Participant, 0, len(c.participants)),
+	}
+	state.ControllerUid, state.ControllerName = c.controller()
+	for _, p := range c.participants {
+		cp := *p
+		state.Participants = append(state.Participants, &cp)
+	}
+
+	return state
+}
+
+// Participant returns the invitation of a user
+func (c *Collaboration) Participant(uid int) (Participant, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	p, ok := c.participants[uid]
+	if !ok {
+		return Participant{}, false
+	}
+	return *p, true
+}
+
+func collabMonitorKey(uid int) string {
+	return fmt.Sprintf("collab-%d", uid)
+}
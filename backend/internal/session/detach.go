@@ -0,0 +1,145 @@
+package session
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+
+	"github.com/veops/oneterm/internal/model"
+	"github.com/veops/oneterm/pkg/logger"
+)
+
+const (
+	// maxBacklog is the max output kept for a detached web terminal, older output is dropped
+	maxBacklog = 1 << 20
+)
+
+var (
+	ErrDetachTimeout = errors.New("detached session timeout")
+)
+
+// detachState keeps a web terminal running while its websocket is dropped
+type detachState struct {
+	detached bool
+	deadline time.Time
+	backlog  bytes.Buffer
+	attachC  chan struct{} // closed when a websocket is attached
+	detachC  chan struct{} // closed when the attached websocket is dropped
+}
+
+// Detach drops ws from a web terminal and keeps the session for the detach timeout.
+// It returns false if the session can not be kept and must be closed.
+func (m *Session) Detach(ws *websocket.Conn) bool {
+	timeout := model.GlobalConfig.Load().GetDetachTimeout()
+	if m.SessionType != model.SESSIONTYPE_WEB || m.IsGuacd() || timeout <= 0 || m.Gctx.Err() != nil {
+		return false
+	}
+
+	m.detachMu.Lock()
+	defer m.detachMu.Unlock()
+
+	// Already dropped, or replaced by another websocket
+	if m.detach.detached || m.Ws != ws {
+		return true
+	}
+	if m.detach.detachC != nil {
+		close(m.detach.detachC)
+	}
+	m.Ws = nil
+	m.detach.detached = true
+	m.detach.deadline = time.Now().Add(timeout)
+	m.detach.attachC = make(chan struct{})
+	m.detach.backlog.Reset()
+	ws.Close()
+
+	m.Status = model.SESSIONSTATUS_DETACHED
+	if err := UpsertSession(m); err != nil {
+		logger.L().Error("upsert session failed", zap.String("sessionId", m.SessionId), zap.Error(err))
+	}
+	logger.L().Info("session detached", zap.String("sessionId", m.SessionId), zap.Duration("timeout", timeout))
+
+	return true
+}
+
+// Attach replaces the dropped websocket of a detached web terminal with ws.
+// It returns the output written while detached, which must be sent to ws before any other output,
+// and a channel which is closed when ws is dropped.
+func (m *Session) Attach(ws *websocket.Conn) (backlog []byte, detachC <-chan struct{}, err error) {
+	m.detachMu.Lock()
+	defer m.detachMu.Unlock()
+
+	if !m.detach.detached || m.Gctx.Err() != nil || time.Now().After(m.detach.deadline) {
+		return nil, nil, fmt.Errorf("session %s is not detached", m.SessionId)
+	}
+	backlog = bytes.Clone(m.detach.backlog.Bytes())
+	m.detach.backlog.Reset()
+	m.Ws = ws
+	m.detach.detached = false
+	m.detach.detachC = make(chan struct{})
+	close(m.detach.attachC)
+
+	m.Status = model.SESSIONSTATUS_ONLINE
+	if err := UpsertSession(m); err != nil {
+		logger.L().Error("upsert session failed", zap.String("sessionId", m.SessionId), zap.Error(err))
+	}
+	logger.L().Info("session attached", zap.String("sessionId", m.SessionId))
+
+	return backlog, m.detach.detachC, nil
+}
+
+// WaitAttach waits for a websocket to be attached to a detached web terminal or the session to be done.
+// It returns ErrDetachTimeout if no websocket is attached in the detach timeout.
+func (m *Session) WaitAttach() error {
+	m.detachMu.Lock()
+	detached, attachC, deadline := m.detach.detached, m.detach.attachC, m.detach.deadline
+	m.detachMu.Unlock()
+	if !detached {
+		return nil
+	}
+
+	tm := time.NewTimer(time.Until(deadline))
+	defer tm.Stop()
+	select {
+	case <-tm.C:
+		return ErrDetachTimeout
+	case <-attachC:
+	case <-m.Gctx.Done():
+	case <-m.Chans.AwayChan:
+	}
+	return nil
+}
+
+// KeepBacklog keeps out for reattaching if the web terminal is detached
+func (m *Session) KeepBacklog(out []byte) bool {
+	m.detachMu.Lock()
+	defer m.detachMu.Unlock()
+
+	if !m.detach.detached {
+		return false
+	}
+	m.detach.backlog.Write(out)
+	if n := m.detach.backlog.Len() - maxBacklog; n > 0 {
+		m.detach.backlog.Next(n)
+	}
+
+	return true
+}
+
+// GetWs returns the websocket of a web terminal, nil while it is detached.
+// Ws is replaced by Detach and Attach, so it must not be read directly once the session runs.
+func (m *Session) GetWs() *websocket.Conn {
+	m.detachMu.Lock()
+	defer m.detachMu.Unlock()
+	return m.Ws
+}
+
+// IsDetached checks if the websocket of the web terminal is dropped
+func (m *Session) IsDetached() bool {
+	m.detachMu.Lock()
+	defer m.detachMu.Unlock()
+	return m.detach.detached
+}
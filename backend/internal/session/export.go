@@ -0,0 +1,78 @@
+package session
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/veops/oneterm/pkg/config"
+	"github.com/veops/oneterm/pkg/logger"
+	"github.com/veops/oneterm/pkg/storage"
+)
+
+// ExportSpoolPath returns the path where an export is rendered before it is saved
+func ExportSpoolPath(exportID, ext string) (string, error) {
+	spoolDir := filepath.Join(config.Cfg.Session.ReplayDir, spoolDirName)
+	if err := os.MkdirAll(spoolDir, 0755); err != nil {
+		return "", err
+	}
+	return filepath.Join(spoolDir, exportID+ext), nil
+}
+
+// SaveExport saves a rendered export of a recording to storage,
+// it is moved to the date directory of the local replay dir if storage fails
+func SaveExport(sessionID, ext, path string, ts time.Time) error {
+	if storage.DefaultSessionReplayAdapter != nil {
+		err := uploadExport(sessionID, ext, path, ts)
+		if err == nil {
+			return os.Remove(path)
+		}
+		logger.L().Error("Failed to save replay export to storage",
+			zap.String("session_id", sessionID), zap.String("ext", ext), zap.Error(err))
+	}
+
+	dateDir := filepath.Join(config.Cfg.Session.ReplayDir, ts.Format("2006-01-02"))
+	if err := os.MkdirAll(dateDir, 0755); err != nil {
+		return err
+	}
+	return os.Rename(path, filepath.Join(dateDir, exportFilename(sessionID, ext)))
+}
+
+func uploadExport(sessionID, ext, path string, ts time.Time) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	return storage.DefaultSessionReplayAdapter.SaveExport(sessionID, ext, file, info.Size(), ts)
+}
+
+// GetExport gets a rendered export of a recording from storage or the local replay dir
+func GetExport(sessionID, ext string, ts time.Time) (io.ReadCloser, error) {
+	if storage.DefaultSessionReplayAdapter != nil {
+		reader, err := storage.DefaultSessionReplayAdapter.GetExport(sessionID, ext, ts)
+		if err == nil {
+			return reader, nil
+		}
+	}
+
+	path := filepath.Join(config.Cfg.Session.ReplayDir, ts.Format("2006-01-02"), exportFilename(sessionID, ext))
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("export %s not found for session %s", ext, sessionID)
+	}
+	return file, nil
+}
+
+func exportFilename(sessionID, ext string) string {
+	return sessionID + ".export" + ext
+}
@@ -0,0 +1,174 @@
+package session
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/veops/oneterm/internal/model"
+	"github.com/veops/oneterm/pkg/config"
+	dbpkg "github.com/veops/oneterm/pkg/db"
+	"github.com/veops/oneterm/pkg/logger"
+	"github.com/veops/oneterm/pkg/storage"
+)
+
+const (
+	// guacdSettleInterval is how often the size of a guacd recording is checked until guacd stops writing it
+	guacdSettleInterval = time.Second
+	// guacdSettleTimeout is the max time to wait for guacd to finish a recording
+	guacdSettleTimeout = time.Second * 30
+)
+
+// FinalizeGuacdReplay signs and compresses the recording guacd wrote to the replay dir and uploads it to storage.
+// The local recording is removed once the size of the uploaded object is checked,
+// otherwise it is moved to the date directory of the local replay dir to be kept by the retention cleaner.
+func FinalizeGuacdReplay(sessionID string, ts time.Time) error {
+	recordingPath := filepath.Join(config.Cfg.Session.ReplayDir, sessionID)
+	if err := waitGuacdRecording(recordingPath); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	signReplayFile(sessionID, recordingPath)
+
+	if storage.DefaultSessionReplayAdapter != nil {
+		err := uploadGuacdReplay(sessionID, recordingPath, ts)
+		if err == nil {
+			logger.L().Info("Guacd replay saved to storage", zap.String("session_id", sessionID))
+			return os.Remove(recordingPath)
+		}
+		logger.L().Error("Failed to save guacd replay to storage", zap.String("session_id", sessionID), zap.Error(err))
+	}
+
+	dateDir := filepath.Join(config.Cfg.Session.ReplayDir, ts.Format("2006-01-02"))
+	if err := os.MkdirAll(dateDir, 0755); err != nil {
+		return err
+	}
+	return os.Rename(recordingPath, filepath.Join(dateDir, sessionID))
+}
+
+// waitGuacdRecording waits until the size of the recording stops changing, guacd may still be flushing it
+func waitGuacdRecording(recordingPath string) error {
+	size := int64(-1)
+	for deadline := time.Now().Add(guacdSettleTimeout); time.Now().Before(deadline); time.Sleep(guacdSettleInterval) {
+		info, err := os.Stat(recordingPath)
+		if err != nil {
+			return err
+		}
+		if info.Size() == size {
+			return nil
+		}
+		size = info.Size()
+	}
+	return fmt.Errorf("recording %s is still being written", recordingPath)
+}
+
+// uploadGuacdReplay compresses the recording into the spool dir and uploads it
+func uploadGuacdReplay(sessionID, recordingPath string, ts time.Time) error {
+	spoolDir := filepath.Join(config.Cfg.Session.ReplayDir, spoolDirName)
+	if err := os.MkdirAll(spoolDir, 0755); err != nil {
+		return err
+	}
+	gzPath := filepath.Join(spoolDir, sessionID+storage.GuacdReplayExt)
+	defer os.Remove(gzPath)
+
+	size, err := compressFile(recordingPath, gzPath)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(gzPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return storage.DefaultSessionReplayAdapter.SaveGuacdReplay(sessionID, file, size, ts)
+}
+
+// compressFile gzips src into dst and returns the size of dst
+func compressFile(src, dst string) (int64, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return 0, err
+	}
+	defer out.Close()
+
+	gz := gzip.NewWriter(out)
+	if _, err = io.Copy(gz, in); err != nil {
+		return 0, err
+	}
+	if err = gz.Close(); err != nil {
+		return 0, err
+	}
+
+	info, err := out.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// GetGuacdReplay gets the recording of a guacd session from storage, or from the local replay dir if it is not uploaded
+func GetGuacdReplay(sessionID string, ts time.Time) (io.ReadCloser, error) {
+	if storage.DefaultSessionReplayAdapter != nil {
+		reader, err := storage.DefaultSessionReplayAdapter.GetGuacdReplay(sessionID, ts)
+		if err == nil {
+			return reader, nil
+		}
+
+		logger.L().Warn("Failed to get guacd replay from storage, trying local file",
+			zap.String("session_id", sessionID),
+			zap.Error(err))
+	}
+
+	return GetReplay(sessionID)
+}
+
+// RecoverGuacdReplays finalizes guacd recordings left in the replay dir, e.g. by a crash before they were uploaded
+func RecoverGuacdReplays() {
+	replayDir := config.Cfg.Session.ReplayDir
+	entries, err := os.ReadDir(replayDir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.L().Error("read replay directory failed", zap.String("dir", replayDir), zap.Error(err))
+		}
+		return
+	}
+
+	for _, entry := range entries {
+		// Guacd names recordings by the session id without extension
+		if !entry.Type().IsRegular() || filepath.Ext(entry.Name()) != "" {
+			continue
+		}
+		sessionID := entry.Name()
+		if GetOnlineSessionById(sessionID) != nil {
+			continue
+		}
+
+		// Replays are looked up under the date the session was created, which a recording crossing midnight is not modified at
+		session := &model.Session{}
+		if err = dbpkg.DB.Model(session).Select("created_at").Where("session_id = ?", sessionID).First(session).Error; err != nil {
+			logger.L().Error("get session of guacd replay failed", zap.String("session_id", sessionID), zap.Error(err))
+			continue
+		}
+		if err = FinalizeGuacdReplay(sessionID, session.CreatedAt); err != nil {
+			logger.L().Error("finalize guacd replay failed", zap.String("session_id", sessionID), zap.Error(err))
+			continue
+		}
+		logger.L().Info("Recovered guacd replay", zap.String("session_id", sessionID))
+	}
+}
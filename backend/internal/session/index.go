@@ -0,0 +1,108 @@
+package session
+
+import (
+	"io"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/samber/lo"
+
+	"github.com/veops/oneterm/internal/model"
+	"github.com/veops/oneterm/pkg/asciicast"
+	dbpkg "github.com/veops/oneterm/pkg/db"
+)
+
+const (
+	// outputLineLimit is the max length of an indexed output line
+	outputLineLimit = 1024
+	// outputLinesLimit is the max number of indexed output lines of a session
+	outputLinesLimit = 100000
+	// outputTermMinLen and outputTermMaxLen bound the length of indexed terms
+	outputTermMinLen = 2
+	outputTermMaxLen = 64
+	// outputBatchSize is how many rows are inserted at once
+	outputBatchSize = 200
+)
+
+// OutputTerms splits text into the lowercase terms of the output index, duplicates are removed
+func OutputTerms(s string) []string {
+	seen := map[string]struct{}{}
+	terms := make([]string, 0)
+	for _, t := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	}) {
+		if len(t) < outputTermMinLen || len(t) > outputTermMaxLen {
+			continue
+		}
+		if _, ok := seen[t]; ok {
+			continue
+		}
+		seen[t] = struct{}{}
+		terms = append(terms, t)
+	}
+	return terms
+}
+
+// indexSpool indexes the output of a spooled recording
+func indexSpool(sessionID, spoolPath string) error {
+	file, err := os.Open(spoolPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return IndexReplay(sessionID, file)
+}
+
+// IndexReplay replaces the indexed output lines of the session with the output of an asciicast recording
+func IndexReplay(sessionID string, r io.Reader) error {
+	lines := parseOutputLines(sessionID, r)
+
+	if err := dbpkg.DB.
+		Where("output_id IN (?)", dbpkg.DB.Model(model.DefaultSessionOutput).Select("id").Where("session_id = ?", sessionID)).
+		Delete(model.DefaultSessionOutputTerm).
+		Error; err != nil {
+		return err
+	}
+	if err := dbpkg.DB.Where("session_id = ?", sessionID).Delete(model.DefaultSessionOutput).Error; err != nil {
+		return err
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+
+	for _, batch := range lo.Chunk(lines, outputBatchSize) {
+		if err := dbpkg.DB.Create(&batch).Error; err != nil {
+			return err
+		}
+		terms := make([]*model.SessionOutputTerm, 0)
+		for _, line := range batch {
+			for _, t := range OutputTerms(line.Line) {
+				terms = append(terms, &model.SessionOutputTerm{Term: t, OutputId: line.Id})
+			}
+		}
+		if len(terms) == 0 {
+			continue
+		}
+		if err := dbpkg.DB.CreateInBatches(terms, outputBatchSize).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parseOutputLines renders the output events of an asciicast recording into lines
+func parseOutputLines(sessionID string, r io.Reader) []*model.SessionOutput {
+	lines := make([]*model.SessionOutput, 0)
+	asciicast.ReadLines(r, func(t float64, line string) bool {
+		if len(line) > outputLineLimit {
+			line = strings.ToValidUTF8(line[:outputLineLimit], "")
+		}
+		lines = append(lines, &model.SessionOutput{SessionId: sessionID, Offset: t, Line: line})
+		return len(lines) < outputLinesLimit
+	})
+
+	return lines
+}
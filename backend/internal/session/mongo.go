@@ -0,0 +1,23 @@
+package session
+
+import (
+	"strings"
+
+	"github.com/veops/oneterm/internal/model"
+)
+
+// MongoShellForm formats a command of a collection like a method of it in mongosh, e.g. db.users.drop
+func MongoShellForm(collection, name string) string {
+	if collection == "" {
+		return "db." + name
+	}
+	return "db." + collection + "." + name
+}
+
+// CheckMongo checks the name of a mongodb command against command policies.
+// The name matches a rule as written, in lower case, or like a method in mongosh, e.g. db.users.drop,
+// and stages of an aggregation, e.g. $out, match rules as well.
+func (p *Parser) CheckMongo(collection, name string, stages ...string) *model.CommandCheckResult {
+	form := MongoShellForm(collection, name)
+	return p.check(form, append([]string{name, strings.ToLower(name), form}, stages...))
+}
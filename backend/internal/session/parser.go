@@ -59,17 +59,24 @@ type Parser struct {
 	SessionId    string
 	Protocol     string
 	Cmds         []*model.Command
+	CmdAllowlist bool                              // Reject commands which are not explicitly allowed
+	Driver       func() (uid int, userName string) // Who types the input, commands are attributed to them
 	isPrompt     bool
 	prompt       string
 	isEdit       bool
 	curCmd       string
 	lastCmd      string
+	lastCheck    *model.CommandCheckResult
+	lastUid      int
+	lastUserName string
 	lastRes      string
 	curRes       string
 	mu           *sync.Mutex
 }
 
-func (p *Parser) AddInput(bs []byte) (cmd string, forbidden bool) {
+// AddInput feeds user input, once a command is entered it is checked against command policies
+// and res is returned, cmd is the filter which blocks it if not allowed
+func (p *Parser) AddInput(bs []byte) (cmd string, res *model.CommandCheckResult) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
@@ -82,6 +89,8 @@ func (p *Parser) AddInput(bs []byte) (cmd string, forbidden bool) {
 		p.WriteDb()
 		p.lastCmd = ""
 		p.lastRes = ""
+		p.lastCheck = nil
+		p.lastUid, p.lastUserName = 0, ""
 	}
 
 	p.Input = append(p.Input, bs...)
@@ -100,41 +109,187 @@ func (p *Parser) AddInput(bs []byte) (cmd string, forbidden bool) {
 	p.curCmd = ""
 	p.resetLocked()
 
-	filter := ""
-	if filter, forbidden = p.IsForbidden(cmdFromOutput); forbidden {
-		cmd = filter
+	if res = p.Check(cmdFromOutput); !res.Allowed {
+		cmd = res.Reason
 		return
 	}
 	p.lastCmd = cmdFromOutput
+	p.lastCheck = res
+	if p.Driver != nil {
+		p.lastUid, p.lastUserName = p.Driver()
+	}
 	return
 }
 
 func (p *Parser) IsForbidden(cmd string) (string, bool) {
+	res := p.Check(cmd)
+	return res.Reason, !res.Allowed
+}
+
+// Check checks cmd against command policies, deny takes precedence over audit and audit over allow.
+// In allowlist mode commands which match neither allow nor audit are denied, which applies to each command
+// of a compound one like ls; rm -rf /.
+func (p *Parser) Check(cmd string) *model.CommandCheckResult {
 	if p.isEdit || cmd == "" {
-		return "", false
+		return &model.CommandCheckResult{Allowed: true, Action: model.CommandActionAllow}
 	}
-	for _, c := range p.Cmds {
-		if c.IsRe {
-			if c.Re.MatchString(cmd) {
-				return fmt.Sprintf("Regex: %s", c.Cmd), true
+	segments := lo.Map(splitCommand(cmd), func(s string, _ int) []string { return []string{s} })
+	if len(segments) == 0 {
+		segments = [][]string{{cmd}}
+	}
+	return p.check(cmd, segments...)
+}
+
+// check checks cmd against command policies. cmd consists of segments which run on their own, e.g. the commands
+// of a shell pipeline, and a policy applies to a segment if it matches any of its forms.
+// Deny and audit policies match anywhere in a form, while allow policies match its command word, so that every
+// segment has to be permitted in allowlist mode.
+func (p *Parser) check(cmd string, segments ...[]string) *model.CommandCheckResult {
+	res := &model.CommandCheckResult{Allowed: true, Action: model.CommandActionAllow}
+	for _, forms := range segments {
+		permitted := false
+		for _, c := range p.Cmds {
+			action := c.GetAction()
+			if action == model.CommandActionAllow || action == model.CommandActionAudit {
+				permitted = permitted || lo.SomeBy(forms, func(form string) bool { return matchCmdWord(c, form) })
 			}
-		} else {
-			if strings.Contains(cmd, c.Cmd) {
-				return c.Cmd, true
+			if action == model.CommandActionAllow {
+				continue
+			}
+			var (
+				filter string
+				ok     bool
+			)
+			for _, form := range forms {
+				if filter, ok = matchCmd(c, form); ok {
+					break
+				}
+			}
+			if !ok {
+				continue
+			}
+			switch action {
+			case model.CommandActionDeny:
+				return &model.CommandCheckResult{Allowed: false, Action: model.CommandActionDeny, Reason: filter, RiskLevel: c.RiskLevel}
+			case model.CommandActionAudit:
+				if res.Action != model.CommandActionAudit || c.RiskLevel > res.RiskLevel {
+					res = &model.CommandCheckResult{Allowed: true, Action: model.CommandActionAudit, Reason: filter, RiskLevel: c.RiskLevel}
+				}
 			}
 		}
+		if p.CmdAllowlist && !permitted {
+			return &model.CommandCheckResult{Allowed: false, Action: model.CommandActionDeny, Reason: lo.Ternary(len(segments) > 1, forms[0], cmd)}
+		}
+	}
+	return res
+}
+
+func matchCmd(c *model.Command, cmd string) (string, bool) {
+	if c.IsRe {
+		if c.Re != nil && c.Re.MatchString(cmd) {
+			return fmt.Sprintf("Regex: %s", c.Cmd), true
+		}
+	} else if strings.Contains(cmd, c.Cmd) {
+		return c.Cmd, true
 	}
 	return "", false
 }
 
+// matchCmdWord tells whether cmd starts with the command of c as whole words, e.g. git status matches git
+func matchCmdWord(c *model.Command, cmd string) bool {
+	if c.IsRe {
+		return c.Re != nil && c.Re.MatchString(cmd)
+	}
+	word := strings.TrimSpace(c.Cmd)
+	cmd = strings.TrimSpace(cmd)
+	return word != "" && (cmd == word || strings.HasPrefix(cmd, word+" ") || strings.HasPrefix(cmd, word+"\t"))
+}
+
+// splitCommand splits a shell command into the commands which run on their own, at ;, &&, ||, |, &, newlines,
+// subshells and command substitutions. Nothing is split in single quotes, and in double quotes only substitutions are.
+func splitCommand(cmd string) (segments []string) {
+	type substitution struct {
+		double bool // Whether it is in double quotes, its own quoting starts over
+		closer byte
+	}
+	var (
+		sb     strings.Builder
+		single bool
+		double bool
+		subs   []substitution
+	)
+	cut := func() {
+		if s := strings.TrimSpace(sb.String()); s != "" {
+			segments = append(segments, s)
+		}
+		sb.Reset()
+	}
+	closes := func(ch byte) bool {
+		if len(subs) == 0 || subs[len(subs)-1].closer != ch {
+			return false
+		}
+		double, subs = subs[len(subs)-1].double, subs[:len(subs)-1]
+		return true
+	}
+	for i := 0; i < len(cmd); i++ {
+		ch := cmd[i]
+		switch {
+		case single:
+			single = ch != '\''
+		case ch == '\\' && i+1 < len(cmd):
+			sb.WriteByte(ch)
+			i++
+			ch = cmd[i]
+		case ch == '\'' && !double:
+			single = true
+		case ch == '"':
+			double = !double
+		case ch == '`':
+			if !closes(ch) {
+				subs, double = append(subs, substitution{double: double, closer: ch}), false
+			}
+			cut()
+			continue
+		case ch == '$' && i+1 < len(cmd) && cmd[i+1] == '(':
+			subs, double = append(subs, substitution{double: double, closer: ')'}), false
+			i++
+			cut()
+			continue
+		case ch == ')' && !double:
+			closes(ch)
+			cut()
+			continue
+		case !double && strings.IndexByte(";&|(\n", ch) >= 0:
+			cut()
+			continue
+		}
+		sb.WriteByte(ch)
+	}
+	cut()
+	return
+}
+
 func (p *Parser) WriteDb() {
 	if p.lastCmd == "" || strings.TrimSpace(p.lastCmd) == "" {
 		return
 	}
-	m := &model.SessionCmd{
-		SessionId: p.SessionId,
-		Cmd:       p.lastCmd,
-		Result:    p.lastRes,
+	p.RecordCmd(p.lastCmd, p.lastRes, p.lastCheck)
+}
+
+// RecordCmd stores a command of the session with its result and the policy decision
+func (p *Parser) RecordCmd(cmd, result string, res *model.CommandCheckResult) {
+	p.Record(&model.SessionCmd{Cmd: cmd, Result: result}, res)
+}
+
+// Record stores m as a command of the session with the policy decision, e.g. a statement of a database proxy with its row count
+func (p *Parser) Record(m *model.SessionCmd, res *model.CommandCheckResult) {
+	m.SessionId, m.Uid, m.UserName = p.SessionId, p.lastUid, p.lastUserName
+	if m.Uid == 0 && p.Driver != nil {
+		m.Uid, m.UserName = p.Driver()
+	}
+	if res != nil {
+		m.Level = int(res.RiskLevel)
+		m.Action = string(res.Action)
 	}
 	err := dbpkg.DB.Model(m).Create(m).Error
 	if err != nil {
@@ -0,0 +1,75 @@
+package session
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/veops/oneterm/internal/model"
+)
+
+func TestSplitCommand(t *testing.T) {
+	tests := []struct {
+		name string
+		cmd  string
+		want []string
+	}{
+		{name: "single", cmd: "ls -l", want: []string{"ls -l"}},
+		{name: "semicolon", cmd: "ls; rm -rf /", want: []string{"ls", "rm -rf /"}},
+		{name: "and or", cmd: "echo ls && reboot || halt", want: []string{"echo ls", "reboot", "halt"}},
+		{name: "pipe and background", cmd: "cat a | sh & id", want: []string{"cat a", "sh", "id"}},
+		{name: "newline", cmd: "ls\nreboot", want: []string{"ls", "reboot"}},
+		{name: "subshell", cmd: "(reboot)", want: []string{"reboot"}},
+		{name: "backticks", cmd: "echo `reboot`", want: []string{"echo", "reboot"}},
+		{name: "substitution", cmd: "echo $(reboot) x", want: []string{"echo", "reboot", "x"}},
+		{name: "substitution in double quotes", cmd: `echo "$(ls; reboot)"`, want: []string{`echo "`, "ls", "reboot", `"`}},
+		{name: "backticks in double quotes", cmd: "echo \"`ls; reboot`\"", want: []string{`echo "`, "ls", "reboot", `"`}},
+		{name: "single quotes", cmd: `echo 'a; $(b) | c'`, want: []string{`echo 'a; $(b) | c'`}},
+		{name: "double quotes", cmd: `echo "a; b | c"`, want: []string{`echo "a; b | c"`}},
+		{name: "escaped", cmd: `echo a\; b`, want: []string{`echo a\; b`}},
+		{name: "empty", cmd: " ; ", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitCommand(tt.cmd); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitCommand(%q) = %q, want %q", tt.cmd, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParserCheck(t *testing.T) {
+	cmds := []*model.Command{
+		{Cmd: "ls", Action: model.CommandActionAllow},
+		{Cmd: "git status", Action: model.CommandActionAllow},
+		{Cmd: "echo", Action: model.CommandActionAllow},
+		{Cmd: "^cat ", IsRe: true, Re: regexp.MustCompile("^cat "), Action: model.CommandActionAudit},
+		{Cmd: "shutdown", Action: model.CommandActionDeny},
+	}
+	tests := []struct {
+		name      string
+		allowlist bool
+		cmd       string
+		allowed   bool
+		action    model.CommandAction
+	}{
+		{name: "allowed word", allowlist: true, cmd: "ls -l", allowed: true, action: model.CommandActionAllow},
+		{name: "allowed words", allowlist: true, cmd: "git status -s", allowed: true, action: model.CommandActionAllow},
+		{name: "other subcommand", allowlist: true, cmd: "git push", allowed: false, action: model.CommandActionDeny},
+		{name: "prefix of a word", allowlist: true, cmd: "lsblk", allowed: false, action: model.CommandActionDeny},
+		{name: "chained", allowlist: true, cmd: "ls; rm -rf /", allowed: false, action: model.CommandActionDeny},
+		{name: "argument", allowlist: true, cmd: "echo ls && reboot", allowed: false, action: model.CommandActionDeny},
+		{name: "substitution", allowlist: true, cmd: "echo $(reboot)", allowed: false, action: model.CommandActionDeny},
+		{name: "all permitted", allowlist: true, cmd: "ls | cat -n", allowed: true, action: model.CommandActionAudit},
+		{name: "denied anywhere", allowlist: false, cmd: "echo a; sudo shutdown now", allowed: false, action: model.CommandActionDeny},
+		{name: "not listed", allowlist: false, cmd: "reboot", allowed: true, action: model.CommandActionAllow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Parser{Cmds: cmds, CmdAllowlist: tt.allowlist}
+			if got := p.Check(tt.cmd); got.Allowed != tt.allowed || got.Action != tt.action {
+				t.Errorf("Check(%q) = %+v, want allowed %v and action %s", tt.cmd, got, tt.allowed, tt.action)
+			}
+		})
+	}
+}
@@ -1,35 +1,74 @@
 package session
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"go.uber.org/zap"
 
+	"github.com/veops/oneterm/internal/audit"
+	"github.com/veops/oneterm/internal/model"
+	"github.com/veops/oneterm/pkg/asciicast"
 	"github.com/veops/oneterm/pkg/config"
 	"github.com/veops/oneterm/pkg/logger"
 	"github.com/veops/oneterm/pkg/storage"
 )
 
+const (
+	// spoolDirName is the directory under the replay dir where recordings are written while sessions run
+	spoolDirName = ".spool"
+	// spoolFlushInterval is how long output may stay in memory before it is flushed to the spool
+	spoolFlushInterval = time.Second
+	// outputTailSize is how much of the latest output is kept to detect password prompts
+	outputTailSize = 256
+)
+
+var (
+	maskPrompts = struct {
+		sync.Mutex
+		key      string
+		patterns []*regexp.Regexp
+	}{}
+)
+
+// Asciinema records a terminal session in asciicast v2 format.
+// Frames are appended to a spool file as the session runs, and the file is uploaded once the session is closed.
 type Asciinema struct {
-	sessionID  string
-	buffer     *bytes.Buffer
-	ts         time.Time
-	useStorage bool
+	sessionID string
+	ts        time.Time
+	file      *os.File
+	writer    *bufio.Writer
+	flushed   time.Time
+	tail      []byte
+	mu        sync.Mutex
 }
 
 func NewAsciinema(id string, w, h int) (ret *Asciinema, err error) {
+	spoolDir := filepath.Join(config.Cfg.Session.ReplayDir, spoolDirName)
+	if err = os.MkdirAll(spoolDir, 0755); err != nil {
+		logger.L().Error("create replay spool directory failed", zap.String("dir", spoolDir), zap.Error(err))
+		return nil, err
+	}
+	file, err := os.OpenFile(filepath.Join(spoolDir, fmt.Sprintf("%s.cast", id)), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		logger.L().Error("create replay spool file failed", zap.String("id", id), zap.Error(err))
+		return nil, err
+	}
+
 	ret = &Asciinema{
-		sessionID:  id,
-		buffer:     bytes.NewBuffer(nil),
-		ts:         time.Now(),
-		useStorage: storage.DefaultSessionReplayAdapter != nil,
+		sessionID: id,
+		ts:        time.Now(),
+		file:      file,
+		writer:    bufio.NewWriter(file),
 	}
 
 	// Write Asciinema header information
@@ -48,10 +87,11 @@ func NewAsciinema(id string, w, h int) (ret *Asciinema, err error) {
 	bs, err := json.Marshal(header)
 	if err != nil {
 		logger.L().Error("failed to marshal asciinema header", zap.String("id", id), zap.Error(err))
+		file.Close()
 		return nil, err
 	}
 
-	ret.buffer.Write(append(bs, '\r', '\n'))
+	ret.append(bs)
 
 	return ret, nil
 }
@@ -62,7 +102,90 @@ func (a *Asciinema) Write(p []byte) {
 	o[1] = "o"
 	o[2] = string(p)
 	bs, _ := json.Marshal(o)
-	a.buffer.Write(append(bs, '\r', '\n'))
+
+	a.mu.Lock()
+	a.tail = append(a.tail, p...)
+	if len(a.tail) > outputTailSize {
+		a.tail = a.tail[len(a.tail)-outputTailSize:]
+	}
+	a.mu.Unlock()
+
+	a.append(bs)
+}
+
+// Input records keystrokes as an input event, they are masked while the terminal shows a password prompt
+func (a *Asciinema) Input(p []byte) {
+	a.mu.Lock()
+	masked := isPasswordPrompt(a.tail)
+	a.mu.Unlock()
+
+	in := string(p)
+	if masked {
+		in = maskInput(in)
+	}
+	i := [3]any{}
+	i[0] = float64(time.Now().UnixMicro()-a.ts.UnixMicro()) / 1_000_000
+	i[1] = "i"
+	i[2] = in
+	bs, _ := json.Marshal(i)
+	a.append(bs)
+}
+
+// Marker records a marker event, e.g. who holds control of a shared session
+func (a *Asciinema) Marker(label string) {
+	m := [3]any{}
+	m[0] = float64(time.Now().UnixMicro()-a.ts.UnixMicro()) / 1_000_000
+	m[1] = "m"
+	m[2] = label
+	bs, _ := json.Marshal(m)
+	a.append(bs)
+}
+
+// isPasswordPrompt checks the last line of the output against the password prompts of the config
+func isPasswordPrompt(tail []byte) bool {
+	line := asciicast.StripEscapes(string(tail))
+	if i := strings.LastIndexAny(line, "\r\n"); i >= 0 {
+		line = line[i+1:]
+	}
+	for _, re := range inputMaskPatterns() {
+		if re.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// inputMaskPatterns compiles the password prompts of the config, invalid ones are ignored
+func inputMaskPatterns() []*regexp.Regexp {
+	prompts := model.GlobalConfig.Load().GetInputMaskPrompts()
+	key := strings.Join(prompts, "\n")
+
+	maskPrompts.Lock()
+	defer maskPrompts.Unlock()
+
+	if maskPrompts.patterns == nil || maskPrompts.key != key {
+		maskPrompts.key, maskPrompts.patterns = key, nil
+		for _, p := range prompts {
+			re, err := regexp.Compile(p)
+			if err != nil {
+				logger.L().Warn("invalid input mask prompt", zap.String("prompt", p), zap.Error(err))
+				continue
+			}
+			maskPrompts.patterns = append(maskPrompts.patterns, re)
+		}
+	}
+
+	return maskPrompts.patterns
+}
+
+// maskInput replaces printable keystrokes with *, control keys like enter are kept
+func maskInput(in string) string {
+	return strings.Map(func(r rune) rune {
+		if r < ' ' || r == 0x7f {
+			return r
+		}
+		return '*'
+	}, in)
 }
 
 func (a *Asciinema) Resize(w, h int) {
@@ -71,58 +194,203 @@ func (a *Asciinema) Resize(w, h int) {
 	r[1] = "r"
 	r[2] = fmt.Sprintf("%dx%d", w, h)
 	bs, _ := json.Marshal(r)
-	a.buffer.Write(append(bs, '\r', '\n'))
+	a.append(bs)
 }
 
-// Close closes the recording and saves to storage
+// append writes a line to the spool. The buffer is flushed by the first append after spoolFlushInterval,
+// so output of a session which went quiet stays in memory until the next line or Close.
+func (a *Asciinema) append(bs []byte) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.writer == nil {
+		return
+	}
+	if _, err := a.writer.Write(append(bs, '\r', '\n')); err != nil {
+		logger.L().Error("write replay spool failed", zap.String("session_id", a.sessionID), zap.Error(err))
+		return
+	}
+	if time.Since(a.flushed) >= spoolFlushInterval {
+		a.writer.Flush()
+		a.flushed = time.Now()
+	}
+}
+
+// Close closes the recording, which is indexed and saved to storage in the background.
+// So the session is closed without waiting for it, a spool left by a stop meanwhile is recovered at the next start.
 func (a *Asciinema) Close() error {
-	if a.useStorage && storage.DefaultSessionReplayAdapter != nil {
-		reader := bytes.NewReader(a.buffer.Bytes())
-		size := int64(a.buffer.Len())
-		err := storage.DefaultSessionReplayAdapter.SaveReplay(a.sessionID, reader, size)
-		if err != nil {
-			logger.L().Error("Failed to save replay to storage", zap.String("session_id", a.sessionID), zap.Error(err))
-			return a.saveToLocalFile()
-		}
+	a.mu.Lock()
+	if a.writer == nil {
+		a.mu.Unlock()
 		return nil
 	}
-	return a.saveToLocalFile()
+	err := a.writer.Flush()
+	if closeErr := a.file.Close(); err == nil {
+		err = closeErr
+	}
+	a.writer = nil
+	a.mu.Unlock()
+	if err != nil {
+		logger.L().Error("close replay spool failed", zap.String("session_id", a.sessionID), zap.Error(err))
+		return err
+	}
+
+	go func() {
+		if err := finalizeSpool(a.sessionID, a.file.Name(), a.ts); err != nil {
+			logger.L().Error("finalize replay failed", zap.String("session_id", a.sessionID), zap.Error(err))
+		}
+	}()
+	return nil
 }
 
-// saveToLocalFile saves to local filesystem (fallback solution)
-func (a *Asciinema) saveToLocalFile() error {
-	logger.L().Info("saveToLocalFile called", zap.String("session_id", a.sessionID))
+// Discard closes the recording and removes its spool without saving it, for a session which never started
+func (a *Asciinema) Discard() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
 
-	// Use date hierarchy strategy for local files - directly under base_path
-	dateDir := a.ts.Format("2006-01-02")
-	replayDir := filepath.Join(config.Cfg.Session.ReplayDir, dateDir)
+	if a.writer == nil {
+		return
+	}
+	a.writer = nil
+	a.file.Close()
+	if err := os.Remove(a.file.Name()); err != nil {
+		logger.L().Error("remove replay spool failed", zap.String("session_id", a.sessionID), zap.Error(err))
+	}
+}
 
-	if err := os.MkdirAll(replayDir, 0755); err != nil {
-		logger.L().Error("create replay directory failed", zap.String("dir", replayDir), zap.Error(err))
-		return err
+// finalizeSpool indexes and signs a spooled recording and uploads it to storage.
+// The spool is removed after upload, it is kept in the local replay dir if upload fails.
+func finalizeSpool(sessionID, spoolPath string, ts time.Time) error {
+	if err := indexSpool(sessionID, spoolPath); err != nil {
+		logger.L().Error("index replay output failed", zap.String("session_id", sessionID), zap.Error(err))
+	}
+	signReplayFile(sessionID, spoolPath)
+
+	if storage.DefaultSessionReplayAdapter != nil {
+		err := uploadSpool(sessionID, spoolPath, ts)
+		if err == nil {
+			return os.Remove(spoolPath)
+		}
+		logger.L().Error("Failed to save replay to storage", zap.String("session_id", sessionID), zap.Error(err))
+	}
+	return saveToLocalFile(sessionID, spoolPath, ts)
+}
+
+// signReplayFile saves the signed digest of a finalized recording, the recording is kept if signing fails
+func signReplayFile(sessionID, path string) {
+	file, err := os.Open(path)
+	if err == nil {
+		defer file.Close()
+		err = audit.SignReplay(sessionID, file)
 	}
+	if err != nil {
+		logger.L().Error("sign replay failed", zap.String("session_id", sessionID), zap.Error(err))
+	}
+}
 
-	filePath := filepath.Join(replayDir, fmt.Sprintf("%s.cast", a.sessionID))
-	file, err := os.Create(filePath)
+// uploadSpool streams the spool file to storage, providers upload large files in multiple parts
+func uploadSpool(sessionID, spoolPath string, ts time.Time) error {
+	file, err := os.Open(spoolPath)
 	if err != nil {
-		logger.L().Error("create replay file failed", zap.String("path", filePath), zap.Error(err))
 		return err
 	}
 	defer file.Close()
 
-	_, err = io.Copy(file, bytes.NewReader(a.buffer.Bytes()))
+	info, err := file.Stat()
 	if err != nil {
+		return err
+	}
+
+	return storage.DefaultSessionReplayAdapter.SaveReplayWithTimestamp(sessionID, file, info.Size(), ts)
+}
+
+// saveToLocalFile moves the spool file to local filesystem (fallback solution)
+func saveToLocalFile(sessionID, spoolPath string, ts time.Time) error {
+	logger.L().Info("saveToLocalFile called", zap.String("session_id", sessionID))
+
+	// Use date hierarchy strategy for local files - directly under base_path
+	dateDir := ts.Format("2006-01-02")
+	replayDir := filepath.Join(config.Cfg.Session.ReplayDir, dateDir)
+
+	if err := os.MkdirAll(replayDir, 0755); err != nil {
+		logger.L().Error("create replay directory failed", zap.String("dir", replayDir), zap.Error(err))
+		return err
+	}
+
+	filePath := filepath.Join(replayDir, fmt.Sprintf("%s.cast", sessionID))
+	if err := os.Rename(spoolPath, filePath); err != nil {
 		logger.L().Error("write replay file failed", zap.String("path", filePath), zap.Error(err))
 		return err
 	}
 
 	logger.L().Info("Replay saved to local file",
-		zap.String("session_id", a.sessionID),
+		zap.String("session_id", sessionID),
 		zap.String("path", filePath))
 
 	return nil
 }
 
+// RecoverSpooledReplays finalizes recordings left in the spool by sessions which never closed, e.g. after a crash.
+// A partially written last frame is dropped so the recording stays playable.
+func RecoverSpooledReplays() {
+	spoolDir := filepath.Join(config.Cfg.Session.ReplayDir, spoolDirName)
+	entries, err := os.ReadDir(spoolDir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.L().Error("read replay spool directory failed", zap.String("dir", spoolDir), zap.Error(err))
+		}
+		return
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".cast") {
+			continue
+		}
+		// Sessions of this process may be recording already
+		sessionID := strings.TrimSuffix(entry.Name(), ".cast")
+		if GetOnlineSessionById(sessionID) != nil {
+			continue
+		}
+
+		spoolPath := filepath.Join(spoolDir, entry.Name())
+		ts, err := repairSpool(spoolPath)
+		if err != nil {
+			logger.L().Error("repair spooled replay failed", zap.String("session_id", sessionID), zap.Error(err))
+			os.Remove(spoolPath)
+			continue
+		}
+		if err = finalizeSpool(sessionID, spoolPath, ts); err != nil {
+			logger.L().Error("finalize spooled replay failed", zap.String("session_id", sessionID), zap.Error(err))
+			continue
+		}
+		logger.L().Info("Recovered spooled replay", zap.String("session_id", sessionID))
+	}
+}
+
+// repairSpool truncates the spool file after its last complete line and returns the start time in its header
+func repairSpool(spoolPath string) (ts time.Time, err error) {
+	bs, err := os.ReadFile(spoolPath)
+	if err != nil {
+		return
+	}
+	i := bytes.IndexByte(bs, '\n')
+	if i < 0 {
+		err = fmt.Errorf("replay %s has no complete header", spoolPath)
+		return
+	}
+	header := struct {
+		Timestamp int64 `json:"timestamp"`
+	}{}
+	ts = time.Now()
+	if json.Unmarshal(bs[:i], &header) == nil && header.Timestamp > 0 {
+		ts = time.Unix(header.Timestamp, 0)
+	}
+	if i = bytes.LastIndexByte(bs, '\n'); i+1 < len(bs) {
+		err = os.Truncate(spoolPath, int64(i+1))
+	}
+	return
+}
+
 // GetReplay gets replay file
 func GetReplay(sessionID string) (io.ReadCloser, error) {
 	// Try to get from storage first
@@ -0,0 +1,80 @@
+package session
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/samber/lo"
+
+	"github.com/veops/oneterm/internal/model"
+)
+
+var (
+	// redisContainers are commands whose first argument is a subcommand, e.g. CONFIG SET
+	redisContainers = []string{"ACL", "CLIENT", "CLUSTER", "COMMAND", "CONFIG", "DEBUG", "FUNCTION", "LATENCY", "MEMORY",
+		"MODULE", "OBJECT", "PUBSUB", "SCRIPT", "SLOWLOG", "XGROUP", "XINFO"}
+	// redisScripts are commands which run scripts, whose commands are not checked
+	redisScripts = []string{"EVAL", "EVAL_RO", "EVALSHA", "EVALSHA_RO", "FCALL", "FCALL_RO", "FUNCTION LOAD", "FUNCTION RESTORE"}
+)
+
+// RedisCommandLine formats a redis command like typed to redis-cli, passwords of it are masked
+func RedisCommandLine(args []string) string {
+	name := ""
+	if len(args) > 0 {
+		name = strings.ToUpper(args[0])
+	}
+	masked := 0
+	parts := make([]string, len(args))
+	for i, arg := range args {
+		if masked > 0 {
+			parts[i], masked = "******", masked-1
+			continue
+		}
+		switch strings.ToUpper(arg) {
+		case "AUTH":
+			masked = lo.Ternary(name == "HELLO", 2, lo.Ternary(i == 0, len(args)-1, 1))
+		case "AUTH2":
+			masked = 2
+		}
+		if arg == "" || strings.ContainsAny(arg, " \t\r\n\"'\\") || !strconv.CanBackquote(arg) {
+			arg = strconv.Quote(arg)
+		}
+		parts[i] = arg
+	}
+	return strings.Join(parts, " ")
+}
+
+// CheckRedis checks the name of a redis command against command policies.
+// The name matches a rule as written in upper or lower case, with the subcommand for commands like CONFIG,
+// or prefixed with the client, e.g. redis-cli config set.
+// Scripts could run denied commands, so commands like EVAL are denied if there are deny rules, unless allowed explicitly.
+func (p *Parser) CheckRedis(args []string) *model.CommandCheckResult {
+	if len(args) == 0 {
+		return &model.CommandCheckResult{Allowed: true, Action: model.CommandActionAllow}
+	}
+	name := strings.ToUpper(args[0])
+	if len(args) > 1 && lo.Contains(redisContainers, name) {
+		name += " " + strings.ToUpper(args[1])
+	}
+	lower := strings.ToLower(name)
+	forms := []string{name, lower, "redis-cli " + lower}
+	res := p.check(RedisCommandLine(args), forms)
+	if !res.Allowed || !lo.Contains(redisScripts, name) {
+		return res
+	}
+
+	denies, allowed := false, false
+	for _, c := range p.Cmds {
+		switch c.GetAction() {
+		case model.CommandActionDeny:
+			denies = true
+		case model.CommandActionAllow:
+			allowed = allowed || lo.SomeBy(forms, func(form string) bool { return matchCmdWord(c, form) })
+		}
+	}
+	if denies && !allowed {
+		return &model.CommandCheckResult{Allowed: false, Action: model.CommandActionDeny, Reason: fmt.Sprintf("%s runs commands unchecked by deny rules, allow it explicitly", name)}
+	}
+	return res
+}
@@ -0,0 +1,64 @@
+package session
+
+import (
+	"testing"
+
+	"github.com/veops/oneterm/internal/model"
+)
+
+func TestRedisCommandLine(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{name: "plain", args: []string{"GET", "k"}, want: "GET k"},
+		{name: "quoted", args: []string{"SET", "k", "a b", ""}, want: `SET k "a b" ""`},
+		{name: "auth", args: []string{"AUTH", "alice", "secret"}, want: "AUTH ****** ******"},
+		{name: "hello", args: []string{"HELLO", "3", "AUTH", "alice", "secret", "SETNAME", "c"}, want: "HELLO 3 AUTH ****** ****** SETNAME c"},
+		{name: "migrate", args: []string{"MIGRATE", "h", "6379", "k", "0", "5000", "AUTH2", "alice", "secret"}, want: "MIGRATE h 6379 k 0 5000 AUTH2 ****** ******"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RedisCommandLine(tt.args); got != tt.want {
+				t.Errorf("RedisCommandLine(%q) = %q, want %q", tt.args, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckRedis(t *testing.T) {
+	deny := []*model.Command{
+		{Cmd: "FLUSHALL", Action: model.CommandActionDeny},
+		{Cmd: "config set", Action: model.CommandActionDeny},
+	}
+	tests := []struct {
+		name      string
+		cmds      []*model.Command
+		allowlist bool
+		args      []string
+		allowed   bool
+	}{
+		{name: "not listed", cmds: deny, args: []string{"get", "k"}, allowed: true},
+		{name: "denied", cmds: deny, args: []string{"flushall"}, allowed: false},
+		{name: "denied subcommand", cmds: deny, args: []string{"CONFIG", "SET", "dir", "/tmp"}, allowed: false},
+		{name: "other subcommand", cmds: deny, args: []string{"config", "get", "dir"}, allowed: true},
+		{name: "eval with deny rules", cmds: deny, args: []string{"EVAL", "return redis.call('FLUSHALL')", "0"}, allowed: false},
+		{name: "fcall with deny rules", cmds: deny, args: []string{"fcall_ro", "f", "0"}, allowed: false},
+		{name: "function load with deny rules", cmds: deny, args: []string{"FUNCTION", "LOAD", "#!lua name=l"}, allowed: false},
+		{name: "function list", cmds: deny, args: []string{"FUNCTION", "LIST"}, allowed: true},
+		{name: "eval allowed explicitly", cmds: append([]*model.Command{{Cmd: "EVAL", Action: model.CommandActionAllow}}, deny...), args: []string{"eval", "return 1", "0"}, allowed: true},
+		{name: "eval without deny rules", args: []string{"EVAL", "return 1", "0"}, allowed: true},
+		{name: "allowlist", cmds: []*model.Command{{Cmd: "GET", Action: model.CommandActionAllow}}, allowlist: true, args: []string{"get", "k"}, allowed: true},
+		{name: "not in allowlist", cmds: []*model.Command{{Cmd: "GET", Action: model.CommandActionAllow}}, allowlist: true, args: []string{"GETDEL", "k"}, allowed: false},
+		{name: "empty", cmds: deny, allowed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Parser{Cmds: tt.cmds, CmdAllowlist: tt.allowlist}
+			if got := p.CheckRedis(tt.args); got.Allowed != tt.allowed {
+				t.Errorf("CheckRedis(%q) = %+v, want allowed %v", tt.args, got, tt.allowed)
+			}
+		})
+	}
+}
@@ -0,0 +1,343 @@
+package session
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/veops/oneterm/internal/model"
+	"github.com/veops/oneterm/pkg/asciicast"
+)
+
+const (
+	// replayIndexInterval is the initial seconds between seek points
+	replayIndexInterval = 10.0
+	// replayIndexMaxPoints bounds the points of an index, the interval is doubled when it is exceeded
+	replayIndexMaxPoints = 1000
+	// replayCheckpointInterval is the initial seconds between checkpoints of a terminal recording
+	replayCheckpointInterval = 60.0
+	// replayMaxCheckpoints and replayMaxCheckpointBytes bound the checkpoints of an index,
+	// every other one is dropped and the interval is doubled when either is exceeded
+	replayMaxCheckpoints     = 200
+	replayMaxCheckpointBytes = 16 << 20
+)
+
+// replayIndexBuilder adds seek points at least interval seconds apart, and checkpoints at least checkpointInterval seconds apart
+type replayIndexBuilder struct {
+	index    *model.ReplayIndex
+	interval float64
+	last     float64
+
+	checkpointInterval float64
+	lastCheckpoint     float64
+	checkpointBytes    int
+}
+
+func newReplayIndexBuilder() *replayIndexBuilder {
+	return &replayIndexBuilder{
+		index:              &model.ReplayIndex{Points: model.Slice[model.ReplayPoint]{}},
+		interval:           replayIndexInterval,
+		last:               -replayIndexInterval,
+		checkpointInterval: replayCheckpointInterval,
+	}
+}
+
+func (b *replayIndexBuilder) add(t float64, offset int64) {
+	b.index.Duration = max(b.index.Duration, t)
+	if t-b.last < b.interval {
+		return
+	}
+	b.index.Points = append(b.index.Points, model.ReplayPoint{Time: t, Offset: offset})
+	b.last = t
+
+	if len(b.index.Points) > replayIndexMaxPoints {
+		points := b.index.Points[:0]
+		for i, p := range b.index.Points {
+			if i%2 == 0 {
+				points = append(points, p)
+			}
+		}
+		b.index.Points = points
+		b.interval *= 2
+	}
+}
+
+// checkpoint keeps the screen before the event at offset, which is at t
+func (b *replayIndexBuilder) checkpoint(t float64, offset int64, screen *asciicast.Screen) {
+	if t-b.lastCheckpoint < b.checkpointInterval || !screen.Settled() {
+		return
+	}
+	cols, rows := screen.Size()
+	cp := model.ReplayCheckpoint{Time: t, Offset: offset, Cols: cols, Rows: rows, Screen: screen.Snapshot()}
+	b.index.Checkpoints = append(b.index.Checkpoints, cp)
+	b.checkpointBytes += len(cp.Screen)
+	b.lastCheckpoint = t
+
+	for len(b.index.Checkpoints) > replayMaxCheckpoints || b.checkpointBytes > replayMaxCheckpointBytes {
+		checkpoints := b.index.Checkpoints[:0]
+		b.checkpointBytes = 0
+		for i, cp := range b.index.Checkpoints {
+			if i%2 == 0 {
+				checkpoints = append(checkpoints, cp)
+				b.checkpointBytes += len(cp.Screen)
+			}
+		}
+		b.index.Checkpoints = checkpoints
+		b.checkpointInterval *= 2
+	}
+}
+
+// BuildReplayIndex scans a recording, asciicast or guacd, and returns its seek index
+func BuildReplayIndex(r io.Reader, guacd bool) (*model.ReplayIndex, error) {
+	if guacd {
+		return buildGuacdIndex(r)
+	}
+	return buildCastIndex(r)
+}
+
+// buildCastIndex indexes the events of an asciicast recording, the first line is the header.
+// The events are played on a screen for checkpoints.
+func buildCastIndex(r io.Reader) (*model.ReplayIndex, error) {
+	b := newReplayIndexBuilder()
+	br := bufio.NewReaderSize(r, 64*1024)
+
+	var screen *asciicast.Screen
+	offset := int64(0)
+	for header := true; ; header = false {
+		line, err := br.ReadBytes('\n')
+		start := offset
+		offset += int64(len(line))
+		if header {
+			screen = newCastScreen(line)
+		} else if t, ok := castEventTime(line); ok {
+			b.add(t, start)
+			b.checkpoint(t, start, screen)
+			playCastEvent(screen, line)
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	b.index.Size = offset
+
+	return b.index, nil
+}
+
+// newCastScreen creates the screen of the header of an asciicast recording, 80x24 if it has no size
+func newCastScreen(header []byte) *asciicast.Screen {
+	h := asciicast.Header{}
+	json.Unmarshal(header, &h)
+	if h.Width <= 0 || h.Height <= 0 {
+		h.Width, h.Height = 80, 24
+	}
+	return asciicast.NewScreen(h.Width, h.Height)
+}
+
+// playCastEvent plays an output or resize event line on screen, and tells which it was
+func playCastEvent(screen *asciicast.Screen, line []byte) (played, resized bool) {
+	event := [3]any{}
+	if json.Unmarshal(line, &event) != nil {
+		return false, false
+	}
+	typ, _ := event[1].(string)
+	data, _ := event[2].(string)
+	switch typ {
+	case "o":
+		screen.Write(data)
+		return true, false
+	case "r":
+		if cols, rows, ok := asciicast.ParseSize(data); ok {
+			screen.Resize(cols, rows)
+			return true, true
+		}
+	}
+	return false, false
+}
+
+// castEventTime parses the time of an event line like [1.5, "o", "..."] without decoding the data
+func castEventTime(line []byte) (float64, bool) {
+	line = bytes.TrimSpace(line)
+	i := bytes.IndexByte(line, ',')
+	if len(line) == 0 || line[0] != '[' || i < 0 {
+		return 0, false
+	}
+	t, err := strconv.ParseFloat(string(bytes.TrimSpace(line[1:i])), 64)
+	return t, err == nil
+}
+
+// buildGuacdIndex indexes the sync instructions of a guacd recording, their timestamps are in milliseconds
+func buildGuacdIndex(r io.Reader) (*model.ReplayIndex, error) {
+	b := newReplayIndexBuilder()
+	br := bufio.NewReaderSize(r, 64*1024)
+
+	offset, first := int64(0), int64(-1)
+	for {
+		start := offset
+		opcode, args, n, err := readGuacdInstruction(br, "sync")
+		offset += n
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if opcode != "sync" || len(args) == 0 {
+			continue
+		}
+		ms, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		if first < 0 {
+			first = ms
+		}
+		b.add(float64(ms-first)/1000, start)
+	}
+	b.index.Size = offset
+
+	return b.index, nil
+}
+
+// readGuacdInstruction reads an instruction like 4.sync,13.1700000000000; and returns the bytes read.
+// Arguments are only kept for the given opcode, the lengths of elements count characters.
+func readGuacdInstruction(br *bufio.Reader, keep string) (opcode string, args []string, n int64, err error) {
+	for i := 0; ; i++ {
+		length := 0
+		for {
+			c, err := br.ReadByte()
+			if err != nil {
+				return "", nil, n, err
+			}
+			n++
+			if c == '.' {
+				break
+			}
+			if c < '0' || c > '9' {
+				return "", nil, n, fmt.Errorf("invalid guacd instruction at byte %d", n)
+			}
+			length = length*10 + int(c-'0')
+		}
+
+		buf := []rune{}
+		save := i == 0 || opcode == keep
+		for j := 0; j < length; j++ {
+			c, size, err := br.ReadRune()
+			if err != nil {
+				return "", nil, n, err
+			}
+			n += int64(size)
+			if save {
+				buf = append(buf, c)
+			}
+		}
+		switch {
+		case i == 0:
+			opcode = string(buf)
+		case save:
+			args = append(args, string(buf))
+		}
+
+		c, err := br.ReadByte()
+		if err != nil {
+			return "", nil, n, err
+		}
+		n++
+		if c == ';' {
+			return opcode, args, n, nil
+		}
+	}
+}
+
+// SliceReplay writes the events of an asciicast recording from start to end seconds, end <= 0 means the end.
+// Times are rebased to start. The events before start are played on a screen which is written at time 0 as a snapshot,
+// so the slice does not begin on a blank screen. They are played from the last checkpoint of index before start,
+// which may be nil, and the recording is seeked there if r is an io.Seeker.
+func SliceReplay(w io.Writer, r io.Reader, start, end float64, index *model.ReplayIndex) error {
+	br := bufio.NewReaderSize(r, 64*1024)
+	header, err := br.ReadBytes('\n')
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(header); err != nil {
+		return err
+	}
+
+	screen, played, resized := newCastScreen(header), false, false
+	if index != nil {
+		if cp, ok := index.Checkpoint(start); ok && cp.Offset >= int64(len(header)) {
+			if err = seekCast(br, r, int64(len(header)), cp.Offset); err != nil {
+				return err
+			}
+			cols, rows := screen.Size()
+			screen = asciicast.NewScreen(cp.Cols, cp.Rows)
+			screen.Write(cp.Screen)
+			played, resized = true, cp.Cols != cols || cp.Rows != rows
+		}
+	}
+
+	write := func(event [3]any) error {
+		bs, _ := json.Marshal(event)
+		_, err := w.Write(append(bs, '\r', '\n'))
+		return err
+	}
+	snapshot := func() error {
+		if !played {
+			return nil
+		}
+		played = false
+		if cols, rows := screen.Size(); resized {
+			if err := write([3]any{0, "r", fmt.Sprintf("%dx%d", cols, rows)}); err != nil {
+				return err
+			}
+		}
+		return write([3]any{0, "o", screen.Snapshot()})
+	}
+
+	for {
+		line, err := br.ReadBytes('\n')
+		event := [3]any{}
+		if t, ok := castEventTime(line); ok && json.Unmarshal(line, &event) == nil {
+			switch {
+			case t < start:
+				p, rs := playCastEvent(screen, line)
+				played, resized = played || p, resized || rs
+			case end > 0 && t > end:
+				return snapshot()
+			default:
+				if err := snapshot(); err != nil {
+					return err
+				}
+				event[0] = float64(int64((t-start)*1_000_000)) / 1_000_000
+				if err := write(event); err != nil {
+					return err
+				}
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return snapshot()
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// seekCast moves br, which has read pos bytes of r, to offset of r
+func seekCast(br *bufio.Reader, r io.Reader, pos, offset int64) error {
+	if seeker, ok := r.(io.Seeker); ok {
+		if _, err := seeker.Seek(offset, io.SeekStart); err != nil {
+			return err
+		}
+		br.Reset(r)
+		return nil
+	}
+	_, err := br.Discard(int(offset - pos))
+	return err
+}
@@ -0,0 +1,163 @@
+package session
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/veops/oneterm/pkg/asciicast"
+)
+
+func TestSliceReplay(t *testing.T) {
+	recording := strings.Join([]string{
+		`{"version":2,"width":80,"height":24}`,
+		`[0.5,"o","$ ls\r\n"]`,
+		`[1.0,"o","a  b\r\n$ "]`,
+		`[1.5,"r","100x30"]`,
+		`[2.0,"o","vim\r\n"]`,
+		`[3.0,"o","\u001b[?1049hfile"]`,
+		`[4.0,"o","\u001b[?1049l$ "]`,
+		``,
+	}, "\n")
+
+	tests := []struct {
+		name       string
+		start, end float64
+		want       []string
+	}{
+		{name: "whole", start: 0, end: 0, want: []string{`[0.5,"o"`, `[1,"o"`, `[1.5,"r"`, `[2,"o"`, `[3,"o"`, `[4,"o"`}},
+		{name: "middle", start: 2, end: 3, want: []string{`[0,"r","100x30"]`, `[0,"o"`, `[0,"o","vim\r\n"]`, `[1,"o"`}},
+		{name: "after the end", start: 5, end: 0, want: []string{`[0,"r","100x30"]`, `[0,"o"`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &bytes.Buffer{}
+			if err := SliceReplay(w, strings.NewReader(recording), tt.start, tt.end, nil); err != nil {
+				t.Fatalf("SliceReplay() error = %v", err)
+			}
+			lines := strings.FieldsFunc(w.String(), func(r rune) bool { return r == '\r' || r == '\n' })
+			if len(lines) != len(tt.want)+1 {
+				t.Fatalf("SliceReplay() = %q, want %d events", lines, len(tt.want))
+			}
+			for i, prefix := range tt.want {
+				if !strings.HasPrefix(lines[i+1], prefix) {
+					t.Errorf("event %d = %s, want prefix %s", i, lines[i+1], prefix)
+				}
+			}
+		})
+	}
+}
+
+func TestSliceReplaySnapshot(t *testing.T) {
+	recording := "{\"version\":2,\"width\":20,\"height\":5}\n" +
+		`[0.1,"o","\u001b[31mred\u001b[0m\r\n$ top"]` + "\n" +
+		`[0.2,"o","\u001b[?1049h\u001b[3;3Hload"]` + "\n" +
+		`[5.0,"o","!"]` + "\n"
+
+	want := asciicast.NewScreen(20, 5)
+	want.Write("\x1b[31mred\x1b[0m\r\n$ top\x1b[?1049h\x1b[3;3Hload!")
+
+	w := &bytes.Buffer{}
+	if err := SliceReplay(w, strings.NewReader(recording), 1, 0, nil); err != nil {
+		t.Fatalf("SliceReplay() error = %v", err)
+	}
+	reader, err := asciicast.NewReader(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := asciicast.NewScreen(20, 5)
+	for event, err := reader.Next(); err == nil; event, err = reader.Next() {
+		got.Write(event.Data)
+	}
+	if got.Snapshot() != want.Snapshot() {
+		t.Errorf("screen after the slice = %q, want %q", got.Snapshot(), want.Snapshot())
+	}
+}
+
+// playSlice plays a slice on a screen and returns its snapshot with the events after the ones at time 0
+func playSlice(t *testing.T, slice string) (string, []string) {
+	reader, err := asciicast.NewReader(strings.NewReader(slice))
+	if err != nil {
+		t.Fatal(err)
+	}
+	screen := asciicast.NewScreen(reader.Header.Width, reader.Header.Height)
+	events := []string{}
+	for event, err := reader.Next(); err == nil; event, err = reader.Next() {
+		if event.Type == "r" {
+			cols, rows, _ := asciicast.ParseSize(event.Data)
+			screen.Resize(cols, rows)
+		} else {
+			screen.Write(event.Data)
+		}
+		if event.Time > 0 {
+			events = append(events, fmt.Sprint(event))
+		}
+	}
+	return screen.Snapshot(), events
+}
+
+func TestSliceReplayCheckpoint(t *testing.T) {
+	sb := &strings.Builder{}
+	sb.WriteString(`{"version":2,"width":40,"height":10}` + "\n")
+	for i := 0; i < 200; i++ {
+		tm := float64(i) * 7
+		switch i % 9 {
+		case 3:
+			fmt.Fprintf(sb, "[%g,\"r\",\"%dx%d\"]\n", tm, 30+i%20, 8+i%5)
+		case 5:
+			fmt.Fprintf(sb, "[%g,\"o\",\"\\u001b[?1049h\\u001b[%d;2H\\u001b[3%dmtop %d\"]\n", tm, 1+i%7, i%8, i)
+		case 6:
+			fmt.Fprintf(sb, "[%g,\"o\",\"\\u001b[?1049l\\u001b[0m$ \"]\n", tm)
+		default:
+			fmt.Fprintf(sb, "[%g,\"o\",\"line %d \\u001b[1mbold\\u001b[0m\\r\\n\"]\n", tm, i)
+		}
+	}
+	recording := sb.String()
+
+	index, err := BuildReplayIndex(strings.NewReader(recording), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(index.Checkpoints) == 0 {
+		t.Fatal("BuildReplayIndex() made no checkpoints")
+	}
+
+	for _, start := range []float64{30, 61, 500, 700, 1000, 1393, 2000} {
+		want := &bytes.Buffer{}
+		if err := SliceReplay(want, strings.NewReader(recording), start, start+100, nil); err != nil {
+			t.Fatal(err)
+		}
+		// A reader which cannot seek skips to the checkpoint
+		for _, r := range []io.Reader{strings.NewReader(recording), struct{ io.Reader }{strings.NewReader(recording)}} {
+			got := &bytes.Buffer{}
+			if err := SliceReplay(got, r, start, start+100, index); err != nil {
+				t.Fatal(err)
+			}
+			wantScreen, wantEvents := playSlice(t, want.String())
+			gotScreen, gotEvents := playSlice(t, got.String())
+			if gotScreen != wantScreen {
+				t.Errorf("start %g: screen = %q, want %q", start, gotScreen, wantScreen)
+			}
+			if fmt.Sprint(gotEvents) != fmt.Sprint(wantEvents) {
+				t.Errorf("start %g: events = %q, want %q", start, gotEvents, wantEvents)
+			}
+		}
+	}
+}
+
+func TestSliceReplayHugeSize(t *testing.T) {
+	// Sizes are sent by clients, the screen must not allocate what they claim
+	recording := "{\"version\":2,\"width\":100000,\"height\":100000}\n" +
+		`[0.1,"o","$ ls"]` + "\n" +
+		`[0.2,"r","100000x100000"]` + "\n" +
+		`[5.0,"o","!"]` + "\n"
+	w := &bytes.Buffer{}
+	if err := SliceReplay(w, strings.NewReader(recording), 1, 0, nil); err != nil {
+		t.Fatalf("SliceReplay() error = %v", err)
+	}
+	if want := fmt.Sprintf(`[0,"r","%dx%d"]`, asciicast.MaxCols, asciicast.MaxRows); !strings.Contains(w.String(), want) {
+		t.Errorf("SliceReplay() = %.200q, want %s", w.String(), want)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"context"
 	"io"
 	"sync"
+	"sync/atomic"
 	"time"
 	"unicode/utf8"
 
@@ -14,6 +15,7 @@ import (
 	"go.uber.org/zap"
 	gossh "golang.org/x/crypto/ssh"
 	"golang.org/x/sync/errgroup"
+	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 
 	"github.com/veops/oneterm/internal/guacd"
@@ -32,7 +34,7 @@ func InitSessionCleanup() {
 	sessions := make([]*Session, 0)
 	if err := dbpkg.DB.
 		Model(sessions).
-		Where("status = ?", model.SESSIONSTATUS_ONLINE).
+		Where("status IN ?", []int{model.SESSIONSTATUS_ONLINE, model.SESSIONSTATUS_DETACHED}).
 		Find(&sessions).
 		Error; err != nil {
 		logger.L().Error("get sessions failed", zap.Error(err))
@@ -50,6 +52,17 @@ func GetOnlineSession() *sync.Map {
 	return onlineSession
 }
 
+// CountOnlineSession counts online sessions satisfying fn
+func CountOnlineSession(fn func(sess *Session) bool) (cnt int) {
+	GetOnlineSession().Range(func(key, value any) bool {
+		if fn(value.(*Session)) {
+			cnt++
+		}
+		return true
+	})
+	return
+}
+
 func GetOnlineSessionById(id string) (sess *Session) {
 	v, ok := GetOnlineSession().Load(id)
 	if !ok {
@@ -92,6 +105,7 @@ type SessionChans struct {
 	WindowChan chan ssh.Window
 	AwayChan   chan struct{}
 	CloseChan  chan string
+	NoticeChan chan string
 }
 
 func NewSessionChans() *SessionChans {
@@ -109,6 +123,7 @@ func NewSessionChans() *SessionChans {
 		WindowChan: make(chan ssh.Window),
 		AwayChan:   make(chan struct{}),
 		CloseChan:  make(chan string),
+		NoticeChan: make(chan string, 8),
 	}
 }
 
@@ -119,10 +134,15 @@ type Session struct {
 	Ws           *websocket.Conn `json:"-" gorm:"-"`
 	CliRw        *CliRW          `json:"-" gorm:"-"`
 	Monitors     *sync.Map       `json:"-" gorm:"-"`
+	Collab       *Collaboration  `json:"-" gorm:"-"`
 	Chans        *SessionChans   `json:"-" gorm:"-"`
 	ConnectionId string          `json:"-" gorm:"-"`
 	GuacdTunnel  *guacd.Tunnel   `json:"-" gorm:"-"`
 	IdleTk       *time.Ticker    `json:"-" gorm:"-"`
+	Lifetime     time.Duration   `json:"-" gorm:"-"`
+	LifeTm       *time.Timer     `json:"-" gorm:"-"`
+	RuleId       int             `json:"-" gorm:"-"`
+	RecordInput  bool            `json:"-" gorm:"-"`
 	SshRecoder   *Asciinema      `json:"-" gorm:"-"`
 	SshParser    *Parser         `json:"-" gorm:"-"`
 	ShareEnd     time.Time       `json:"-" gorm:"-"`
@@ -133,6 +153,11 @@ type Session struct {
 	SSHClient *gossh.Client `json:"-" gorm:"-"`
 	sshMutex  sync.RWMutex  `json:"-" gorm:"-"`
 
+	// Web terminal kept while its websocket is dropped
+	detach   detachState `json:"-" gorm:"-"`
+	detachMu sync.Mutex  `json:"-" gorm:"-"`
+	metaMu   sync.Mutex  `json:"-" gorm:"-"`
+
 	// Web session support
 	WebSession  interface{}            `json:"-" gorm:"-"`
 	Permissions *model.AuthPermissions `json:"-" gorm:"-"`
@@ -160,22 +185,73 @@ func (m *Session) SetIdle() {
 
 }
 
+// SetLifetime closes the session after d regardless of activity, d <= 0 means no limit
+func (m *Session) SetLifetime(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	m.Lifetime = d
+	if m.LifeTm == nil {
+		m.LifeTm = time.NewTimer(d)
+	} else {
+		m.LifeTm.Reset(d)
+	}
+}
+
+// SetCloseReason sets why the session is closed, the first reason wins
+func (m *Session) SetCloseReason(reason string) {
+	m.metaMu.Lock()
+	defer m.metaMu.Unlock()
+	if m.CloseReason == "" {
+		m.CloseReason = reason
+	}
+}
+
+// SetWindow tracks the peak window size of terminal sessions
+func (m *Session) SetWindow(w, h int) {
+	m.metaMu.Lock()
+	defer m.metaMu.Unlock()
+	m.PeakWidth, m.PeakHeight = max(m.PeakWidth, w), max(m.PeakHeight, h)
+}
+
+// LifetimeC returns the channel fired when session lifetime is reached, nil channel blocks forever
+func (m *Session) LifetimeC() <-chan time.Time {
+	if m.LifeTm == nil {
+		return nil
+	}
+	return m.LifeTm.C
+}
+
 func NewSession(ctx context.Context) *Session {
 	s := &Session{}
 	s.G, s.Gctx = errgroup.WithContext(ctx)
 	s.Chans = NewSessionChans()
 	s.Monitors = &sync.Map{}
+	s.Collab = newCollaboration(s)
 	s.SetIdle()
 	return s
 }
 
 func UpsertSession(data *Session) (err error) {
-	return dbpkg.DB.
-		Clauses(clause.OnConflict{
-			DoUpdates: clause.AssignmentColumns([]string{"status", "closed_at"}),
-		}).
-		Create(data).
-		Error
+	// The counters are added to atomically by relays of the running session, so they are not read by gorm
+	counters := map[string]any{
+		"bytes_in":  atomic.LoadInt64(&data.BytesIn),
+		"bytes_out": atomic.LoadInt64(&data.BytesOut),
+		"forbidden": atomic.LoadInt64(&data.Forbidden),
+	}
+	return dbpkg.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.
+			Omit("bytes_in", "bytes_out", "forbidden").
+			Clauses(clause.OnConflict{
+				DoUpdates: clause.AssignmentColumns([]string{"status", "closed_at", "exit_code",
+					"close_reason", "peak_width", "peak_height"}),
+			}).
+			Create(data).
+			Error; err != nil {
+			return err
+		}
+		return tx.Model(model.DefaultSession).Where("session_id = ?", data.SessionId).Updates(counters).Error
+	})
 }
 
 // SetSSHClient stores SSH client for connection reuse
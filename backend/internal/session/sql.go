@@ -0,0 +1,146 @@
+package session
+
+import (
+	"strings"
+
+	"github.com/veops/oneterm/internal/model"
+)
+
+// SQLDialect is the lexical rules of a database which splitting a query into statements depends on
+type SQLDialect struct {
+	Client      string // Command line client, rules like ^mysql.*drop\s+table match statements as if typed to it
+	HashComment bool   // # starts a comment
+	DashSpace   bool   // -- starts a comment only if followed by a space
+	Executable  bool   // /*! ... */ is executed, not a comment
+	Backslash   bool   // \ escapes in quoted strings
+	EscapeQuote bool   // \ escapes in E'...' strings
+	DollarQuote bool   // $tag$...$tag$ quotes a string
+}
+
+var (
+	SQLMySQL    = SQLDialect{Client: "mysql", HashComment: true, DashSpace: true, Executable: true, Backslash: true}
+	SQLPostgres = SQLDialect{Client: "psql", EscapeQuote: true, DollarQuote: true}
+)
+
+// SplitSQL splits query into statements without comments, runs of whitespace outside quotes are collapsed into a space
+func SplitSQL(query string, d SQLDialect) (stmts []string) {
+	var (
+		sb   strings.Builder
+		exec bool // Inside an executable comment
+	)
+	flush := func() {
+		if s := strings.TrimSpace(sb.String()); s != "" {
+			stmts = append(stmts, s)
+		}
+		sb.Reset()
+	}
+	space := func() {
+		if s := sb.String(); s != "" && s[len(s)-1] != ' ' {
+			sb.WriteByte(' ')
+		}
+	}
+
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			escape := d.Backslash && c != '`' || d.EscapeQuote && c == '\'' && i > 0 && (query[i-1] == 'E' || query[i-1] == 'e')
+			j := quoteEnd(query, i, escape)
+			sb.WriteString(query[i:j])
+			i = j - 1
+		case c == '$' && d.DollarQuote && dollarTag(query[i:]) != "" && (i == 0 || !isIdentChar(query[i-1])):
+			tag := dollarTag(query[i:])
+			j := len(query)
+			if k := strings.Index(query[i+len(tag):], tag); k >= 0 {
+				j = i + len(tag) + k + len(tag)
+			}
+			sb.WriteString(query[i:j])
+			i = j - 1
+		case c == '-' && strings.HasPrefix(query[i:], "--") && (!d.DashSpace || i+2 >= len(query) || query[i+2] <= ' '),
+			c == '#' && d.HashComment:
+			for i < len(query) && query[i] != '\n' {
+				i++
+			}
+			space()
+		case c == '/' && strings.HasPrefix(query[i:], "/*!") && d.Executable:
+			// The content is a statement for the server, only the version is dropped
+			for i += 3; i < len(query) && query[i] >= '0' && query[i] <= '9'; i++ {
+			}
+			i--
+			exec = true
+			space()
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			if j := strings.Index(query[i+2:], "*/"); j >= 0 {
+				i += j + 3
+			} else {
+				i = len(query)
+			}
+			space()
+		case c == '*' && exec && strings.HasPrefix(query[i:], "*/"):
+			i++
+			exec = false
+			space()
+		case c == ';':
+			flush()
+		case c <= ' ':
+			space()
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	flush()
+
+	return
+}
+
+// quoteEnd returns the index after the quote which closes the one at i, doubled quotes are escaped quotes
+func quoteEnd(s string, i int, backslash bool) int {
+	q := s[i]
+	for j := i + 1; j < len(s); j++ {
+		switch {
+		case s[j] == '\\' && backslash:
+			j++
+		case s[j] == q:
+			if j+1 < len(s) && s[j+1] == q {
+				j++
+				continue
+			}
+			return j + 1
+		}
+	}
+	return len(s)
+}
+
+// dollarTag returns the tag like $body$ or $$ which s starts with
+func dollarTag(s string) string {
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '$':
+			return s[:i+1]
+		case !isIdentChar(c) || i == 1 && c >= '0' && c <= '9':
+			return ""
+		}
+	}
+	return ""
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c >= 0x80
+}
+
+// CheckSQL checks every statement of query against command policies, the most restrictive result is returned.
+// A statement matches a rule as written, in lower case, or prefixed with the client, e.g. mysql drop table t.
+func (p *Parser) CheckSQL(query string, d SQLDialect) *model.CommandCheckResult {
+	res := &model.CommandCheckResult{Allowed: true, Action: model.CommandActionAllow}
+	for _, stmt := range SplitSQL(query, d) {
+		lower := strings.ToLower(stmt)
+		r := p.check(stmt, []string{stmt, lower, d.Client + " " + lower})
+		if !r.Allowed {
+			return r
+		}
+		if r.Action == model.CommandActionAudit && (res.Action != model.CommandActionAudit || r.RiskLevel > res.RiskLevel) {
+			res = r
+		}
+	}
+	return res
+}
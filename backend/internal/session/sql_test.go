@@ -0,0 +1,78 @@
+package session
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/veops/oneterm/internal/model"
+)
+
+func TestSplitSQL(t *testing.T) {
+	tests := []struct {
+		name    string
+		dialect SQLDialect
+		query   string
+		want    []string
+	}{
+		{name: "statements", dialect: SQLMySQL, query: "select 1; select 2;", want: []string{"select 1", "select 2"}},
+		{name: "whitespace", dialect: SQLMySQL, query: "select\n\t  1", want: []string{"select 1"}},
+		{name: "line comments", dialect: SQLMySQL, query: "select 1 -- x;\n; drop table t # y;", want: []string{"select 1", "drop table t"}},
+		{name: "dash without space", dialect: SQLMySQL, query: "select 1--1", want: []string{"select 1--1"}},
+		{name: "dash in postgres", dialect: SQLPostgres, query: "select 1--1;\nselect 2", want: []string{"select 1 select 2"}},
+		{name: "hash in postgres", dialect: SQLPostgres, query: "select a #> b", want: []string{"select a #> b"}},
+		{name: "block comment", dialect: SQLMySQL, query: "drop/* x; */table t", want: []string{"drop table t"}},
+		{name: "unclosed comment", dialect: SQLMySQL, query: "select 1 /* ;", want: []string{"select 1"}},
+		{name: "executable comment", dialect: SQLMySQL, query: "/*!40101 drop table t */; select 1", want: []string{"drop table t", "select 1"}},
+		{name: "executable comment in postgres", dialect: SQLPostgres, query: "/*! drop table t */ select 1", want: []string{"select 1"}},
+		{name: "quotes", dialect: SQLMySQL, query: "select ';', \"--;\", `a;b`; x", want: []string{"select ';', \"--;\", `a;b`", "x"}},
+		{name: "doubled quotes", dialect: SQLMySQL, query: "select 'a'';b'; x", want: []string{"select 'a'';b'", "x"}},
+		{name: "backslash in mysql", dialect: SQLMySQL, query: `select 'a\';b'; x`, want: []string{`select 'a\';b'`, "x"}},
+		{name: "backslash in postgres", dialect: SQLPostgres, query: `select 'a\';b'`, want: []string{`select 'a\'`, "b'"}},
+		{name: "escape string", dialect: SQLPostgres, query: `select E'a\';b'; x`, want: []string{`select E'a\';b'`, "x"}},
+		{name: "dollar quotes", dialect: SQLPostgres, query: "select $$a;b$$; select $f$c;$$;d$f$", want: []string{"select $$a;b$$", "select $f$c;$$;d$f$"}},
+		{name: "dollar parameter", dialect: SQLPostgres, query: "select $1; select a$b$", want: []string{"select $1", "select a$b$"}},
+		{name: "unclosed quote", dialect: SQLMySQL, query: "select 'a; drop table t", want: []string{"select 'a; drop table t"}},
+		{name: "empty", dialect: SQLMySQL, query: " ; -- x\n;", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SplitSQL(tt.query, tt.dialect); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SplitSQL(%q) = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckSQL(t *testing.T) {
+	cmds := []*model.Command{
+		{Cmd: "drop table", Action: model.CommandActionDeny},
+		{Cmd: "^psql.*truncate", IsRe: true, Re: regexp.MustCompile("^psql.*truncate"), Action: model.CommandActionDeny},
+		{Cmd: "delete from", Action: model.CommandActionAudit},
+	}
+	tests := []struct {
+		name    string
+		dialect SQLDialect
+		query   string
+		allowed bool
+		action  model.CommandAction
+	}{
+		{name: "allowed", dialect: SQLMySQL, query: "select * from t", allowed: true, action: model.CommandActionAllow},
+		{name: "denied", dialect: SQLMySQL, query: "DROP   TABLE t", allowed: false, action: model.CommandActionDeny},
+		{name: "second statement", dialect: SQLMySQL, query: "select 1; drop table t", allowed: false, action: model.CommandActionDeny},
+		{name: "comment between words", dialect: SQLMySQL, query: "drop/**/table t", allowed: false, action: model.CommandActionDeny},
+		{name: "executable comment", dialect: SQLMySQL, query: "/*!50000 drop */ table t", allowed: false, action: model.CommandActionDeny},
+		{name: "client prefix", dialect: SQLPostgres, query: "TRUNCATE t", allowed: false, action: model.CommandActionDeny},
+		{name: "client prefix of another dialect", dialect: SQLMySQL, query: "truncate t", allowed: true, action: model.CommandActionAllow},
+		{name: "audited", dialect: SQLMySQL, query: "select 1; delete from t", allowed: true, action: model.CommandActionAudit},
+		{name: "commented out", dialect: SQLMySQL, query: "select 1 -- drop table t", allowed: true, action: model.CommandActionAllow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Parser{Cmds: cmds}
+			if got := p.CheckSQL(tt.query, tt.dialect); got.Allowed != tt.allowed || got.Action != tt.action {
+				t.Errorf("CheckSQL(%q) = %+v, want allowed %v and action %s", tt.query, got, tt.allowed, tt.action)
+			}
+		})
+	}
+}
@@ -33,6 +33,9 @@ var (
 	RedisColor      = lipgloss.Color("#9C27B0") // Purple for Redis
 	MongoDBColor    = lipgloss.Color("#4DB33D") // Keep MongoDB brand green
 	PostgreSQLColor = PrimaryColor2  // Light blue for PostgreSQL
+	MSSQLColor      = lipgloss.Color("#CC2927") // Red for SQL Server
+	OracleColor     = lipgloss.Color("#F29111") // Orange for Oracle
+	ClickHouseColor = lipgloss.Color("#FAFF69") // Yellow for ClickHouse
 	TelnetColor     = PrimaryColor8  // Soft blue for Telnet
 )
 
@@ -87,6 +90,12 @@ func GetProtocolColor(protocol string) lipgloss.Color {
 		return MongoDBColor
 	case "postgresql":
 		return PostgreSQLColor
+	case "mssql":
+		return MSSQLColor
+	case "oracle":
+		return OracleColor
+	case "clickhouse":
+		return ClickHouseColor
 	case "telnet":
 		return TelnetColor
 	default:
@@ -0,0 +1,102 @@
+package sshsrv
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gliderlabs/ssh"
+	"github.com/samber/lo"
+	"github.com/spf13/cast"
+	"go.uber.org/zap"
+	gossh "golang.org/x/crypto/ssh"
+
+	"github.com/veops/oneterm/internal/acl"
+	myConnector "github.com/veops/oneterm/internal/connector"
+	"github.com/veops/oneterm/internal/model"
+	"github.com/veops/oneterm/internal/service"
+	gsession "github.com/veops/oneterm/internal/session"
+	"github.com/veops/oneterm/pkg/logger"
+)
+
+// localForwardChannelData is the payload of direct-tcpip channels, see RFC 4254 section 7.2
+type localForwardChannelData struct {
+	DestAddr   string
+	DestPort   uint32
+	OriginAddr string
+	OriginPort uint32
+}
+
+// directTCPIPHandler forwards ssh -L connections to ports of authorized assets, e.g. ssh -L 8080:web01:80 oneterm.
+// The destination is the name or ip of an asset, an account given at login, e.g. alice@web01#root, is preferred.
+func directTCPIPHandler(srv *ssh.Server, conn *gossh.ServerConn, newChan gossh.NewChannel, sctx ssh.Context) {
+	d := localForwardChannelData{}
+	if err := gossh.Unmarshal(newChan.ExtraData(), &d); err != nil {
+		newChan.Reject(gossh.ConnectionFailed, "error parsing forward data: "+err.Error())
+		return
+	}
+
+	ctx := newGinContext(sctx, "")
+	asset, account, err := forwardTarget(ctx, sctx, d.DestAddr)
+	if err != nil {
+		newChan.Reject(gossh.Prohibited, err.Error())
+		return
+	}
+	ctx.Params = gin.Params{
+		{Key: "account_id", Value: cast.ToString(account.Id)},
+		{Key: "asset_id", Value: cast.ToString(asset.Id)},
+	}
+
+	accepted := false
+	err = myConnector.DoForward(ctx, int(d.DestPort), func() (io.ReadWriteCloser, error) {
+		ch, reqs, err := newChan.Accept()
+		if err != nil {
+			return nil, err
+		}
+		accepted = true
+		go gossh.DiscardRequests(reqs)
+		return ch, nil
+	})
+	if err != nil {
+		logger.L().Warn("port forward failed", zap.String("dest", fmt.Sprintf("%s:%d", d.DestAddr, d.DestPort)), zap.Error(err))
+		if !accepted {
+			newChan.Reject(gossh.ConnectionFailed, errMessage(ctx, err))
+		}
+	}
+}
+
+// forwardTarget finds the asset of the destination and an account of it which is allowed to forward ports
+func forwardTarget(ctx *gin.Context, sctx ssh.Context, dest string) (*model.Asset, *model.Account, error) {
+	currentUser, _ := acl.GetSessionFromCtx(ctx)
+	targets, err := authorizedTargets(ctx, currentUser)
+	if err != nil {
+		return nil, nil, err
+	}
+	found, ok := myConnector.FindTarget(targets, dest)
+	if !ok {
+		return nil, nil, fmt.Errorf("asset %s not found or not authorized", dest)
+	}
+
+	accounts := found.Accounts
+	if target, ok := sctx.Value("target").(*directTarget); ok && target != nil && target.Account != "" {
+		if _, ok := myConnector.FindTarget([]*myConnector.Target{found}, target.Asset); ok {
+			accounts = lo.Filter(accounts, func(a *model.Account, _ int) bool { return a.Name == target.Account })
+		}
+	}
+
+	for _, account := range accounts {
+		sess := &gsession.Session{
+			Session: &model.Session{
+				AssetId:   found.Asset.Id,
+				AccountId: account.Id,
+				Asset:     found.Asset,
+			},
+		}
+		result, err := service.DefaultAuthService.HasAuthorizationV2(ctx, sess, model.ActionPortForward)
+		if err == nil && result.IsAllowed(model.ActionPortForward) {
+			return found.Asset, account, nil
+		}
+	}
+
+	return nil, nil, fmt.Errorf("port forwarding to asset %s is not authorized", dest)
+}
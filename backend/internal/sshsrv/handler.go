@@ -1,10 +1,9 @@
 package sshsrv
 
 import (
+	"errors"
 	"fmt"
 	"io"
-	"net/http"
-	"net/url"
 	"strings"
 	"time"
 
@@ -17,60 +16,37 @@ import (
 	"golang.org/x/sync/errgroup"
 
 	"github.com/veops/oneterm/internal/acl"
-	"github.com/veops/oneterm/internal/model"
+	myConnector "github.com/veops/oneterm/internal/connector"
 	"github.com/veops/oneterm/internal/service"
+	"github.com/veops/oneterm/internal/sshsrv/colors"
 	"github.com/veops/oneterm/internal/version"
+	myErrors "github.com/veops/oneterm/pkg/errors"
 	"github.com/veops/oneterm/pkg/logger"
 )
 
-// testResponseWriter implements http.ResponseWriter for gin.CreateTestContext
-type testResponseWriter struct {
-	headers http.Header
-	body    []byte
-	status  int
-}
-
-func (w *testResponseWriter) Write(b []byte) (int, error) {
-	w.body = append(w.body, b...)
-	return len(b), nil
-}
-
-func (w *testResponseWriter) WriteHeader(status int) {
-	w.status = status
-}
-
-func (w *testResponseWriter) Header() http.Header {
-	if w.headers == nil {
-		w.headers = make(http.Header)
-	}
-	return w.headers
-}
-
 func handler(sess ssh.Session) {
 	defer acl.Logout(sess.Context().Value("session").(*acl.Session))
 	pty, _, isPty := sess.Pty()
 	if !isPty {
-		logger.L().Error("not a pty request")
+		execHandler(sess)
 		return
 	}
 
-	// Create a properly initialized gin.Context
-	req := &http.Request{
-		RemoteAddr: sess.RemoteAddr().String(),
-		URL: &url.URL{
-			RawQuery: fmt.Sprintf("info=true&w=%d&h=%d", pty.Window.Width, pty.Window.Height),
-		},
-		Header: make(http.Header),
-		Method: "GET",
-		Host:   "localhost",
-	}
+	ctx := newGinContext(sess.Context(), fmt.Sprintf("info=true&w=%d&h=%d", pty.Window.Width, pty.Window.Height))
 
-	// Use gin.CreateTestContext to create a properly initialized context
-	rec := &testResponseWriter{}
-	ctx, _ := gin.CreateTestContext(rec)
-	ctx.Request = req
-	ctx.Set("sessionType", model.SESSIONTYPE_CLIENT)
-	ctx.Set("session", sess.Context().Value("session"))
+	// Connect straight to the target given at login or as the command
+	target, err := sessionTarget(sess)
+	if err == nil && target != nil {
+		err = connectTarget(ctx, sess, target)
+	}
+	if err != nil {
+		fmt.Fprintf(sess, "%s %s\r\n", colors.ErrorStyle.Render("✗"), errMessage(ctx, err))
+		sess.Exit(1)
+		return
+	}
+	if target != nil {
+		return
+	}
 
 	eg, gctx := errgroup.WithContext(sess.Context())
 	r, w := io.Pipe()
@@ -95,6 +71,37 @@ func handler(sess ssh.Session) {
 	}
 }
 
+// execHandler runs the command of a non-interactive session, e.g. ssh oneterm web01 -- uptime or scp
+func execHandler(sess ssh.Session) {
+	ctx := newGinContext(sess.Context(), "")
+
+	code := 1
+	target, command, err := execTarget(sess)
+	if err == nil {
+		code, err = execTargetCommand(ctx, sess, target, command)
+	}
+	if err != nil {
+		logger.L().Warn("exec failed", zap.String("command", sess.RawCommand()), zap.Error(err))
+		fmt.Fprintf(sess.Stderr(), "%s\n", errMessage(ctx, err))
+	}
+	sess.Exit(code)
+}
+
+// errMessage returns the localized message of api errors
+func errMessage(ctx *gin.Context, err error) string {
+	var ae *myErrors.ApiError
+	if errors.As(err, &ae) {
+		return ae.MessageWithCtx(ctx)
+	}
+	return err.Error()
+}
+
+// newGinContext creates a gin.Context carrying the login session of the ssh session
+func newGinContext(sctx ssh.Context, rawQuery string) *gin.Context {
+	sess, _ := sctx.Value("session").(*acl.Session)
+	return myConnector.NewGinContext(sctx.RemoteAddr(), rawQuery, sess)
+}
+
 func signer() ssh.Signer {
 	sysConfigService := service.NewSystemConfigService()
 
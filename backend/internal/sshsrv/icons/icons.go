@@ -18,6 +18,12 @@ func GetProtocolIcon(protocol string) string {
 		return "◉"
 	case "postgresql":
 		return "▣"
+	case "mssql":
+		return "■"
+	case "oracle":
+		return "◈"
+	case "clickhouse":
+		return "▥"
 	case "telnet":
 		return "◎"
 	default:
@@ -39,6 +45,12 @@ func GetStyledProtocolIcon(protocol string) string {
 		return lipgloss.NewStyle().Foreground(colors.MongoDBColor).Render(icon)
 	case "postgresql":
 		return lipgloss.NewStyle().Foreground(colors.PostgreSQLColor).Render(icon)
+	case "mssql":
+		return lipgloss.NewStyle().Foreground(colors.MSSQLColor).Render(icon)
+	case "oracle":
+		return lipgloss.NewStyle().Foreground(colors.OracleColor).Render(icon)
+	case "clickhouse":
+		return lipgloss.NewStyle().Foreground(colors.ClickHouseColor).Render(icon)
 	case "telnet":
 		return lipgloss.NewStyle().Foreground(colors.TelnetColor).Render(icon)
 	default:
@@ -63,6 +75,12 @@ func GetDefaultPort(protocol string) string {
 		return "27017"
 	case "postgresql":
 		return "5432"
+	case "mssql":
+		return "1433"
+	case "oracle":
+		return "1521"
+	case "clickhouse":
+		return "9000"
 	case "telnet":
 		return "23"
 	default:
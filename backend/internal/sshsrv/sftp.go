@@ -0,0 +1,363 @@
+package sshsrv
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gliderlabs/ssh"
+	"github.com/pkg/sftp"
+	"github.com/samber/lo"
+	"go.uber.org/zap"
+
+	"github.com/veops/oneterm/internal/acl"
+	"github.com/veops/oneterm/internal/model"
+	"github.com/veops/oneterm/internal/service"
+	fileservice "github.com/veops/oneterm/internal/service/file"
+	gsession "github.com/veops/oneterm/internal/session"
+	"github.com/veops/oneterm/pkg/logger"
+)
+
+// sftpHandler serves the sftp subsystem as a virtual filesystem.
+// The root lists authorized assets, each asset lists its accounts and
+// /<asset>/<account>/<path> is proxied to <path> on the asset as the account.
+// Names of assets and accounts are escaped by sftpName.
+type sftpHandler struct {
+	ctx     *gin.Context
+	targets map[string]*sftpTarget
+}
+
+type sftpTarget struct {
+	asset    *model.Asset
+	accounts map[string]*model.Account
+}
+
+// sftpPath is a resolved path of the virtual filesystem
+type sftpPath struct {
+	asset   *model.Asset
+	account *model.Account
+	remote  string
+	depth   int
+}
+
+func sftpSubsystem(sess ssh.Session) {
+	defer acl.Logout(sess.Context().Value("session").(*acl.Session))
+
+	h, err := newSftpHandler(newGinContext(sess.Context(), ""))
+	if err != nil {
+		logger.L().Error("init sftp handler failed", zap.Error(err))
+		return
+	}
+
+	server := sftp.NewRequestServer(sess, sftp.Handlers{FileGet: h, FilePut: h, FileCmd: h, FileList: h})
+	defer server.Close()
+	if err := server.Serve(); err != nil && !errors.Is(err, io.EOF) {
+		logger.L().Debug("sftp server stopped", zap.Error(err))
+	}
+}
+
+func newSftpHandler(ctx *gin.Context) (*sftpHandler, error) {
+	currentUser, _ := acl.GetSessionFromCtx(ctx)
+	targets, err := authorizedTargets(ctx, currentUser)
+	if err != nil {
+		return nil, err
+	}
+
+	h := &sftpHandler{ctx: ctx, targets: map[string]*sftpTarget{}}
+	for _, target := range targets {
+		// Files are only reachable through ssh
+		if !lo.ContainsBy(target.Asset.Protocols, func(p string) bool { return strings.HasPrefix(p, "ssh") }) {
+			continue
+		}
+		t := &sftpTarget{asset: target.Asset, accounts: map[string]*model.Account{}}
+		for _, account := range target.Accounts {
+			t.accounts[sftpName(account.Name)] = account
+		}
+		h.targets[sftpName(target.Asset.Name)] = t
+	}
+
+	return h, nil
+}
+
+// sftpName escapes the name of an asset or account as a name of the virtual filesystem,
+// so that names with / and names like .. are neither split nor cleaned out of a path.
+func sftpName(name string) string {
+	name = strings.NewReplacer("%", "%25", "/", "%2F").Replace(name)
+	if strings.Trim(name, ".") == "" {
+		name = strings.ReplaceAll(name, ".", "%2E")
+	}
+	return name
+}
+
+// resolve maps a path of the virtual filesystem to an asset, an account and a remote path
+func (h *sftpHandler) resolve(p string) (*sftpPath, error) {
+	parts := strings.SplitN(strings.TrimPrefix(path.Clean("/"+p), "/"), "/", 3)
+	if parts[0] == "" {
+		return &sftpPath{}, nil
+	}
+
+	target, ok := h.targets[parts[0]]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	res := &sftpPath{asset: target.asset, depth: 1}
+	if len(parts) == 1 {
+		return res, nil
+	}
+
+	if res.account, ok = target.accounts[parts[1]]; !ok {
+		return nil, os.ErrNotExist
+	}
+	res.depth, res.remote = 2, "/"
+	if len(parts) == 3 {
+		res.depth, res.remote = 3, "/"+parts[2]
+	}
+
+	return res, nil
+}
+
+// authorize checks the action with the same V2 rules as the web file api
+func (h *sftpHandler) authorize(p *sftpPath, action model.AuthAction) error {
+	sess := &gsession.Session{
+		Session: &model.Session{
+			AssetId:   p.asset.Id,
+			AccountId: p.account.Id,
+			Asset:     p.asset,
+		},
+	}
+	result, err := service.DefaultAuthService.HasAuthorizationV2(h.ctx, sess, action)
+	if err != nil {
+		return err
+	}
+	if !result.IsAllowed(action) {
+		return os.ErrPermission
+	}
+	return nil
+}
+
+// client resolves a file path and returns the sftp client of its asset once the action is authorized
+func (h *sftpHandler) client(filepath string, action model.AuthAction) (*sftpPath, *sftp.Client, error) {
+	p, err := h.resolve(filepath)
+	if err != nil {
+		return nil, nil, err
+	}
+	if p.depth < 2 {
+		return nil, nil, os.ErrPermission
+	}
+	if err = h.authorize(p, action); err != nil {
+		return nil, nil, err
+	}
+	cli, err := fileservice.GetFileManager().GetFileClient(p.asset.Id, p.account.Id)
+	if err != nil {
+		return nil, nil, err
+	}
+	return p, cli, nil
+}
+
+// record writes the operation to file history, the target of a rename follows the file name
+func (h *sftpHandler) record(p *sftpPath, operation string, target ...string) {
+	dir, filename := path.Split(p.remote)
+	if operation == "mkdir" || operation == "rmdir" {
+		dir, filename = p.remote, ""
+	}
+	if len(target) > 0 {
+		filename += " -> " + target[0]
+	}
+	if err := fileservice.DefaultFileService.RecordFileHistory(h.ctx, operation, dir, filename, p.asset.Id, p.account.Id); err != nil {
+		logger.L().Error("Failed to record file history", zap.Error(err))
+	}
+}
+
+// Fileread implements sftp.FileReader
+func (h *sftpHandler) Fileread(r *sftp.Request) (io.ReaderAt, error) {
+	p, cli, err := h.client(r.Filepath, model.ActionFileDownload)
+	if err != nil {
+		return nil, err
+	}
+	f, err := cli.Open(p.remote)
+	if err != nil {
+		return nil, err
+	}
+	return &sftpTransfer{File: f, done: func() { h.record(p, "download") }}, nil
+}
+
+// Filewrite implements sftp.FileWriter
+func (h *sftpHandler) Filewrite(r *sftp.Request) (io.WriterAt, error) {
+	p, cli, err := h.client(r.Filepath, model.ActionFileUpload)
+	if err != nil {
+		return nil, err
+	}
+
+	flags := os.O_WRONLY
+	pflags := r.Pflags()
+	if pflags.Creat {
+		flags |= os.O_CREATE
+	}
+	if pflags.Trunc {
+		flags |= os.O_TRUNC
+	}
+	if pflags.Excl {
+		flags |= os.O_EXCL
+	}
+	f, err := cli.OpenFile(p.remote, flags)
+	if err != nil {
+		return nil, err
+	}
+	return &sftpTransfer{File: f, done: func() { h.record(p, "upload") }}, nil
+}
+
+// Filecmd implements sftp.FileCmder, every modification requires the file_upload permission
+func (h *sftpHandler) Filecmd(r *sftp.Request) error {
+	p, cli, err := h.client(r.Filepath, model.ActionFileUpload)
+	if err != nil {
+		return err
+	}
+	if p.depth < 3 {
+		return os.ErrPermission
+	}
+
+	switch r.Method {
+	case "Setstat":
+		err = h.setstat(cli, p.remote, r)
+	case "Rename":
+		target, err := h.resolve(r.Target)
+		if err != nil {
+			return err
+		}
+		if target.depth < 3 || target.asset.Id != p.asset.Id || target.account.Id != p.account.Id {
+			return os.ErrPermission
+		}
+		if err = cli.Rename(p.remote, target.remote); err == nil {
+			h.record(p, "rename", target.remote)
+		}
+		return err
+	case "Rmdir":
+		err = cli.RemoveDirectory(p.remote)
+	case "Remove":
+		err = cli.Remove(p.remote)
+	case "Mkdir":
+		err = cli.Mkdir(p.remote)
+	default:
+		return sftp.ErrSSHFxOpUnsupported
+	}
+	if err == nil {
+		h.record(p, strings.ToLower(r.Method))
+	}
+	return err
+}
+
+func (h *sftpHandler) setstat(cli *sftp.Client, remote string, r *sftp.Request) error {
+	attrs, flags := r.Attributes(), r.AttrFlags()
+	if flags.Size {
+		if err := cli.Truncate(remote, int64(attrs.Size)); err != nil {
+			return err
+		}
+	}
+	if flags.Permissions {
+		if err := cli.Chmod(remote, attrs.FileMode()); err != nil {
+			return err
+		}
+	}
+	if flags.Acmodtime {
+		if err := cli.Chtimes(remote, time.Unix(int64(attrs.Atime), 0), time.Unix(int64(attrs.Mtime), 0)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Filelist implements sftp.FileLister
+func (h *sftpHandler) Filelist(r *sftp.Request) (sftp.ListerAt, error) {
+	p, err := h.resolve(r.Filepath)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case p.depth == 0 && r.Method == "List":
+		return sftpLister(lo.MapToSlice(h.targets, func(name string, _ *sftpTarget) os.FileInfo { return virtualDir(name) })), nil
+	case p.depth == 0:
+		return sftpLister{virtualDir("/")}, nil
+	case p.depth == 1 && r.Method == "List":
+		return sftpLister(lo.MapToSlice(h.targets[sftpName(p.asset.Name)].accounts, func(name string, _ *model.Account) os.FileInfo { return virtualDir(name) })), nil
+	case p.depth == 1:
+		return sftpLister{virtualDir(sftpName(p.asset.Name))}, nil
+	}
+
+	// Browsing files of an asset requires the connect permission as the web file api does
+	p, cli, err := h.client(r.Filepath, model.ActionConnect)
+	if err != nil {
+		return nil, err
+	}
+	switch r.Method {
+	case "List":
+		infos, err := cli.ReadDir(p.remote)
+		return sftpLister(infos), err
+	case "Stat":
+		if p.depth == 2 {
+			return sftpLister{virtualDir(sftpName(p.account.Name))}, nil
+		}
+		info, err := cli.Stat(p.remote)
+		if err != nil {
+			return nil, err
+		}
+		return sftpLister{info}, nil
+	default:
+		return nil, sftp.ErrSSHFxOpUnsupported
+	}
+}
+
+// Readlink implements sftp.ReadlinkFileLister, absolute targets are mapped into the virtual filesystem
+func (h *sftpHandler) Readlink(filepath string) (string, error) {
+	p, cli, err := h.client(filepath, model.ActionConnect)
+	if err != nil {
+		return "", err
+	}
+	target, err := cli.ReadLink(p.remote)
+	if err != nil || !path.IsAbs(target) {
+		return target, err
+	}
+	return path.Join("/", sftpName(p.asset.Name), sftpName(p.account.Name), target), nil
+}
+
+// sftpTransfer is a remote file which records file history once the transfer completes
+type sftpTransfer struct {
+	*sftp.File
+	done func()
+}
+
+func (t *sftpTransfer) Close() error {
+	err := t.File.Close()
+	if err == nil {
+		t.done()
+	}
+	return err
+}
+
+type sftpLister []os.FileInfo
+
+// ListAt implements sftp.ListerAt
+func (l sftpLister) ListAt(ls []os.FileInfo, offset int64) (int, error) {
+	if offset >= int64(len(l)) {
+		return 0, io.EOF
+	}
+	n := copy(ls, l[offset:])
+	if n < len(ls) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// virtualDir is a read only directory of the virtual filesystem
+type virtualDir string
+
+func (d virtualDir) Name() string       { return string(d) }
+func (d virtualDir) Size() int64        { return 0 }
+func (d virtualDir) Mode() os.FileMode  { return os.ModeDir | 0555 }
+func (d virtualDir) ModTime() time.Time { return time.Time{} }
+func (d virtualDir) IsDir() bool        { return true }
+func (d virtualDir) Sys() any           { return nil }
@@ -0,0 +1,47 @@
+package sshsrv
+
+import (
+	"testing"
+
+	"github.com/veops/oneterm/internal/model"
+)
+
+func TestSftpResolve(t *testing.T) {
+	h := &sftpHandler{targets: map[string]*sftpTarget{}}
+	for _, name := range []string{"web01", "web/01", "..", ".", "100%"} {
+		h.targets[sftpName(name)] = &sftpTarget{
+			asset:    &model.Asset{Name: name},
+			accounts: map[string]*model.Account{sftpName(name): {Name: name}},
+		}
+	}
+
+	tests := []struct {
+		path    string
+		asset   string
+		account string
+		remote  string
+	}{
+		{path: "/web01/web01/etc/hosts", asset: "web01", account: "web01", remote: "/etc/hosts"},
+		{path: "/web%2F01/web%2F01", asset: "web/01", account: "web/01", remote: "/"},
+		{path: "/%2E%2E/%2E%2E/x/..", asset: "..", account: "..", remote: "/"},
+		{path: "/%2E", asset: "."},
+		{path: "/100%25/100%25/a", asset: "100%", account: "100%", remote: "/a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			p, err := h.resolve(tt.path)
+			if err != nil {
+				t.Fatalf("resolve(%q) error = %v", tt.path, err)
+			}
+			if p.asset.Name != tt.asset || (p.account != nil && p.account.Name != tt.account) || p.remote != tt.remote {
+				t.Errorf("resolve(%q) = %s %v %q", tt.path, p.asset.Name, p.account, p.remote)
+			}
+		})
+	}
+
+	for _, p := range []string{"/web", "/web/01", "/web01/web02"} {
+		if _, err := h.resolve(p); err == nil {
+			t.Errorf("resolve(%q) found an unknown name", p)
+		}
+	}
+}
@@ -22,14 +22,25 @@ func init() {
 	server = &ssh.Server{
 		Addr:    fmt.Sprintf("%s:%d", config.Cfg.Ssh.Host, config.Cfg.Ssh.Port),
 		Handler: handler,
+		SubsystemHandlers: map[string]ssh.SubsystemHandler{
+			"sftp": sftpSubsystem,
+		},
+		ChannelHandlers: map[string]ssh.ChannelHandler{
+			"session":      ssh.DefaultSessionHandler,
+			"direct-tcpip": directTCPIPHandler,
+		},
 		PasswordHandler: func(ctx ssh.Context, password string) bool {
-			sess, err := acl.LoginByPassword(ctx, ctx.User(), password, utils.IpFromNetAddr(ctx.RemoteAddr()))
+			username, target := parseLoginUser(ctx.User())
+			sess, err := acl.LoginByPassword(ctx, username, password, utils.IpFromNetAddr(ctx.RemoteAddr()))
 			ctx.SetValue("session", sess)
+			ctx.SetValue("target", target)
 			return err == nil
 		},
 		PublicKeyHandler: func(ctx ssh.Context, key ssh.PublicKey) bool {
-			sess, err := acl.LoginByPublicKey(ctx, ctx.User(), string(gossh.MarshalAuthorizedKey(key)), utils.IpFromNetAddr(ctx.RemoteAddr()))
+			username, target := parseLoginUser(ctx.User())
+			sess, err := acl.LoginByPublicKey(ctx, username, string(gossh.MarshalAuthorizedKey(key)), utils.IpFromNetAddr(ctx.RemoteAddr()))
 			ctx.SetValue("session", sess)
+			ctx.SetValue("target", target)
 			return err == nil
 		},
 		HostSigners: []ssh.Signer{},
@@ -0,0 +1,153 @@
+package sshsrv
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gliderlabs/ssh"
+	"github.com/samber/lo"
+	"github.com/spf13/cast"
+
+	"github.com/veops/oneterm/internal/acl"
+	myConnector "github.com/veops/oneterm/internal/connector"
+	"github.com/veops/oneterm/internal/model"
+)
+
+// directTarget is an asset to connect to without the interactive picker.
+// It is given in the login user, e.g. ssh alice@web01#root@oneterm,
+// or as the ssh command, e.g. ssh alice@oneterm web01#root or ssh alice@oneterm telnet root@web01.
+type directTarget struct {
+	Protocol string
+	Asset    string
+	Account  string
+}
+
+// parseLoginUser splits a login user like alice@web01#root into the username and the target.
+// A target needs the account, so usernames like alice@example.com are kept whole.
+func parseLoginUser(user string) (string, *directTarget) {
+	if !strings.Contains(user, "#") {
+		return user, nil
+	}
+	username, asset, account, ok := myConnector.SplitLoginUser(user)
+	if !ok {
+		return user, nil
+	}
+	return username, &directTarget{Asset: asset, Account: account}
+}
+
+// parseTarget parses a target like [protocol ]asset[#account] or [protocol ]account@asset
+func parseTarget(s string) (*directTarget, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 || len(fields) > 2 {
+		return nil, fmt.Errorf("invalid target %q, expected [protocol] asset#account or [protocol] account@asset", s)
+	}
+
+	target := &directTarget{}
+	if len(fields) == 2 {
+		if _, ok := p2p[fields[0]]; !ok {
+			return nil, fmt.Errorf("unsupported protocol %q", fields[0])
+		}
+		target.Protocol = fields[0]
+	}
+
+	t := fields[len(fields)-1]
+	if asset, account, ok := strings.Cut(t, "#"); ok {
+		target.Asset, target.Account = asset, account
+	} else if account, asset, ok := strings.Cut(t, "@"); ok {
+		target.Asset, target.Account = asset, account
+	} else {
+		target.Asset = t
+	}
+	if target.Asset == "" {
+		return nil, fmt.Errorf("invalid target %q, asset is required", s)
+	}
+
+	return target, nil
+}
+
+// sessionTarget returns the target given at login or as the command, nil means the interactive picker
+func sessionTarget(sess ssh.Session) (*directTarget, error) {
+	if target, ok := sess.Context().Value("target").(*directTarget); ok && target != nil {
+		return target, nil
+	}
+	if cmd := strings.TrimSpace(sess.RawCommand()); cmd != "" {
+		return parseTarget(cmd)
+	}
+	return nil, nil
+}
+
+// resolve finds the authorized asset, account and port of the target
+func (t *directTarget) resolve(ctx *gin.Context, currentUser *acl.Session) (*model.Asset, *model.Account, string, error) {
+	targets, err := authorizedTargets(ctx, currentUser)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	return myConnector.ResolveTarget(targets, t.Asset, t.Account, lo.Ternary(t.Protocol == "", "ssh", t.Protocol))
+}
+
+// execTarget returns the target and the command of a non-interactive session.
+// The command follows the target given at login, or is given as <target> -- <command>.
+func execTarget(sess ssh.Session) (*directTarget, string, error) {
+	raw := strings.TrimSpace(sess.RawCommand())
+	if target, ok := sess.Context().Value("target").(*directTarget); ok && target != nil {
+		if raw == "" {
+			return nil, "", fmt.Errorf("empty command")
+		}
+		return target, raw, nil
+	}
+
+	t, cmd, ok := strings.Cut(raw, " -- ")
+	if !ok || strings.TrimSpace(cmd) == "" {
+		return nil, "", fmt.Errorf("invalid command %q, expected <asset> -- <command>", raw)
+	}
+	target, err := parseTarget(t)
+	if err != nil {
+		return nil, "", err
+	}
+	return target, strings.TrimSpace(cmd), nil
+}
+
+// targetContext resolves the target and returns a copy of ctx with the params DoConnect and DoExec expect
+func targetContext(ctx *gin.Context, sess ssh.Session, target *directTarget, w, h int) (*gin.Context, error) {
+	currentUser, _ := acl.GetSessionFromCtx(ctx)
+	asset, account, protocol, err := target.resolve(ctx, currentUser)
+	if err != nil {
+		return nil, err
+	}
+
+	newCtx := myConnector.NewGinContext(sess.RemoteAddr(), fmt.Sprintf("w=%d&h=%d", w, h), currentUser)
+	newCtx.Params = gin.Params{
+		{Key: "account_id", Value: cast.ToString(account.Id)},
+		{Key: "asset_id", Value: cast.ToString(asset.Id)},
+		{Key: "protocol", Value: protocol},
+	}
+
+	return newCtx, nil
+}
+
+// connectTarget connects the ssh session straight to the target through DoConnect
+func connectTarget(ctx *gin.Context, sess ssh.Session, target *directTarget) error {
+	pty, _, _ := sess.Pty()
+	newCtx, err := targetContext(ctx, sess, target, pty.Window.Width, pty.Window.Height)
+	if err != nil {
+		return err
+	}
+
+	conn := &connector{Ctx: newCtx, Sess: sess, gctx: sess.Context()}
+	conn.SetStdin(sess)
+	conn.SetStdout(sess)
+	conn.SetStderr(sess.Stderr())
+
+	return conn.Run()
+}
+
+// execTargetCommand runs the command on the target through DoExec and returns the exit status
+func execTargetCommand(ctx *gin.Context, sess ssh.Session, target *directTarget, command string) (int, error) {
+	newCtx, err := targetContext(ctx, sess, target, 80, 24)
+	if err != nil {
+		return 1, err
+	}
+
+	return myConnector.DoExec(newCtx, command, sess, sess, sess.Stderr())
+}
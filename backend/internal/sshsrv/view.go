@@ -55,6 +55,9 @@ var (
 		"mysql":      3306,
 		"mongodb":    27017,
 		"postgresql": 5432,
+		"mssql":      1433,
+		"oracle":     1521,
+		"clickhouse": 9000,
 		"telnet":     23,
 	}
 )
@@ -302,7 +305,7 @@ func (m *view) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				if strings.Contains(cmd, "@") {
 					suggestion = "\n💪 Try: ssh " + cmd + " (if connecting via SSH)"
 				} else {
-					suggestion = "\n💪 Available commands: ssh, mysql, redis, mongodb, postgresql, telnet, help, list, exit"
+					suggestion = "\n💪 Available commands: ssh, mysql, redis, mongodb, postgresql, mssql, oracle, clickhouse, telnet, help, list, exit"
 				}
 				return m, tea.Sequence(
 					hisCmd,
@@ -527,6 +530,9 @@ func (m *view) helpText() string {
   • redis user@host      - Connect to Redis server
   • mongodb user@host    - Connect to MongoDB database
   • postgresql user@host - Connect to PostgreSQL database
+  • mssql user@host      - Connect to SQL Server database
+  • oracle user@host     - Connect to Oracle database
+  • clickhouse user@host - Connect to ClickHouse database
   • telnet user@host     - Connect via Telnet
   • list/ls/table        - Show assets in interactive table
   • recent or r or \r    - Show recent sessions with last login time
@@ -653,48 +659,68 @@ func (m *view) assetOverview() string {
 	return lipgloss.NewStyle().PaddingTop(1).Render(fullTip)
 }
 
-func (m *view) refresh() {
-	eg := &errgroup.Group{}
-	eg.Go(func() (err error) {
-		assets, err := repository.GetAllFromCacheDb(m.gctx, model.DefaultAsset)
-		if err != nil {
+// authorizedTargets returns assets and accounts the current user has connect permission for
+func authorizedTargets(ctx *gin.Context, currentUser *acl.Session) (targets []*myConnector.Target, err error) {
+	assets, err := repository.GetAllFromCacheDb(ctx, model.DefaultAsset)
+	if err != nil {
+		return
+	}
+	accounts, err := repository.GetAllFromCacheDb(ctx, model.DefaultAccount)
+	if err != nil {
+		return
+	}
+	if !acl.IsAdmin(currentUser) {
+		var assetIds, accountIds []int
+
+		// Use V2 authorization system for asset filtering
+		authV2Service := service.NewAuthorizationV2Service()
+		if _, assetIds, _, err = authV2Service.GetAuthorizationScopeByACL(ctx); err != nil {
 			return
 		}
-		accounts, err := repository.GetAllFromCacheDb(m.gctx, model.DefaultAccount)
-		if err != nil {
+		assets = lo.Filter(assets, func(a *model.Asset, _ int) bool { return lo.Contains(assetIds, a.Id) })
+
+		if accountIds, err = controller.GetAccountIdsByAuthorization(ctx); err != nil {
 			return
 		}
-		if !acl.IsAdmin(m.currentUser) {
-			var assetIds, accountIds []int
+		accounts = lo.Filter(accounts, func(a *model.Account, _ int) bool { return lo.Contains(accountIds, a.Id) })
+	}
 
-			// Use V2 authorization system for asset filtering
-			authV2Service := service.NewAuthorizationV2Service()
-			if _, assetIds, _, err = authV2Service.GetAuthorizationScopeByACL(m.Ctx); err != nil {
-				return
+	accountMap := lo.SliceToMap(accounts, func(a *model.Account) (int, *model.Account) { return a.Id, a })
+
+	for _, asset := range assets {
+		target := &myConnector.Target{Asset: asset}
+		for accountId, authData := range asset.Authorization {
+			account, ok := accountMap[accountId]
+			if !ok {
+				continue
 			}
-			assets = lo.Filter(assets, func(a *model.Asset, _ int) bool { return lo.Contains(assetIds, a.Id) })
 
-			if accountIds, err = controller.GetAccountIdsByAuthorization(m.Ctx); err != nil {
-				return
+			// Check if this account has connect permission
+			if authData.Permissions == nil || !authData.Permissions.Connect {
+				continue
 			}
-			accounts = lo.Filter(accounts, func(a *model.Account, _ int) bool { return lo.Contains(accountIds, a.Id) })
+			target.Accounts = append(target.Accounts, account)
 		}
+		if len(target.Accounts) > 0 {
+			targets = append(targets, target)
+		}
+	}
 
-		accountMap := lo.SliceToMap(accounts, func(a *model.Account) (int, *model.Account) { return a.Id, a })
-
-		m.combines = make(map[string][3]int)
-		for _, asset := range assets {
-			for accountId, authData := range asset.Authorization {
-				account, ok := accountMap[accountId]
-				if !ok {
-					continue
-				}
+	return
+}
 
-				// Check if this account has connect permission
-				if authData.Permissions == nil || !authData.Permissions.Connect {
-					continue
-				}
+func (m *view) refresh() {
+	eg := &errgroup.Group{}
+	eg.Go(func() (err error) {
+		targets, err := authorizedTargets(m.Ctx, m.currentUser)
+		if err != nil {
+			return
+		}
 
+		m.combines = make(map[string][3]int)
+		for _, target := range targets {
+			asset := target.Asset
+			for _, account := range target.Accounts {
 				for _, p := range asset.Protocols {
 					ss := strings.Split(p, ":")
 					if len(ss) != 2 {
@@ -853,7 +879,9 @@ func (conn *connector) Run() error {
 		return err
 	}
 
-	conn.Vw.magicn()
+	if conn.Vw != nil {
+		conn.Vw.magicn()
+	}
 
 	r, w := io.Pipe()
 	go func() {
@@ -889,6 +917,7 @@ func (conn *connector) Run() error {
 			case <-gsess.Gctx.Done():
 				return
 			case w := <-ch:
+				gsess.SetWindow(w.Width, w.Height)
 				// Non-blocking send to WindowChan
 				// Some protocols (like telnet) don't handle window changes
 				select {
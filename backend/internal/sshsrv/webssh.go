@@ -121,6 +121,7 @@ func createWebSSHSession(ctx *gin.Context, ws *websocket.Conn, currentUser *acl.
 
 	sess.SshParser = gsession.NewParser(sess.SessionId, w, h)
 	sess.SshParser.Protocol = sess.Protocol
+	sess.SshParser.Driver = sess.Collab.Controller
 
 	// Initialize SSH recorder
 	if recorder, err := gsession.NewAsciinema(sess.SessionId, w, h); err == nil {
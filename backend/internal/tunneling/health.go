@@ -0,0 +1,60 @@
+package tunneling
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/veops/oneterm/internal/model"
+)
+
+var (
+	// gatewayHealth holds the latest health check of every gateway by id
+	gatewayHealth = sync.Map{}
+)
+
+// CheckGateway dials the chain of the gateway hop by hop with fresh clients and records the health of every hop.
+// Hops after the first unreachable one are reported unhealthy without being dialed.
+func CheckGateway(gateway *model.Gateway) []*model.GatewayHop {
+	hops := make([]*model.GatewayHop, 0)
+	clients := make([]*ssh.Client, 0)
+	defer func() {
+		for i := len(clients) - 1; i >= 0; i-- {
+			clients[i].Close()
+		}
+	}()
+
+	var parent *ssh.Client
+	failed := ""
+	for _, g := range gateway.Chain() {
+		hop := &model.GatewayHop{Id: g.Id, Name: g.Name, Host: g.Host, Port: g.Port, CheckedAt: time.Now()}
+		if failed != "" {
+			hop.Error = fmt.Sprintf("unreachable, previous hop %s is down", failed)
+		} else {
+			start := time.Now()
+			sshCli, err := DefaultManager.dialGateway(parent, g)
+			hop.Latency = time.Since(start).Milliseconds()
+			if err != nil {
+				hop.Error, failed = err.Error(), g.Name
+			} else {
+				hop.Healthy = true
+				clients = append(clients, sshCli)
+				parent = sshCli
+			}
+		}
+		gatewayHealth.Store(g.Id, hop)
+		hops = append(hops, hop)
+	}
+
+	return hops
+}
+
+// GetGatewayHealth returns the latest health check of the gateway, nil if it has not been checked yet
+func GetGatewayHealth(id int) *model.GatewayHop {
+	if v, ok := gatewayHealth.Load(id); ok {
+		return v.(*model.GatewayHop)
+	}
+	return nil
+}
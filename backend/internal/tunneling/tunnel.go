@@ -9,10 +9,12 @@ import (
 	"sync"
 	"time"
 
+	"github.com/samber/lo"
 	"github.com/spf13/cast"
 	"go.uber.org/zap"
 	"golang.org/x/crypto/ssh"
 
+	"github.com/veops/oneterm/internal/hostkey"
 	"github.com/veops/oneterm/internal/model"
 	"github.com/veops/oneterm/pkg/logger"
 )
@@ -21,6 +23,7 @@ import (
 type GatewayTunnel struct {
 	listener   net.Listener
 	GatewayId  int
+	GatewayIds []int // Hops of the gateway chain, the first one is dialed directly
 	SessionId  string
 	LocalIp    string
 	LocalPort  int
@@ -104,30 +107,14 @@ func (tm *TunnelManager) OpenTunnel(isConnectable bool, sessionId, remoteIp stri
 	tm.mtx.Lock()
 	defer tm.mtx.Unlock()
 
-	sshCli, ok := tm.sshClients[gateway.Id]
-	if !ok {
-		auth, err := tm.getAuthMethod(gateway)
-		if err != nil {
-			return nil, err
-		}
-
-		sshCli, err = ssh.Dial("tcp", fmt.Sprintf("%s:%d", gateway.Host, gateway.Port), &ssh.ClientConfig{
-			User:            gateway.Account,
-			Auth:            []ssh.AuthMethod{auth},
-			Timeout:         time.Second,
-			HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-		})
-		if err != nil {
-			logger.L().Error("open gateway sshcli failed", zap.Int("gatewayId", gateway.Id), zap.Error(err))
-			return nil, err
-		}
-		go func() {
-			logger.L().Debug("ssh proxy wait closed", zap.Int("gatewayId", gateway.Id), zap.Error(sshCli.Wait()))
-			delete(tm.sshClients, gateway.Id)
-		}()
+	sshCli, err := tm.getClient(gateway)
+	if err != nil {
+		return nil, err
+	}
+	gatewayIds := lo.Map(gateway.Chain(), func(g *model.Gateway, _ int) int { return g.Id })
+	for _, id := range gatewayIds {
+		tm.sshClientsCount[id] += 1
 	}
-	tm.sshClients[gateway.Id] = sshCli
-	tm.sshClientsCount[gateway.Id] += 1
 
 	localPort, err := getAvailablePort()
 	if err != nil {
@@ -142,6 +129,7 @@ func (tm *TunnelManager) OpenTunnel(isConnectable bool, sessionId, remoteIp stri
 	g := &GatewayTunnel{
 		listener:   listener,
 		GatewayId:  gateway.Id,
+		GatewayIds: gatewayIds,
 		SessionId:  sessionId,
 		LocalIp:    "localhost",
 		LocalPort:  localPort,
@@ -171,13 +159,17 @@ func (tm *TunnelManager) CloseTunnels(sessionIds ...string) {
 			continue
 		}
 
-		tm.sshClientsCount[gt.GatewayId] -= 1
-		if tm.sshClientsCount[gt.GatewayId] <= 0 {
-			if g := tm.sshClients[gt.GatewayId]; g != nil {
-				g.Close()
+		// Release hops from the last one as inner clients are tunneled through outer ones
+		for i := len(gt.GatewayIds) - 1; i >= 0; i-- {
+			id := gt.GatewayIds[i]
+			tm.sshClientsCount[id] -= 1
+			if tm.sshClientsCount[id] <= 0 {
+				if g := tm.sshClients[id]; g != nil {
+					g.Close()
+				}
+				delete(tm.sshClients, id)
+				delete(tm.sshClientsCount, id)
 			}
-			delete(tm.sshClients, gt.GatewayId)
-			delete(tm.sshClientsCount, gt.GatewayId)
 		}
 
 		// Close and delete tunnel
@@ -194,6 +186,69 @@ func (tm *TunnelManager) CloseTunnels(sessionIds ...string) {
 	}
 }
 
+// getClient returns the client of the gateway, hops of its chain which are not connected yet are dialed in order
+func (tm *TunnelManager) getClient(gateway *model.Gateway) (*ssh.Client, error) {
+	if sshCli, ok := tm.sshClients[gateway.Id]; ok {
+		return sshCli, nil
+	}
+
+	var parent *ssh.Client
+	if gateway.Parent != nil {
+		var err error
+		if parent, err = tm.getClient(gateway.Parent); err != nil {
+			return nil, err
+		}
+	}
+
+	sshCli, err := tm.dialGateway(parent, gateway)
+	if err != nil {
+		logger.L().Error("open gateway sshcli failed", zap.Int("gatewayId", gateway.Id), zap.Error(err))
+		return nil, err
+	}
+	go func() {
+		logger.L().Debug("ssh proxy wait closed", zap.Int("gatewayId", gateway.Id), zap.Error(sshCli.Wait()))
+		tm.mtx.Lock()
+		defer tm.mtx.Unlock()
+		if tm.sshClients[gateway.Id] == sshCli {
+			delete(tm.sshClients, gateway.Id)
+		}
+	}()
+	tm.sshClients[gateway.Id] = sshCli
+
+	return sshCli, nil
+}
+
+// dialGateway dials the gateway directly, or through the client of its parent gateway if there is one
+func (tm *TunnelManager) dialGateway(parent *ssh.Client, gateway *model.Gateway) (*ssh.Client, error) {
+	auth, err := tm.getAuthMethod(gateway)
+	if err != nil {
+		return nil, err
+	}
+
+	addr := fmt.Sprintf("%s:%d", gateway.Host, gateway.Port)
+	cfg := hostkey.Apply(&ssh.ClientConfig{
+		User:    gateway.Account,
+		Auth:    []ssh.AuthMethod{auth},
+		Timeout: time.Second,
+	}, model.KnownHostTargetGateway, gateway.Id)
+	if parent == nil {
+		return ssh.Dial("tcp", addr, cfg)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+	conn, err := parent.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, cfg)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
 // getAuthMethod gets SSH authentication method based on gateway config
 func (tm *TunnelManager) getAuthMethod(gateway *model.Gateway) (ssh.AuthMethod, error) {
 	switch gateway.AccountType {
@@ -267,10 +322,18 @@ func Proxy(isConnectable bool, sessionId string, protocol string, asset *model.A
 		return
 	}
 
+	return ProxyAddr(isConnectable, sessionId, ip, port, gateway)
+}
+
+// ProxyAddr returns the local address of a tunnel to ip:port through the gateway, or ip:port itself without gateway
+func ProxyAddr(isConnectable bool, sessionId string, ip string, port int, gateway *model.Gateway) (string, int, error) {
+	if gateway == nil {
+		return ip, port, nil
+	}
+
 	g, err := OpenTunnel(isConnectable, sessionId, ip, port, gateway)
 	if err != nil {
-		return
+		return "", 0, err
 	}
-	ip, port = g.LocalIp, g.LocalPort
-	return
+	return g.LocalIp, g.LocalPort, nil
 }
@@ -0,0 +1,75 @@
+// Package asciicast reads asciicast v2 recordings and renders them to text transcripts, GIF and MP4 videos
+// without external tools.
+package asciicast
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Header is the first line of an asciicast v2 recording
+type Header struct {
+	Version   int     `json:"version"`
+	Width     int     `json:"width"`
+	Height    int     `json:"height"`
+	Timestamp int64   `json:"timestamp"`
+	Duration  float64 `json:"duration"`
+	Title     string  `json:"title"`
+}
+
+// Event is an output "o", input "i" or resize "r" event of a recording
+type Event struct {
+	Time float64
+	Type string
+	Data string
+}
+
+// Reader reads the header and events of a recording
+type Reader struct {
+	Header  Header
+	scanner *bufio.Scanner
+}
+
+// NewReader reads the header of a recording, lines which are not events are skipped by Next
+func NewReader(r io.Reader) (*Reader, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("empty recording")
+	}
+
+	reader := &Reader{scanner: scanner}
+	if err := json.Unmarshal(scanner.Bytes(), &reader.Header); err != nil {
+		return nil, fmt.Errorf("invalid recording header: %w", err)
+	}
+	if reader.Header.Width <= 0 || reader.Header.Height <= 0 {
+		reader.Header.Width, reader.Header.Height = 80, 24
+	}
+
+	return reader, nil
+}
+
+// Next returns the next event, io.EOF at the end of the recording
+func (r *Reader) Next() (*Event, error) {
+	for r.scanner.Scan() {
+		raw := [3]any{}
+		if err := json.Unmarshal(r.scanner.Bytes(), &raw); err != nil {
+			continue
+		}
+		t, ok1 := raw[0].(float64)
+		typ, ok2 := raw[1].(string)
+		data, ok3 := raw[2].(string)
+		if ok1 && ok2 && ok3 {
+			return &Event{Time: t, Type: typ, Data: data}, nil
+		}
+	}
+	if err := r.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
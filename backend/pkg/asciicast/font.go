@@ -0,0 +1,161 @@
+package asciicast
+
+import (
+	"image"
+)
+
+const (
+	// cellWidth and cellHeight are the pixels of a character, glyphs are 8x8 with doubled rows
+	cellWidth  = 8
+	cellHeight = 16
+)
+
+// glyphs is the public domain font8x8_basic for ' ' to '~', bit 0 of a row is its leftmost pixel
+var glyphs = [95][8]byte{
+	{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+	{0x18, 0x3C, 0x3C, 0x18, 0x18, 0x00, 0x18, 0x00},
+	{0x36, 0x36, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+	{0x36, 0x36, 0x7F, 0x36, 0x7F, 0x36, 0x36, 0x00},
+	{0x0C, 0x3E, 0x03, 0x1E, 0x30, 0x1F, 0x0C, 0x00},
+	{0x00, 0x63, 0x33, 0x18, 0x0C, 0x66, 0x63, 0x00},
+	{0x1C, 0x36, 0x1C, 0x6E, 0x3B, 0x33, 0x6E, 0x00},
+	{0x06, 0x06, 0x03, 0x00, 0x00, 0x00, 0x00, 0x00},
+	{0x18, 0x0C, 0x06, 0x06, 0x06, 0x0C, 0x18, 0x00},
+	{0x06, 0x0C, 0x18, 0x18, 0x18, 0x0C, 0x06, 0x00},
+	{0x00, 0x66, 0x3C, 0xFF, 0x3C, 0x66, 0x00, 0x00},
+	{0x00, 0x0C, 0x0C, 0x3F, 0x0C, 0x0C, 0x00, 0x00},
+	{0x00, 0x00, 0x00, 0x00, 0x00, 0x0C, 0x0C, 0x06},
+	{0x00, 0x00, 0x00, 0x3F, 0x00, 0x00, 0x00, 0x00},
+	{0x00, 0x00, 0x00, 0x00, 0x00, 0x0C, 0x0C, 0x00},
+	{0x60, 0x30, 0x18, 0x0C, 0x06, 0x03, 0x01, 0x00},
+	{0x3E, 0x63, 0x73, 0x7B, 0x6F, 0x67, 0x3E, 0x00},
+	{0x0C, 0x0E, 0x0C, 0x0C, 0x0C, 0x0C, 0x3F, 0x00},
+	{0x1E, 0x33, 0x30, 0x1C, 0x06, 0x33, 0x3F, 0x00},
+	{0x1E, 0x33, 0x30, 0x1C, 0x30, 0x33, 0x1E, 0x00},
+	{0x38, 0x3C, 0x36, 0x33, 0x7F, 0x30, 0x78, 0x00},
+	{0x3F, 0x03, 0x1F, 0x30, 0x30, 0x33, 0x1E, 0x00},
+	{0x1C, 0x06, 0x03, 0x1F, 0x33, 0x33, 0x1E, 0x00},
+	{0x3F, 0x33, 0x30, 0x18, 0x0C, 0x0C, 0x0C, 0x00},
+	{0x1E, 0x33, 0x33, 0x1E, 0x33, 0x33, 0x1E, 0x00},
+	{0x1E, 0x33, 0x33, 0x3E, 0x30, 0x18, 0x0E, 0x00},
+	{0x00, 0x0C, 0x0C, 0x00, 0x00, 0x0C, 0x0C, 0x00},
+	{0x00, 0x0C, 0x0C, 0x00, 0x00, 0x0C, 0x0C, 0x06},
+	{0x18, 0x0C, 0x06, 0x03, 0x06, 0x0C, 0x18, 0x00},
+	{0x00, 0x00, 0x3F, 0x00, 0x00, 0x3F, 0x00, 0x00},
+	{0x06, 0x0C, 0x18, 0x30, 0x18, 0x0C, 0x06, 0x00},
+	{0x1E, 0x33, 0x30, 0x18, 0x0C, 0x00, 0x0C, 0x00},
+	{0x3E, 0x63, 0x7B, 0x7B, 0x7B, 0x03, 0x1E, 0x00},
+	{0x0C, 0x1E, 0x33, 0x33, 0x3F, 0x33, 0x33, 0x00},
+	{0x3F, 0x66, 0x66, 0x3E, 0x66, 0x66, 0x3F, 0x00},
+	{0x3C, 0x66, 0x03, 0x03, 0x03, 0x66, 0x3C, 0x00},
+	{0x1F, 0x36, 0x66, 0x66, 0x66, 0x36, 0x1F, 0x00},
+	{0x7F, 0x46, 0x16, 0x1E, 0x16, 0x46, 0x7F, 0x00},
+	{0x7F, 0x46, 0x16, 0x1E, 0x16, 0x06, 0x0F, 0x00},
+	{0x3C, 0x66, 0x03, 0x03, 0x73, 0x66, 0x7C, 0x00},
+	{0x33, 0x33, 0x33, 0x3F, 0x33, 0x33, 0x33, 0x00},
+	{0x1E, 0x0C, 0x0C, 0x0C, 0x0C, 0x0C, 0x1E, 0x00},
+	{0x78, 0x30, 0x30, 0x30, 0x33, 0x33, 0x1E, 0x00},
+	{0x67, 0x66, 0x36, 0x1E, 0x36, 0x66, 0x67, 0x00},
+	{0x0F, 0x06, 0x06, 0x06, 0x46, 0x66, 0x7F, 0x00},
+	{0x63, 0x77, 0x7F, 0x7F, 0x6B, 0x63, 0x63, 0x00},
+	{0x63, 0x67, 0x6F, 0x7B, 0x73, 0x63, 0x63, 0x00},
+	{0x1C, 0x36, 0x63, 0x63, 0x63, 0x36, 0x1C, 0x00},
+	{0x3F, 0x66, 0x66, 0x3E, 0x06, 0x06, 0x0F, 0x00},
+	{0x1E, 0x33, 0x33, 0x33, 0x3B, 0x1E, 0x38, 0x00},
+	{0x3F, 0x66, 0x66, 0x3E, 0x36, 0x66, 0x67, 0x00},
+	{0x1E, 0x33, 0x07, 0x0E, 0x38, 0x33, 0x1E, 0x00},
+	{0x3F, 0x2D, 0x0C, 0x0C, 0x0C, 0x0C, 0x1E, 0x00},
+	{0x33, 0x33, 0x33, 0x33, 0x33, 0x33, 0x3F, 0x00},
+	{0x33, 0x33, 0x33, 0x33, 0x33, 0x1E, 0x0C, 0x00},
+	{0x63, 0x63, 0x63, 0x6B, 0x7F, 0x77, 0x63, 0x00},
+	{0x63, 0x63, 0x36, 0x1C, 0x1C, 0x36, 0x63, 0x00},
+	{0x33, 0x33, 0x33, 0x1E, 0x0C, 0x0C, 0x1E, 0x00},
+	{0x7F, 0x63, 0x31, 0x18, 0x4C, 0x66, 0x7F, 0x00},
+	{0x1E, 0x06, 0x06, 0x06, 0x06, 0x06, 0x1E, 0x00},
+	{0x03, 0x06, 0x0C, 0x18, 0x30, 0x60, 0x40, 0x00},
+	{0x1E, 0x18, 0x18, 0x18, 0x18, 0x18, 0x1E, 0x00},
+	{0x08, 0x1C, 0x36, 0x63, 0x00, 0x00, 0x00, 0x00},
+	{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xFF},
+	{0x0C, 0x0C, 0x18, 0x00, 0x00, 0x00, 0x00, 0x00},
+	{0x00, 0x00, 0x1E, 0x30, 0x3E, 0x33, 0x6E, 0x00},
+	{0x07, 0x06, 0x06, 0x3E, 0x66, 0x66, 0x3B, 0x00},
+	{0x00, 0x00, 0x1E, 0x33, 0x03, 0x33, 0x1E, 0x00},
+	{0x38, 0x30, 0x30, 0x3E, 0x33, 0x33, 0x6E, 0x00},
+	{0x00, 0x00, 0x1E, 0x33, 0x3F, 0x03, 0x1E, 0x00},
+	{0x1C, 0x36, 0x06, 0x0F, 0x06, 0x06, 0x0F, 0x00},
+	{0x00, 0x00, 0x6E, 0x33, 0x33, 0x3E, 0x30, 0x1F},
+	{0x07, 0x06, 0x36, 0x6E, 0x66, 0x66, 0x67, 0x00},
+	{0x0C, 0x00, 0x0E, 0x0C, 0x0C, 0x0C, 0x1E, 0x00},
+	{0x30, 0x00, 0x30, 0x30, 0x30, 0x33, 0x33, 0x1E},
+	{0x07, 0x06, 0x66, 0x36, 0x1E, 0x36, 0x67, 0x00},
+	{0x0E, 0x0C, 0x0C, 0x0C, 0x0C, 0x0C, 0x1E, 0x00},
+	{0x00, 0x00, 0x33, 0x7F, 0x7F, 0x6B, 0x63, 0x00},
+	{0x00, 0x00, 0x1F, 0x33, 0x33, 0x33, 0x33, 0x00},
+	{0x00, 0x00, 0x1E, 0x33, 0x33, 0x33, 0x1E, 0x00},
+	{0x00, 0x00, 0x3B, 0x66, 0x66, 0x3E, 0x06, 0x0F},
+	{0x00, 0x00, 0x6E, 0x33, 0x33, 0x3E, 0x30, 0x78},
+	{0x00, 0x00, 0x3B, 0x6E, 0x66, 0x06, 0x0F, 0x00},
+	{0x00, 0x00, 0x3E, 0x03, 0x1E, 0x30, 0x1F, 0x00},
+	{0x08, 0x0C, 0x3E, 0x0C, 0x0C, 0x2C, 0x18, 0x00},
+	{0x00, 0x00, 0x33, 0x33, 0x33, 0x33, 0x6E, 0x00},
+	{0x00, 0x00, 0x33, 0x33, 0x33, 0x1E, 0x0C, 0x00},
+	{0x00, 0x00, 0x63, 0x6B, 0x7F, 0x7F, 0x36, 0x00},
+	{0x00, 0x00, 0x63, 0x36, 0x1C, 0x36, 0x63, 0x00},
+	{0x00, 0x00, 0x33, 0x33, 0x33, 0x3E, 0x30, 0x1F},
+	{0x00, 0x00, 0x3F, 0x19, 0x0C, 0x26, 0x3F, 0x00},
+	{0x38, 0x0C, 0x0C, 0x07, 0x0C, 0x0C, 0x38, 0x00},
+	{0x18, 0x18, 0x18, 0x00, 0x18, 0x18, 0x18, 0x00},
+	{0x07, 0x0C, 0x0C, 0x38, 0x0C, 0x0C, 0x07, 0x00},
+	{0x6E, 0x3B, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+}
+
+// boxLines are the left, right, up and down strokes of box drawing characters
+var boxLines = map[rune][4]bool{
+	'─': {true, true, false, false}, '━': {true, true, false, false}, '═': {true, true, false, false},
+	'│': {false, false, true, true}, '┃': {false, false, true, true}, '║': {false, false, true, true},
+	'┌': {false, true, false, true}, '╔': {false, true, false, true}, '╭': {false, true, false, true},
+	'┐': {true, false, false, true}, '╗': {true, false, false, true}, '╮': {true, false, false, true},
+	'└': {false, true, true, false}, '╚': {false, true, true, false}, '╰': {false, true, true, false},
+	'┘': {true, false, true, false}, '╝': {true, false, true, false}, '╯': {true, false, true, false},
+	'├': {false, true, true, true}, '╠': {false, true, true, true},
+	'┤': {true, false, true, true}, '╣': {true, false, true, true},
+	'┬': {true, true, false, true}, '╦': {true, true, false, true},
+	'┴': {true, true, true, false}, '╩': {true, true, true, false},
+	'┼': {true, true, true, true}, '╬': {true, true, true, true},
+}
+
+// drawGlyph draws r with fg over bg into the cell of width cells at pixel x, y
+func drawGlyph(img *image.Paletted, x, y, width int, r rune, fg, bg uint8, underline bool) {
+	w := width * cellWidth
+	on := func(px, py int) bool {
+		switch {
+		case underline && py == cellHeight-1:
+			return true
+		case r >= ' ' && r <= '~':
+			return glyphs[r-' '][py/2]&(1<<(px*8/w)) != 0
+		case r == '█':
+			return true
+		case r == '▀':
+			return py < cellHeight/2
+		case r == '▄':
+			return py >= cellHeight/2
+		case r == '░', r == '▒', r == '▓':
+			return (px+py)%(4-int(r-'░')) == 0
+		}
+		if lines, ok := boxLines[r]; ok {
+			cx, cy := w/2, cellHeight/2
+			return (py == cy && ((lines[0] && px <= cx) || (lines[1] && px >= cx))) ||
+				(px == cx && ((lines[2] && py <= cy) || (lines[3] && py >= cy)))
+		}
+		// glyphs out of the font are drawn as boxes
+		return r != ' ' && py >= 2 && py <= cellHeight-3 && px >= 1 && px <= w-2 &&
+			(py == 2 || py == cellHeight-3 || px == 1 || px == w-2)
+	}
+
+	bounds := img.Bounds()
+	for py := 0; py < cellHeight && y+py < bounds.Max.Y; py++ {
+		for px := 0; px < w && x+px < bounds.Max.X; px++ {
+			img.Pix[img.PixOffset(x+px, y+py)] = ternary(on(px, py), fg, bg)
+		}
+	}
+}
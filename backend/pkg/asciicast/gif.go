@@ -0,0 +1,144 @@
+package asciicast
+
+import (
+	"bufio"
+	"compress/lzw"
+	"encoding/binary"
+	"image"
+	"io"
+	"math"
+)
+
+// RenderGIF renders a recording to an animated GIF, frames are written as they are rendered
+// so the whole animation is never kept in memory
+func RenderGIF(w io.Writer, r io.Reader, opts Options) error {
+	return render(r, opts, func(width, height int) (frameWriter, error) {
+		return newGIFWriter(w, width, height)
+	})
+}
+
+// gifFrame is a pending frame, its delay is known once the next frame arrives
+type gifFrame struct {
+	rect image.Rectangle
+	pix  []byte
+	t    float64
+}
+
+type gifWriter struct {
+	w       *bufio.Writer
+	pending *gifFrame
+}
+
+func newGIFWriter(w io.Writer, width, height int) (*gifWriter, error) {
+	g := &gifWriter{w: bufio.NewWriterSize(w, 64*1024)}
+
+	header := []byte("GIF89a")
+	header = binary.LittleEndian.AppendUint16(header, uint16(width))
+	header = binary.LittleEndian.AppendUint16(header, uint16(height))
+	// global color table of 256 colors
+	header = append(header, 0xf7, 0, 0)
+	for _, c := range palette {
+		r, g, b, _ := c.RGBA()
+		header = append(header, uint8(r>>8), uint8(g>>8), uint8(b>>8))
+	}
+	// loop forever
+	header = append(header, 0x21, 0xff, 0x0b)
+	header = append(header, "NETSCAPE2.0"...)
+	header = append(header, 0x03, 0x01, 0x00, 0x00, 0x00)
+
+	_, err := g.w.Write(header)
+	return g, err
+}
+
+func (g *gifWriter) WriteFrame(img *image.Paletted, rect image.Rectangle, t float64) error {
+	if err := g.flush(t); err != nil {
+		return err
+	}
+	pix := make([]byte, 0, rect.Dx()*rect.Dy())
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		i := img.PixOffset(rect.Min.X, y)
+		pix = append(pix, img.Pix[i:i+rect.Dx()]...)
+	}
+	g.pending = &gifFrame{rect: rect, pix: pix, t: t}
+	return nil
+}
+
+// flush writes the pending frame which is shown until next
+func (g *gifWriter) flush(next float64) error {
+	f := g.pending
+	if f == nil {
+		return nil
+	}
+	g.pending = nil
+
+	delay := max(math.Round(next*100)-math.Round(f.t*100), 2)
+	buf := []byte{0x21, 0xf9, 0x04, 0x04}
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(min(delay, math.MaxUint16)))
+	buf = append(buf, 0, 0, 0x2c)
+	for _, v := range []int{f.rect.Min.X, f.rect.Min.Y, f.rect.Dx(), f.rect.Dy()} {
+		buf = binary.LittleEndian.AppendUint16(buf, uint16(v))
+	}
+	buf = append(buf, 0, 8)
+	if _, err := g.w.Write(buf); err != nil {
+		return err
+	}
+
+	bw := &gifBlockWriter{w: g.w}
+	lw := lzw.NewWriter(bw, lzw.LSB, 8)
+	if _, err := lw.Write(f.pix); err != nil {
+		return err
+	}
+	if err := lw.Close(); err != nil {
+		return err
+	}
+	return bw.close()
+}
+
+func (g *gifWriter) Close(end float64) error {
+	if err := g.flush(end); err != nil {
+		return err
+	}
+	if err := g.w.WriteByte(0x3b); err != nil {
+		return err
+	}
+	return g.w.Flush()
+}
+
+// gifBlockWriter splits image data into sub-blocks of up to 255 bytes
+type gifBlockWriter struct {
+	w   *bufio.Writer
+	buf []byte
+}
+
+func (b *gifBlockWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		size := min(255-len(b.buf), len(p))
+		b.buf, p = append(b.buf, p[:size]...), p[size:]
+		if len(b.buf) == 255 {
+			if err := b.writeBlock(); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return n, nil
+}
+
+func (b *gifBlockWriter) writeBlock() error {
+	if err := b.w.WriteByte(byte(len(b.buf))); err != nil {
+		return err
+	}
+	_, err := b.w.Write(b.buf)
+	b.buf = b.buf[:0]
+	return err
+}
+
+// close writes the last sub-block and the terminator
+func (b *gifBlockWriter) close() error {
+	if len(b.buf) > 0 {
+		if err := b.writeBlock(); err != nil {
+			return err
+		}
+	}
+	return b.w.WriteByte(0)
+}
@@ -0,0 +1,184 @@
+package asciicast
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"io"
+	"math"
+)
+
+// RenderMP4 renders a recording to an MP4 video of Motion-JPEG frames.
+// Frames are written as they are rendered and the index is appended at the end, so w must be seekable
+// to patch the size of the media data.
+func RenderMP4(w io.WriteSeeker, r io.Reader, opts Options) error {
+	return render(r, opts, func(width, height int) (frameWriter, error) {
+		return newMP4Writer(w, width, height)
+	})
+}
+
+type mp4Writer struct {
+	ws     io.WriteSeeker
+	w      *bufio.Writer
+	width  int
+	height int
+	rgba   *image.RGBA
+	jpg    bytes.Buffer
+
+	offset    int64 // bytes written
+	mdatStart int64
+	times     []int64 // milliseconds
+	sizes     []uint32
+}
+
+func newMP4Writer(ws io.WriteSeeker, width, height int) (*mp4Writer, error) {
+	m := &mp4Writer{
+		ws:     ws,
+		w:      bufio.NewWriterSize(ws, 256*1024),
+		width:  width,
+		height: height,
+		rgba:   image.NewRGBA(image.Rect(0, 0, width, height)),
+	}
+
+	ftyp := mp4Box("ftyp", []byte("isom"), be32(0x200), []byte("isomiso2mp41"))
+	if err := m.write(ftyp); err != nil {
+		return nil, err
+	}
+	// the 64 bit size of the mdat box is patched when closed
+	m.mdatStart = m.offset
+	if err := m.write(be32(1), []byte("mdat"), be64(0)); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+func (m *mp4Writer) write(parts ...[]byte) error {
+	for _, p := range parts {
+		n, err := m.w.Write(p)
+		m.offset += int64(n)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *mp4Writer) WriteFrame(img *image.Paletted, rect image.Rectangle, t float64) error {
+	draw.Draw(m.rgba, rect, img, rect.Min, draw.Src)
+	m.jpg.Reset()
+	if err := jpeg.Encode(&m.jpg, m.rgba, &jpeg.Options{Quality: 90}); err != nil {
+		return err
+	}
+	m.times = append(m.times, int64(math.Round(t*1000)))
+	m.sizes = append(m.sizes, uint32(m.jpg.Len()))
+	return m.write(m.jpg.Bytes())
+}
+
+func (m *mp4Writer) Close(end float64) error {
+	mdatSize := m.offset - m.mdatStart
+	if err := m.write(m.moov(int64(math.Round(end * 1000)))); err != nil {
+		return err
+	}
+	if err := m.w.Flush(); err != nil {
+		return err
+	}
+
+	if _, err := m.ws.Seek(m.mdatStart+8, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := m.ws.Write(be64(uint64(mdatSize))); err != nil {
+		return err
+	}
+	_, err := m.ws.Seek(0, io.SeekEnd)
+	return err
+}
+
+// moov builds the movie box of a single video track whose samples are one chunk after the mdat header
+func (m *mp4Writer) moov(end int64) []byte {
+	duration := uint32(0)
+	if len(m.times) > 0 {
+		duration = uint32(max(end-m.times[0], 0))
+	}
+	matrix := concat(be32(0x10000), be32(0), be32(0), be32(0), be32(0x10000), be32(0), be32(0), be32(0), be32(0x40000000))
+
+	// sample durations, run length encoded
+	stts := []byte{}
+	entries, run, last := uint32(0), uint32(0), uint32(0)
+	for i, t := range m.times {
+		next := end
+		if i+1 < len(m.times) {
+			next = m.times[i+1]
+		}
+		delta := uint32(max(next-t, 1))
+		if run > 0 && delta != last {
+			stts, entries, run = append(stts, concat(be32(run), be32(last))...), entries+1, 0
+		}
+		run, last = run+1, delta
+	}
+	if run > 0 {
+		stts, entries = append(stts, concat(be32(run), be32(last))...), entries+1
+	}
+
+	stsz := concat(fullBox(0, 0), be32(0), be32(uint32(len(m.sizes))))
+	for _, size := range m.sizes {
+		stsz = append(stsz, be32(size)...)
+	}
+
+	name := make([]byte, 32)
+	name[0] = byte(copy(name[1:], "Photo - JPEG"))
+	sampleEntry := mp4Box("jpeg",
+		make([]byte, 6), be16(1), be16(0), be16(0), make([]byte, 12),
+		be16(uint16(m.width)), be16(uint16(m.height)), be32(0x480000), be32(0x480000),
+		be32(0), be16(1), name, be16(0x18), be16(0xffff),
+	)
+
+	stbl := mp4Box("stbl",
+		mp4Box("stsd", fullBox(0, 0), be32(1), sampleEntry),
+		mp4Box("stts", fullBox(0, 0), be32(entries), stts),
+		mp4Box("stsc", fullBox(0, 0), be32(1), be32(1), be32(uint32(len(m.sizes))), be32(1)),
+		mp4Box("stsz", stsz),
+		mp4Box("co64", fullBox(0, 0), be32(1), be64(uint64(m.mdatStart+16))),
+	)
+	minf := mp4Box("minf",
+		mp4Box("vmhd", fullBox(0, 1), make([]byte, 8)),
+		mp4Box("dinf", mp4Box("dref", fullBox(0, 0), be32(1), mp4Box("url ", fullBox(0, 1)))),
+		stbl,
+	)
+	mdia := mp4Box("mdia",
+		mp4Box("mdhd", fullBox(0, 0), be32(0), be32(0), be32(1000), be32(duration), be16(0x55c4), be16(0)),
+		mp4Box("hdlr", fullBox(0, 0), be32(0), []byte("vide"), make([]byte, 12), []byte("VideoHandler\x00")),
+		minf,
+	)
+	trak := mp4Box("trak",
+		mp4Box("tkhd", fullBox(0, 3), be32(0), be32(0), be32(1), be32(0), be32(duration), make([]byte, 8),
+			be16(0), be16(0), be16(0), be16(0), matrix, be32(uint32(m.width)<<16), be32(uint32(m.height)<<16)),
+		mdia,
+	)
+
+	return mp4Box("moov",
+		mp4Box("mvhd", fullBox(0, 0), be32(0), be32(0), be32(1000), be32(duration), be32(0x10000), be16(0x100),
+			make([]byte, 10), matrix, make([]byte, 24), be32(2)),
+		trak,
+	)
+}
+
+func mp4Box(typ string, parts ...[]byte) []byte {
+	payload := concat(parts...)
+	return concat(be32(uint32(8+len(payload))), []byte(typ), payload)
+}
+
+func fullBox(version uint8, flags uint32) []byte {
+	return be32(uint32(version)<<24 | flags)
+}
+
+func concat(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+func be16(v uint16) []byte { return binary.BigEndian.AppendUint16(nil, v) }
+func be32(v uint32) []byte { return binary.BigEndian.AppendUint32(nil, v) }
+func be64(v uint64) []byte { return binary.BigEndian.AppendUint64(nil, v) }
@@ -0,0 +1,40 @@
+package asciicast
+
+import (
+	"image/color"
+)
+
+const (
+	// defaultFg and defaultBg are the palette indexes of the default colors
+	defaultFg = 7
+	defaultBg = 0
+)
+
+// palette is the xterm 256 color palette, cells store indexes of it and frames are paletted with it
+var palette = func() color.Palette {
+	p := make(color.Palette, 0, 256)
+	for _, c := range []uint32{
+		0x000000, 0xcd0000, 0x00cd00, 0xcdcd00, 0x0000ee, 0xcd00cd, 0x00cdcd, 0xe5e5e5,
+		0x7f7f7f, 0xff0000, 0x00ff00, 0xffff00, 0x5c5cff, 0xff00ff, 0x00ffff, 0xffffff,
+	} {
+		p = append(p, color.RGBA{uint8(c >> 16), uint8(c >> 8), uint8(c), 0xff})
+	}
+	levels := []uint8{0x00, 0x5f, 0x87, 0xaf, 0xd7, 0xff}
+	for r := 0; r < 6; r++ {
+		for g := 0; g < 6; g++ {
+			for b := 0; b < 6; b++ {
+				p = append(p, color.RGBA{levels[r], levels[g], levels[b], 0xff})
+			}
+		}
+	}
+	for i := 0; i < 24; i++ {
+		v := uint8(8 + i*10)
+		p = append(p, color.RGBA{v, v, v, 0xff})
+	}
+	return p
+}()
+
+// rgbIndex returns the index of the palette color nearest to a true color
+func rgbIndex(r, g, b int) uint8 {
+	return uint8(palette.Index(color.RGBA{uint8(r), uint8(g), uint8(b), 0xff}))
+}
@@ -0,0 +1,182 @@
+package asciicast
+
+import (
+	"errors"
+	"image"
+	"io"
+)
+
+// Options controls the frames rendered from a recording
+type Options struct {
+	// FrameInterval is the minimum seconds between frames, 0.1 by default
+	FrameInterval float64
+	// MaxIdle caps the seconds a frame is shown when nothing is written, 2 by default
+	MaxIdle float64
+}
+
+// frameWriter encodes frames, rect is the area of img changed since the previous frame
+type frameWriter interface {
+	WriteFrame(img *image.Paletted, rect image.Rectangle, t float64) error
+	Close(end float64) error
+}
+
+// draw draws the cells in rect of the screen, and the cursor if it is in rect
+func (s *Screen) draw(img *image.Paletted, rect image.Rectangle) {
+	for y := rect.Min.Y; y < min(rect.Max.Y, s.rows); y++ {
+		for x := rect.Min.X; x < min(rect.Max.X, s.cols); x++ {
+			c := s.cells[y][x]
+			if c.cont {
+				continue
+			}
+			fg, bg := c.fg, c.bg
+			if c.attr&attrBold != 0 && fg < 8 {
+				fg += 8
+			}
+			if c.attr&attrReverse != 0 {
+				fg, bg = bg, fg
+			}
+			if !s.hideCursor && x == s.x && y == s.y {
+				fg, bg = bg, fg
+			}
+			width := 1
+			if x+1 < s.cols && s.cells[y][x+1].cont {
+				width = 2
+			}
+			drawGlyph(img, x*cellWidth, y*cellHeight, width, c.r, fg, bg, c.attr&attrUnderline != 0)
+		}
+	}
+}
+
+// renderer keeps the cells of the last frame to find the area changed by events
+type renderer struct {
+	screen *Screen
+	img    *image.Paletted
+	prev   [][]cell
+	cursor image.Point
+}
+
+func newRenderer(cols, rows int) *renderer {
+	cols, rows = ClampSize(cols, rows)
+	return &renderer{
+		screen: NewScreen(cols, rows),
+		img:    image.NewPaletted(image.Rect(0, 0, cols*cellWidth, rows*cellHeight), palette),
+		cursor: image.Pt(-1, -1),
+	}
+}
+
+// changed returns the cells changed since the last frame, widened by a column for wide characters
+func (r *renderer) changed() image.Rectangle {
+	s, rect := r.screen, image.Rectangle{}
+	add := func(x, y int) {
+		rect = rect.Union(image.Rect(max(x-1, 0), y, min(x+2, s.cols), y+1))
+	}
+	for y := 0; y < s.rows; y++ {
+		for x := 0; x < s.cols; x++ {
+			if y >= len(r.prev) || x >= len(r.prev[y]) || r.prev[y][x] != s.cells[y][x] {
+				add(x, y)
+			}
+		}
+	}
+	cursor := ternary(s.hideCursor, image.Pt(-1, -1), image.Pt(s.x, s.y))
+	if cursor != r.cursor {
+		if r.cursor.X >= 0 {
+			add(r.cursor.X, r.cursor.Y)
+		}
+		if cursor.X >= 0 {
+			add(cursor.X, cursor.Y)
+		}
+	}
+	return rect
+}
+
+// frame draws the changed cells and returns the changed pixels, empty if nothing changed
+func (r *renderer) frame() image.Rectangle {
+	s, rect := r.screen, r.changed()
+	if rect.Empty() {
+		return rect
+	}
+	s.draw(r.img, rect)
+
+	r.prev = make([][]cell, s.rows)
+	for y := range r.prev {
+		r.prev[y] = append([]cell(nil), s.cells[y]...)
+	}
+	r.cursor = ternary(s.hideCursor, image.Pt(-1, -1), image.Pt(s.x, s.y))
+
+	pixels := image.Rect(rect.Min.X*cellWidth, rect.Min.Y*cellHeight, rect.Max.X*cellWidth, rect.Max.Y*cellHeight)
+	return pixels.Intersect(r.img.Bounds())
+}
+
+// render plays a recording on a screen and writes a frame at most every interval while it changes.
+// Idle gaps longer than MaxIdle are shortened, so frame times are not the times of the recording.
+func render(r io.Reader, opts Options, newWriter func(width, height int) (frameWriter, error)) error {
+	if opts.FrameInterval <= 0 {
+		opts.FrameInterval = 0.1
+	}
+	if opts.MaxIdle <= 0 {
+		opts.MaxIdle = 2
+	}
+
+	reader, err := NewReader(r)
+	if err != nil {
+		return err
+	}
+	rd := newRenderer(reader.Header.Width, reader.Header.Height)
+	fw, err := newWriter(rd.img.Bounds().Dx(), rd.img.Bounds().Dy())
+	if err != nil {
+		return err
+	}
+
+	lastEmit, lastTime, lastRaw, shift := 0.0, 0.0, 0.0, 0.0
+	if err = fw.WriteFrame(rd.img, rd.frame(), 0); err != nil {
+		return err
+	}
+	emit := func(t float64) error {
+		rect := rd.frame()
+		if rect.Empty() {
+			return nil
+		}
+		lastEmit = t
+		return fw.WriteFrame(rd.img, rect, t)
+	}
+
+	for {
+		event, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if event.Type != "o" && event.Type != "r" {
+			continue
+		}
+		if gap := event.Time - lastRaw; gap > opts.MaxIdle {
+			shift += gap - opts.MaxIdle
+		}
+		lastRaw = max(lastRaw, event.Time)
+		t := max(event.Time-shift, lastTime)
+
+		if t-lastEmit >= opts.FrameInterval {
+			if err = emit(max(lastTime, lastEmit+opts.FrameInterval)); err != nil {
+				return err
+			}
+		}
+		lastTime = t
+
+		switch event.Type {
+		case "o":
+			rd.screen.Write(event.Data)
+		case "r":
+			if cols, rows, ok := ParseSize(event.Data); ok {
+				rd.screen.Resize(cols, rows)
+			}
+		}
+	}
+
+	end := max(lastTime, lastEmit+opts.FrameInterval)
+	if err = emit(end); err != nil {
+		return err
+	}
+	return fw.Close(end + 1)
+}
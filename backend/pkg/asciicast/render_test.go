@@ -0,0 +1,133 @@
+package asciicast
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/gif"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testRecording = `{"version":2,"width":20,"height":5}
+[0.1,"o","$ ls\r\n"]
+[0.5,"o","\u001b[32ma\u001b[0m  b\r\n"]
+[1.0,"r","30x6"]
+[9.0,"o","$ exit\r\n"]
+`
+
+func TestRenderGIF(t *testing.T) {
+	w := &bytes.Buffer{}
+	if err := RenderGIF(w, strings.NewReader(testRecording), Options{}); err != nil {
+		t.Fatalf("RenderGIF() error = %v", err)
+	}
+
+	g, err := gif.DecodeAll(w)
+	if err != nil {
+		t.Fatalf("decode gif: %v", err)
+	}
+	if g.Config.Width != 20*cellWidth || g.Config.Height != 5*cellHeight {
+		t.Errorf("size = %dx%d, want %dx%d", g.Config.Width, g.Config.Height, 20*cellWidth, 5*cellHeight)
+	}
+	if len(g.Image) < 3 {
+		t.Fatalf("frames = %d, want at least 3", len(g.Image))
+	}
+	total := 0
+	for _, d := range g.Delay {
+		total += d
+	}
+	// the idle gap of 8 seconds is shortened to 2
+	if total < 250 || total > 500 {
+		t.Errorf("duration = %d centiseconds, want the idle gap shortened", total)
+	}
+}
+
+func TestRenderMP4(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "replay.mp4")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := RenderMP4(f, strings.NewReader(testRecording), Options{}); err != nil {
+		t.Fatalf("RenderMP4() error = %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the top level boxes must cover the file, the size of mdat is patched to 64 bits
+	types := []string{}
+	for offset := 0; offset < len(data); {
+		if offset+16 > len(data) {
+			t.Fatalf("truncated box at %d", offset)
+		}
+		size, typ := int(binary.BigEndian.Uint32(data[offset:])), string(data[offset+4:offset+8])
+		if size == 1 {
+			size = int(binary.BigEndian.Uint64(data[offset+8:]))
+		}
+		if size < 8 || offset+size > len(data) {
+			t.Fatalf("box %s at %d has size %d of %d bytes", typ, offset, size, len(data))
+		}
+		if typ == "mdat" {
+			img, err := jpeg.Decode(bytes.NewReader(data[offset+16 : offset+size]))
+			if err != nil {
+				t.Fatalf("decode first frame: %v", err)
+			}
+			if b := img.Bounds(); b.Dx() != 20*cellWidth || b.Dy() != 5*cellHeight {
+				t.Errorf("frame size = %dx%d, want %dx%d", b.Dx(), b.Dy(), 20*cellWidth, 5*cellHeight)
+			}
+		}
+		types = append(types, typ)
+		offset += size
+	}
+	if strings.Join(types, ",") != "ftyp,mdat,moov" {
+		t.Errorf("boxes = %v, want ftyp, mdat and moov", types)
+	}
+
+	// every frame is a sample of the single chunk
+	i := bytes.Index(data, []byte("stsz"))
+	if i < 0 {
+		t.Fatal("no stsz box")
+	}
+	count := int(binary.BigEndian.Uint32(data[i+12:]))
+	sum := 0
+	for j := 0; j < count; j++ {
+		sum += int(binary.BigEndian.Uint32(data[i+16+j*4:]))
+	}
+	if mdat := int(binary.BigEndian.Uint64(data[bytes.Index(data, []byte("mdat"))+4:])); sum != mdat-16 {
+		t.Errorf("samples = %d bytes, want the %d bytes of mdat", sum, mdat-16)
+	}
+}
+
+func TestRenderHugeSize(t *testing.T) {
+	// Sizes are sent by clients, rendering must not allocate what they claim
+	recording := `{"version":2,"width":100000,"height":100000}
+[0.1,"o","$ ls\r\n"]
+[0.2,"r","100000x100000"]
+[0.3,"r","-5x0"]
+[0.4,"o","a\r\n"]
+`
+	w := &bytes.Buffer{}
+	if err := RenderGIF(w, strings.NewReader(recording), Options{}); err != nil {
+		t.Fatalf("RenderGIF() error = %v", err)
+	}
+	g, err := gif.DecodeConfig(w)
+	if err != nil {
+		t.Fatalf("decode gif: %v", err)
+	}
+	if g.Width != MaxCols*cellWidth || g.Height != MaxRows*cellHeight {
+		t.Errorf("size = %dx%d, want %dx%d", g.Width, g.Height, MaxCols*cellWidth, MaxRows*cellHeight)
+	}
+
+	s := NewScreen(100000, 100000)
+	if cols, rows := s.Size(); cols != MaxCols || rows != MaxRows {
+		t.Errorf("NewScreen() size = %dx%d, want %dx%d", cols, rows, MaxCols, MaxRows)
+	}
+	if cols, rows, ok := ParseSize("100000x3"); !ok || cols != MaxCols || rows != 3 {
+		t.Errorf("ParseSize() = %d, %d, %v", cols, rows, ok)
+	}
+}
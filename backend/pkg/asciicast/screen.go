@@ -0,0 +1,539 @@
+package asciicast
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+)
+
+const (
+	// MaxCols and MaxRows bound the size of a screen, larger sizes sent by clients are cut so replays fit in memory
+	MaxCols = 500
+	MaxRows = 200
+)
+
+const (
+	attrBold uint8 = 1 << iota
+	attrUnderline
+	attrReverse
+)
+
+const (
+	stateGround = iota
+	stateEscape
+	stateCSI
+	stateOSC
+	stateOSCEscape
+	stateCharset
+)
+
+// cell is a character on the screen with its colors, cont marks the second half of a wide character
+type cell struct {
+	r    rune
+	fg   uint8
+	bg   uint8
+	attr uint8
+	cont bool
+}
+
+// Screen is a minimal vt100/xterm emulator which keeps the cells shown by a terminal
+type Screen struct {
+	cols, rows int
+	cells      [][]cell
+	main       [][]cell // the main buffer while the alternate one is shown
+	x, y       int
+	savedX     int
+	savedY     int
+	top        int // scroll region, inclusive
+	bottom     int
+	pen        cell
+	hideCursor bool
+	wrapNext   bool
+
+	state  int
+	params strings.Builder
+}
+
+// NewScreen creates a blank screen of cols x rows
+func NewScreen(cols, rows int) *Screen {
+	s := &Screen{pen: cell{fg: defaultFg, bg: defaultBg}}
+	s.Resize(cols, rows)
+	return s
+}
+
+func (s *Screen) blank() cell {
+	return cell{r: ' ', fg: s.pen.fg, bg: s.pen.bg}
+}
+
+func newCells(cols, rows int) [][]cell {
+	cells := make([][]cell, rows)
+	for i := range cells {
+		cells[i] = make([]cell, cols)
+		for j := range cells[i] {
+			cells[i][j] = cell{r: ' ', fg: defaultFg, bg: defaultBg}
+		}
+	}
+	return cells
+}
+
+// ClampSize bounds a terminal size to at least 1 x 1 and at most MaxCols x MaxRows
+func ClampSize(cols, rows int) (int, int) {
+	return min(max(cols, 1), MaxCols), min(max(rows, 1), MaxRows)
+}
+
+// ParseSize parses the size of a resize event like 80x24, clamped by ClampSize
+func ParseSize(data string) (cols, rows int, ok bool) {
+	if _, err := fmt.Sscanf(data, "%dx%d", &cols, &rows); err != nil {
+		return 0, 0, false
+	}
+	cols, rows = ClampSize(cols, rows)
+	return cols, rows, true
+}
+
+// Resize changes the size of the screen, the top left of the content is kept.
+// The size is clamped by ClampSize.
+func (s *Screen) Resize(cols, rows int) {
+	cols, rows = ClampSize(cols, rows)
+	resize := func(old [][]cell) [][]cell {
+		cells := newCells(cols, rows)
+		for i := 0; i < min(rows, len(old)); i++ {
+			copy(cells[i], old[i])
+		}
+		return cells
+	}
+	s.cells = resize(s.cells)
+	if s.main != nil {
+		s.main = resize(s.main)
+	}
+	s.cols, s.rows = cols, rows
+	s.top, s.bottom = 0, rows-1
+	s.x, s.y = min(s.x, cols-1), min(s.y, rows-1)
+	s.savedX, s.savedY = min(s.savedX, cols-1), min(s.savedY, rows-1)
+	s.wrapNext = false
+}
+
+// Size returns the columns and rows of the screen
+func (s *Screen) Size() (int, int) {
+	return s.cols, s.rows
+}
+
+// Write feeds output of the terminal to the screen
+func (s *Screen) Write(data string) {
+	for _, c := range data {
+		switch s.state {
+		case stateEscape:
+			s.escape(c)
+		case stateCSI:
+			if c >= 0x40 && c <= 0x7e {
+				s.csi(c, s.params.String())
+				s.state = stateGround
+			} else {
+				s.params.WriteRune(c)
+			}
+		case stateOSC:
+			switch c {
+			case 0x07:
+				s.state = stateGround
+			case 0x1b:
+				s.state = stateOSCEscape
+			}
+		case stateOSCEscape:
+			s.state = ternary(c == '\\', stateGround, stateOSC)
+		case stateCharset:
+			s.state = stateGround
+		default:
+			s.ground(c)
+		}
+	}
+}
+
+func ternary[T any](cond bool, a, b T) T {
+	if cond {
+		return a
+	}
+	return b
+}
+
+func (s *Screen) ground(c rune) {
+	switch c {
+	case 0x1b:
+		s.state = stateEscape
+	case '\r':
+		s.x, s.wrapNext = 0, false
+	case '\n', '\v', '\f':
+		s.index()
+	case '\b':
+		s.x, s.wrapNext = max(s.x-1, 0), false
+	case '\t':
+		s.x = min((s.x/8+1)*8, s.cols-1)
+	default:
+		if c >= ' ' && c != 0x7f {
+			s.put(c)
+		}
+	}
+}
+
+func (s *Screen) put(c rune) {
+	w := runewidth.RuneWidth(c)
+	if w == 0 {
+		return
+	}
+	if s.wrapNext || s.x+w > s.cols {
+		s.x, s.wrapNext = 0, false
+		s.index()
+	}
+	cl := s.pen
+	cl.r = c
+	s.cells[s.y][s.x] = cl
+	if w == 2 && s.x+1 < s.cols {
+		cl.cont = true
+		s.cells[s.y][s.x+1] = cl
+	}
+	if s.x+w >= s.cols {
+		s.x, s.wrapNext = s.cols-1, true
+	} else {
+		s.x += w
+	}
+}
+
+// index moves the cursor down and scrolls the region at its bottom
+func (s *Screen) index() {
+	s.wrapNext = false
+	if s.y == s.bottom {
+		s.scrollUp(s.top, s.bottom, 1)
+	} else if s.y < s.rows-1 {
+		s.y++
+	}
+}
+
+// reverseIndex moves the cursor up and scrolls the region at its top
+func (s *Screen) reverseIndex() {
+	s.wrapNext = false
+	if s.y == s.top {
+		s.scrollDown(s.top, s.bottom, 1)
+	} else if s.y > 0 {
+		s.y--
+	}
+}
+
+// restoreCursor moves the cursor to the saved position, which is kept on the screen in case it was resized since
+func (s *Screen) restoreCursor() {
+	s.x, s.y = min(s.savedX, s.cols-1), min(s.savedY, s.rows-1)
+	s.wrapNext = false
+}
+
+func (s *Screen) blankRow() []cell {
+	row := make([]cell, s.cols)
+	for i := range row {
+		row[i] = s.blank()
+	}
+	return row
+}
+
+func (s *Screen) scrollUp(top, bottom, n int) {
+	for ; n > 0; n-- {
+		copy(s.cells[top:bottom], s.cells[top+1:bottom+1])
+		s.cells[bottom] = s.blankRow()
+	}
+}
+
+func (s *Screen) scrollDown(top, bottom, n int) {
+	for ; n > 0; n-- {
+		copy(s.cells[top+1:bottom+1], s.cells[top:bottom])
+		s.cells[top] = s.blankRow()
+	}
+}
+
+func (s *Screen) escape(c rune) {
+	s.state = stateGround
+	switch c {
+	case '[':
+		s.params.Reset()
+		s.state = stateCSI
+	case ']':
+		s.state = stateOSC
+	case '(', ')', '*', '+', '#':
+		s.state = stateCharset
+	case '7':
+		s.savedX, s.savedY = s.x, s.y
+	case '8':
+		s.restoreCursor()
+	case 'D':
+		s.index()
+	case 'E':
+		s.x = 0
+		s.index()
+	case 'M':
+		s.reverseIndex()
+	case 'c':
+		*s = *NewScreen(s.cols, s.rows)
+	}
+}
+
+func (s *Screen) csi(final rune, raw string) {
+	private := strings.HasPrefix(raw, "?")
+	raw = strings.TrimLeft(raw, "?>=<")
+	raw = strings.TrimRight(raw, " !\"#$%&'()*+,-./")
+	params := []int{}
+	for _, p := range strings.Split(raw, ";") {
+		n, _ := strconv.Atoi(strings.Split(p, ":")[0])
+		params = append(params, n)
+	}
+	arg := func(i, def int) int {
+		if i < len(params) && params[i] > 0 {
+			return params[i]
+		}
+		return def
+	}
+
+	s.wrapNext = false
+	switch final {
+	case 'A':
+		s.y = max(s.y-arg(0, 1), ternary(s.y >= s.top, s.top, 0))
+	case 'B', 'e':
+		s.y = min(s.y+arg(0, 1), ternary(s.y <= s.bottom, s.bottom, s.rows-1))
+	case 'C', 'a':
+		s.x = min(s.x+arg(0, 1), s.cols-1)
+	case 'D':
+		s.x = max(s.x-arg(0, 1), 0)
+	case 'E':
+		s.x, s.y = 0, min(s.y+arg(0, 1), s.rows-1)
+	case 'F':
+		s.x, s.y = 0, max(s.y-arg(0, 1), 0)
+	case 'G', '`':
+		s.x = min(arg(0, 1), s.cols) - 1
+	case 'd':
+		s.y = min(arg(0, 1), s.rows) - 1
+	case 'H', 'f':
+		s.x, s.y = min(arg(1, 1), s.cols)-1, min(arg(0, 1), s.rows)-1
+	case 'J':
+		s.eraseDisplay(arg(0, 0))
+	case 'K':
+		s.eraseLine(arg(0, 0))
+	case 'L':
+		if s.y >= s.top && s.y <= s.bottom {
+			s.scrollDown(s.y, s.bottom, min(arg(0, 1), s.bottom-s.y+1))
+		}
+	case 'M':
+		if s.y >= s.top && s.y <= s.bottom {
+			s.scrollUp(s.y, s.bottom, min(arg(0, 1), s.bottom-s.y+1))
+		}
+	case 'P':
+		row, n := s.cells[s.y], min(arg(0, 1), s.cols-s.x)
+		copy(row[s.x:], row[s.x+n:])
+		for i := s.cols - n; i < s.cols; i++ {
+			row[i] = s.blank()
+		}
+	case '@':
+		row, n := s.cells[s.y], min(arg(0, 1), s.cols-s.x)
+		copy(row[s.x+n:], row[s.x:s.cols-n])
+		for i := s.x; i < s.x+n; i++ {
+			row[i] = s.blank()
+		}
+	case 'X':
+		for i := s.x; i < min(s.x+arg(0, 1), s.cols); i++ {
+			s.cells[s.y][i] = s.blank()
+		}
+	case 'S':
+		s.scrollUp(s.top, s.bottom, min(arg(0, 1), s.bottom-s.top+1))
+	case 'T':
+		s.scrollDown(s.top, s.bottom, min(arg(0, 1), s.bottom-s.top+1))
+	case 'r':
+		top, bottom := arg(0, 1)-1, min(arg(1, s.rows), s.rows)-1
+		if top < bottom {
+			s.top, s.bottom = top, bottom
+			s.x, s.y = 0, 0
+		}
+	case 's':
+		s.savedX, s.savedY = s.x, s.y
+	case 'u':
+		s.restoreCursor()
+	case 'm':
+		s.sgr(params)
+	case 'h', 'l':
+		if private {
+			s.mode(params, final == 'h')
+		}
+	}
+}
+
+// mode sets private modes, i.e. cursor visibility and the alternate screen
+func (s *Screen) mode(params []int, set bool) {
+	for _, p := range params {
+		switch p {
+		case 25:
+			s.hideCursor = !set
+		case 47, 1047, 1049:
+			if set && s.main == nil {
+				if p == 1049 {
+					s.savedX, s.savedY = s.x, s.y
+				}
+				s.main, s.cells = s.cells, newCells(s.cols, s.rows)
+			} else if !set && s.main != nil {
+				s.cells, s.main = s.main, nil
+				if p == 1049 {
+					s.restoreCursor()
+				}
+			}
+		}
+	}
+}
+
+func (s *Screen) eraseDisplay(mode int) {
+	switch mode {
+	case 0:
+		s.eraseLine(0)
+		for y := s.y + 1; y < s.rows; y++ {
+			s.cells[y] = s.blankRow()
+		}
+	case 1:
+		s.eraseLine(1)
+		for y := 0; y < s.y; y++ {
+			s.cells[y] = s.blankRow()
+		}
+	default:
+		for y := 0; y < s.rows; y++ {
+			s.cells[y] = s.blankRow()
+		}
+	}
+}
+
+func (s *Screen) eraseLine(mode int) {
+	from, to := s.x, s.cols
+	switch mode {
+	case 1:
+		from, to = 0, s.x+1
+	case 2:
+		from = 0
+	}
+	for x := from; x < to; x++ {
+		s.cells[s.y][x] = s.blank()
+	}
+}
+
+// sgr sets the colors and attributes of the pen
+func (s *Screen) sgr(params []int) {
+	for i := 0; i < len(params); i++ {
+		p := params[i]
+		switch {
+		case p == 0:
+			s.pen = cell{fg: defaultFg, bg: defaultBg}
+		case p == 1:
+			s.pen.attr |= attrBold
+		case p == 4:
+			s.pen.attr |= attrUnderline
+		case p == 7:
+			s.pen.attr |= attrReverse
+		case p == 22:
+			s.pen.attr &^= attrBold
+		case p == 24:
+			s.pen.attr &^= attrUnderline
+		case p == 27:
+			s.pen.attr &^= attrReverse
+		case p >= 30 && p <= 37:
+			s.pen.fg = uint8(p - 30)
+		case p == 39:
+			s.pen.fg = defaultFg
+		case p >= 40 && p <= 47:
+			s.pen.bg = uint8(p - 40)
+		case p == 49:
+			s.pen.bg = defaultBg
+		case p >= 90 && p <= 97:
+			s.pen.fg = uint8(p - 90 + 8)
+		case p >= 100 && p <= 107:
+			s.pen.bg = uint8(p - 100 + 8)
+		case (p == 38 || p == 48) && i+2 < len(params) && params[i+1] == 5:
+			s.setColor(p == 38, uint8(params[i+2]))
+			i += 2
+		case (p == 38 || p == 48) && i+4 < len(params) && params[i+1] == 2:
+			s.setColor(p == 38, rgbIndex(params[i+2], params[i+3], params[i+4]))
+			i += 4
+		}
+	}
+}
+
+func (s *Screen) setColor(fg bool, c uint8) {
+	if fg {
+		s.pen.fg = c
+	} else {
+		s.pen.bg = c
+	}
+}
+
+// Settled tells whether Snapshot keeps the whole state, which it does not within an escape sequence or before a pending wrap
+func (s *Screen) Settled() bool {
+	return s.state == stateGround && !s.wrapNext
+}
+
+// Snapshot returns the output which draws the screen as it is on a reset terminal of the same size,
+// i.e. both buffers, the scroll region, the saved and the current cursor and the pen
+func (s *Screen) Snapshot() string {
+	b := &strings.Builder{}
+	b.WriteString("\x1bc")
+	if s.main != nil {
+		drawCells(b, s.main)
+		b.WriteString("\x1b[?1047h")
+	}
+	drawCells(b, s.cells)
+	if s.top != 0 || s.bottom != s.rows-1 {
+		fmt.Fprintf(b, "\x1b[%d;%dr", s.top+1, s.bottom+1)
+	}
+	fmt.Fprintf(b, "\x1b[%d;%dH\x1b7", s.savedY+1, s.savedX+1)
+	fmt.Fprintf(b, "\x1b[%d;%dH", s.y+1, s.x+1)
+	b.WriteString(sgrOf(s.pen))
+	if s.hideCursor {
+		b.WriteString("\x1b[?25l")
+	}
+	return b.String()
+}
+
+// drawCells writes the rows of cells, blanks at the end of a row are left to the erased screen
+func drawCells(b *strings.Builder, cells [][]cell) {
+	blank := cell{r: ' ', fg: defaultFg, bg: defaultBg}
+	pen := blank
+	for y, row := range cells {
+		end := len(row)
+		for end > 0 && row[end-1] == blank {
+			end--
+		}
+		if end == 0 {
+			continue
+		}
+		fmt.Fprintf(b, "\x1b[%d;1H", y+1)
+		for _, c := range row[:end] {
+			if c.cont {
+				continue
+			}
+			if c.fg != pen.fg || c.bg != pen.bg || c.attr != pen.attr {
+				b.WriteString(sgrOf(c))
+				pen = c
+			}
+			b.WriteRune(c.r)
+		}
+	}
+	b.WriteString("\x1b[0m")
+}
+
+// sgrOf returns the sequence which sets the colors and attributes of c
+func sgrOf(c cell) string {
+	b := &strings.Builder{}
+	b.WriteString("\x1b[0")
+	for _, a := range []struct {
+		attr uint8
+		code string
+	}{{attrBold, ";1"}, {attrUnderline, ";4"}, {attrReverse, ";7"}} {
+		if c.attr&a.attr != 0 {
+			b.WriteString(a.code)
+		}
+	}
+	if c.fg != defaultFg {
+		fmt.Fprintf(b, ";38;5;%d", c.fg)
+	}
+	if c.bg != defaultBg {
+		fmt.Fprintf(b, ";48;5;%d", c.bg)
+	}
+	b.WriteString("m")
+	return b.String()
+}
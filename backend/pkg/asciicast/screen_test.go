@@ -0,0 +1,134 @@
+package asciicast
+
+import (
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// text returns the rows of the screen with trailing blanks trimmed
+func text(s *Screen) []string {
+	rows := make([]string, 0, s.rows)
+	for _, row := range s.cells {
+		b := strings.Builder{}
+		for _, c := range row {
+			if !c.cont {
+				b.WriteRune(c.r)
+			}
+		}
+		rows = append(rows, strings.TrimRight(b.String(), " "))
+	}
+	return rows
+}
+
+func TestScreenWrite(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		rows   []string
+		x, y   int
+	}{
+		{name: "lines", output: "ab\r\ncd", rows: []string{"ab", "cd", "", ""}, x: 2, y: 1},
+		{name: "wrap", output: "abcdefghij", rows: []string{"abcdefgh", "ij", "", ""}, x: 2, y: 1},
+		{name: "pending wrap", output: "abcdefgh\r", rows: []string{"abcdefgh", "", "", ""}, x: 0, y: 0},
+		{name: "scroll", output: "1\r\n2\r\n3\r\n4\r\n5", rows: []string{"2", "3", "4", "5"}, x: 1, y: 3},
+		{name: "backspace and tab", output: "abc\b\bX\tY", rows: []string{"aXc    Y", "", "", ""}, x: 7, y: 0},
+		{name: "cursor position", output: "\x1b[3;4Hx\x1b[Hy", rows: []string{"y", "", "   x", ""}, x: 1, y: 0},
+		{name: "erase line", output: "abcdef\x1b[3G\x1b[K", rows: []string{"ab", "", "", ""}, x: 2, y: 0},
+		{name: "erase display", output: "ab\r\ncd\x1b[2J", rows: []string{"", "", "", ""}, x: 2, y: 1},
+		{name: "delete and insert", output: "abcdef\x1b[2G\x1b[2P\x1b[1@", rows: []string{"a def", "", "", ""}, x: 1, y: 0},
+		{name: "scroll region", output: "1\r\n2\r\n3\r\n4\x1b[2;3r\x1b[3;1H\n", rows: []string{"1", "3", "", "4"}, x: 0, y: 2},
+		{name: "wide", output: "中文abcd", rows: []string{"中文abcd", "", "", ""}, x: 7, y: 0},
+		{name: "alternate", output: "sh\x1b[?1049hvim\x1b[?1049l", rows: []string{"sh", "", "", ""}, x: 2, y: 0},
+		{name: "osc", output: "\x1b]0;title\x07ok", rows: []string{"ok", "", "", ""}, x: 2, y: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewScreen(8, 4)
+			s.Write(tt.output)
+			if got := text(s); !reflect.DeepEqual(got, tt.rows) {
+				t.Errorf("rows = %q, want %q", got, tt.rows)
+			}
+			if s.x != tt.x || s.y != tt.y {
+				t.Errorf("cursor = %d,%d, want %d,%d", s.x, s.y, tt.x, tt.y)
+			}
+		})
+	}
+}
+
+func TestScreenRestoreCursorAfterResize(t *testing.T) {
+	tests := []struct {
+		name          string
+		save, restore string
+	}{
+		{name: "esc", save: "\x1b7", restore: "\x1b8"},
+		{name: "csi", save: "\x1b[s", restore: "\x1b[u"},
+		{name: "alternate screen", save: "\x1b[?1049h", restore: "\x1b[?1049l"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewScreen(80, 24)
+			s.Write("\x1b[24;80H" + tt.save)
+			s.Resize(40, 10)
+			s.Write(tt.restore + "x\x1b[Ky")
+			if s.x >= 40 || s.y >= 10 {
+				t.Errorf("cursor = %d,%d, out of the 40x10 screen", s.x, s.y)
+			}
+		})
+	}
+}
+
+// TestScreenRandom writes random output and resizes, the screen must never panic nor lose its cursor
+func TestScreenRandom(t *testing.T) {
+	pieces := []string{
+		"a", "中", "\r", "\n", "\b", "\t", "\x1b7", "\x1b8", "\x1bM", "\x1bD", "\x1bc", "\x1b[s", "\x1b[u",
+		"\x1b[999;999H", "\x1b[5A", "\x1b[5B", "\x1b[99C", "\x1b[99D", "\x1b[99G", "\x1b[99d", "\x1b[J", "\x1b[1J",
+		"\x1b[2K", "\x1b[9L", "\x1b[9M", "\x1b[9P", "\x1b[9@", "\x1b[9X", "\x1b[9S", "\x1b[9T", "\x1b[3;9r",
+		"\x1b[r", "\x1b[?1049h", "\x1b[?1049l", "\x1b[?47h", "\x1b[?47l", "\x1b[1;38;5;200m", "\x1b]2;x\x07",
+	}
+	rnd := rand.New(rand.NewSource(1))
+	s := NewScreen(20, 8)
+	for i := 0; i < 100000; i++ {
+		if rnd.Intn(50) == 0 {
+			s.Resize(1+rnd.Intn(30), 1+rnd.Intn(12))
+		}
+		s.Write(pieces[rnd.Intn(len(pieces))])
+		if s.x < 0 || s.x >= s.cols || s.y < 0 || s.y >= s.rows {
+			t.Fatalf("cursor = %d,%d, out of the %dx%d screen", s.x, s.y, s.cols, s.rows)
+		}
+	}
+}
+
+func TestScreenSnapshot(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+	}{
+		{name: "text", output: "$ ls\r\na  b\r\n$ "},
+		{name: "colors", output: "\x1b[1;31mred\x1b[0m \x1b[38;5;200;48;5;17mx\x1b[7my\x1b[0m"},
+		{name: "wide", output: "中文\x1b[3;70Hend"},
+		{name: "scroll region", output: "\x1b[2;5r\x1b[4;3Hin\x1b7\x1b[1;1Htop"},
+		{name: "alternate", output: "shell\x1b[?1049h\x1b[2;2Hvim\x1b[?25l"},
+		{name: "pen", output: "\x1b[4;44mpen"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := NewScreen(80, 24)
+			want.Write(tt.output)
+			got := NewScreen(80, 24)
+			got.Write(want.Snapshot())
+
+			if !reflect.DeepEqual(got.cells, want.cells) || !reflect.DeepEqual(got.main, want.main) {
+				t.Errorf("cells differ after the snapshot of %q", tt.output)
+			}
+			if got.x != want.x || got.y != want.y || got.savedX != want.savedX || got.savedY != want.savedY {
+				t.Errorf("cursor = %d,%d saved %d,%d, want %d,%d saved %d,%d",
+					got.x, got.y, got.savedX, got.savedY, want.x, want.y, want.savedX, want.savedY)
+			}
+			if got.top != want.top || got.bottom != want.bottom || got.pen != want.pen || got.hideCursor != want.hideCursor {
+				t.Errorf("state differs after the snapshot of %q", tt.output)
+			}
+		})
+	}
+}
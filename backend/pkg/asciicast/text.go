@@ -0,0 +1,87 @@
+package asciicast
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+var (
+	// escapes matches terminal escape sequences, i.e. CSI, OSC and two byte sequences
+	escapes = regexp.MustCompile(`\x1b(\[[0-9;?]*[ -/]*[@-~]|\][^\x07]*\x07|[@-Z\\-_])`)
+)
+
+// StripEscapes removes terminal escape sequences from s
+func StripEscapes(s string) string {
+	return escapes.ReplaceAllString(s, "")
+}
+
+// ReadLines renders the output of a recording into lines and calls fn with each line and the time it started.
+// Escape sequences are dropped, backspaces are applied and empty lines are skipped.
+// fn returns false to stop reading.
+func ReadLines(r io.Reader, fn func(t float64, line string) bool) error {
+	reader, err := NewReader(r)
+	if err != nil {
+		return err
+	}
+
+	line, start := []rune{}, -1.0
+	emit := func() bool {
+		t, s := start, strings.TrimSpace(string(line))
+		line, start = line[:0], -1
+		return s == "" || fn(t, s)
+	}
+
+	for {
+		event, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if event.Type != "o" {
+			continue
+		}
+		for _, c := range StripEscapes(event.Data) {
+			switch {
+			case c == '\n':
+				if !emit() {
+					return nil
+				}
+			case c == '\b':
+				if len(line) > 0 {
+					line = line[:len(line)-1]
+				}
+			case c == '\t':
+				line = append(line, ' ')
+			case unicode.IsControl(c):
+			default:
+				if start < 0 {
+					start = event.Time
+				}
+				line = append(line, c)
+			}
+		}
+	}
+	emit()
+
+	return nil
+}
+
+// WriteTranscript writes the output of a recording as plain text lines prefixed with their time in the recording
+func WriteTranscript(w io.Writer, r io.Reader) error {
+	var werr error
+	err := ReadLines(r, func(t float64, line string) bool {
+		ms := int64(t * 1000)
+		_, werr = fmt.Fprintf(w, "[%02d:%02d:%02d.%03d] %s\n", ms/3600000, ms/60000%60, ms/1000%60, ms%1000, line)
+		return werr == nil
+	})
+	if err != nil {
+		return err
+	}
+	return werr
+}
@@ -46,3 +46,25 @@ func SetEx(ctx context.Context, key string, src any, exp time.Duration) (err err
 	}
 	return RC.SetEx(ctx, key, bs, exp).Err()
 }
+
+// DeleteByPattern deletes all keys matching the glob pattern
+func DeleteByPattern(ctx context.Context, pattern string) (err error) {
+	iter := RC.Scan(ctx, 0, pattern, 100).Iterator()
+	keys := make([]string, 0, 100)
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+		if len(keys) == cap(keys) {
+			if err = RC.Del(ctx, keys...).Err(); err != nil {
+				return
+			}
+			keys = keys[:0]
+		}
+	}
+	if err = iter.Err(); err != nil {
+		return
+	}
+	if len(keys) > 0 {
+		err = RC.Del(ctx, keys...).Err()
+	}
+	return
+}
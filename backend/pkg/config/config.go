@@ -137,6 +137,18 @@ type SshConfig struct {
 	PrivateKey string `yaml:"privateKey,omitempty"` // Deprecated: now stored encrypted in database SystemConfig table
 }
 
+// DbProxyConfig is the listeners which database clients, e.g. DBeaver, connect to with oneterm credentials.
+// A port of 0 disables the proxy of the protocol.
+type DbProxyConfig struct {
+	Host       string `yaml:"host"`
+	Mysql      int    `yaml:"mysql"`
+	Postgresql int    `yaml:"postgresql"`
+	Redis      int    `yaml:"redis"`
+	Mongodb    int    `yaml:"mongodb"`
+	CertFile   string `yaml:"certFile"` // TLS certificate of the listeners, a self-signed one is generated if empty
+	KeyFile    string `yaml:"keyFile"`
+}
+
 type GuacdConfig struct {
 	Host string `yaml:"host"`
 	Port int    `yaml:"port"`
@@ -156,6 +168,7 @@ type ConfigYaml struct {
 	Guacd     GuacdConfig    `yaml:"guacd"`
 	Http      HttpConfig     `yaml:"http"`
 	Ssh       SshConfig      `yaml:"ssh"`
+	DbProxy   DbProxyConfig  `yaml:"dbProxy"`
 	Session   SessionConfig  `yaml:"session"`
 	Auth      Auth           `yaml:"auth"`
 	SecretKey string         `yaml:"secretKey"`
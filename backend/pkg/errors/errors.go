@@ -25,6 +25,11 @@ const (
 	ErrAccessTime       = 4011
 	ErrIdleTimeout      = 4012
 	ErrWrongPvk         = 4013
+	ErrHostKeyUnknown   = 4014
+	ErrHostKeyChanged   = 4015
+	ErrMaxSessions      = 4016
+	ErrSessionTimeout   = 4017
+	ErrGatewayHasChild  = 4018
 	ErrUnauthorized     = 4401
 	ErrInternal         = 5000
 	ErrRemoteServer     = 5001
@@ -49,6 +54,11 @@ var (
 		ErrLogin:            myi18n.MsgLoginError,
 		ErrAccessTime:       myi18n.MsgAccessTime,
 		ErrIdleTimeout:      myi18n.MsgIdleTimeout,
+		ErrHostKeyUnknown:   myi18n.MsgHostKeyUnknown,
+		ErrHostKeyChanged:   myi18n.MsgHostKeyChanged,
+		ErrMaxSessions:      myi18n.MsgMaxSessions,
+		ErrSessionTimeout:   myi18n.MsgSessionTimeout,
+		ErrGatewayHasChild:  myi18n.MsgGatewayHasChild,
 		ErrUnauthorized:     myi18n.MsgUnauthorized,
 		ErrInternal:         myi18n.MsgInternalError,
 		ErrRemoteServer:     myi18n.MsgRemoteServer,
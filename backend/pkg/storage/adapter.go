@@ -1,7 +1,9 @@
 package storage
 
 import (
+	"compress/gzip"
 	"context"
+	"fmt"
 	"io"
 	"time"
 
@@ -106,18 +108,30 @@ func (a *SessionReplayAdapter) ReplayExists(sessionID string) (bool, error) {
 // For date hierarchy strategy: YYYY-MM-DD/sessionID.cast
 // For flat strategy: sessionID.cast
 func (a *SessionReplayAdapter) generateReplayKey(sessionID string, timestamp time.Time) string {
+	return a.generateKey(sessionID+".cast", timestamp)
+}
+
+// generateGuacdReplayKey generates storage key for compressed guacd recordings
+// For date hierarchy strategy: YYYY-MM-DD/sessionID.guac.gz
+// For flat strategy: sessionID.guac.gz
+func (a *SessionReplayAdapter) generateGuacdReplayKey(sessionID string, timestamp time.Time) string {
+	return a.generateKey(sessionID+GuacdReplayExt, timestamp)
+}
+
+// generateKey prefixes the filename with the date directory if the provider uses date hierarchy strategy
+func (a *SessionReplayAdapter) generateKey(filename string, timestamp time.Time) string {
 	// Check if provider supports advanced path generation
 	if advProvider, ok := a.provider.(AdvancedProvider); ok {
 		strategy := advProvider.GetPathStrategy()
 		if strategy == DateHierarchyStrategy {
-			// Use date-based path: YYYY-MM-DD/sessionID.cast
+			// Use date-based path: YYYY-MM-DD/filename
 			dateDir := timestamp.Format("2006-01-02")
-			return dateDir + "/" + sessionID + ".cast"
+			return dateDir + "/" + filename
 		}
 	}
 
 	// Fallback to flat structure
-	return sessionID + ".cast"
+	return filename
 }
 
 // SaveReplayWithTimestamp saves a session replay with explicit timestamp
@@ -133,6 +147,82 @@ func (a *SessionReplayAdapter) SaveReplayWithTimestamp(sessionID string, reader
 	return a.provider.Upload(ctx, key, reader, size)
 }
 
+// GuacdReplayExt is the extension of guacd recordings in storage, they are gzip compressed
+const GuacdReplayExt = ".guac.gz"
+
+// SaveGuacdReplay saves a compressed guacd recording and checks the size of the uploaded object
+func (a *SessionReplayAdapter) SaveGuacdReplay(sessionID string, reader io.Reader, size int64, timestamp time.Time) error {
+	if a.provider == nil {
+		return fmt.Errorf("no storage provider available")
+	}
+
+	ctx := context.Background()
+	key := a.generateGuacdReplayKey(sessionID, timestamp)
+
+	if err := a.provider.Upload(ctx, key, reader, size); err != nil {
+		return err
+	}
+
+	uploaded, err := a.provider.GetSize(ctx, key)
+	if err != nil {
+		return fmt.Errorf("failed to get size of uploaded recording: %w", err)
+	}
+	if uploaded != size {
+		return fmt.Errorf("size of uploaded recording is %d, expected %d", uploaded, size)
+	}
+
+	return nil
+}
+
+// GetGuacdReplay retrieves a compressed guacd recording, the reader returns the decompressed recording
+func (a *SessionReplayAdapter) GetGuacdReplay(sessionID string, timestamp time.Time) (io.ReadCloser, error) {
+	if a.provider == nil {
+		return nil, fmt.Errorf("no storage provider available")
+	}
+
+	reader, err := a.provider.Download(context.Background(), a.generateGuacdReplayKey(sessionID, timestamp))
+	if err != nil {
+		return nil, err
+	}
+
+	gz, err := gzip.NewReader(reader)
+	if err != nil {
+		reader.Close()
+		return nil, err
+	}
+
+	return &gzipReadCloser{Reader: gz, raw: reader}, nil
+}
+
+// SaveExport saves a rendered export of a session recording, ext is the extension like .gif
+func (a *SessionReplayAdapter) SaveExport(sessionID, ext string, reader io.Reader, size int64, timestamp time.Time) error {
+	if a.provider == nil {
+		return fmt.Errorf("no storage provider available")
+	}
+
+	return a.provider.Upload(context.Background(), a.generateKey(sessionID+".export"+ext, timestamp), reader, size)
+}
+
+// GetExport retrieves a rendered export of a session recording
+func (a *SessionReplayAdapter) GetExport(sessionID, ext string, timestamp time.Time) (io.ReadCloser, error) {
+	if a.provider == nil {
+		return nil, fmt.Errorf("no storage provider available")
+	}
+
+	return a.provider.Download(context.Background(), a.generateKey(sessionID+".export"+ext, timestamp))
+}
+
+// gzipReadCloser closes both the gzip reader and the underlying reader
+type gzipReadCloser struct {
+	*gzip.Reader
+	raw io.ReadCloser
+}
+
+func (r *gzipReadCloser) Close() error {
+	r.Reader.Close()
+	return r.raw.Close()
+}
+
 // Global adapter instance
 var DefaultSessionReplayAdapter *SessionReplayAdapter
 